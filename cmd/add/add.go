@@ -0,0 +1,28 @@
+package add
+
+import (
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandAdd(r *repository.Repository) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "add <pathspec>...",
+		Short: "Add file contents to the index",
+		Long: `Add the current content of files to the index, recursing into directories.
+Files removed from the worktree are removed from the index, and adding a conflicted file marks it as resolved.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !r.IsInitiated() {
+				return repository.ErrorUninitiate
+			}
+			paths, err := r.PrefixPaths(args)
+			if err != nil {
+				return err
+			}
+			return r.Add(paths)
+		},
+	}
+	return cmd
+}
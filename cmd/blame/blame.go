@@ -0,0 +1,45 @@
+package blame
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandBlame(r *repository.Repository) *cobra.Command {
+	opts := &repository.Blame{}
+	var cmd = &cobra.Command{
+		Use:   "blame [<options>] [<rev>] [--] <file>",
+		Short: "Show what revision and author last modified each line of a file",
+		Long: `Annotate each line of a file with the commit that introduced it, walking the history back from a revision,
+or from the worktree version of the file.
+  -L <start>,<end>   blames only the given lines, also <start>,+<count>, <start>,-<count>, <start> and ,<end>
+  -w                 ignores whitespace when comparing the versions of the file
+  -M                 follows lines moved within the file
+  -C                 also follows lines copied from the other files changed by the same commit`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				opts.Rev = args[0]
+			}
+			paths, err := r.PrefixPaths(args[len(args)-1:])
+			if err != nil {
+				return err
+			}
+			opts.Path = paths[0]
+			out, err := r.Blame(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVarP(&opts.Ranges, "line-range", "L", nil, "Annotate only the given range of lines")
+	cmd.Flags().BoolVarP(&opts.IgnoreWhitespace, "ignore-whitespace", "w", false, "Ignore whitespace when comparing the versions of the file")
+	cmd.Flags().BoolVar(&opts.Porcelain, "porcelain", false, "Show the output in a format designed for machine consumption")
+	cmd.Flags().BoolVarP(&opts.DetectMoves, "detect-moves", "M", false, "Follow lines moved within the file")
+	cmd.Flags().BoolVarP(&opts.DetectCopies, "detect-copies", "C", false, "Follow lines copied from the other files changed by the same commit")
+	return cmd
+}
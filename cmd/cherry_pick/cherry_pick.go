@@ -0,0 +1,70 @@
+package cherrypick
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandCherryPick(r *repository.Repository) *cobra.Command {
+	opts := &repository.CherryPick{Action: repository.ActionPick}
+	var cmd = &cobra.Command{
+		Use:   "cherry-pick <commit>...",
+		Short: "Apply the changes introduced by some existing commits",
+		Long: `Apply the changes introduced by some existing commits, committing each of them on the current branch with its message and author.
+Commits are given one by one, or as ranges like a..b or ^a b, which are picked oldest first.
+A conflict stops the sequence: resolve it, add the files and run --continue, skip the commit with --skip,
+or go back to where the sequence started with --abort.
+  -m <parent-number>   picks merge commits against their given parent, from 1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ValidArgs(opts, args); err != nil {
+				return err
+			}
+			opts.Commits = args
+			return Run(cmd, r, opts)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.RecordOrigin, "record-origin", "x", false, "Append a line recording the picked commit to the message")
+	cmd.Flags().IntVarP(&opts.Mainline, "mainline", "m", 0, "Parent number of the mainline of merge commits")
+	cmd.Flags().BoolVarP(&opts.NoCommit, "no-commit", "n", false, "Apply the changes to the index and the worktree without committing")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "Resume the sequence once the conflicts are resolved")
+	cmd.Flags().BoolVar(&opts.Skip, "skip", false, "Skip the current commit and go on with the sequence")
+	cmd.Flags().BoolVar(&opts.Abort, "abort", false, "Cancel the sequence and go back to where it started")
+	return cmd
+}
+
+// ValidArgs checks the commits and the flags controlling a sequence in
+// progress are not mixed up.
+func ValidArgs(opts *repository.CherryPick, args []string) error {
+	control := 0
+	for _, set := range []bool{opts.Continue, opts.Skip, opts.Abort} {
+		if set {
+			control++
+		}
+	}
+	switch {
+	case control > 1:
+		return fmt.Errorf("--continue, --skip and --abort can not be used together")
+	case control == 1 && len(args) > 0:
+		return fmt.Errorf("--continue, --skip and --abort take no commit")
+	case control == 0 && len(args) == 0:
+		return fmt.Errorf("a commit is required")
+	}
+	return nil
+}
+
+// Run runs a cherry-pick or revert sequence, exiting with 1 when it stops.
+func Run(cmd *cobra.Command, r *repository.Repository, opts *repository.CherryPick) error {
+	out, done, err := r.CherryPick(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	if !done {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return repository.ExitError{Code: 1}
+	}
+	return nil
+}
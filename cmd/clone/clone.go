@@ -0,0 +1,55 @@
+package clone
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandClone(r *repository.Repository) *cobra.Command {
+	opts := &repository.Clone{}
+	var cmd = &cobra.Command{
+		Use:   "clone [--bare] [--shared] [--reference <repository>] <repository> [<directory>]",
+		Short: "Clone a repository into a new directory",
+		Long: `Clone a local repository, a path or a file:// URL, into a new directory, named after the repository by default.
+The branches of the repository become the remote-tracking branches of origin and the branch its HEAD points to is checked out.
+  --bare                       makes a bare repository holding the branches as they are
+  -s, --shared                 borrows the objects of the repository through objects/info/alternates instead of copying them
+  --reference <repository>     borrows the objects of another repository, only copying the ones it does not have`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.Source = args[0]
+			dir := repository.CloneDirectory(opts.Source, opts.Bare)
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			created, err := repository.NewRepository(r.FS, abs)
+			if err != nil {
+				return err
+			}
+			*r = *created
+			if opts.Bare {
+				fmt.Printf("Cloning into bare repository '%s'...\n", dir)
+			} else {
+				fmt.Printf("Cloning into '%s'...\n", dir)
+			}
+			out, err := r.Clone(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			fmt.Println("done.")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.Bare, "bare", false, "Create a bare repository")
+	cmd.Flags().BoolVarP(&opts.Shared, "shared", "s", false, "Borrow the objects of the repository instead of copying them")
+	cmd.Flags().StringVar(&opts.Reference, "reference", "", "Borrow the objects of the reference repository")
+	return cmd
+}
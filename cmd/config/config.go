@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/repository"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	Get        bool
+	GetAll     bool
+	Set        bool
+	Add        bool
+	Unset      bool
+	UnsetAll   bool
+	List       bool
+	ShowOrigin bool
+	System     bool
+	Global     bool
+	Local      bool
+	Worktree   bool
+	Type       string
+	Bool       bool
+	Int        bool
+	Path       bool
+}
+
+func NewCommandConfig(r *repository.Repository) *cobra.Command {
+	opts := &options{}
+	var cmd = &cobra.Command{
+		Use:   "config [<options>] [<name> [<value>]]",
+		Short: "Get and set repository or global options",
+		Long: `Query and change the configuration. Variables are read from /etc/ggitconfig, ~/.ggitconfig, .ggit/config
+and .ggit/config.worktree when extensions.worktreeConfig is set, a later file overriding the earlier ones.
+include.path and includeIf.<condition>.path include other files, with the conditions gitdir:, gitdir/i: and onbranch:.
+With a name only the variable is shown, with a name and a value it is set in the repository file.
+  --get, --get-all          shows the value, or every value, of a variable; exits with 1 if it is not set
+  --set, --add              sets the value of a variable, or adds one to it
+  --unset, --unset-all      removes a variable, or every value of it; exits with 5 if it is not set
+  -l, --list                lists every variable
+  --show-origin             shows the file each value comes from
+  --system, --global, --local, --worktree
+                            reads and writes only the file of this scope
+  --type <bool|int|path>    shows the values in the canonical form of the type, also --bool, --int and --path`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfig(cmd, r, opts, args)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.Get, "get", false, "Show the value of a variable")
+	cmd.Flags().BoolVar(&opts.GetAll, "get-all", false, "Show every value of a multi-valued variable")
+	cmd.Flags().BoolVar(&opts.Set, "set", false, "Set the value of a variable")
+	cmd.Flags().BoolVar(&opts.Add, "add", false, "Add a value to a variable, keeping its other values")
+	cmd.Flags().BoolVar(&opts.Unset, "unset", false, "Remove a variable")
+	cmd.Flags().BoolVar(&opts.UnsetAll, "unset-all", false, "Remove every value of a variable")
+	cmd.Flags().BoolVarP(&opts.List, "list", "l", false, "List every variable")
+	cmd.Flags().BoolVar(&opts.ShowOrigin, "show-origin", false, "Show the file each value comes from")
+	cmd.Flags().BoolVar(&opts.System, "system", false, "Use the system-wide configuration file")
+	cmd.Flags().BoolVar(&opts.Global, "global", false, "Use the configuration file of the user")
+	cmd.Flags().BoolVar(&opts.Local, "local", false, "Use the configuration file of the repository")
+	cmd.Flags().BoolVar(&opts.Worktree, "worktree", false, "Use the configuration file of the worktree")
+	cmd.Flags().StringVar(&opts.Type, "type", "", "Show the values in the canonical form of bool, int or path")
+	cmd.Flags().BoolVar(&opts.Bool, "bool", false, "Show the values as booleans")
+	cmd.Flags().BoolVar(&opts.Int, "int", false, "Show the values as integers")
+	cmd.Flags().BoolVar(&opts.Path, "path", false, "Show the values as paths")
+	return cmd
+}
+
+func runConfig(cmd *cobra.Command, r *repository.Repository, opts *options, args []string) error {
+	scope, err := configScope(opts)
+	if err != nil {
+		return err
+	}
+	kind, err := configType(opts)
+	if err != nil {
+		return err
+	}
+	if opts.List {
+		if len(args) != 0 {
+			return fmt.Errorf("wrong number of arguments, should be 0")
+		}
+		return printEntries(r, r.Config.List(scope), opts.ShowOrigin, kind, true)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no action specified")
+	}
+	section, key, err := repository.ParseConfigName(args[0])
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.Set || opts.Add || (len(args) == 2 && !opts.Get && !opts.GetAll && !opts.Unset && !opts.UnsetAll):
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments, should be 2")
+		}
+		if opts.Add {
+			err = r.Config.Add(scope, section, key, args[1])
+		} else {
+			err = r.Config.Set(scope, section, key, args[1])
+		}
+	case opts.Unset || opts.UnsetAll:
+		if len(args) != 1 {
+			return fmt.Errorf("wrong number of arguments, should be 1")
+		}
+		err = r.Config.Unset(scope, section, key, opts.UnsetAll)
+	default:
+		if len(args) != 1 {
+			return fmt.Errorf("wrong number of arguments, should be 1")
+		}
+		return getEntries(cmd, r, scope, section, key, opts, kind)
+	}
+
+	var multiple repository.ConfigMultipleValuesError
+	switch {
+	case errors.Is(err, repository.ErrorConfigNotFound):
+		return exit(cmd, 5)
+	case errors.As(err, &multiple):
+		fmt.Printf("warning: %s\n", err)
+		if !opts.Unset {
+			fmt.Printf("error: cannot overwrite multiple values with a single value\n"+
+				"       Use a regexp, --add or --replace-all to change %s.\n", multiple.Name)
+		}
+		return exit(cmd, 5)
+	}
+	return err
+}
+
+// getEntries shows the value of key in section, or all of them with
+// --get-all, and exits with 1 when it is not set.
+func getEntries(cmd *cobra.Command, r *repository.Repository, scope string, section string, key string, opts *options, kind string) error {
+	entries := r.Config.Find(scope, section, key)
+	if len(entries) == 0 {
+		return exit(cmd, 1)
+	}
+	if !opts.GetAll {
+		entries = entries[len(entries)-1:]
+	}
+	return printEntries(r, entries, opts.ShowOrigin, kind, false)
+}
+
+// printEntries prints entries, as name=value when names is set, prefixed
+// with the file they come from when origin is set.
+func printEntries(r *repository.Repository, entries []repository.ConfigEntry, origin bool, kind string, names bool) error {
+	var b strings.Builder
+	for _, e := range entries {
+		value, err := repository.FormatConfigValue(e.Name, e.Value, kind)
+		if err != nil {
+			return err
+		}
+		if origin {
+			path := e.Origin
+			if rel, err := filepath.Rel(r.Worktree, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+			fmt.Fprintf(&b, "file:%s\t", filepath.ToSlash(path))
+		}
+		if names {
+			fmt.Fprintf(&b, "%s=", e.Name)
+		}
+		fmt.Fprintf(&b, "%s\n", value)
+	}
+	fmt.Print(b.String())
+	return nil
+}
+
+// configScope returns the scope chosen by the options, empty for every
+// scope.
+func configScope(opts *options) (string, error) {
+	scope := ""
+	for flag, set := range map[string]bool{repository.ConfigSystem: opts.System, repository.ConfigGlobal: opts.Global, repository.ConfigLocal: opts.Local, repository.ConfigWorktree: opts.Worktree} {
+		if !set {
+			continue
+		}
+		if scope != "" {
+			return "", fmt.Errorf("only one config file at a time")
+		}
+		scope = flag
+	}
+	return scope, nil
+}
+
+// configType returns the type chosen by the options, empty for none.
+func configType(opts *options) (string, error) {
+	kind := opts.Type
+	for flag, set := range map[string]bool{"bool": opts.Bool, "int": opts.Int, "path": opts.Path} {
+		if !set {
+			continue
+		}
+		if kind != "" && kind != flag {
+			return "", fmt.Errorf("only one type at a time")
+		}
+		kind = flag
+	}
+	switch kind {
+	case "", "bool", "int", "path":
+		return kind, nil
+	}
+	return "", fmt.Errorf("unrecognized --type argument, %s", kind)
+}
+
+func exit(cmd *cobra.Command, code int) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return repository.ExitError{Code: code}
+}
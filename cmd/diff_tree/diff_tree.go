@@ -0,0 +1,153 @@
+package difftree
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/repository"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewCommandDiffTree(r *repository.Repository) *cobra.Command {
+	opts := &repository.DiffTree{}
+	var stat string
+	var color string
+	var cmd = &cobra.Command{
+		Use:   "diff-tree <tree-ish> <tree-ish>",
+		Short: "Compares the content and mode of blobs found via two tree objects",
+		Long: `Compares the content and mode of blobs found via two tree objects, recursing into subtrees.
+Renames and copies are detected from content similarity with -M and -C, e.g. -M50%.
+With -p a patch is shown, optionally as a word diff with --word-diff.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.From = args[0]
+			opts.To = args[1]
+			if err := parseStat(cmd.Flags(), stat, opts); err != nil {
+				return err
+			}
+			opts.Formats = formats(cmd.Flags())
+			if err := parseColor(cmd.Flags(), color, opts); err != nil {
+				return err
+			}
+			return runDiffTree(r, opts)
+		},
+	}
+	cmd.Flags().Bool(repository.DiffFormatRaw, false, "Generate the diff in raw format (default)")
+	cmd.Flags().Bool(repository.DiffFormatNameStatus, false, "Show only the names and status of changed files")
+	cmd.Flags().StringVar(&stat, repository.DiffFormatStat, "", "Generate a diffstat, optionally limited to <width>[,<name-width>[,<count>]]")
+	cmd.Flags().Lookup(repository.DiffFormatStat).NoOptDefVal = "80"
+	cmd.Flags().IntVar(&opts.Stat.Width, "stat-width", 0, "Limit the width of the diffstat")
+	cmd.Flags().IntVar(&opts.Stat.NameWidth, "stat-name-width", 0, "Limit the width of the file names in the diffstat")
+	cmd.Flags().IntVar(&opts.Stat.GraphWidth, "stat-graph-width", 0, "Limit the width of the graph in the diffstat")
+	cmd.Flags().IntVar(&opts.Stat.Count, "stat-count", 0, "Limit the number of files shown in the diffstat")
+	cmd.Flags().Bool(repository.DiffFormatNumstat, false, "Show the number of added and deleted lines in decimal notation")
+	cmd.Flags().Bool(repository.DiffFormatShortstat, false, "Output only the last line of the diffstat")
+	cmd.Flags().StringVar(&opts.Dirstat, repository.DiffFormatDirstat, "", "Output the distribution of changes for each sub-directory")
+	cmd.Flags().Lookup(repository.DiffFormatDirstat).NoOptDefVal = "changes"
+	cmd.Flags().StringVarP(&opts.FindRenames, "find-renames", "M", "", "Detect renames, optionally with a minimum similarity score")
+	cmd.Flags().Lookup("find-renames").NoOptDefVal = "50%"
+	cmd.Flags().StringVarP(&opts.FindCopies, "find-copies", "C", "", "Detect copies as well as renames, optionally with a minimum similarity score")
+	cmd.Flags().Lookup("find-copies").NoOptDefVal = "50%"
+	cmd.Flags().BoolVar(&opts.FindCopiesHarder, "find-copies-harder", false, "Also consider unmodified files as copy sources")
+	cmd.Flags().BoolP(repository.DiffFormatPatch, "p", false, "Generate a patch")
+	cmd.Flags().IntVarP(&opts.Patch.Context, "unified", "U", 3, "Generate patches with <n> lines of context")
+	cmd.Flags().StringVar(&color, "color", "never", "Color the patch: always, never or auto")
+	cmd.Flags().Lookup("color").NoOptDefVal = "always"
+	cmd.Flags().StringVar(&opts.Patch.WordDiff, "word-diff", diff.WordDiffNone, "Show a word diff: plain, color, porcelain or none")
+	cmd.Flags().Lookup("word-diff").NoOptDefVal = diff.WordDiffPlain
+	cmd.Flags().StringVar(&opts.Patch.WordRegex, "word-diff-regex", "", "Use <regex> to decide what a word is")
+	cmd.Flags().StringVar(&opts.Patch.ColorMoved, "color-moved", "", "Color moved lines: no, default, plain, blocks, zebra or dimmed-zebra")
+	cmd.Flags().Lookup("color-moved").NoOptDefVal = diff.MovedDefault
+	return cmd
+}
+
+// formats collects the output formats selected on the command line.
+func formats(flags *pflag.FlagSet) []string {
+	result := []string{}
+	for _, name := range []string{
+		repository.DiffFormatRaw,
+		repository.DiffFormatNameStatus,
+		repository.DiffFormatNumstat,
+		repository.DiffFormatStat,
+		repository.DiffFormatShortstat,
+		repository.DiffFormatDirstat,
+	} {
+		if flags.Changed(name) {
+			result = append(result, name)
+		}
+	}
+	// Context lines and word diffs only make sense for a patch.
+	for _, name := range []string{repository.DiffFormatPatch, "unified", "word-diff", "word-diff-regex"} {
+		if flags.Changed(name) {
+			return append(result, repository.DiffFormatPatch)
+		}
+	}
+	return result
+}
+
+// parseColor decides whether the patch is colored. Asking for moved lines
+// colors the patch unless --color says otherwise, and auto colors it when
+// the output is a terminal.
+func parseColor(flags *pflag.FlagSet, value string, opts *repository.DiffTree) error {
+	if flags.Changed("word-diff-regex") && !flags.Changed("word-diff") {
+		opts.Patch.WordDiff = diff.WordDiffPlain
+	}
+	switch value {
+	case "always":
+		opts.Patch.Color = true
+	case "never":
+		opts.Patch.Color = flags.Changed("color-moved") && !flags.Changed("color")
+	case "auto":
+		info, err := os.Stdout.Stat()
+		opts.Patch.Color = err == nil && info.Mode()&os.ModeCharDevice != 0
+	default:
+		return fmt.Errorf("invalid --color value %s", value)
+	}
+	return nil
+}
+
+// parseStat applies the <width>[,<name-width>[,<count>]] value of --stat.
+// The dedicated --stat-* flags take precedence.
+func parseStat(flags *pflag.FlagSet, value string, opts *repository.DiffTree) error {
+	if value == "" {
+		return nil
+	}
+	targets := []struct {
+		flag  string
+		value *int
+	}{
+		{"stat-width", &opts.Stat.Width},
+		{"stat-name-width", &opts.Stat.NameWidth},
+		{"stat-count", &opts.Stat.Count},
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) > len(targets) {
+		return fmt.Errorf("invalid --stat value %s", value)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid --stat value %s", value)
+		}
+		if !flags.Changed(targets[i].flag) {
+			*targets[i].value = n
+		}
+	}
+	return nil
+}
+
+func runDiffTree(r *repository.Repository, opts *repository.DiffTree) error {
+	if !r.IsInitiated() {
+		return repository.ErrorUninitiate
+	}
+	data, err := r.DiffTree(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(data)
+	return nil
+}
@@ -0,0 +1,38 @@
+package fetch
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandFetch(r *repository.Repository) *cobra.Command {
+	opts := &repository.Fetch{}
+	var cmd = &cobra.Command{
+		Use:   "fetch [<repository> [<refspec>...]]",
+		Short: "Download objects and refs from another repository",
+		Long: `Fetch the refs of another local repository, a remote name, a path or a file:// URL, and the objects they need that are missing.
+The refspecs, remote.<name>.fetch by default, map the refs of the repository to local refs, e.g. +refs/heads/*:refs/remotes/origin/*.
+A ref is only updated if that is a fast-forward, unless its refspec starts with +.
+What was fetched is recorded in FETCH_HEAD.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.Remote = args[0]
+				opts.Refspecs = args[1:]
+			}
+			out, clean, err := r.Fetch(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,38 @@
+package fsck
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandFsck(r *repository.Repository) *cobra.Command {
+	opts := &repository.Fsck{}
+	var cmd = &cobra.Command{
+		Use:   "fsck [<options>]",
+		Short: "Verify the connectivity and validity of the objects in the database",
+		Long: `Verify the object database: recompute the ID of every object, validate the format of trees, commits and tags,
+and check that every object reachable from HEAD, the refs, the reflogs and the index is present.
+Objects nothing refers to are reported as dangling.
+The exit code is 0 when no problem was found, otherwise 1 is set for corrupt or malformed objects
+and 2 for missing objects and refs pointing to no object.
+  --no-reflogs   does not consider the reflog entries as references`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, code, err := r.Fsck(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if code != 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: code}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.NoReflogs, "no-reflogs", false, "Do not consider the reflog entries as references")
+	return cmd
+}
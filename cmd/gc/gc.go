@@ -0,0 +1,30 @@
+package gc
+
+import (
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandGc(r *repository.Repository) *cobra.Command {
+	opts := &repository.Gc{}
+	var noPrune bool
+	var cmd = &cobra.Command{
+		Use:   "gc [--prune=<date>] [--no-prune]",
+		Short: "Cleanup unnecessary files and optimize the local repository",
+		Long: `Remove the loose objects that are also packed, and the unreachable loose objects older than the prune date.
+Objects borrowed from alternates are never removed, but the objects they refer to are kept.
+  --prune=<date>   prunes the unreachable objects older than date, such as 2.weeks.ago (gc.pruneExpire, the default), now or never
+  --no-prune       does not prune any unreachable object`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if noPrune {
+				opts.Prune = "never"
+			}
+			return r.Gc(opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Prune, "prune", "", "Prune the unreachable objects older than date")
+	cmd.Flags().BoolVar(&noPrune, "no-prune", false, "Do not prune any unreachable object")
+	return cmd
+}
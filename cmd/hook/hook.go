@@ -0,0 +1,70 @@
+package hook
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/repository"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandHook(r *repository.Repository) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "hook",
+		Short: "Run git hooks",
+		Long: `Run the hooks of the repository, from .ggit/hooks or the directory core.hooksPath names.
+The ggit commands run their hooks themselves; hook run is meant for testing them.`,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(newCommandRun(r))
+	return cmd
+}
+
+func newCommandRun(r *repository.Repository) *cobra.Command {
+	var ignoreMissing bool
+	var toStdin string
+	var cmd = &cobra.Command{
+		Use:   "run [--ignore-missing] [--to-stdin=<path>] <hook-name> [-- <hook-args>]",
+		Short: "Run a hook",
+		Long: `Run the hook <hook-name> with the arguments given after --, and exit with its exit status.
+  --to-stdin=<path>   gives the content of the file as the standard input of the hook
+  --ignore-missing    exits with 0 instead of failing when the hook does not exist`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dash := cmd.ArgsLenAtDash(); dash > 1 || dash < 0 && len(args) > 1 {
+				return fmt.Errorf("the arguments of the hook go after --")
+			}
+			if len(args) == 0 || cmd.ArgsLenAtDash() == 0 {
+				return fmt.Errorf("a hook name is required")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := &repository.Hook{Name: args[0], Args: args[1:]}
+			if toStdin != "" {
+				data, err := os.ReadFile(toStdin)
+				if err != nil {
+					return err
+				}
+				opts.Stdin = string(data)
+			}
+			out, ran, err := r.RunHook(opts)
+			fmt.Print(out)
+			var failed *repository.HookError
+			switch {
+			case errors.As(err, &failed):
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: failed.Code}
+			case err != nil:
+				return err
+			case !ran && !ignoreMissing:
+				return fmt.Errorf("cannot find a hook named %s", opts.Name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&ignoreMissing, "ignore-missing", false, "Exit with 0 when the hook does not exist")
+	cmd.Flags().StringVar(&toStdin, "to-stdin", "", "File to give as the standard input of the hook")
+	return cmd
+}
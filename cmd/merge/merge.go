@@ -0,0 +1,66 @@
+package merge
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandMerge(r *repository.Repository) *cobra.Command {
+	opts := &repository.Merge{}
+	var cmd = &cobra.Command{
+		Use:   "merge [<commit>...]",
+		Short: "Join two or more development histories together",
+		Long: `Join the history of a commit into the current branch.
+The branch is fast-forwarded when possible, otherwise the trees are merged from their merge base and a merge commit is created.
+Conflicts are left in the worktree with conflict markers and in the index as stages 1, 2 and 3,
+to be resolved and concluded with --continue, or undone with --abort.
+The conflict markers follow --conflict or merge.conflictStyle: merge, diff3 or zdiff3.
+Several commits are merged at once with the octopus strategy.
+  -s ours              keeps the tree of the current branch, recording the other commits as parents
+  -s subtree           merges a project living in a subdirectory, detected automatically
+  -X ours, -X theirs   resolves conflicting hunks in favor of one side
+  -X ignore-space-change, -X renormalize, -X subtree=<prefix>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validArgs(opts, args); err != nil {
+				return err
+			}
+			opts.Commits = args
+			out, clean, err := r.Merge(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.NoFF, "no-ff", false, "Create a merge commit even when the merge resolves as a fast-forward")
+	cmd.Flags().BoolVar(&opts.AllowUnrelated, "allow-unrelated-histories", false, "Allow merging histories that do not share a common ancestor")
+	cmd.Flags().BoolVar(&opts.Squash, "squash", false, "Merge the trees without committing nor recording the merge")
+	cmd.Flags().BoolVar(&opts.Abort, "abort", false, "Abort the current conflict resolution and restore the pre-merge state")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "Conclude the merge once the conflicts are resolved")
+	cmd.Flags().BoolVar(&opts.NoVerify, "no-verify", false, "Bypass the pre-merge-commit and commit-msg hooks")
+	cmd.Flags().StringVar(&opts.ConflictStyle, "conflict", "", "Style of the conflict markers: merge, diff3 or zdiff3")
+	cmd.Flags().StringVarP(&opts.Strategy, "strategy", "s", "", "Merge strategy: "+strings.Join(repository.MergeStrategies(), ", "))
+	cmd.Flags().StringArrayVarP(&opts.StrategyOptions, "strategy-option", "X", nil, "Option of the merge strategy")
+	return cmd
+}
+
+func validArgs(opts *repository.Merge, args []string) error {
+	switch {
+	case opts.Abort && opts.Continue:
+		return fmt.Errorf("--abort and --continue can not be used together")
+	case (opts.Abort || opts.Continue) && len(args) > 0:
+		return fmt.Errorf("--abort and --continue take no commit")
+	case !opts.Abort && !opts.Continue && len(args) == 0:
+		return fmt.Errorf("a commit to merge is required")
+	}
+	return nil
+}
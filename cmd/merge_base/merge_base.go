@@ -0,0 +1,114 @@
+package mergebase
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	All        bool
+	IsAncestor bool
+	ForkPoint  bool
+}
+
+func NewCommandMergeBase(r *repository.Repository) *cobra.Command {
+	opts := &options{}
+	var cmd = &cobra.Command{
+		Use:   "merge-base <commit> <commit>...",
+		Short: "Find as good common ancestors as possible for a merge",
+		Long: `Find as good common ancestors as possible for a merge.
+With more than two commits, the merge base of the first commit and a hypothetical merge of the others is shown.
+  --is-ancestor <commit> <commit>  exits with 0 if the first commit is an ancestor of the second, 1 otherwise
+  --fork-point <ref> [<commit>]    finds where <commit> forked from the history of <ref>, using its reflog`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validArgs(opts, args); err != nil {
+				return err
+			}
+			found, err := runMergeBase(r, opts, args)
+			if err != nil {
+				return err
+			}
+			if !found {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.All, "all", "a", false, "Output all merge bases instead of only the first one")
+	cmd.Flags().BoolVar(&opts.IsAncestor, "is-ancestor", false, "Check if the first commit is an ancestor of the second commit")
+	cmd.Flags().BoolVar(&opts.ForkPoint, "fork-point", false, "Find the point at which a commit forked from a ref")
+	return cmd
+}
+
+func validArgs(opts *options, args []string) error {
+	switch {
+	case opts.IsAncestor && opts.ForkPoint:
+		return fmt.Errorf("--is-ancestor and --fork-point can not be used together")
+	case opts.IsAncestor && len(args) != 2:
+		return fmt.Errorf("--is-ancestor takes exactly two commits")
+	case opts.ForkPoint && len(args) > 2:
+		return fmt.Errorf("--fork-point takes a ref and at most one commit")
+	case !opts.IsAncestor && !opts.ForkPoint && len(args) < 2:
+		return fmt.Errorf("at least two commits are required")
+	}
+	return nil
+}
+
+// runMergeBase prints the answer of the selected mode.
+//
+// Returns:
+//   - Whether a merge base or fork point was found, or whether the first
+//     commit is an ancestor of the second.
+//   - An error if a commit can not be resolved.
+func runMergeBase(r *repository.Repository, opts *options, args []string) (bool, error) {
+	if !r.IsInitiated() {
+		return false, repository.ErrorUninitiate
+	}
+	if opts.ForkPoint {
+		commit := "HEAD"
+		if len(args) == 2 {
+			commit = args[1]
+		}
+		sha, err := r.ResolveCommit(commit)
+		if err != nil {
+			return false, err
+		}
+		point, err := r.ForkPoint(args[0], sha)
+		if err != nil {
+			return false, err
+		}
+		if point != "" {
+			fmt.Println(point)
+		}
+		return point != "", nil
+	}
+
+	commits := make([]string, 0, len(args))
+	for _, arg := range args {
+		sha, err := r.ResolveCommit(arg)
+		if err != nil {
+			return false, err
+		}
+		commits = append(commits, sha)
+	}
+	if opts.IsAncestor {
+		return r.IsAncestor(commits[0], commits[1])
+	}
+
+	bases, err := r.MergeBases(commits[0], commits[1:]...)
+	if err != nil {
+		return false, err
+	}
+	if !opts.All && len(bases) > 1 {
+		bases = bases[:1]
+	}
+	for _, base := range bases {
+		fmt.Println(base)
+	}
+	return len(bases) > 0, nil
+}
@@ -0,0 +1,51 @@
+package mergetree
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandMergeTree(r *repository.Repository) *cobra.Command {
+	opts := &repository.MergeTree{}
+	var writeTree bool
+	var cmd = &cobra.Command{
+		Use:   "merge-tree --write-tree <branch1> <branch2>",
+		Short: "Perform merge without touching index or working tree",
+		Long: `Perform a three-way merge of two commits in the object database only, as merge would, without touching the index, the worktree or the refs.
+The merged tree is written, with conflict markers in the conflicted files, and its ID is shown,
+followed by the conflicted files as "<mode> <object> <stage>	<path>" lines and, when there are conflicts, an empty line and the messages of the merge.
+Exits with 1 when there are conflicts.
+  -z   separates the output with NUL characters and lists the paths and the type of each message`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !writeTree {
+				return fmt.Errorf("only the --write-tree mode is supported")
+			}
+			if opts.Messages && opts.NoMessages {
+				return fmt.Errorf("--messages and --no-messages can not be used together")
+			}
+			opts.Branch1 = args[0]
+			opts.Branch2 = args[1]
+			out, clean, err := r.MergeTree(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&writeTree, "write-tree", false, "Write the merged tree and show its ID")
+	cmd.Flags().BoolVar(&opts.NameOnly, "name-only", false, "Show only the paths of the conflicted files")
+	cmd.Flags().BoolVar(&opts.Messages, "messages", false, "Show the messages of the merge even when it is clean")
+	cmd.Flags().BoolVar(&opts.NoMessages, "no-messages", false, "Hide the messages of the merge")
+	cmd.Flags().BoolVarP(&opts.NullTerminated, "null", "z", false, "Separate the output with NUL characters")
+	cmd.Flags().BoolVar(&opts.AllowUnrelated, "allow-unrelated-histories", false, "Allow merging histories that do not share a common ancestor")
+	return cmd
+}
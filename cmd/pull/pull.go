@@ -0,0 +1,37 @@
+package pull
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandPull(r *repository.Repository) *cobra.Command {
+	opts := &repository.Pull{}
+	var cmd = &cobra.Command{
+		Use:   "pull [--no-ff] [<repository> [<refspec>...]]",
+		Short: "Fetch from and integrate with another repository",
+		Long: `Fetch from another local repository, like ggit fetch, then merge the fetched refs into the current branch:
+the upstream branch of the current branch, branch.<name>.merge, or the refs named on the command line.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.Remote = args[0]
+				opts.Refspecs = args[1:]
+			}
+			out, clean, err := r.Pull(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&opts.NoFF, "no-ff", false, "Create a merge commit even when the merge resolves as a fast-forward")
+	return cmd
+}
@@ -0,0 +1,45 @@
+package push
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandPush(r *repository.Repository) *cobra.Command {
+	opts := &repository.Push{}
+	var cmd = &cobra.Command{
+		Use:   "push [--force] [--force-with-lease=<ref>[:<expect>]] [--delete] [--tags] [--atomic] [--no-verify] [<repository> [<refspec>...]]",
+		Short: "Update remote refs along with associated objects",
+		Long: `Update the refs of another local repository, a remote name, a path or a file:// URL, sending the objects they need that it lacks.
+The refspecs map local refs or revisions to the refs of the repository, e.g. master:refs/heads/main; an empty source, as in :topic, deletes the ref.
+Without refspecs, remote.<name>.push or the current branch are pushed.
+A ref is only updated if that is a fast-forward, unless its refspec starts with +, --force is given, or its lease holds.
+The pre-push hook can refuse the push.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.Remote = args[0]
+				opts.Refspecs = args[1:]
+			}
+			out, clean, err := r.Push(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.Force, "force", "f", false, "Update the refs even when that is no fast-forward")
+	cmd.Flags().StringArrayVar(&opts.ForceWithLease, "force-with-lease", nil, "Update the ref <ref> even when that is no fast-forward, as long as it is at <expect>, or at its remote-tracking branch")
+	cmd.Flags().BoolVarP(&opts.Delete, "delete", "d", false, "Delete the refs named from the remote")
+	cmd.Flags().BoolVar(&opts.Tags, "tags", false, "Push all the tags, in addition to the refspecs")
+	cmd.Flags().BoolVar(&opts.Atomic, "atomic", false, "Update either all the refs of the remote or none")
+	cmd.Flags().BoolVar(&opts.NoVerify, "no-verify", false, "Bypass the pre-push hook")
+	return cmd
+}
@@ -0,0 +1,72 @@
+package rebase
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandRebase(r *repository.Repository) *cobra.Command {
+	opts := &repository.Rebase{}
+	var cmd = &cobra.Command{
+		Use:   "rebase [--onto <newbase>] <upstream> [<branch>]",
+		Short: "Reapply commits on top of another base tip",
+		Long: `Replay the commits of the current branch, or of <branch>, that are not in <upstream> on top of <upstream>,
+or of <newbase> with --onto, then move the branch to the last replayed commit.
+With --interactive the todo list is handed to GGIT_SEQUENCE_EDITOR, or sequence.editor, to reorder commits
+and pick, reword, edit, squash, fixup, drop or exec them; reworded and squashed messages go through GGIT_EDITOR.
+--autosquash moves "fixup! <subject>" and "squash! <subject>" commits after the commit they name.
+A conflict, a failed exec or an edit stops the rebase: resume it with --continue, skip the commit with --skip,
+or go back to where the rebase started with --abort.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validArgs(opts, args); err != nil {
+				return err
+			}
+			if len(args) > 0 {
+				opts.Upstream = args[0]
+			}
+			if len(args) > 1 {
+				opts.Branch = args[1]
+			}
+			out, clean, err := r.Rebase(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&opts.Onto, "onto", "", "Replay the commits on top of this commit instead of <upstream>")
+	cmd.Flags().BoolVarP(&opts.Interactive, "interactive", "i", false, "Edit the todo list with the sequence editor before replaying it")
+	cmd.Flags().BoolVar(&opts.Autosquash, "autosquash", false, "Move fixup! and squash! commits after the commit they name")
+	cmd.Flags().StringArrayVarP(&opts.Exec, "exec", "x", nil, "Run a shell command after each replayed commit")
+	cmd.Flags().BoolVar(&opts.NoVerify, "no-verify", false, "Bypass the pre-rebase hook")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "Resume the rebase once the stopped commit is resolved")
+	cmd.Flags().BoolVar(&opts.Skip, "skip", false, "Skip the stopped commit and go on with the rebase")
+	cmd.Flags().BoolVar(&opts.Abort, "abort", false, "Cancel the rebase and go back to where it started")
+	return cmd
+}
+
+func validArgs(opts *repository.Rebase, args []string) error {
+	control := 0
+	for _, set := range []bool{opts.Continue, opts.Skip, opts.Abort} {
+		if set {
+			control++
+		}
+	}
+	switch {
+	case control > 1:
+		return fmt.Errorf("--continue, --skip and --abort can not be used together")
+	case control == 1 && len(args) > 0:
+		return fmt.Errorf("--continue, --skip and --abort take no argument")
+	case len(args) > 2:
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package remote
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandRemote(r *repository.Repository) *cobra.Command {
+	var verbose bool
+	var cmd = &cobra.Command{
+		Use:   "remote [-v | --verbose]",
+		Short: "Manage set of tracked repositories",
+		Long: `Manage the remotes, the [remote "<name>"] sections of the repository configuration.
+Without a subcommand, the remotes are listed, with their fetch and push URLs with -v.
+The URLs are shown rewritten by url.<base>.insteadOf and url.<base>.pushInsteadOf.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var b strings.Builder
+			for _, remote := range r.Remotes() {
+				if !verbose {
+					fmt.Fprintln(&b, remote.Name)
+					continue
+				}
+				for _, url := range remote.URLs {
+					fmt.Fprintf(&b, "%s\t%s (fetch)\n", remote.Name, url)
+				}
+				for _, url := range remote.PushURLs {
+					fmt.Fprintf(&b, "%s\t%s (push)\n", remote.Name, url)
+				}
+			}
+			fmt.Print(b.String())
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the URLs of the remotes")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add <name> <url>",
+		Short: "Add a remote fetching its branches as refs/remotes/<name>/*",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return r.AddRemote(args[0], args[1])
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
+		Short:   "Remove a remote, its remote-tracking branches and the configuration of the branches tracking it",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return r.RemoveRemote(args[0])
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rename <old> <new>",
+		Short: "Rename a remote and its remote-tracking branches",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return r.RenameRemote(args[0], args[1])
+		},
+	})
+	var push bool
+	setURL := &cobra.Command{
+		Use:   "set-url [--push] <name> <newurl>",
+		Short: "Change the URL of a remote",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return r.SetRemoteURL(args[0], args[1], push)
+		},
+	}
+	setURL.Flags().BoolVar(&push, "push", false, "Change the push URL instead")
+	cmd.AddCommand(setURL)
+	return cmd
+}
@@ -2,27 +2,69 @@ package repoinit
 
 import (
 	"fmt"
+	"ggit/internal/filesystem"
 	"ggit/internal/repository"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
 
 func NewCommandInit(r *repository.Repository) *cobra.Command {
+	opts := &repository.Init{}
 	var cmd = &cobra.Command{
-		Use:   "init",
+		Use:   "init [--bare] [--template=<dir>] [--separate-git-dir=<dir>] [--object-format=<format>] [<directory>]",
 		Short: "Create an empty Git repository",
 		Long: `This command creates an empty Git repository - basically a .git directory with subdirectories for objects, refs/heads, refs/tags, and template files. 
-	An initial branch without any commits will be created (see the --initial-branch option below for its name).`,
-		Args: cobra.ExactArgs(0),
-		RunE: func(cmd *cobra.Command, _ []string) error {
-			return runCreate(r)
+	An initial branch without any commits will be created (see the --initial-branch option below for its name).
+The repository is created in the directory, the current one by default, which is created when missing.
+  --bare                      lays the repository out in the directory itself, without a worktree
+  --template=<dir>            copies the files of the template directory, such as hooks and info/exclude
+  --separate-git-dir=<dir>    creates the repository in dir, the worktree getting a .ggit file pointing to it
+  --object-format=<format>    computes the object IDs with sha1, the default, or sha256`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCreate(r, opts, args)
 		},
 	}
+	cmd.Flags().BoolVar(&opts.Bare, "bare", false, "Create a bare repository")
+	cmd.Flags().StringVar(&opts.Template, "template", "", "Directory from which templates will be used")
+	cmd.Flags().StringVar(&opts.SeparateGitDir, "separate-git-dir", "", "Create the repository directory in the given path")
+	cmd.Flags().StringVar(&opts.ObjectFormat, "object-format", "", "Hash algorithm of the object IDs, sha1 or sha256")
 	return cmd
 }
 
-func runCreate(r *repository.Repository) error {
-	output, err := r.Create(true)
+func runCreate(r *repository.Repository, opts *repository.Init, args []string) error {
+	// The repository is created in the given or current directory, even
+	// inside the worktree of another one, unless GGIT_DIR names it.
+	dir, err := filesystem.GetCWD()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		if dir, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+		if err := r.FS.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	created, err := repository.NewRepository(r.FS, dir)
+	if err != nil {
+		return err
+	}
+	if env := os.Getenv("GGIT_DIR"); env != "" && !opts.Bare {
+		if created.Gitdir, err = filepath.Abs(env); err != nil {
+			return err
+		}
+	}
+	if env := os.Getenv("GGIT_WORK_TREE"); env != "" && !opts.Bare {
+		if created.Worktree, err = filepath.Abs(env); err != nil {
+			return err
+		}
+	}
+	*r = *created
+	output, err := r.Init(opts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,74 @@
+package reset
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandReset(r *repository.Repository) *cobra.Command {
+	opts := &repository.Reset{}
+	var soft, mixed, hard bool
+	var cmd = &cobra.Command{
+		Use:   "reset [--soft | --mixed | --hard] [<commit>] [--] [<path>...]",
+		Short: "Reset current HEAD to the specified state",
+		Long: `Move the current branch to a commit, HEAD by default, and reset what follows it:
+  --soft    only moves the branch, keeping the index and the worktree
+  --mixed   also resets the index, keeping the changes in the worktree (default)
+  --hard    also resets the worktree, discarding every change to the tracked files
+With paths, only their index entries are reset to the commit, which unstages them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mode, err := resetMode(soft, mixed, hard)
+			if err != nil {
+				return err
+			}
+			opts.Mode = mode
+			dash := cmd.ArgsLenAtDash()
+			switch {
+			case dash > 1:
+				return fmt.Errorf("only one commit can be given before --")
+			case dash == 1:
+				opts.Commit, opts.Paths = args[0], args[1:]
+			case dash == 0:
+				opts.Paths = args
+			case len(args) > 0:
+				// Without --, the first argument is the commit unless it is
+				// not one.
+				if _, err := r.ResolveCommit(args[0]); err == nil {
+					opts.Commit, args = args[0], args[1:]
+				}
+				opts.Paths = args
+			}
+			if opts.Paths, err = r.PrefixPaths(opts.Paths); err != nil {
+				return err
+			}
+			out, err := r.Reset(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&soft, "soft", false, "Only move the current branch")
+	cmd.Flags().BoolVar(&mixed, "mixed", false, "Move the current branch and reset the index")
+	cmd.Flags().BoolVar(&hard, "hard", false, "Move the current branch and reset the index and the worktree")
+	return cmd
+}
+
+func resetMode(soft bool, mixed bool, hard bool) (string, error) {
+	modes := []string{}
+	for mode, set := range map[string]bool{repository.ResetSoft: soft, repository.ResetMixed: mixed, repository.ResetHard: hard} {
+		if set {
+			modes = append(modes, mode)
+		}
+	}
+	if len(modes) > 1 {
+		return "", fmt.Errorf("--soft, --mixed and --hard can not be used together")
+	}
+	if len(modes) == 0 {
+		return repository.ResetMixed, nil
+	}
+	return modes[0], nil
+}
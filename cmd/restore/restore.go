@@ -0,0 +1,31 @@
+package restore
+
+import (
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandRestore(r *repository.Repository) *cobra.Command {
+	opts := &repository.Restore{}
+	var cmd = &cobra.Command{
+		Use:   "restore [--source=<tree>] [--staged] [--worktree] [--] <path>...",
+		Short: "Restore working tree files",
+		Long: `Restore the content of paths from a source, removing the ones the source does not have.
+The worktree is restored by default, the index with --staged, and both with --staged --worktree.
+The source is a commit or a tree, and defaults to the index when only the worktree is restored, HEAD otherwise.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paths, err := r.PrefixPaths(args)
+			if err != nil {
+				return err
+			}
+			opts.Paths = paths
+			return r.Restore(opts)
+		},
+	}
+	cmd.Flags().StringVarP(&opts.Source, "source", "s", "", "Tree-ish to restore the content from")
+	cmd.Flags().BoolVarP(&opts.Staged, "staged", "S", false, "Restore the index")
+	cmd.Flags().BoolVarP(&opts.Worktree, "worktree", "W", false, "Restore the worktree")
+	return cmd
+}
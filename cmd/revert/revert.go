@@ -0,0 +1,34 @@
+package revert
+
+import (
+	cherrypick "ggit/cmd/cherry_pick"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandRevert(r *repository.Repository) *cobra.Command {
+	opts := &repository.CherryPick{Action: repository.ActionRevert}
+	var cmd = &cobra.Command{
+		Use:   "revert <commit>...",
+		Short: "Revert some existing commits",
+		Long: `Revert the changes introduced by some existing commits, recording a new commit for each of them on the current branch.
+Commits are given one by one, or as ranges like a..b or ^a b.
+A conflict stops the sequence: resolve it, add the files and run --continue, skip the commit with --skip,
+or go back to where the sequence started with --abort.
+  -m <parent-number>   reverts merge commits against their given parent, from 1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cherrypick.ValidArgs(opts, args); err != nil {
+				return err
+			}
+			opts.Commits = args
+			return cherrypick.Run(cmd, r, opts)
+		},
+	}
+	cmd.Flags().IntVarP(&opts.Mainline, "mainline", "m", 0, "Parent number of the mainline of merge commits")
+	cmd.Flags().BoolVarP(&opts.NoCommit, "no-commit", "n", false, "Apply the changes to the index and the worktree without committing")
+	cmd.Flags().BoolVar(&opts.Continue, "continue", false, "Resume the sequence once the conflicts are resolved")
+	cmd.Flags().BoolVar(&opts.Skip, "skip", false, "Skip the current commit and go on with the sequence")
+	cmd.Flags().BoolVar(&opts.Abort, "abort", false, "Cancel the sequence and go back to where it started")
+	return cmd
+}
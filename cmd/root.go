@@ -4,17 +4,44 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"ggit/cmd/add"
+	"ggit/cmd/blame"
 	catfile "ggit/cmd/cat_file"
+	cherrypick "ggit/cmd/cherry_pick"
+	"ggit/cmd/clone"
+	"ggit/cmd/config"
+	difftree "ggit/cmd/diff_tree"
+	"ggit/cmd/fetch"
+	"ggit/cmd/fsck"
+	"ggit/cmd/gc"
+	"ggit/cmd/hook"
+	"ggit/cmd/merge"
+	mergebase "ggit/cmd/merge_base"
+	mergetree "ggit/cmd/merge_tree"
+	"ggit/cmd/pull"
+	"ggit/cmd/push"
+	"ggit/cmd/rebase"
+	"ggit/cmd/remote"
 	repoinit "ggit/cmd/repo_init"
+	"ggit/cmd/reset"
+	"ggit/cmd/restore"
+	"ggit/cmd/revert"
+	"ggit/cmd/stash"
 	"ggit/internal/factory"
 	"ggit/internal/filesystem"
 	"ggit/internal/repository"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+// repo is the repository the commands work on, found again once the
+// global options have changed the current directory.
+var repo *repository.Repository
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "ggit",
@@ -27,12 +54,90 @@ For example:`,
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	args, err := changeDirectories(os.Args[1:])
+	if err == nil {
+		err = findRepository()
+	}
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		os.Exit(1)
+	}
+	rootCmd.SetArgs(expandOptionalShorthands(rootCmd, args))
+	err = rootCmd.Execute()
+	var exit repository.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// changeDirectories changes into the directory of each -C option given
+// before the command, a relative one being relative to the previous one,
+// and ignores the empty ones.
+//
+// Returns:
+//   - The arguments left once the -C options are removed.
+//   - An error if a directory can not be changed into.
+func changeDirectories(args []string) ([]string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-C") {
+		dir := strings.TrimPrefix(args[0], "-C")
+		args = args[1:]
+		if dir == "" {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("no directory given for -C")
+			}
+			dir, args = args[0], args[1:]
+		}
+		if dir == "" {
+			continue
+		}
+		if err := os.Chdir(dir); err != nil {
+			return nil, fmt.Errorf("cannot change to '%s': %w", dir, err)
+		}
+	}
+	return args, nil
+}
+
+// findRepository finds the repository of the current directory.
+func findRepository() error {
+	cwd, err := filesystem.GetCWD()
+	if err != nil {
+		return err
+	}
+	found, err := repository.FindRepository(repo.FS, cwd)
+	if err != nil {
+		return err
+	}
+	*repo = *found
+	return nil
+}
+
+// expandOptionalShorthands rewrites shorthand flags with an attached value,
+// such as -M50%, into their long form. pflag treats the characters following
+// a shorthand flag with an optional value as further shorthand flags.
+func expandOptionalShorthands(root *cobra.Command, args []string) []string {
+	cmd, _, err := root.Find(args)
+	if err != nil {
+		return args
+	}
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && arg[2] != '=' {
+			flag := cmd.Flags().ShorthandLookup(arg[1:2])
+			if flag != nil && flag.NoOptDefVal != "" {
+				arg = fmt.Sprintf("--%s=%s", flag.Name, arg[2:])
+			}
+		}
+		expanded = append(expanded, arg)
+	}
+	return append(expanded, args[len(expanded):]...)
+}
+
 func init() {
 	fs := factory.NewFactory()
 	cwd, err := filesystem.GetCWD()
@@ -45,6 +150,31 @@ func init() {
 		fmt.Printf("%e", err)
 		os.Exit(1)
 	}
+	repo = r
+	// -C is handled by Execute before the command is parsed, as it is only
+	// accepted ahead of the command name; it is declared to be documented.
+	rootCmd.Flags().StringArrayP("directory", "C", nil, "Run as if ggit was started in the given path instead of the current directory")
 	rootCmd.AddCommand(repoinit.NewCommandInit(r))
 	rootCmd.AddCommand(catfile.NewCommandCatFile(r))
+	rootCmd.AddCommand(difftree.NewCommandDiffTree(r))
+	rootCmd.AddCommand(mergebase.NewCommandMergeBase(r))
+	rootCmd.AddCommand(add.NewCommandAdd(r))
+	rootCmd.AddCommand(merge.NewCommandMerge(r))
+	rootCmd.AddCommand(mergetree.NewCommandMergeTree(r))
+	rootCmd.AddCommand(cherrypick.NewCommandCherryPick(r))
+	rootCmd.AddCommand(revert.NewCommandRevert(r))
+	rootCmd.AddCommand(rebase.NewCommandRebase(r))
+	rootCmd.AddCommand(stash.NewCommandStash(r))
+	rootCmd.AddCommand(reset.NewCommandReset(r))
+	rootCmd.AddCommand(restore.NewCommandRestore(r))
+	rootCmd.AddCommand(blame.NewCommandBlame(r))
+	rootCmd.AddCommand(fsck.NewCommandFsck(r))
+	rootCmd.AddCommand(config.NewCommandConfig(r))
+	rootCmd.AddCommand(clone.NewCommandClone(r))
+	rootCmd.AddCommand(gc.NewCommandGc(r))
+	rootCmd.AddCommand(hook.NewCommandHook(r))
+	rootCmd.AddCommand(fetch.NewCommandFetch(r))
+	rootCmd.AddCommand(pull.NewCommandPull(r))
+	rootCmd.AddCommand(remote.NewCommandRemote(r))
+	rootCmd.AddCommand(push.NewCommandPush(r))
 }
@@ -0,0 +1,117 @@
+package stash
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCommandStash(r *repository.Repository) *cobra.Command {
+	opts := &repository.StashPush{}
+	push := func(cmd *cobra.Command, args []string) error {
+		out, err := r.StashPush(opts)
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	}
+	var cmd = &cobra.Command{
+		Use:   "stash",
+		Short: "Stash the changes in a dirty working directory away",
+		Long: `Record the changes of the index and the worktree as a stash entry and go back to a clean worktree.
+Entries are commits on refs/stash, whose reflog is the stack of entries, named stash@{<n>} from the newest.
+Without a subcommand, the changes are pushed.`,
+		Args: cobra.NoArgs,
+		RunE: push,
+	}
+	cmd.Flags().BoolVarP(&opts.IncludeUntracked, "include-untracked", "u", false, "Also stash the untracked files, then remove them")
+	cmd.Flags().StringVarP(&opts.Message, "message", "m", "", "Description of the stash entry")
+
+	pushCmd := &cobra.Command{
+		Use:   "push",
+		Short: "Save the local changes to a new stash entry",
+		Args:  cobra.NoArgs,
+		RunE:  push,
+	}
+	pushCmd.Flags().AddFlagSet(cmd.Flags())
+	cmd.AddCommand(pushCmd)
+	cmd.AddCommand(newCommandApply(r, "apply", "Apply a stash entry on top of the worktree", false))
+	cmd.AddCommand(newCommandApply(r, "pop", "Apply a stash entry and drop it from the stack", true))
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the stash entries",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := r.StashList()
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "drop [<stash>]",
+		Short: "Remove a stash entry from the stack",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := r.StashDrop(stashName(args))
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		},
+	})
+
+	var patch bool
+	showCmd := &cobra.Command{
+		Use:   "show [<stash>]",
+		Short: "Show the changes recorded in a stash entry",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := r.StashShow(stashName(args), patch)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		},
+	}
+	showCmd.Flags().BoolVarP(&patch, "patch", "p", false, "Show the changes as a patch")
+	cmd.AddCommand(showCmd)
+	return cmd
+}
+
+// newCommandApply returns the apply or pop subcommand, exiting with 1 when
+// the entry conflicts.
+func newCommandApply(r *repository.Repository, use string, short string, pop bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " [<stash>]",
+		Short: short,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, clean, err := r.StashApply(stashName(args), pop)
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			if !clean {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return repository.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+}
+
+func stashName(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
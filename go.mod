@@ -2,13 +2,15 @@ module ggit
 
 go 1.23.1
 
-require github.com/spf13/cobra v1.8.1
+require (
+	github.com/samber/lo v1.47.0
+	github.com/spf13/cobra v1.8.1
+	github.com/stretchr/testify v1.9.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/samber/lo v1.47.0 // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -16,6 +18,6 @@ require (
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/afero v1.11.0
-	github.com/spf13/pflag v1.0.5 // indirect
-	gopkg.in/ini.v1 v1.67.0 // indirect
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/ini.v1 v1.67.0
 )
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU keeps values up to a total size, evicting the least recently used
+// ones first. It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	limit int64
+	size  int64
+	order *list.List
+	items map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+// New returns a cache holding values up to a total size of limit. A limit
+// of zero or less disables the cache.
+func New[K comparable, V any](limit int64) *LRU[K, V] {
+	return &LRU[K, V]{limit: limit, order: list.New(), items: map[K]*list.Element{}}
+}
+
+// Get returns the value of key and marks it as the most recently used. A
+// nil cache holds nothing.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	if c == nil {
+		var zero V
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*entry[K, V]).value, true
+}
+
+// Add stores the value of key, of the given size, evicting the least
+// recently used values until the cache fits its limit. A value larger than
+// the limit, or added to a nil cache, is not stored.
+func (c *LRU[K, V]) Add(key K, value V, size int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	if c.limit <= 0 || size > c.limit {
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, size: size})
+	c.size += size
+	c.evict()
+}
+
+// SetLimit changes the total size of the values the cache holds, evicting
+// values to fit.
+func (c *LRU[K, V]) SetLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+	c.evict()
+}
+
+// Len returns the number of values in the cache.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Size returns the total size of the values in the cache.
+func (c *LRU[K, V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *LRU[K, V]) evict() {
+	for c.size > c.limit && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) remove(e *list.Element) {
+	c.order.Remove(e)
+	item := e.Value.(*entry[K, V])
+	delete(c.items, item.key)
+	c.size -= item.size
+}
@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"fmt"
+	"ggit/internal/cache"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("Evict", func(t *testing.T) {
+		c := cache.New[string, string](10)
+		c.Add("a", "aaaa", 4)
+		c.Add("b", "bbbb", 4)
+		_, ok := c.Get("a")
+		assert.True(t, ok)
+		c.Add("c", "cccc", 4)
+
+		_, ok = c.Get("b")
+		assert.False(t, ok)
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, "aaaa", v)
+		assert.Equal(t, 2, c.Len())
+		assert.Equal(t, int64(8), c.Size())
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		c := cache.New[string, int](10)
+		c.Add("a", 1, 6)
+		c.Add("a", 2, 3)
+		v, _ := c.Get("a")
+		assert.Equal(t, 2, v)
+		assert.Equal(t, int64(3), c.Size())
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		c := cache.New[string, int](10)
+		c.Add("a", 1, 4)
+		c.Add("b", 2, 11)
+		_, ok := c.Get("b")
+		assert.False(t, ok)
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c := cache.New[string, int](0)
+		c.Add("a", 1, 1)
+		assert.Equal(t, 0, c.Len())
+	})
+
+	t.Run("SetLimit", func(t *testing.T) {
+		c := cache.New[string, int](10)
+		c.Add("a", 1, 4)
+		c.Add("b", 2, 4)
+		c.SetLimit(5)
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+		assert.Equal(t, int64(4), c.Size())
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		c := cache.New[string, int](64)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					key := fmt.Sprint(i % 100)
+					if v, ok := c.Get(key); ok {
+						assert.Equal(t, i%100, v)
+					}
+					c.Add(key, i%100, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, c.Size(), int64(64))
+	})
+}
@@ -0,0 +1,48 @@
+package diff
+
+// ANSI escape sequences of git's default diff colors.
+const (
+	colorReset      = "\033[m"
+	colorMeta       = "\033[1m"
+	colorFrag       = "\033[36m"
+	colorOld        = "\033[31m"
+	colorNew        = "\033[32m"
+	colorWhitespace = "\033[41m"
+
+	colorOldMoved       = "\033[1;35m"
+	colorOldMovedAlt    = "\033[1;34m"
+	colorNewMoved       = "\033[1;36m"
+	colorNewMovedAlt    = "\033[1;33m"
+	colorMovedDimmed    = "\033[2m"
+	colorMovedAltDimmed = "\033[2;3m"
+)
+
+// oldColor returns the color of a deleted line.
+func oldColor(flags movedFlags) string {
+	switch flags & (movedLine | movedAlt | movedDimmed) {
+	case movedLine | movedAlt | movedDimmed:
+		return colorMovedAltDimmed
+	case movedLine | movedAlt:
+		return colorOldMovedAlt
+	case movedLine | movedDimmed:
+		return colorMovedDimmed
+	case movedLine:
+		return colorOldMoved
+	}
+	return colorOld
+}
+
+// newColor returns the color of an added line.
+func newColor(flags movedFlags) string {
+	switch flags & (movedLine | movedAlt | movedDimmed) {
+	case movedLine | movedAlt | movedDimmed:
+		return colorMovedAltDimmed
+	case movedLine | movedAlt:
+		return colorNewMovedAlt
+	case movedLine | movedDimmed:
+		return colorMovedDimmed
+	case movedLine:
+		return colorNewMoved
+	}
+	return colorNew
+}
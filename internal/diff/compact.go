@@ -0,0 +1,313 @@
+package diff
+
+// changeFile is one side of an edit script, with the lines it changes
+// flagged. The flags have a sentinel before the first and after the last
+// line.
+type changeFile struct {
+	lines []string
+	flags []bool
+}
+
+func (f *changeFile) changed(i int) bool {
+	return f.flags[i+1]
+}
+
+func (f *changeFile) set(i int, changed bool) {
+	f.flags[i+1] = changed
+}
+
+// group is a run of changed lines, possibly empty, between two unchanged
+// lines. Both sides of an edit script have the same number of groups.
+type group struct {
+	start, end int
+}
+
+func (f *changeFile) first() group {
+	g := group{}
+	for f.changed(g.end) {
+		g.end++
+	}
+	return g
+}
+
+func (f *changeFile) next(g *group) bool {
+	if g.end == len(f.lines) {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; f.changed(g.end); g.end++ {
+	}
+	return true
+}
+
+func (f *changeFile) previous(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; f.changed(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+func (f *changeFile) slideDown(g *group) bool {
+	if g.end >= len(f.lines) || f.lines[g.start] != f.lines[g.end] {
+		return false
+	}
+	f.set(g.start, false)
+	f.set(g.end, true)
+	g.start, g.end = g.start+1, g.end+1
+	for f.changed(g.end) {
+		g.end++
+	}
+	return true
+}
+
+func (f *changeFile) slideUp(g *group) bool {
+	if g.start == 0 || f.lines[g.start-1] != f.lines[g.end-1] {
+		return false
+	}
+	g.start, g.end = g.start-1, g.end-1
+	f.set(g.start, true)
+	f.set(g.end, false)
+	for f.changed(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// compact shifts each group of changed lines of f as far down as possible,
+// merging it with the groups it bumps into, unless it can be aligned with
+// a group of changes of other. With indent, a group that can not be
+// aligned is shifted to where the indentation of the lines around it
+// suggests a block starts and ends instead. This is xdiff's change
+// compaction, so that diffs and merges see the same changes git does.
+func (f *changeFile) compact(other *changeFile, indent bool) {
+	g, o := f.first(), other.first()
+	for {
+		if g.end != g.start {
+			var earliestEnd int
+			for {
+				size := g.end - g.start
+				matching := -1
+				for f.slideUp(&g) {
+					other.previous(&o)
+				}
+				earliestEnd = g.end
+				if o.end > o.start {
+					matching = g.end
+				}
+				for f.slideDown(&g) {
+					other.next(&o)
+					if o.end > o.start {
+						matching = g.end
+					}
+				}
+				if size == g.end-g.start {
+					switch {
+					case g.end == earliestEnd:
+					case matching != -1:
+						for o.end == o.start {
+							f.slideUp(&g)
+							other.previous(&o)
+						}
+					case indent:
+						for best := f.bestShift(g, earliestEnd); g.end > best; {
+							f.slideUp(&g)
+							other.previous(&o)
+						}
+					}
+					break
+				}
+			}
+		}
+		if !f.next(&g) {
+			break
+		}
+		other.next(&o)
+	}
+}
+
+// compacted flags the lines of a and b the compacted edit script of xdiff
+// turning a into b deletes and inserts, with the indent heuristic of git's diffs
+// when indent is set.
+func compacted(a []string, b []string, indent bool) (*changeFile, *changeFile) {
+	fa := &changeFile{lines: a, flags: make([]bool, len(a)+2)}
+	fb := &changeFile{lines: b, flags: make([]bool, len(b)+2)}
+	xdiff(fa, fb)
+	fa.compact(fb, indent)
+	fb.compact(fa, indent)
+	return fa, fb
+}
+
+// CompactEdits returns the edit script turning a into b the way git's diffs
+// show it: computed by xdiff, then with each run of changes shifted by the
+// change compaction and the indent heuristic.
+func CompactEdits(a []string, b []string) []Edit {
+	fa, fb := compacted(a, b, true)
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if !fa.changed(i) && !fb.changed(j) {
+			edits = append(edits, Edit{Op: Equal, OldIndex: i, NewIndex: j, Text: a[i]})
+			i, j = i+1, j+1
+			continue
+		}
+		for ; fa.changed(i); i++ {
+			edits = append(edits, Edit{Op: Delete, OldIndex: i, NewIndex: -1, Text: a[i]})
+		}
+		for ; fb.changed(j); j++ {
+			edits = append(edits, Edit{Op: Insert, OldIndex: -1, NewIndex: j, Text: b[j]})
+		}
+	}
+	return edits
+}
+
+// Limits and weights of the indent heuristic, as xdiff has them.
+const (
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	indentHeuristicMaxSliding       = 100
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+// lineIndent returns the indentation of a line, tabs reaching the next
+// multiple of 8, or -1 for a line of whitespace only.
+func lineIndent(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case !isSpace(c):
+			return indent
+		case c == ' ':
+			indent++
+		case c == '\t':
+			indent += 8 - indent%8
+		}
+		if indent >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// splitMeasurement describes the lines around a split between two lines:
+// the indentation of the line after it, and the blank lines and the
+// indentation of the first non-blank lines before and after that one.
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+func (f *changeFile) measureSplit(split int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(f.lines) {
+		m.endOfFile = true
+	} else {
+		m.indent = lineIndent(f.lines[split])
+	}
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = lineIndent(f.lines[i]); m.preIndent != -1 {
+			break
+		}
+		if m.preBlank++; m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+	for i := split + 1; i < len(f.lines); i++ {
+		if m.postIndent = lineIndent(f.lines[i]); m.postIndent != -1 {
+			break
+		}
+		if m.postBlank++; m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+// splitScore rates splits, lower being better.
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight*totalBlank + postBlankWeight*postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	blanks := totalBlank != 0
+	s.effectiveIndent += indent
+	pick := func(withBlank int, without int) int {
+		if blanks {
+			return withBlank
+		}
+		return without
+	}
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		s.penalty += pick(relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case m.postIndent != -1 && m.postIndent > indent:
+		s.penalty += pick(relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		s.penalty += pick(relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+func (s splitScore) compare(other splitScore) int {
+	indents := 0
+	switch {
+	case s.effectiveIndent > other.effectiveIndent:
+		indents = 1
+	case s.effectiveIndent < other.effectiveIndent:
+		indents = -1
+	}
+	return indentWeight*indents + s.penalty - other.penalty
+}
+
+// bestShift returns where the group g, slid down as far as it goes, should
+// end for the lines around it to look most like the start and the end of
+// a block; earliestEnd is where it ends slid up as far as it goes.
+func (f *changeFile) bestShift(g group, earliestEnd int) int {
+	size := g.end - g.start
+	best, bestScore := -1, splitScore{}
+	for shift := max(earliestEnd, g.end-size-1, g.end-indentHeuristicMaxSliding); shift <= g.end; shift++ {
+		score := splitScore{}
+		score.add(f.measureSplit(shift))
+		score.add(f.measureSplit(shift - size))
+		if best == -1 || score.compare(bestScore) <= 0 {
+			best, bestScore = shift, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,50 @@
+package diff
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"strings"
+)
+
+// binaryProbe is how many leading bytes are inspected to detect binary files.
+const binaryProbe = 8000
+
+// IsBinary reports whether data looks like binary content, that is whether
+// a NUL byte appears within its first 8000 bytes.
+func IsBinary(data string) bool {
+	return strings.IndexByte(data[:min(len(data), binaryProbe)], 0) >= 0
+}
+
+// contents reads and caches the content of the files of a diff.
+type contents struct {
+	r    ObjectReader
+	data map[string]string
+}
+
+func newContents(r ObjectReader) *contents {
+	return &contents{r: r, data: map[string]string{}}
+}
+
+// read returns the content of a file. Missing files are empty and
+// submodules are represented by the commit they point to.
+func (c *contents) read(f File) (string, error) {
+	if !f.Exists() {
+		return "", nil
+	}
+	if f.Mode == objects.ModeGitlink {
+		return fmt.Sprintf("Subproject commit %s\n", f.Hash), nil
+	}
+	if data, ok := c.data[f.Hash]; ok {
+		return data, nil
+	}
+	obj, err := c.r.ReadObject(f.Hash)
+	if err != nil {
+		return "", err
+	}
+	blob, ok := obj.(*objects.Blob)
+	if !ok {
+		return "", fmt.Errorf("object %s is a %s, not a blob", f.Hash, obj.Format())
+	}
+	c.data[f.Hash] = blob.ReadData()
+	return c.data[f.Hash], nil
+}
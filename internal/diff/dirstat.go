@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ways of measuring the damage done to a file for --dirstat.
+const (
+	DirstatChanges = "changes"
+	DirstatLines   = "lines"
+	DirstatFiles   = "files"
+)
+
+// DirstatOptions controls FormatDirstat. Permille is the minimum share of
+// the total damage, in tenths of a percent, a directory needs to be shown.
+type DirstatOptions struct {
+	Mode       string
+	Cumulative bool
+	Permille   int
+}
+
+const defaultDirstatPermille = 30
+
+// ParseDirstat parses the comma separated parameters of --dirstat:
+// "changes", "lines" or "files", "cumulative" or "noncumulative" and a
+// limit in percent such as "10" or "2.5".
+//
+// Returns:
+//   - The parsed options, with git's defaults for missing parameters.
+//   - An error for unknown parameters.
+func ParseDirstat(params string) (DirstatOptions, error) {
+	opts := DirstatOptions{Mode: DirstatChanges, Permille: defaultDirstatPermille}
+	for _, p := range strings.Split(params, ",") {
+		switch p {
+		case "":
+		case DirstatChanges, DirstatLines, DirstatFiles:
+			opts.Mode = p
+		case "cumulative":
+			opts.Cumulative = true
+		case "noncumulative":
+			opts.Cumulative = false
+		default:
+			whole, fraction, _ := strings.Cut(p, ".")
+			n, err := strconv.Atoi(whole)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("unknown dirstat parameter %s", p)
+			}
+			opts.Permille = n * 10
+			if fraction != "" {
+				if _, err := strconv.Atoi(fraction); err != nil {
+					return opts, fmt.Errorf("unknown dirstat parameter %s", p)
+				}
+				opts.Permille += int(fraction[0] - '0')
+			}
+		}
+	}
+	return opts, nil
+}
+
+type dirstatFile struct {
+	name    string
+	changed int
+}
+
+// FormatDirstat renders the share of the changes made in each directory.
+// Directories below the limit are folded into their parent unless the
+// cumulative option counts each directory on its own.
+//
+// Returns:
+//   - One line per directory such as "  42.0% src/".
+//   - An error if the content of a file can not be read.
+func FormatDirstat(r ObjectReader, changes []Change, opts DirstatOptions) (string, error) {
+	files := []dirstatFile{}
+	total := 0
+
+	var stats []FileStat
+	if opts.Mode == DirstatLines {
+		var err error
+		stats, err = Stats(r, changes)
+		if err != nil {
+			return "", err
+		}
+	}
+	contents := newContents(r)
+
+	for i, c := range changes {
+		damage := 0
+		switch {
+		case opts.Mode == DirstatLines:
+			damage = stats[i].Added + stats[i].Deleted
+			if stats[i].Binary {
+				damage = (damage + 63) / 64
+			}
+		case c.From.Exists() && c.To.Exists() && c.From.Hash == c.To.Hash:
+			damage = 0
+		case opts.Mode == DirstatFiles:
+			damage = 1
+		default:
+			from, err := contents.read(c.From)
+			if err != nil {
+				return "", err
+			}
+			to, err := contents.read(c.To)
+			if err != nil {
+				return "", err
+			}
+			copied, added := countChanges(from, to)
+			if !c.From.Exists() {
+				added = len(to)
+			}
+			damage = max(len(from)-copied+added, 1)
+		}
+		if damage > 0 {
+			files = append(files, dirstatFile{name: c.Path(), changed: damage})
+			total += damage
+		}
+	}
+	if total == 0 {
+		return "", nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+	d := &dirstat{files: files, total: total, opts: opts}
+	d.gather("")
+	return d.out.String(), nil
+}
+
+type dirstat struct {
+	files []dirstatFile
+	total int
+	opts  DirstatOptions
+	out   strings.Builder
+}
+
+// gather sums the damage of the files below base and prints the directory
+// when its share reaches the limit.
+func (d *dirstat) gather(base string) int {
+	sum, sources := 0, 0
+	for len(d.files) > 0 {
+		f := d.files[0]
+		if !strings.HasPrefix(f.name, base) {
+			break
+		}
+		if slash := strings.IndexByte(f.name[len(base):], '/'); slash >= 0 {
+			sum += d.gather(f.name[:len(base)+slash+1])
+			sources++
+		} else {
+			sum += f.changed
+			d.files = d.files[1:]
+			sources += 2
+		}
+	}
+
+	// The top level and directories whose changes all come from a single
+	// subdirectory are not reported.
+	if base != "" && sources != 1 && sum > 0 {
+		permille := sum * 1000 / d.total
+		if permille >= d.opts.Permille {
+			fmt.Fprintf(&d.out, "%4d.%01d%% %s\n", permille/10, permille%10, base)
+			if !d.opts.Cumulative {
+				return 0
+			}
+		}
+	}
+	return sum
+}
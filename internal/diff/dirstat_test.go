@@ -0,0 +1,80 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirstat(t *testing.T) {
+	opts, err := diff.ParseDirstat("")
+	assert.NoError(t, err)
+	assert.Equal(t, diff.DirstatOptions{Mode: diff.DirstatChanges, Permille: 30}, opts)
+
+	opts, err = diff.ParseDirstat("lines,cumulative,2.5")
+	assert.NoError(t, err)
+	assert.Equal(t, diff.DirstatOptions{Mode: diff.DirstatLines, Cumulative: true, Permille: 25}, opts)
+
+	opts, err = diff.ParseDirstat("files,10")
+	assert.NoError(t, err)
+	assert.Equal(t, diff.DirstatOptions{Mode: diff.DirstatFiles, Permille: 100}, opts)
+
+	_, err = diff.ParseDirstat("words")
+	assert.Error(t, err)
+}
+
+func TestFormatDirstat(t *testing.T) {
+	m := memStore{}
+	from := m.tree(map[string]string{
+		"docs/a.txt":     "a\n",
+		"src/app/x.go":   strings.Repeat("x\n", 10),
+		"src/app/y.go":   strings.Repeat("y\n", 10),
+		"src/lib/z.go":   strings.Repeat("z\n", 10),
+		"src/lib/w.go":   strings.Repeat("w\n", 10),
+		"top.txt":        "top\n",
+		"vendor/dep.txt": "dep\n",
+	})
+	to := m.tree(map[string]string{
+		"docs/a.txt":     "a\n",
+		"src/app/x.go":   strings.Repeat("X\n", 10),
+		"src/app/y.go":   strings.Repeat("Y\n", 5),
+		"src/lib/z.go":   strings.Repeat("Z\n", 10),
+		"src/lib/w.go":   strings.Repeat("w\n", 10),
+		"top.txt":        "TOP\n",
+		"vendor/dep.txt": "dep\n",
+	})
+	changes, err := diff.TreeDiff(m, from, to, nil)
+	assert.NoError(t, err)
+
+	t.Run("Changes", func(t *testing.T) {
+		out, err := diff.FormatDirstat(m, changes, diff.DirstatOptions{Mode: diff.DirstatChanges, Permille: 30})
+		assert.NoError(t, err)
+		assert.Equal(t, "  59.3% src/app/\n  33.8% src/lib/\n", out)
+	})
+
+	t.Run("Cumulative", func(t *testing.T) {
+		out, err := diff.FormatDirstat(m, changes, diff.DirstatOptions{Mode: diff.DirstatChanges, Cumulative: true, Permille: 30})
+		assert.NoError(t, err)
+		assert.Equal(t, "  59.3% src/app/\n  33.8% src/lib/\n  93.2% src/\n", out)
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		out, err := diff.FormatDirstat(m, changes, diff.DirstatOptions{Mode: diff.DirstatFiles, Permille: 30})
+		assert.NoError(t, err)
+		assert.Equal(t, "  50.0% src/app/\n  25.0% src/lib/\n", out)
+	})
+
+	t.Run("Lines", func(t *testing.T) {
+		out, err := diff.FormatDirstat(m, changes, diff.DirstatOptions{Mode: diff.DirstatLines, Permille: 0})
+		assert.NoError(t, err)
+		assert.Equal(t, "  61.4% src/app/\n  35.0% src/lib/\n", out)
+	})
+
+	t.Run("NoChanges", func(t *testing.T) {
+		out, err := diff.FormatDirstat(m, nil, diff.DirstatOptions{Mode: diff.DirstatChanges})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+	})
+}
@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	nullMode = "000000"
+	nullHash = "0000000000000000000000000000000000000000"
+)
+
+// StatusString returns the status letter of a change followed, for renames
+// and copies, by the three digit similarity score, e.g. "R087".
+func (c Change) StatusString() string {
+	if c.Status == Renamed || c.Status == Copied {
+		return fmt.Sprintf("%c%03d", c.Status, c.Score)
+	}
+	return string(c.Status)
+}
+
+// paths returns the tab separated paths of a change as printed by the raw
+// and name-status formats.
+func (c Change) paths() string {
+	if c.Status == Renamed || c.Status == Copied {
+		return c.From.Path + "\t" + c.To.Path
+	}
+	return c.Path()
+}
+
+// FormatRaw renders changes in git's raw diff format:
+//
+//	:100644 100644 <old sha> <new sha> M	path
+//
+// Returns:
+//   - One line per change, each terminated by a newline.
+func FormatRaw(changes []Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&b, ":%s %s %s %s %s\t%s\n",
+			rawMode(c.From), rawMode(c.To), rawHash(c.From, c.To), rawHash(c.To, c.From), c.StatusString(), c.paths())
+	}
+	return b.String()
+}
+
+// FormatNameStatus renders the status and paths of each change.
+//
+// Returns:
+//   - One line per change, each terminated by a newline.
+func FormatNameStatus(changes []Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&b, "%s\t%s\n", c.StatusString(), c.paths())
+	}
+	return b.String()
+}
+
+func rawMode(f File) string {
+	if !f.Exists() {
+		return nullMode
+	}
+	return fmt.Sprintf("%06s", f.Mode)
+}
+
+// rawHash returns the object ID of f, or zeros as long as the ID of the
+// other side when f does not exist.
+func rawHash(f File, other File) string {
+	if !f.Exists() {
+		if other.Hash == "" {
+			return nullHash
+		}
+		return strings.Repeat("0", len(other.Hash))
+	}
+	return f.Hash
+}
+
+// FormatSummary renders the created, deleted, renamed and copied files and
+// the mode changes, like git's --summary:
+//
+//	create mode 100644 path
+//	rename dir/{old => new} (87%)
+//
+// Returns:
+//   - One line per summarized change, each terminated by a newline.
+func FormatSummary(changes []Change) string {
+	var b strings.Builder
+	for _, c := range changes {
+		switch c.Status {
+		case Added:
+			fmt.Fprintf(&b, " create mode %06s %s\n", c.To.Mode, c.To.Path)
+		case Deleted:
+			fmt.Fprintf(&b, " delete mode %06s %s\n", c.From.Mode, c.From.Path)
+		case Renamed, Copied:
+			verb := "rename"
+			if c.Status == Copied {
+				verb = "copy"
+			}
+			fmt.Fprintf(&b, " %s %s (%d%%)\n", verb, RenameName(c.From.Path, c.To.Path), c.Score)
+			if c.From.Mode != c.To.Mode {
+				fmt.Fprintf(&b, " mode change %06s => %06s\n", c.From.Mode, c.To.Mode)
+			}
+		default:
+			if c.From.Mode != c.To.Mode {
+				fmt.Fprintf(&b, " mode change %06s => %06s %s\n", c.From.Mode, c.To.Mode, c.To.Path)
+			}
+		}
+	}
+	return b.String()
+}
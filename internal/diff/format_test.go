@@ -0,0 +1,57 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	changes := []diff.Change{
+		{
+			Status: diff.Added,
+			To:     diff.File{Path: "new.txt", Mode: "100644", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+		},
+		{
+			Status: diff.Renamed,
+			Score:  87,
+			From:   diff.File{Path: "old/name.go", Mode: "100644", Hash: "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2"},
+			To:     diff.File{Path: "new/name.go", Mode: "100755", Hash: "33d3dc5cb51d3fadadae47a73739521805ba8ab1"},
+		},
+		{
+			Status: diff.Deleted,
+			From:   diff.File{Path: "gone", Mode: "120000", Hash: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+		},
+	}
+
+	t.Run("Raw", func(t *testing.T) {
+		expected := ":000000 100644 0000000000000000000000000000000000000000 ce013625030ba8dba906f756967f9e9ca394464a A\tnew.txt\n" +
+			":100644 100755 a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2 33d3dc5cb51d3fadadae47a73739521805ba8ab1 R087\told/name.go\tnew/name.go\n" +
+			":120000 000000 4b825dc642cb6eb9a060e54bf8d69288fbee4904 0000000000000000000000000000000000000000 D\tgone\n"
+		assert.Equal(t, expected, diff.FormatRaw(changes))
+	})
+
+	t.Run("NameStatus", func(t *testing.T) {
+		expected := "A\tnew.txt\nR087\told/name.go\tnew/name.go\nD\tgone\n"
+		assert.Equal(t, expected, diff.FormatNameStatus(changes))
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		modeChange := diff.Change{
+			Status: diff.Modified,
+			From:   diff.File{Path: "run.sh", Mode: "100644", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+			To:     diff.File{Path: "run.sh", Mode: "100755", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+		}
+		expected := " create mode 100644 new.txt\n" +
+			" rename {old => new}/name.go (87%)\n" +
+			" mode change 100644 => 100755\n" +
+			" delete mode 120000 gone\n" +
+			" mode change 100644 => 100755 run.sh\n"
+		assert.Equal(t, expected, diff.FormatSummary(append(changes, modeChange)))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Equal(t, "", diff.FormatRaw(nil))
+	})
+}
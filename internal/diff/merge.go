@@ -0,0 +1,407 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Conflict styles of Merge3: the merge style shows both sides of a
+// conflict, diff3 adds the base, and zdiff3 moves the lines both sides
+// agree on out of the conflict.
+const (
+	ConflictStyleMerge        = "merge"
+	ConflictStyleDiff3        = "diff3"
+	ConflictStyleZealousDiff3 = "zdiff3"
+)
+
+// Sides a merge can resolve conflicts in favor of.
+const (
+	FavorOurs   = "ours"
+	FavorTheirs = "theirs"
+)
+
+const defaultMarkerSize = 7
+
+// MergeOptions controls the conflict markers written by Merge3. The labels
+// follow the markers of their side; MarkerSize defaults to seven. Favor
+// resolves conflicts with the lines of one side instead of markers, and
+// IgnoreSpaceChange compares lines regardless of changes in the amount of
+// whitespace.
+type MergeOptions struct {
+	Style             string
+	Ours              string
+	Base              string
+	Theirs            string
+	MarkerSize        int
+	Favor             string
+	IgnoreSpaceChange bool
+}
+
+// Kinds of merge hunks, matching xdiff's merge modes.
+const (
+	hunkConflict  = 0
+	hunkOurs      = 1
+	hunkTheirs    = 2
+	hunkIdentical = 4
+)
+
+// mergeHunk is a region changed by at least one side. i0, i1 and i2 are
+// where it starts in the base, ours and theirs and chg0, chg1 and chg2 how
+// many lines it spans there.
+type mergeHunk struct {
+	mode             int
+	i0, i1, i2       int
+	chg0, chg1, chg2 int
+}
+
+// change is a run of lines of a replaced by lines of b.
+type change struct {
+	i1, chg1 int
+	i2, chg2 int
+}
+
+// changes groups the compacted edit script turning a into b into runs of
+// changes.
+func changes(a []string, b []string) []change {
+	fa, fb := compacted(a, b, false)
+
+	result := []change{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if !fa.changed(i) && !fb.changed(j) {
+			i, j = i+1, j+1
+			continue
+		}
+		c := change{i1: i, i2: j}
+		for ; fa.changed(i); i++ {
+			c.chg1++
+		}
+		for ; fb.changed(j); j++ {
+			c.chg2++
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// Hunk is a run of changed lines: OldCount lines from OldStart, from 0, of
+// the old version are replaced by NewCount lines from NewStart of the new
+// one.
+type Hunk struct {
+	OldStart, OldCount int
+	NewStart, NewCount int
+}
+
+// Hunks returns the runs of changed lines turning a into b, compacted like
+// the ones of merges.
+func Hunks(a []string, b []string) []Hunk {
+	hunks := []Hunk{}
+	for _, c := range changes(a, b) {
+		hunks = append(hunks, Hunk{OldStart: c.i1, OldCount: c.chg1, NewStart: c.i2, NewCount: c.chg2})
+	}
+	return hunks
+}
+
+// merger holds the lines of the three versions being merged, and the keys
+// they are compared by.
+type merger struct {
+	base, ours, theirs    []string
+	kBase, kOurs, kTheirs []string
+	opts                  MergeOptions
+	hunks                 []*mergeHunk
+}
+
+// Merge3 merges the changes ours and theirs made to base, the way git's
+// xdiff merges files: changes to different lines are combined, overlapping
+// changes are conflicts unless identical, and conflicts are narrowed down
+// to the lines the sides disagree on.
+//
+// Returns:
+//   - The merged content, with conflict markers around each conflict.
+//   - The number of conflicts.
+func Merge3(base string, ours string, theirs string, opts MergeOptions) (string, int) {
+	m := &merger{base: SplitLines(base), ours: SplitLines(ours), theirs: SplitLines(theirs), opts: opts}
+	if m.opts.MarkerSize <= 0 {
+		m.opts.MarkerSize = defaultMarkerSize
+	}
+	m.kBase, m.kOurs, m.kTheirs = m.base, m.ours, m.theirs
+	if opts.IgnoreSpaceChange {
+		m.kBase, m.kOurs, m.kTheirs = spaceChangeKeys(m.base), spaceChangeKeys(m.ours), spaceChangeKeys(m.theirs)
+	}
+	c1, c2 := changes(m.kBase, m.kOurs), changes(m.kBase, m.kTheirs)
+	if len(c1) == 0 {
+		return theirs, 0
+	}
+	if len(c2) == 0 {
+		return ours, 0
+	}
+	m.collect(c1, c2)
+	switch opts.Style {
+	case ConflictStyleZealousDiff3:
+		m.trimConflicts()
+	case ConflictStyleDiff3:
+	default:
+		m.refineConflicts()
+		m.simplifyNonConflicts()
+	}
+	return m.output()
+}
+
+// add records a hunk, joining it with the previous one when they overlap.
+func (m *merger) add(mode, i0, chg0, i1, chg1, i2, chg2 int) {
+	if n := len(m.hunks); n > 0 {
+		h := m.hunks[n-1]
+		if i1 <= h.i1+h.chg1 || i2 <= h.i2+h.chg2 {
+			if mode != h.mode {
+				h.mode = hunkConflict
+			}
+			h.chg0 = i0 + chg0 - h.i0
+			h.chg1 = i1 + chg1 - h.i1
+			h.chg2 = i2 + chg2 - h.i2
+			return
+		}
+	}
+	m.hunks = append(m.hunks, &mergeHunk{mode: mode, i0: i0, chg0: chg0, i1: i1, chg1: chg1, i2: i2, chg2: chg2})
+}
+
+// collect walks the changes of both sides in parallel and records which
+// side each changed region of the base is taken from.
+func (m *merger) collect(c1 []change, c2 []change) {
+	x, y := 0, 0
+	for x < len(c1) && y < len(c2) {
+		s1, s2 := c1[x], c2[y]
+		if s1.i1+s1.chg1 < s2.i1 {
+			m.add(hunkOurs, s1.i1, s1.chg1, s1.i2, s1.chg2, s2.i2-s2.i1+s1.i1, s1.chg1)
+			x++
+			continue
+		}
+		if s2.i1+s2.chg1 < s1.i1 {
+			m.add(hunkTheirs, s2.i1, s2.chg1, s1.i2-s1.i1+s2.i1, s2.chg1, s2.i2, s2.chg2)
+			y++
+			continue
+		}
+		if s1.i1 != s2.i1 || s1.chg1 != s2.chg1 || s1.chg2 != s2.chg2 ||
+			!equalLines(m.kOurs[s1.i2:s1.i2+s1.chg2], m.kTheirs[s2.i2:s2.i2+s2.chg2]) {
+			off := s1.i1 - s2.i1
+			ffo := off + s1.chg1 - s2.chg1
+			i0, i1, i2 := s1.i1, s1.i2, s2.i2
+			if off > 0 {
+				i0 -= off
+				i1 -= off
+			} else {
+				i2 += off
+			}
+			chg0 := s1.i1 + s1.chg1 - i0
+			chg1 := s1.i2 + s1.chg2 - i1
+			chg2 := s2.i2 + s2.chg2 - i2
+			if ffo < 0 {
+				chg0 -= ffo
+				chg1 -= ffo
+			} else {
+				chg2 += ffo
+			}
+			m.add(hunkConflict, i0, chg0, i1, chg1, i2, chg2)
+		}
+		e1, e2 := s1.i1+s1.chg1, s2.i1+s2.chg1
+		if e1 >= e2 {
+			y++
+		}
+		if e2 >= e1 {
+			x++
+		}
+	}
+	for ; x < len(c1); x++ {
+		s1 := c1[x]
+		m.add(hunkOurs, s1.i1, s1.chg1, s1.i2, s1.chg2, s1.i1+len(m.theirs)-len(m.base), s1.chg1)
+	}
+	for ; y < len(c2); y++ {
+		s2 := c2[y]
+		m.add(hunkTheirs, s2.i1, s2.chg1, s2.i1+len(m.ours)-len(m.base), s2.chg1, s2.i2, s2.chg2)
+	}
+}
+
+// spaceChangeKeys returns the lines with every run of whitespace turned into
+// a single space and trailing whitespace removed, for comparisons that
+// ignore changes in the amount of whitespace.
+func spaceChangeKeys(lines []string) []string {
+	keys := make([]string, len(lines))
+	for i, l := range lines {
+		keys[i] = strings.Join(strings.Fields(l), " ")
+		if l != "" && unicode.IsSpace(rune(l[0])) && keys[i] != "" {
+			keys[i] = " " + keys[i]
+		}
+	}
+	return keys
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// trimConflicts moves the lines both sides of a conflict start or end with
+// out of the conflict.
+func (m *merger) trimConflicts() {
+	for _, h := range m.hunks {
+		if h.mode != hunkConflict {
+			continue
+		}
+		for h.chg1 > 0 && h.chg2 > 0 && m.kOurs[h.i1] == m.kTheirs[h.i2] {
+			h.i1, h.i2 = h.i1+1, h.i2+1
+			h.chg1, h.chg2 = h.chg1-1, h.chg2-1
+		}
+		for h.chg1 > 0 && h.chg2 > 0 && m.kOurs[h.i1+h.chg1-1] == m.kTheirs[h.i2+h.chg2-1] {
+			h.chg1, h.chg2 = h.chg1-1, h.chg2-1
+		}
+	}
+}
+
+// refineConflicts compares both sides of each conflict and splits it into
+// the regions they actually differ in. Conflicts whose sides are identical
+// are resolved.
+func (m *merger) refineConflicts() {
+	refined := make([]*mergeHunk, 0, len(m.hunks))
+	for _, h := range m.hunks {
+		if h.mode != hunkConflict || h.chg1 == 0 || h.chg2 == 0 {
+			refined = append(refined, h)
+			continue
+		}
+		diffs := changes(m.kOurs[h.i1:h.i1+h.chg1], m.kTheirs[h.i2:h.i2+h.chg2])
+		if len(diffs) == 0 {
+			h.mode = hunkIdentical
+			refined = append(refined, h)
+			continue
+		}
+		for i, d := range diffs {
+			split := &mergeHunk{mode: hunkConflict, i1: h.i1 + d.i1, chg1: d.chg1, i2: h.i2 + d.i2, chg2: d.chg2}
+			if i == 0 {
+				split.i0, split.chg0 = h.i0, h.chg0
+			}
+			refined = append(refined, split)
+		}
+	}
+	m.hunks = refined
+}
+
+// simplifyNonConflicts joins conflicts separated by at most three lines:
+// one conflict is simpler to read and takes no more room.
+func (m *merger) simplifyNonConflicts() {
+	simplified := []*mergeHunk{}
+	for _, h := range m.hunks {
+		if n := len(simplified); n > 0 {
+			prev := simplified[n-1]
+			if prev.mode == hunkConflict && h.mode == hunkConflict && h.i1-(prev.i1+prev.chg1) <= 3 {
+				prev.chg1 = h.i1 + h.chg1 - prev.i1
+				prev.chg2 = h.i2 + h.chg2 - prev.i2
+				continue
+			}
+		}
+		simplified = append(simplified, h)
+	}
+	m.hunks = simplified
+}
+
+func (m *merger) output() (string, int) {
+	var b strings.Builder
+	conflicts, i := 0, 0
+	for _, h := range m.hunks {
+		if h.mode == hunkConflict {
+			switch m.opts.Favor {
+			case FavorOurs:
+				h.mode = hunkOurs
+			case FavorTheirs:
+				h.mode = hunkTheirs
+			}
+		}
+		switch {
+		case h.mode == hunkConflict:
+			conflicts++
+			cr := m.needsCR(h)
+			writeLines(&b, m.ours[i:h.i1], "", false)
+			m.marker(&b, '<', m.opts.Ours, cr)
+			writeLines(&b, m.ours[h.i1:h.i1+h.chg1], cr, true)
+			if m.opts.Style == ConflictStyleDiff3 || m.opts.Style == ConflictStyleZealousDiff3 {
+				m.marker(&b, '|', m.opts.Base, cr)
+				writeLines(&b, m.base[h.i0:h.i0+h.chg0], cr, true)
+			}
+			m.marker(&b, '=', "", cr)
+			writeLines(&b, m.theirs[h.i2:h.i2+h.chg2], cr, true)
+			m.marker(&b, '>', m.opts.Theirs, cr)
+		case h.mode == hunkOurs:
+			writeLines(&b, m.ours[i:h.i1+h.chg1], "", false)
+		case h.mode == hunkTheirs:
+			writeLines(&b, m.ours[i:h.i1], "", false)
+			writeLines(&b, m.theirs[h.i2:h.i2+h.chg2], "", false)
+		default:
+			continue
+		}
+		i = h.i1 + h.chg1
+	}
+	writeLines(&b, m.ours[i:], "", false)
+	return b.String(), conflicts
+}
+
+func (m *merger) marker(b *strings.Builder, c byte, label string, cr string) {
+	b.WriteString(strings.Repeat(string(c), m.opts.MarkerSize))
+	if label != "" {
+		fmt.Fprintf(b, " %s", label)
+	}
+	b.WriteString(cr + "\n")
+}
+
+// writeLines writes lines, terminating the last one when terminate is set
+// and it lacks a newline.
+func writeLines(b *strings.Builder, lines []string, cr string, terminate bool) {
+	for _, l := range lines {
+		b.WriteString(l)
+	}
+	if terminate && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		b.WriteString(cr + "\n")
+	}
+}
+
+// needsCR returns the line terminator to use for the conflict markers of
+// h: a carriage return when the lines around it end with CRLF.
+func (m *merger) needsCR(h *mergeHunk) string {
+	crlf := isCRLF(m.ours, max(h.i1-1, 0))
+	if crlf == 1 {
+		crlf = isCRLF(m.theirs, max(h.i2-1, 0))
+	}
+	if crlf == 1 {
+		crlf = isCRLF(m.base, 0)
+	}
+	if crlf == 1 {
+		return "\r"
+	}
+	return ""
+}
+
+// isCRLF reports whether line i of lines ends with CRLF: 1 if it does, 0
+// if it ends with LF only and -1 if it can not be told.
+func isCRLF(lines []string, i int) int {
+	ends := func(l string) int {
+		if strings.HasSuffix(l, "\r\n") {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case i < len(lines)-1:
+		return ends(lines[i])
+	case len(lines) == 0:
+		return -1
+	case strings.HasSuffix(lines[i], "\n"):
+		return ends(lines[i])
+	case i == 0:
+		return -1
+	}
+	return ends(lines[i-1])
+}
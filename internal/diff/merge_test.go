@@ -0,0 +1,112 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge3(t *testing.T) {
+	labels := func(style string) diff.MergeOptions {
+		return diff.MergeOptions{Style: style, Ours: "ours", Base: "base", Theirs: "theirs"}
+	}
+
+	// The expected results are those of git merge-file.
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		style     string
+		expected  string
+		conflicts int
+	}{
+		{
+			name: "Clean", base: "a\nb\nc\nd\ne\n", ours: "a\nB\nc\nd\ne\n", theirs: "a\nb\nc\nD\ne\n",
+			expected: "a\nB\nc\nD\ne\n",
+		},
+		{
+			name: "Identical", base: "a\nb\nc\n", ours: "a\nb2\nc\n", theirs: "a\nb2\nc\n",
+			expected: "a\nb2\nc\n",
+		},
+		{
+			name: "OneSide", base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nc\n",
+			expected: "a\nc\n",
+		},
+		{
+			name: "Refined", base: "1\n2\n3\n", ours: "A\ns1\ns2\ns3\ns4\nB\n", theirs: "C\ns1\ns2\ns3\ns4\nD\n",
+			expected:  "<<<<<<< ours\nA\n=======\nC\n>>>>>>> theirs\ns1\ns2\ns3\ns4\n<<<<<<< ours\nB\n=======\nD\n>>>>>>> theirs\n",
+			conflicts: 2,
+		},
+		{
+			name: "Simplified", base: "1\n2\n3\n4\n5\n", ours: "1\nx\ny\nsame\nz\n5\n", theirs: "1\nq\ny\nsame\nr\n5\n",
+			expected:  "1\n<<<<<<< ours\nx\ny\nsame\nz\n=======\nq\ny\nsame\nr\n>>>>>>> theirs\n5\n",
+			conflicts: 1,
+		},
+		{
+			name: "Diff3", base: "x\n1\ny\n", ours: "x\nS\nO\nE\ny\n", theirs: "x\nS\nT\nE\ny\n", style: diff.ConflictStyleDiff3,
+			expected:  "x\n<<<<<<< ours\nS\nO\nE\n||||||| base\n1\n=======\nS\nT\nE\n>>>>>>> theirs\ny\n",
+			conflicts: 1,
+		},
+		{
+			name: "ZealousDiff3", base: "x\n1\ny\n", ours: "x\nS\nO\nE\ny\n", theirs: "x\nS\nT\nE\ny\n", style: diff.ConflictStyleZealousDiff3,
+			expected:  "x\nS\n<<<<<<< ours\nO\n||||||| base\n1\n=======\nT\n>>>>>>> theirs\nE\ny\n",
+			conflicts: 1,
+		},
+		{
+			name: "MissingNewline", base: "a\nb\n", ours: "a\nb\nours", theirs: "a\nb\ntheirs", style: diff.ConflictStyleDiff3,
+			expected:  "a\nb\n<<<<<<< ours\nours\n||||||| base\n=======\ntheirs\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+		{
+			name: "CRLF", base: "a\r\nb\r\nc\r\n", ours: "a\r\nX\r\nc\r\n", theirs: "a\r\nY\r\nc\r\n",
+			expected:  "a\r\n<<<<<<< ours\r\nX\r\n=======\r\nY\r\n>>>>>>> theirs\r\nc\r\n",
+			conflicts: 1,
+		},
+		{
+			name: "Compacted", base: "c\ne\n", ours: "e\nc\ne\nh\ne\n", theirs: "e\nX\n",
+			expected:  "<<<<<<< ours\ne\nc\ne\nh\ne\n=======\ne\nX\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflicts := diff.Merge3(test.base, test.ours, test.theirs, labels(test.style))
+			assert.Equal(t, test.expected, merged)
+			assert.Equal(t, test.conflicts, conflicts)
+		})
+	}
+
+	t.Run("Favor", func(t *testing.T) {
+		for favor, expected := range map[string]string{
+			diff.FavorOurs:   "1\nO\n3\n4\nO5\n",
+			diff.FavorTheirs: "1\nT\n3\n4\nO5\n",
+		} {
+			merged, conflicts := diff.Merge3("1\n2\n3\n4\n5\n", "1\nO\n3\n4\nO5\n", "1\nT\n3\n4\n5\n", diff.MergeOptions{Favor: favor})
+			assert.Equal(t, expected, merged, favor)
+			assert.Zero(t, conflicts, favor)
+		}
+	})
+
+	t.Run("IgnoreSpaceChange", func(t *testing.T) {
+		// Their whitespace change gives way to our change, and our
+		// whitespace change to theirs.
+		merged, conflicts := diff.Merge3("a b\nc\nd\n", "a B\nc\nd \n", "a  b\nc\n  d\n", diff.MergeOptions{IgnoreSpaceChange: true})
+		assert.Equal(t, "a B\nc\n  d\n", merged, "leading whitespace is not a change in its amount")
+		assert.Zero(t, conflicts)
+
+		merged, conflicts = diff.Merge3("a b\nc\n", "a B\nc \n", "a  b\nc\t\n", diff.MergeOptions{IgnoreSpaceChange: true})
+		assert.Equal(t, "a B\nc \n", merged)
+		assert.Zero(t, conflicts)
+
+		merged, conflicts = diff.Merge3("a b\n", "a  b\n", "a c\n", diff.MergeOptions{IgnoreSpaceChange: true})
+		assert.Equal(t, "a c\n", merged)
+		assert.Zero(t, conflicts)
+	})
+
+	t.Run("MarkerSize", func(t *testing.T) {
+		merged, _ := diff.Merge3("a\n", "b\n", "c\n", diff.MergeOptions{MarkerSize: 3})
+		assert.Equal(t, "<<<\nb\n===\nc\n>>>\n", merged)
+	})
+}
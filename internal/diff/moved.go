@@ -0,0 +1,180 @@
+package diff
+
+import "fmt"
+
+// Modes of moved line detection.
+const (
+	MovedNo          = "no"
+	MovedDefault     = "default"
+	MovedPlain       = "plain"
+	MovedBlocks      = "blocks"
+	MovedZebra       = "zebra"
+	MovedDimmedZebra = "dimmed-zebra"
+)
+
+// movedMinAlnumSize is how many alphanumeric characters a block needs to be
+// marked as moved.
+const movedMinAlnumSize = 20
+
+// movedFlags marks added and deleted lines that belong to a moved block.
+type movedFlags int
+
+const (
+	movedLine movedFlags = 1 << iota
+	movedAlt
+	movedDimmed
+)
+
+// parseColorMoved validates a moved line mode. An empty mode disables the
+// detection and "default" selects zebra.
+func parseColorMoved(mode string) (string, error) {
+	switch mode {
+	case "":
+		return MovedNo, nil
+	case MovedDefault:
+		return MovedZebra, nil
+	case "dimmed_zebra":
+		return MovedDimmedZebra, nil
+	case MovedNo, MovedPlain, MovedBlocks, MovedZebra, MovedDimmedZebra:
+		return mode, nil
+	}
+	return "", fmt.Errorf("bad --color-moved argument: %s", mode)
+}
+
+// markMoved flags added lines that also appear as deleted lines and vice
+// versa. Except in plain mode, lines are grouped into blocks that were
+// moved together; blocks with less than 20 alphanumeric characters are
+// not marked, and adjacent blocks alternate between two colors.
+func (p *patch) markMoved(mode string) {
+	index := map[lineKind]map[string][]int{lineMinus: {}, linePlus: {}}
+	for n, l := range p.lines {
+		if l.kind == lineMinus || l.kind == linePlus {
+			index[l.kind][l.text] = append(index[l.kind][l.text], n)
+		}
+	}
+
+	var blocks []int
+	flipped := false
+	length := 0
+	movedKind := lineKind(-1)
+	for n := 0; n < len(p.lines); n++ {
+		l := &p.lines[n]
+		var matches []int
+		switch l.kind {
+		case linePlus:
+			matches = index[lineMinus][l.text]
+		case lineMinus:
+			matches = index[linePlus][l.text]
+		default:
+			flipped = false
+		}
+
+		if len(blocks) > 0 && (len(matches) == 0 || l.kind != movedKind) {
+			if !p.adjustLastBlock(mode, n, length) && length > 1 {
+				// Look for another block starting at the second line of
+				// the one that was dropped.
+				matches = nil
+				n -= length
+			}
+			blocks = nil
+			length = 0
+			flipped = false
+		}
+		if len(matches) == 0 {
+			movedKind = -1
+			continue
+		}
+		if mode == MovedPlain {
+			l.moved |= movedLine
+			continue
+		}
+
+		// Keep the candidate blocks the current line continues.
+		next := []int{}
+		for _, m := range blocks {
+			if m+1 < len(p.lines) && p.lines[m+1].kind == p.lines[m].kind && p.lines[m+1].text == l.text {
+				next = append(next, m+1)
+			}
+		}
+		blocks = next
+
+		if len(blocks) == 0 {
+			contiguous := p.adjustLastBlock(mode, n, length)
+			if !contiguous && length > 1 {
+				n -= length
+			} else {
+				blocks = append(blocks, matches...)
+			}
+			flipped = contiguous && len(blocks) > 0 && movedKind == l.kind && !flipped
+			movedKind = -1
+			if len(blocks) > 0 {
+				movedKind = l.kind
+			}
+			length = 0
+		}
+		if len(blocks) > 0 {
+			length++
+			l.moved |= movedLine
+			if flipped && mode != MovedBlocks {
+				l.moved |= movedAlt
+			}
+		}
+	}
+	p.adjustLastBlock(mode, len(p.lines), length)
+	if mode == MovedDimmedZebra {
+		p.dimMoved()
+	}
+}
+
+// adjustLastBlock unmarks the block of the length lines before line n if
+// it has too few alphanumeric characters to count as moved.
+//
+// Returns:
+//   - Whether the block is non-empty and stays marked.
+func (p *patch) adjustLastBlock(mode string, n int, length int) bool {
+	if mode == MovedPlain {
+		return length > 0
+	}
+	alnum := 0
+	for i := 1; i <= length; i++ {
+		for _, c := range []byte(p.lines[n-i].text) {
+			if isAlpha(c) || c >= '0' && c <= '9' {
+				alnum++
+				if alnum >= movedMinAlnumSize {
+					return true
+				}
+			}
+		}
+	}
+	for i := 1; i <= length; i++ {
+		p.lines[n-i].moved &^= movedLine
+	}
+	return false
+}
+
+// dimMoved dims the moved lines inside a block, keeping the lines at the
+// borders between two adjacent blocks highlighted.
+func (p *patch) dimMoved() {
+	isChange := func(n int) bool {
+		return n >= 0 && n < len(p.lines) && (p.lines[n].kind == lineMinus || p.lines[n].kind == linePlus)
+	}
+	zebra := movedLine | movedAlt
+	for n := range p.lines {
+		l := &p.lines[n]
+		if !isChange(n) || l.moved&movedLine == 0 {
+			continue
+		}
+		prev, next := isChange(n-1), isChange(n+1)
+		if prev && next && p.lines[n-1].moved&zebra == l.moved&zebra && p.lines[n+1].moved&zebra == l.moved&zebra {
+			l.moved |= movedDimmed
+			continue
+		}
+		if prev && p.lines[n-1].moved&movedLine != 0 && p.lines[n-1].moved&movedAlt != l.moved&movedAlt {
+			continue
+		}
+		if next && p.lines[n+1].moved&movedLine != 0 && p.lines[n+1].moved&movedAlt != l.moved&movedAlt {
+			continue
+		}
+		l.moved |= movedDimmed
+	}
+}
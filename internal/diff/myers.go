@@ -0,0 +1,169 @@
+package diff
+
+import "strings"
+
+// Operation is the kind of a single edit of an edit script.
+type Operation int
+
+const (
+	Equal Operation = iota
+	Insert
+	Delete
+)
+
+// Edit is one element of an edit script. OldIndex and NewIndex point into
+// the compared sequences and are -1 on the side the element is missing from.
+type Edit struct {
+	Op       Operation
+	OldIndex int
+	NewIndex int
+	Text     string
+}
+
+// SplitLines splits data into lines, keeping the line terminators.
+// The last line has no terminator when data does not end with a newline.
+func SplitLines(data string) []string {
+	if data == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(data, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compute returns a minimal edit script turning a into b, computed with
+// the linear space variant of Myers' algorithm. Inside a run of changes all
+// deletions come before the insertions.
+func Compute(a []string, b []string) []Edit {
+	ids := map[string]int{}
+	intern := func(s []string) []int {
+		result := make([]int, len(s))
+		for i, v := range s {
+			id, ok := ids[v]
+			if !ok {
+				id = len(ids)
+				ids[v] = id
+			}
+			result[i] = id
+		}
+		return result
+	}
+	m := &myers{a: intern(a), b: intern(b)}
+	m.compare(0, len(a), 0, len(b))
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for _, match := range append(m.matches, [2]int{len(a), len(b)}) {
+		for ; i < match[0]; i++ {
+			edits = append(edits, Edit{Op: Delete, OldIndex: i, NewIndex: -1, Text: a[i]})
+		}
+		for ; j < match[1]; j++ {
+			edits = append(edits, Edit{Op: Insert, OldIndex: -1, NewIndex: j, Text: b[j]})
+		}
+		if i < len(a) && j < len(b) {
+			edits = append(edits, Edit{Op: Equal, OldIndex: i, NewIndex: j, Text: a[i]})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// Count returns the number of inserted and deleted elements of an edit script.
+func Count(edits []Edit) (int, int) {
+	inserted, deleted := 0, 0
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			inserted++
+		case Delete:
+			deleted++
+		}
+	}
+	return inserted, deleted
+}
+
+type myers struct {
+	a       []int
+	b       []int
+	matches [][2]int
+}
+
+// compare records the matching elements of a[aLo:aHi] and b[bLo:bHi] in order.
+func (m *myers) compare(aLo int, aHi int, bLo int, bHi int) {
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		m.matches = append(m.matches, [2]int{aLo, bLo})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+
+	if aLo < aHi && bLo < bHi {
+		x, y, u, v := m.middleSnake(aLo, aHi, bLo, bHi)
+		m.compare(aLo, x, bLo, y)
+		for ; x < u; x, y = x+1, y+1 {
+			m.matches = append(m.matches, [2]int{x, y})
+		}
+		m.compare(u, aHi, v, bHi)
+	}
+
+	for i := 0; i < suffix; i++ {
+		m.matches = append(m.matches, [2]int{aHi + i, bHi + i})
+	}
+}
+
+// middleSnake finds the middle snake of an optimal path through the edit
+// graph of a[aLo:aHi] and b[bLo:bHi] and returns its start and end points.
+func (m *myers) middleSnake(aLo int, aHi int, bLo int, bHi int) (int, int, int, int) {
+	n, mm := aHi-aLo, bHi-bLo
+	limit := (n + mm + 1) / 2
+	delta := n - mm
+	odd := delta%2 != 0
+	offset := limit + 1
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := forward[offset+k-1] + 1
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < mm && m.a[aLo+x] == m.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && x+backward[offset+delta-k] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			x := backward[offset+k-1] + 1
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < mm && m.a[aHi-1-x] == m.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if !odd && delta-k >= -d && delta-k <= d && x+forward[offset+delta-k] >= n {
+				return aLo + n - x, bLo + mm - y, aLo + n - x0, bLo + mm - y0
+			}
+		}
+	}
+	// Unreachable: an optimal path has at most n+mm edits.
+	return aLo, bLo, aHi, bHi
+}
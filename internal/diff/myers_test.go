@@ -0,0 +1,99 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLines(t *testing.T) {
+	assert.Nil(t, diff.SplitLines(""))
+	assert.Equal(t, []string{"a\n", "b\n"}, diff.SplitLines("a\nb\n"))
+	assert.Equal(t, []string{"a\n", "b"}, diff.SplitLines("a\nb"))
+}
+
+// lcsLength computes the length of the longest common subsequence with the
+// quadratic dynamic programming algorithm.
+func lcsLength(a []string, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func apply(edits []diff.Edit) ([]string, []string) {
+	a, b := []string{}, []string{}
+	for _, e := range edits {
+		if e.Op != diff.Insert {
+			a = append(a, e.Text)
+		}
+		if e.Op != diff.Delete {
+			b = append(b, e.Text)
+		}
+	}
+	return a, b
+}
+
+func TestCompute(t *testing.T) {
+	t.Run("Simple", func(t *testing.T) {
+		a := strings.Split("a b c a b b a", " ")
+		b := strings.Split("c b a b a c", " ")
+		edits := diff.Compute(a, b)
+		inserted, deleted := diff.Count(edits)
+		assert.Equal(t, 2, inserted)
+		assert.Equal(t, 3, deleted)
+	})
+
+	t.Run("DeletesBeforeInserts", func(t *testing.T) {
+		edits := diff.Compute([]string{"a", "old", "c"}, []string{"a", "new", "c"})
+		ops := []diff.Operation{}
+		for _, e := range edits {
+			ops = append(ops, e.Op)
+		}
+		assert.Equal(t, []diff.Operation{diff.Equal, diff.Delete, diff.Insert, diff.Equal}, ops)
+		assert.Equal(t, 1, edits[1].OldIndex)
+		assert.Equal(t, 1, edits[2].NewIndex)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, diff.Compute(nil, nil))
+		inserted, deleted := diff.Count(diff.Compute(nil, []string{"a", "b"}))
+		assert.Equal(t, 2, inserted)
+		assert.Equal(t, 0, deleted)
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		random := func() []string {
+			s := make([]string, rng.Intn(30))
+			for i := range s {
+				s[i] = string(rune('a' + rng.Intn(4)))
+			}
+			return s
+		}
+		for i := 0; i < 500; i++ {
+			a, b := random(), random()
+			edits := diff.Compute(a, b)
+			gotA, gotB := apply(edits)
+			assert.Equal(t, a, append([]string{}, gotA...))
+			assert.Equal(t, b, append([]string{}, gotB...))
+			inserted, deleted := diff.Count(edits)
+			common := lcsLength(a, b)
+			assert.Equal(t, len(a)-common, deleted)
+			assert.Equal(t, len(b)-common, inserted)
+		}
+	})
+}
@@ -0,0 +1,400 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Modes of the word diff of FormatPatch.
+const (
+	WordDiffNone      = "none"
+	WordDiffPlain     = "plain"
+	WordDiffColor     = "color"
+	WordDiffPorcelain = "porcelain"
+)
+
+// PatchOptions controls FormatPatch. Context is the number of unchanged
+// lines shown around each change. WordDiff selects a word diff mode, with
+// WordRegex matching a single word instead of a run of non-whitespace.
+// ColorMoved selects how moved lines of a colored line diff are marked.
+type PatchOptions struct {
+	Context    int
+	Color      bool
+	WordDiff   string
+	WordRegex  string
+	ColorMoved string
+}
+
+const (
+	// abbrevLength is the length of the abbreviated object names of the
+	// index line.
+	abbrevLength = 7
+	// funcNameLength limits the function name shown in hunk headers.
+	funcNameLength = 80
+	devNull        = "/dev/null"
+)
+
+type lineKind int
+
+const (
+	lineMeta lineKind = iota
+	lineFrag
+	lineContext
+	lineMinus
+	linePlus
+	lineNoNewline
+	lineBinary
+	lineWords
+	lineWordsContext
+)
+
+// patchLine is a single line of patch output before it is colored. The
+// text of content lines excludes the leading sign and the newline; word
+// diff output is kept as a block of finished lines.
+type patchLine struct {
+	kind  lineKind
+	text  string
+	fn    string
+	moved movedFlags
+}
+
+type patch struct {
+	opts     PatchOptions
+	contents *contents
+	words    *regexp.Regexp
+	lines    []patchLine
+}
+
+// FormatPatch renders changes as a unified diff in git's format, with an
+// extended header per file describing renames, copies and mode changes.
+// Type changes are shown as a deletion followed by an addition.
+//
+// Returns:
+//   - The patch, one "diff --git" section per file.
+//   - An error if the content of a file can not be read, or if the word
+//     regex or the moved line mode is invalid.
+func FormatPatch(r ObjectReader, changes []Change, opts PatchOptions) (string, error) {
+	if opts.WordDiff == "" {
+		opts.WordDiff = WordDiffNone
+	}
+	switch opts.WordDiff {
+	case WordDiffNone, WordDiffPlain, WordDiffPorcelain:
+	case WordDiffColor:
+		opts.Color = true
+	default:
+		return "", fmt.Errorf("bad --word-diff argument: %s", opts.WordDiff)
+	}
+	moved, err := parseColorMoved(opts.ColorMoved)
+	if err != nil {
+		return "", err
+	}
+
+	p := &patch{opts: opts, contents: newContents(r)}
+	if opts.WordRegex != "" {
+		p.words, err = regexp.Compile("(?m)" + opts.WordRegex)
+		if err != nil {
+			return "", fmt.Errorf("invalid word regex %s: %w", opts.WordRegex, err)
+		}
+		p.words.Longest()
+	}
+
+	for _, c := range changes {
+		if c.Status == TypeChanged {
+			if err := p.file(Change{Status: Deleted, From: c.From}); err != nil {
+				return "", err
+			}
+			if err := p.file(Change{Status: Added, To: c.To}); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := p.file(c); err != nil {
+			return "", err
+		}
+	}
+	if opts.Color && opts.WordDiff == WordDiffNone && moved != MovedNo {
+		p.markMoved(moved)
+	}
+	return p.render(), nil
+}
+
+func (p *patch) add(kind lineKind, format string, a ...any) {
+	p.lines = append(p.lines, patchLine{kind: kind, text: fmt.Sprintf(format, a...)})
+}
+
+// file adds the header and the hunks of a single change.
+func (p *patch) file(c Change) error {
+	from, err := p.contents.read(c.From)
+	if err != nil {
+		return err
+	}
+	to, err := p.contents.read(c.To)
+	if err != nil {
+		return err
+	}
+
+	fromPath, toPath := c.From.Path, c.To.Path
+	if !c.From.Exists() {
+		fromPath = toPath
+	}
+	if !c.To.Exists() {
+		toPath = fromPath
+	}
+	p.add(lineMeta, "diff --git a/%s b/%s", fromPath, toPath)
+	switch {
+	case !c.From.Exists():
+		p.add(lineMeta, "new file mode %06s", c.To.Mode)
+	case !c.To.Exists():
+		p.add(lineMeta, "deleted file mode %06s", c.From.Mode)
+	case c.From.Mode != c.To.Mode:
+		p.add(lineMeta, "old mode %06s", c.From.Mode)
+		p.add(lineMeta, "new mode %06s", c.To.Mode)
+	}
+	switch c.Status {
+	case Renamed:
+		p.add(lineMeta, "similarity index %d%%", c.Score)
+		p.add(lineMeta, "rename from %s", c.From.Path)
+		p.add(lineMeta, "rename to %s", c.To.Path)
+	case Copied:
+		p.add(lineMeta, "similarity index %d%%", c.Score)
+		p.add(lineMeta, "copy from %s", c.From.Path)
+		p.add(lineMeta, "copy to %s", c.To.Path)
+	}
+	if c.From.Hash == c.To.Hash {
+		return nil
+	}
+	index := fmt.Sprintf("index %s..%s", abbrev(c.From), abbrev(c.To))
+	if c.From.Exists() && c.To.Exists() && c.From.Mode == c.To.Mode {
+		index += fmt.Sprintf(" %06s", c.From.Mode)
+	}
+	p.add(lineMeta, "%s", index)
+
+	fromLabel, toLabel := "a/"+fromPath, "b/"+toPath
+	if !c.From.Exists() {
+		fromLabel = devNull
+	}
+	if !c.To.Exists() {
+		toLabel = devNull
+	}
+	if IsBinary(from) || IsBinary(to) {
+		p.add(lineBinary, "Binary files %s and %s differ", fromLabel, toLabel)
+		return nil
+	}
+
+	old := SplitLines(from)
+	edits := CompactEdits(old, SplitLines(to))
+	if inserted, deleted := Count(edits); inserted+deleted == 0 {
+		return nil
+	}
+	p.add(lineMeta, "--- %s", fromLabel)
+	p.add(lineMeta, "+++ %s", toLabel)
+	p.hunks(edits, old)
+	return nil
+}
+
+func abbrev(f File) string {
+	if !f.Exists() {
+		return nullHash[:abbrevLength]
+	}
+	return f.Hash[:min(abbrevLength, len(f.Hash))]
+}
+
+// hunks groups the edits into hunks with the requested number of context
+// lines. Changes separated by at most twice the context share a hunk.
+func (p *patch) hunks(edits []Edit, old []string) {
+	ctx := max(p.opts.Context, 0)
+	oldPos := make([]int, len(edits)+1)
+	newPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if e.Op != Insert {
+			oldPos[i+1]++
+		}
+		if e.Op != Delete {
+			newPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != Equal {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].Op == Equal {
+				next++
+			}
+			if next == len(edits) || next-end > 2*ctx {
+				break
+			}
+			end = next
+		}
+		start := max(i-ctx, 0)
+		stop := min(end+ctx, len(edits))
+
+		oldCount := oldPos[stop] - oldPos[start]
+		newCount := newPos[stop] - newPos[start]
+		p.lines = append(p.lines, patchLine{
+			kind: lineFrag,
+			text: fmt.Sprintf("@@ -%s +%s @@", hunkRange(oldPos[start], oldCount), hunkRange(newPos[start], newCount)),
+			fn:   funcName(old, oldPos[start]),
+		})
+		if p.opts.WordDiff == WordDiffNone {
+			p.lineHunk(edits[start:stop])
+		} else {
+			p.wordHunk(edits[start:stop])
+		}
+		i = stop
+	}
+}
+
+// hunkRange formats one side of a hunk header. An empty range names the
+// line before it, a single line omits the count.
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// funcName finds the line shown after a hunk header: the closest line
+// before the hunk that starts with a letter, an underscore or a dollar sign.
+func funcName(old []string, start int) string {
+	for i := start - 1; i >= 0; i-- {
+		line := old[i]
+		if line == "" || !(isAlpha(line[0]) || line[0] == '_' || line[0] == '$') {
+			continue
+		}
+		line = line[:min(len(line), funcNameLength)]
+		return strings.TrimRight(line, " \t\n\v\f\r")
+	}
+	return ""
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func (p *patch) lineHunk(edits []Edit) {
+	for _, e := range edits {
+		kind := lineContext
+		switch e.Op {
+		case Delete:
+			kind = lineMinus
+		case Insert:
+			kind = linePlus
+		}
+		p.lines = append(p.lines, patchLine{kind: kind, text: strings.TrimSuffix(e.Text, "\n")})
+		if !strings.HasSuffix(e.Text, "\n") {
+			p.lines = append(p.lines, patchLine{kind: lineNoNewline, text: `\ No newline at end of file`})
+		}
+	}
+}
+
+// render turns the collected lines into the final output.
+func (p *patch) render() string {
+	var b strings.Builder
+	reset := ""
+	if p.opts.Color {
+		reset = colorReset
+	}
+	emit := func(set string, text string) {
+		if p.opts.Color {
+			b.WriteString(set)
+		}
+		b.WriteString(text)
+		b.WriteString(reset)
+		b.WriteByte('\n')
+	}
+
+	for _, l := range p.lines {
+		switch l.kind {
+		case lineMeta:
+			emit(colorMeta, l.text)
+		case lineFrag:
+			if p.opts.Color {
+				b.WriteString(colorFrag)
+			}
+			b.WriteString(l.text)
+			b.WriteString(reset)
+			if l.fn != "" {
+				b.WriteString(" " + reset + l.fn + reset)
+			}
+			b.WriteByte('\n')
+		case lineContext:
+			emit("", " "+l.text)
+		case lineMinus:
+			emit(oldColor(l.moved), "-"+l.text)
+		case linePlus:
+			if !p.opts.Color {
+				emit("", "+"+l.text)
+				continue
+			}
+			set := newColor(l.moved)
+			b.WriteString(set + "+" + reset)
+			writeWhitespaceErrors(&b, l.text, set)
+			b.WriteByte('\n')
+		case lineNoNewline:
+			emit("", l.text)
+		case lineBinary:
+			b.WriteString(l.text + "\n")
+		case lineWords:
+			b.WriteString(l.text)
+		case lineWordsContext:
+			switch {
+			case p.opts.WordDiff == WordDiffPorcelain:
+				emit("", " "+l.text)
+				b.WriteString("~\n")
+			case l.text == "":
+				b.WriteByte('\n')
+			default:
+				emit("", l.text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeWhitespaceErrors writes an added line the way git colors it: the
+// indentation is left plain, spaces before a tab and trailing whitespace
+// are highlighted as errors.
+func writeWhitespaceErrors(b *strings.Builder, text string, set string) {
+	trailing := len(text)
+	for trailing > 0 && isSpace(text[trailing-1]) {
+		trailing--
+	}
+	written := 0
+	for i := 0; i < trailing; i++ {
+		if text[i] == ' ' {
+			continue
+		}
+		if text[i] != '\t' {
+			break
+		}
+		if written < i {
+			b.WriteString(colorWhitespace + text[written:i] + colorReset + "\t")
+		} else {
+			b.WriteString(text[written : i+1])
+		}
+		written = i + 1
+	}
+	if trailing > written {
+		b.WriteString(set + text[written:trailing] + colorReset)
+	}
+	if trailing < len(text) {
+		b.WriteString(colorWhitespace + text[trailing:] + colorReset)
+	}
+}
@@ -0,0 +1,216 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPatch(t *testing.T) {
+	m := memStore{}
+	from := m.tree(map[string]string{
+		"a.go": "func one() {\n\treturn 1\n}\n\nfunc two() {\n\ta := 1\n\tb := 2\n\treturn a + b\n}\n",
+		"gone": "bye\n",
+	})
+	to := m.tree(map[string]string{
+		"a.go": "func one() {\n\treturn 1\n}\n\nfunc two() {\n\ta := 1\n\tb := 3\n\treturn a + b\n}\n",
+		"new":  "x",
+	})
+	changes, err := diff.TreeDiff(m, from, to, nil)
+	assert.NoError(t, err)
+
+	removed := "diff --git a/gone b/gone\n" +
+		"deleted file mode 100644\n" +
+		"index b023018..0000000\n" +
+		"--- a/gone\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n"
+	added := "diff --git a/new b/new\n" +
+		"new file mode 100644\n" +
+		"index 0000000..c1b0730\n" +
+		"--- /dev/null\n" +
+		"+++ b/new\n" +
+		"@@ -0,0 +1 @@\n"
+	header := "diff --git a/a.go b/a.go\n" +
+		"index 7057859..c593682 100644\n" +
+		"--- a/a.go\n" +
+		"+++ b/a.go\n"
+
+	t.Run("Lines", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3})
+		assert.NoError(t, err)
+		expected := header +
+			"@@ -4,6 +4,6 @@ func one() {\n" +
+			" \n" +
+			" func two() {\n" +
+			" \ta := 1\n" +
+			"-\tb := 2\n" +
+			"+\tb := 3\n" +
+			" \treturn a + b\n" +
+			" }\n" +
+			removed + "-bye\n" +
+			added + "+x\n\\ No newline at end of file\n"
+		assert.Equal(t, expected, out)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes[:1], diff.PatchOptions{Context: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, header+"@@ -6,3 +6,3 @@ func two() {\n \ta := 1\n-\tb := 2\n+\tb := 3\n \treturn a + b\n", out)
+	})
+
+	t.Run("WordDiffPorcelain", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, WordDiff: diff.WordDiffPorcelain})
+		assert.NoError(t, err)
+		expected := header +
+			"@@ -4,6 +4,6 @@ func one() {\n" +
+			" \n~\n" +
+			" func two() {\n~\n" +
+			" \ta := 1\n~\n" +
+			" \tb := \n-2\n+3\n~\n" +
+			" \treturn a + b\n~\n" +
+			" }\n~\n" +
+			removed + "-bye\n~\n" +
+			added + "+x\n~\n"
+		assert.Equal(t, expected, out)
+	})
+
+	t.Run("WordDiffRegex", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, WordDiff: diff.WordDiffPlain, WordRegex: "."})
+		assert.NoError(t, err)
+		expected := header +
+			"@@ -4,6 +4,6 @@ func one() {\n" +
+			"\n" +
+			"func two() {\n" +
+			"\ta := 1\n" +
+			"\tb := [-2-]{+3+}\n" +
+			"\treturn a + b\n" +
+			"}\n" +
+			removed + "[-bye-]\n" +
+			added + "{+x+}\n"
+		assert.Equal(t, expected, out)
+	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		_, err := diff.FormatPatch(m, changes, diff.PatchOptions{WordDiff: "words"})
+		assert.Error(t, err)
+		_, err = diff.FormatPatch(m, changes, diff.PatchOptions{WordDiff: diff.WordDiffPlain, WordRegex: "("})
+		assert.Error(t, err)
+		_, err = diff.FormatPatch(m, changes, diff.PatchOptions{ColorMoved: "rainbow"})
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatPatchHeaders(t *testing.T) {
+	m := memStore{}
+	from := m.tree(map[string]string{
+		"bin":     "\x00\x01abc",
+		"old.txt": lines(20, "rename me"),
+		"run.sh":  "echo hi\n",
+	})
+	to := m.tree(map[string]string{
+		"bin":       "\x00\x01abcd",
+		"new.txt":   lines(20, "rename me"),
+		"run.sh@x":  "echo hi\n",
+		"empty.txt": "",
+	})
+	changes, err := diff.TreeDiff(m, from, to, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	assert.NoError(t, err)
+
+	out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3})
+	assert.NoError(t, err)
+	expected := "diff --git a/bin b/bin\n" +
+		"index 9fc36a0..6ec61e8 100644\n" +
+		"Binary files a/bin and b/bin differ\n" +
+		"diff --git a/empty.txt b/empty.txt\n" +
+		"new file mode 100644\n" +
+		"index 0000000..e69de29\n" +
+		"diff --git a/old.txt b/new.txt\n" +
+		"similarity index 100%\n" +
+		"rename from old.txt\n" +
+		"rename to new.txt\n" +
+		"diff --git a/run.sh b/run.sh\n" +
+		"old mode 100644\n" +
+		"new mode 100755\n"
+	assert.Equal(t, expected, out)
+}
+
+// The hunks below are git diff-tree -p's.
+func TestFormatPatchEditScript(t *testing.T) {
+	hunks := func(t *testing.T, from string, to string) string {
+		m := memStore{}
+		changes, err := diff.TreeDiff(m, m.tree(map[string]string{"f": from}), m.tree(map[string]string{"f": to}), nil)
+		assert.NoError(t, err)
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3})
+		assert.NoError(t, err)
+		return out[strings.Index(out, "@@"):]
+	}
+
+	t.Run("IndentHeuristic", func(t *testing.T) {
+		out := hunks(t, "{\n{\n{\n        q()\n{\n", "{\n        q()\n{\n")
+		assert.Equal(t, "@@ -1,5 +1,3 @@\n-{\n-{\n {\n         q()\n {\n", out)
+	})
+
+	t.Run("UnmatchedLines", func(t *testing.T) {
+		out := hunks(t, "a\n{\n\tx;\n\ty;\n", "a\n\tx;\nb\n{\n{\n")
+		assert.Equal(t, "@@ -1,4 +1,5 @@\n a\n-{\n \tx;\n-\ty;\n+b\n+{\n+{\n", out)
+	})
+
+	t.Run("Split", func(t *testing.T) {
+		out := hunks(t, "b\n        q()\na\nint f()\n", "{\nb\n        q()\nint f()\na\n")
+		assert.Equal(t, "@@ -1,4 +1,5 @@\n+{\n b\n         q()\n-a\n int f()\n+a\n", out)
+	})
+}
+
+func TestFormatPatchColor(t *testing.T) {
+	m := memStore{}
+	block := "first moved line with words\nsecond moved line with words\n"
+	middle := "middle one\nmiddle two\nmiddle three\n"
+	from := m.tree(map[string]string{"f": "head\n" + block + middle + "tail\n"})
+	to := m.tree(map[string]string{"f": "head\n" + middle + block + "tail  \n"})
+	changes, err := diff.TreeDiff(m, from, to, nil)
+	assert.NoError(t, err)
+
+	t.Run("Lines", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, Color: true})
+		assert.NoError(t, err)
+		assert.Contains(t, out, "\033[36m@@ -1,7 +1,7 @@\033[m\n")
+		assert.Contains(t, out, "\033[31m-first moved line with words\033[m\n")
+		assert.Contains(t, out, "\033[32m+\033[m\033[32mfirst moved line with words\033[m\n")
+		assert.Contains(t, out, "\033[32m+\033[m\033[32mtail\033[m\033[41m  \033[m\n")
+	})
+
+	t.Run("Moved", func(t *testing.T) {
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, Color: true, ColorMoved: diff.MovedDefault})
+		assert.NoError(t, err)
+		assert.Contains(t, out, "\033[1;35m-first moved line with words\033[m\n")
+		assert.Contains(t, out, "\033[1;36m+\033[m\033[1;36msecond moved line with words\033[m\n")
+		assert.Contains(t, out, "\033[31m-tail\033[m\n")
+	})
+
+	t.Run("MovedShortBlock", func(t *testing.T) {
+		from := m.tree(map[string]string{"f": "a\nb\nc\nd\n"})
+		to := m.tree(map[string]string{"f": "b\na\nc\nd\n"})
+		changes, err := diff.TreeDiff(m, from, to, nil)
+		assert.NoError(t, err)
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, Color: true, ColorMoved: diff.MovedBlocks})
+		assert.NoError(t, err)
+		assert.NotContains(t, out, "\033[1;3")
+
+		out, err = diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, Color: true, ColorMoved: diff.MovedPlain})
+		assert.NoError(t, err)
+		assert.Contains(t, out, "\033[1;35m-a\033[m\n")
+	})
+
+	t.Run("WordDiff", func(t *testing.T) {
+		from := m.tree(map[string]string{"f": "foo bar baz\n"})
+		to := m.tree(map[string]string{"f": "foo qux baz\n"})
+		changes, err := diff.TreeDiff(m, from, to, nil)
+		assert.NoError(t, err)
+		out, err := diff.FormatPatch(m, changes, diff.PatchOptions{Context: 3, WordDiff: diff.WordDiffColor})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasSuffix(out, "\033[36m@@ -1 +1 @@\033[m\nfoo \033[31mbar\033[m\033[32mqux\033[m baz\n"))
+	})
+}
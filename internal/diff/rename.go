@@ -0,0 +1,234 @@
+package diff
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRenameScore is the minimum similarity used when -M or -C are given
+// without an explicit score.
+const DefaultRenameScore = 50
+
+const (
+	// maxChunk is the longest chunk of content hashed when estimating similarity.
+	maxChunk = 64
+	// hashBase is the modulus of the chunk hashes, as used by git.
+	hashBase = 107927
+)
+
+// ParseScore parses a similarity score the way git does: digits followed by
+// a percent sign are a percentage, bare digits are the decimal fraction after
+// "0.", so "5" and "50%" both mean fifty percent.
+//
+// Returns:
+//   - The score as a percentage.
+//   - An error if the score is not a number or exceeds one hundred percent.
+func ParseScore(s string) (int, error) {
+	if s == "" {
+		return DefaultRenameScore, nil
+	}
+	if strings.HasSuffix(s, "%") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || n < 0 || n > 100 {
+			return 0, fmt.Errorf("invalid similarity score %s", s)
+		}
+		return n, nil
+	}
+	if _, err := strconv.Atoi(s); err != nil {
+		return 0, fmt.Errorf("invalid similarity score %s", s)
+	}
+	fraction, err := strconv.ParseFloat("0."+s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid similarity score %s", s)
+	}
+	return int(fraction*100 + 0.5), nil
+}
+
+// Similarity estimates how much of src is kept in dst, as a percentage.
+// Like git's diffcore-delta, both contents are split into lines of at most
+// 64 bytes and the bytes of the chunks found on both sides are counted.
+func Similarity(src string, dst string) int {
+	size := max(len(src), len(dst))
+	if size == 0 {
+		return 100
+	}
+	copied, _ := countChanges(src, dst)
+	return copied * 100 / size
+}
+
+// countChanges counts the bytes of src that are found again in dst and the
+// bytes of dst that are new.
+func countChanges(src string, dst string) (int, int) {
+	srcChunks := chunks(src)
+	copied, added := 0, 0
+	for hash, n := range chunks(dst) {
+		copied += min(n, srcChunks[hash])
+		added += max(n-srcChunks[hash], 0)
+	}
+	return copied, added
+}
+
+// chunks returns the number of bytes of data per chunk hash. Chunks end
+// after a newline or 64 bytes, an unterminated last chunk is not counted and
+// carriage returns before a newline of text content are ignored. The rolling hash is the one git uses, so that
+// similarity scores match git's, hash collisions included.
+func chunks(data string) map[uint32]int {
+	counts := map[uint32]int{}
+	text := !IsBinary(data)
+	var accum1, accum2 uint32
+	n := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if text && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+		old := accum1
+		accum1 = (accum1 << 7) ^ (accum2 >> 25)
+		accum2 = (accum2 << 7) ^ (old >> 25)
+		accum1 += uint32(c)
+		n++
+		if n < maxChunk && c != '\n' {
+			continue
+		}
+		counts[(accum1+accum2*0x61)%hashBase] += n
+		n, accum1, accum2 = 0, 0, 0
+	}
+	return counts
+}
+
+type renameSource struct {
+	file     File
+	deletion int
+	used     bool
+}
+
+type renameCandidate struct {
+	dst   int
+	src   int
+	score int
+}
+
+// detectRenames pairs added files with deleted files, and with -C also with
+// modified and unchanged files, whose content is similar enough.
+func detectRenames(r ObjectReader, changes []Change, unchanged []File, opts *Options) ([]Change, error) {
+	sources := []*renameSource{}
+	dsts := []int{}
+	for i, c := range changes {
+		switch {
+		case c.Status == Added && c.To.Mode != objects.ModeGitlink:
+			dsts = append(dsts, i)
+		case c.Status == Deleted && c.From.Mode != objects.ModeGitlink:
+			sources = append(sources, &renameSource{file: c.From, deletion: i})
+		case opts.Copies && (c.Status == Modified || c.Status == TypeChanged):
+			sources = append(sources, &renameSource{file: c.From, deletion: -1})
+		}
+	}
+	if opts.Copies {
+		for _, f := range unchanged {
+			sources = append(sources, &renameSource{file: f, deletion: -1})
+		}
+	}
+	if len(dsts) == 0 || len(sources) == 0 {
+		return changes, nil
+	}
+
+	paired := map[int]Change{}
+	pair := func(dst int, src *renameSource, score int) bool {
+		status := Copied
+		if src.deletion >= 0 && !src.used {
+			status = Renamed
+			src.used = true
+		} else if !opts.Copies {
+			return false
+		}
+		paired[dst] = Change{Status: status, Score: score, From: src.file, To: changes[dst].To}
+		return true
+	}
+
+	// Exact renames first, preferring sources with the same base name.
+	for _, dst := range dsts {
+		to := changes[dst].To
+		var best *renameSource
+		for _, src := range sources {
+			if src.file.Hash != to.Hash || kind(src.file.Mode) != kind(to.Mode) {
+				continue
+			}
+			if src.used && !opts.Copies {
+				continue
+			}
+			if best == nil || (best.used && !src.used) ||
+				(best.used == src.used && path.Base(src.file.Path) == path.Base(to.Path) && path.Base(best.file.Path) != path.Base(to.Path)) {
+				best = src
+			}
+		}
+		if best != nil {
+			pair(dst, best, 100)
+		}
+	}
+
+	files := newContents(r)
+	candidates := []renameCandidate{}
+	for di, dst := range dsts {
+		if _, ok := paired[dst]; ok {
+			continue
+		}
+		to := changes[dst].To
+		dstData, err := files.read(to)
+		if err != nil {
+			return nil, err
+		}
+		for si, src := range sources {
+			if kind(src.file.Mode) != kind(to.Mode) || (src.used && !opts.Copies) {
+				continue
+			}
+			srcData, err := files.read(src.file)
+			if err != nil {
+				return nil, err
+			}
+			if len(srcData) == 0 || len(dstData) == 0 {
+				continue
+			}
+			size := max(len(srcData), len(dstData))
+			delta := size - min(len(srcData), len(dstData))
+			if size*(100-opts.RenameScore) < delta*100 {
+				continue
+			}
+			score := Similarity(srcData, dstData)
+			if score >= opts.RenameScore {
+				candidates = append(candidates, renameCandidate{dst: di, src: si, score: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, c := range candidates {
+		dst := dsts[c.dst]
+		if _, ok := paired[dst]; ok {
+			continue
+		}
+		pair(dst, sources[c.src], c.score)
+	}
+
+	consumed := map[int]bool{}
+	for _, src := range sources {
+		if src.used {
+			consumed[src.deletion] = true
+		}
+	}
+	result := make([]Change, 0, len(changes))
+	for i, c := range changes {
+		if consumed[i] {
+			continue
+		}
+		if p, ok := paired[i]; ok {
+			c = p
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
@@ -0,0 +1,133 @@
+package diff_test
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScore(t *testing.T) {
+	type scoreTest struct {
+		Value  string
+		Result int
+	}
+	tests := []scoreTest{
+		{Value: "", Result: 50},
+		{Value: "50%", Result: 50},
+		{Value: "5", Result: 50},
+		{Value: "75", Result: 75},
+		{Value: "05", Result: 5},
+		{Value: "100%", Result: 100},
+	}
+	for _, test := range tests {
+		t.Run(test.Value, func(t *testing.T) {
+			score, err := diff.ParseScore(test.Value)
+			assert.NoError(t, err)
+			assert.Equal(t, test.Result, score)
+		})
+	}
+
+	for _, value := range []string{"abc", "120%", "-5%"} {
+		t.Run(value, func(t *testing.T) {
+			_, err := diff.ParseScore(value)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 100, diff.Similarity("a\nb\n", "a\nb\n"))
+	assert.Equal(t, 0, diff.Similarity("a\n", "b\n"))
+	assert.Equal(t, 50, diff.Similarity("aaa\nbbb\n", "aaa\nccc\n"))
+}
+
+func lines(n int, prefix string) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(prefix)
+		b.WriteString(strings.Repeat("x", i%7))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestDetectRenames(t *testing.T) {
+	m := memStore{}
+	content := lines(20, "line")
+	edited := strings.Replace(content, "linex\n", "changed\n", 1)
+
+	t.Run("ExactRename", func(t *testing.T) {
+		from := m.tree(map[string]string{"a/file.txt": content})
+		to := m.tree(map[string]string{"b/file.txt": content})
+		changes, err := diff.TreeDiff(m, from, to, &diff.Options{Renames: true, RenameScore: 50})
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+		assert.Equal(t, diff.Renamed, changes[0].Status)
+		assert.Equal(t, 100, changes[0].Score)
+		assert.Equal(t, "a/file.txt", changes[0].From.Path)
+		assert.Equal(t, "b/file.txt", changes[0].To.Path)
+	})
+
+	t.Run("InexactRename", func(t *testing.T) {
+		from := m.tree(map[string]string{"old.txt": content})
+		to := m.tree(map[string]string{"new.txt": edited})
+		changes, err := diff.TreeDiff(m, from, to, &diff.Options{Renames: true, RenameScore: 50})
+		assert.NoError(t, err)
+		score := diff.Similarity(content, edited)
+		assert.Less(t, score, 100)
+		assert.Equal(t, []string{fmt.Sprintf("R%03d new.txt", score)}, statuses(changes))
+	})
+
+	t.Run("BelowThreshold", func(t *testing.T) {
+		from := m.tree(map[string]string{"old.txt": content})
+		to := m.tree(map[string]string{"new.txt": edited})
+		changes, err := diff.TreeDiff(m, from, to, &diff.Options{Renames: true, RenameScore: 100})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"A new.txt", "D old.txt"}, statuses(changes))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		from := m.tree(map[string]string{"old.txt": content})
+		to := m.tree(map[string]string{"new.txt": content})
+		changes, err := diff.TreeDiff(m, from, to, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"A new.txt", "D old.txt"}, statuses(changes))
+	})
+
+	t.Run("CopyFromModified", func(t *testing.T) {
+		from := m.tree(map[string]string{"orig.txt": content})
+		to := m.tree(map[string]string{"orig.txt": content + "more\n", "copy.txt": content})
+		changes, err := diff.TreeDiff(m, from, to, &diff.Options{Copies: true, RenameScore: 50})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"C100 copy.txt", "M orig.txt"}, statuses(changes))
+	})
+
+	t.Run("CopyFromUnchanged", func(t *testing.T) {
+		from := m.tree(map[string]string{"orig.txt": content})
+		to := m.tree(map[string]string{"orig.txt": content, "copy.txt": edited})
+		opts := &diff.Options{Copies: true, RenameScore: 50}
+		changes, err := diff.TreeDiff(m, from, to, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"A copy.txt"}, statuses(changes))
+
+		opts.FindCopiesHarder = true
+		changes, err = diff.TreeDiff(m, from, to, opts)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+		assert.Equal(t, diff.Copied, changes[0].Status)
+		assert.Equal(t, "orig.txt", changes[0].From.Path)
+	})
+
+	t.Run("RenameAndCopy", func(t *testing.T) {
+		from := m.tree(map[string]string{"orig.txt": content})
+		to := m.tree(map[string]string{"one.txt": content, "two.txt": content})
+		changes, err := diff.TreeDiff(m, from, to, &diff.Options{Copies: true, RenameScore: 50})
+		assert.NoError(t, err)
+		assert.Len(t, changes, 2)
+		kinds := []diff.Status{changes[0].Status, changes[1].Status}
+		assert.ElementsMatch(t, []diff.Status{diff.Renamed, diff.Copied}, kinds)
+	})
+}
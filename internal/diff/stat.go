@@ -0,0 +1,273 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FileStat holds the number of inserted and deleted lines of a changed file.
+// For binary files Added and Deleted are the sizes of the new and the old
+// content in bytes.
+type FileStat struct {
+	Name    string
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// StatOptions controls the layout of FormatStat. Zero values select the
+// defaults: 80 columns, no name or graph limit and every file shown.
+type StatOptions struct {
+	Width      int
+	NameWidth  int
+	GraphWidth int
+	Count      int
+}
+
+const defaultStatWidth = 80
+
+// Stats counts the inserted and deleted lines of each change.
+//
+// Returns:
+//   - One FileStat per change, in the order of the changes.
+//   - An error if the content of a file can not be read.
+func Stats(r ObjectReader, changes []Change) ([]FileStat, error) {
+	files := newContents(r)
+	stats := make([]FileStat, 0, len(changes))
+	for _, c := range changes {
+		from, err := files.read(c.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := files.read(c.To)
+		if err != nil {
+			return nil, err
+		}
+
+		stat := FileStat{Name: c.displayName()}
+		switch {
+		case IsBinary(from) || IsBinary(to):
+			stat.Binary = true
+			stat.Added = len(to)
+			stat.Deleted = len(from)
+		case c.From.Hash != c.To.Hash:
+			stat.Added, stat.Deleted = Count(CompactEdits(SplitLines(from), SplitLines(to)))
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// displayName returns the name a change is shown under in stat output.
+func (c Change) displayName() string {
+	if c.Status == Renamed || c.Status == Copied {
+		return RenameName(c.From.Path, c.To.Path)
+	}
+	return c.Path()
+}
+
+// RenameName abbreviates a rename the way git prints it, factoring out the
+// leading and trailing directories both paths share: "a/{b => c}/d".
+func RenameName(from string, to string) string {
+	prefix := 0
+	for i := 0; i < len(from) && i < len(to) && from[i] == to[i]; i++ {
+		if from[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// at returns the byte at i, treating the end of the string as a NUL.
+	at := func(s string, i int) byte {
+		if i >= len(s) {
+			return 0
+		}
+		return s[i]
+	}
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	i, j := len(from), len(to)
+	for i >= prefix-adjust && j >= prefix-adjust && at(from, i) == at(to, j) {
+		if at(from, i) == '/' {
+			suffix = len(from) - i
+		}
+		i--
+		j--
+	}
+
+	fromMid := max(len(from)-prefix-suffix, 0)
+	toMid := max(len(to)-prefix-suffix, 0)
+	if prefix+suffix == 0 {
+		return from + " => " + to
+	}
+	return from[:prefix] + "{" + from[prefix:prefix+fromMid] + " => " + to[prefix:prefix+toMid] + "}" + from[len(from)-suffix:]
+}
+
+// FormatNumstat renders the machine readable per file statistics:
+// inserted lines, deleted lines and the name separated by tabs. Binary
+// files show "-" instead of line counts.
+func FormatNumstat(stats []FileStat) string {
+	var b strings.Builder
+	for _, s := range stats {
+		if s.Binary {
+			fmt.Fprintf(&b, "-\t-\t%s\n", s.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%d\t%d\t%s\n", s.Added, s.Deleted, s.Name)
+	}
+	return b.String()
+}
+
+// FormatShortstat renders the summary line with the number of changed files,
+// insertions and deletions.
+func FormatShortstat(stats []FileStat) string {
+	files, insertions, deletions := len(stats), 0, 0
+	for _, s := range stats {
+		if !s.Binary {
+			insertions += s.Added
+			deletions += s.Deleted
+		}
+	}
+	if files == 0 {
+		return " 0 files changed\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, " %d %s changed", files, plural(files, "file", "files"))
+	if insertions > 0 || deletions == 0 {
+		fmt.Fprintf(&b, ", %d %s(+)", insertions, plural(insertions, "insertion", "insertions"))
+	}
+	if deletions > 0 || insertions == 0 {
+		fmt.Fprintf(&b, ", %d %s(-)", deletions, plural(deletions, "deletion", "deletions"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func plural(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// FormatStat renders the per file statistics as a histogram followed by the
+// summary line. Names and graphs are scaled down to fit the width the way
+// git's --stat does.
+func FormatStat(stats []FileStat, opts StatOptions) string {
+	if len(stats) == 0 {
+		return ""
+	}
+	shown := stats
+	if opts.Count > 0 && opts.Count < len(stats) {
+		shown = stats[:opts.Count]
+	}
+
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for _, s := range shown {
+		maxLen = max(maxLen, len(s.Name))
+		if s.Binary {
+			binWidth = max(binWidth, 14+len(strconv.Itoa(s.Added))+len(strconv.Itoa(s.Deleted)))
+			numberWidth = 3
+			continue
+		}
+		maxChange = max(maxChange, s.Added+s.Deleted)
+	}
+
+	width := opts.Width
+	if width <= 0 {
+		width = defaultStatWidth
+	}
+	numberWidth = max(numberWidth, len(strconv.Itoa(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	if opts.GraphWidth > 0 && opts.GraphWidth < graphWidth {
+		graphWidth = opts.GraphWidth
+	}
+	nameWidth := maxLen
+	if opts.NameWidth > 0 && opts.NameWidth < maxLen {
+		nameWidth = opts.NameWidth
+	}
+
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if opts.GraphWidth > 0 && graphWidth > opts.GraphWidth {
+			graphWidth = opts.GraphWidth
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	var b strings.Builder
+	for _, s := range shown {
+		prefix := ""
+		name := s.Name
+		length := nameWidth
+		if nameWidth < len(name) {
+			prefix = "..."
+			length = max(length-3, 0)
+			name = name[len(name)-length:]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		padding := strings.Repeat(" ", max(length-len(name), 0))
+
+		if s.Binary {
+			fmt.Fprintf(&b, " %s%s%s | %*s", prefix, name, padding, numberWidth, "Bin")
+			if s.Added == 0 && s.Deleted == 0 {
+				b.WriteString("\n")
+				continue
+			}
+			fmt.Fprintf(&b, " %d -> %d bytes\n", s.Deleted, s.Added)
+			continue
+		}
+
+		add, del := s.Added, s.Deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+		separator := ""
+		if s.Added+s.Deleted > 0 {
+			separator = " "
+		}
+		fmt.Fprintf(&b, " %s%s%s | %*d%s%s%s\n", prefix, name, padding, numberWidth, s.Added+s.Deleted,
+			separator, strings.Repeat("+", add), strings.Repeat("-", del))
+	}
+	if len(shown) < len(stats) {
+		b.WriteString(" ...\n")
+	}
+	b.WriteString(FormatShortstat(stats))
+	return b.String()
+}
+
+// scaleLinear scales a change count to the graph width, making sure that
+// any change is drawn with at least one column.
+func scaleLinear(it int, width int, maxChange int) int {
+	if it == 0 {
+		return 0
+	}
+	return 1 + it*(width-1)/maxChange
+}
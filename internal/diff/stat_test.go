@@ -0,0 +1,104 @@
+package diff_test
+
+import (
+	"ggit/internal/diff"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameName(t *testing.T) {
+	type renameTest struct {
+		From   string
+		To     string
+		Result string
+	}
+	tests := []renameTest{
+		{From: "a.txt", To: "b.txt", Result: "a.txt => b.txt"},
+		{From: "src/a/f1.txt", To: "src/b.txt", Result: "src/{a/f1.txt => b.txt}"},
+		{From: "lib/old/file.go", To: "lib/new/file.go", Result: "lib/{old => new}/file.go"},
+		{From: "file.go", To: "dir/file.go", Result: "file.go => dir/file.go"},
+		{From: "a/x/file.go", To: "a/file.go", Result: "a/{x => }/file.go"},
+	}
+	for _, test := range tests {
+		t.Run(test.Result, func(t *testing.T) {
+			assert.Equal(t, test.Result, diff.RenameName(test.From, test.To))
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := memStore{}
+	from := m.tree(map[string]string{
+		"text.txt": "one\ntwo\nthree\n",
+		"bin.dat":  "\x00\x01\x02",
+		"old.txt":  lines(20, "line"),
+	})
+	to := m.tree(map[string]string{
+		"text.txt": "one\n2\nthree\nfour\n",
+		"bin.dat":  "\x00\x01\x02\x03\x04",
+		"new.txt":  lines(20, "line"),
+	})
+	changes, err := diff.TreeDiff(m, from, to, &diff.Options{Renames: true, RenameScore: 50})
+	assert.NoError(t, err)
+
+	stats, err := diff.Stats(m, changes)
+	assert.NoError(t, err)
+	assert.Equal(t, []diff.FileStat{
+		{Name: "bin.dat", Added: 5, Deleted: 3, Binary: true},
+		{Name: "old.txt => new.txt"},
+		{Name: "text.txt", Added: 2, Deleted: 1},
+	}, stats)
+
+	t.Run("Numstat", func(t *testing.T) {
+		assert.Equal(t, "-\t-\tbin.dat\n0\t0\told.txt => new.txt\n2\t1\ttext.txt\n", diff.FormatNumstat(stats))
+	})
+
+	t.Run("Shortstat", func(t *testing.T) {
+		assert.Equal(t, " 3 files changed, 2 insertions(+), 1 deletion(-)\n", diff.FormatShortstat(stats))
+		assert.Equal(t, " 0 files changed\n", diff.FormatShortstat(nil))
+		assert.Equal(t, " 1 file changed, 0 insertions(+), 0 deletions(-)\n", diff.FormatShortstat(stats[1:2]))
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		expected := " bin.dat            | Bin 3 -> 5 bytes\n" +
+			" old.txt => new.txt |   0\n" +
+			" text.txt           |   3 ++-\n" +
+			" 3 files changed, 2 insertions(+), 1 deletion(-)\n"
+		assert.Equal(t, expected, diff.FormatStat(stats, diff.StatOptions{}))
+	})
+}
+
+func TestFormatStat(t *testing.T) {
+	stats := []diff.FileStat{
+		{Name: "src/" + strings.Repeat("long/", 10) + "name.go", Added: 300, Deleted: 100},
+		{Name: "small.txt", Added: 1, Deleted: 1},
+	}
+
+	t.Run("Scaled", func(t *testing.T) {
+		out := diff.FormatStat(stats, diff.StatOptions{Width: 60})
+		lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+		assert.Len(t, lines, 3)
+		assert.Equal(t, " .../long/long/long/long/long/name.go   | 400 +++++++++----", lines[0])
+		assert.Equal(t, " small.txt                              |   2 +-", lines[1])
+		for _, line := range lines[:2] {
+			assert.LessOrEqual(t, len(line), 60)
+		}
+	})
+
+	t.Run("NameWidth", func(t *testing.T) {
+		out := diff.FormatStat(stats, diff.StatOptions{NameWidth: 12, GraphWidth: 10})
+		assert.True(t, strings.HasPrefix(out, " .../name.go  | 400 +++++++---\n"))
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		out := diff.FormatStat(stats, diff.StatOptions{Count: 1})
+		assert.Contains(t, out, "\n ...\n 2 files changed, 301 insertions(+), 101 deletions(-)\n")
+		assert.NotContains(t, out, "small.txt")
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Equal(t, "", diff.FormatStat(nil, diff.StatOptions{}))
+	})
+}
@@ -0,0 +1,218 @@
+package diff
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"path"
+	"sort"
+)
+
+// Status describes how a path changed between two trees.
+type Status byte
+
+const (
+	Added       Status = 'A'
+	Deleted     Status = 'D'
+	Modified    Status = 'M'
+	TypeChanged Status = 'T'
+	Renamed     Status = 'R'
+	Copied      Status = 'C'
+)
+
+// File is one side of a change. A missing side has an empty mode and hash.
+type File struct {
+	Path string
+	Mode string
+	Hash string
+}
+
+// Exists reports whether the file is present on its side of the change.
+func (f File) Exists() bool {
+	return f.Mode != ""
+}
+
+// Change is a single difference between two trees. Score holds the
+// similarity percentage of renames and copies.
+type Change struct {
+	Status Status
+	Score  int
+	From   File
+	To     File
+}
+
+// Path returns the path the change is reported under: the destination path,
+// or the source path for deletions.
+func (c Change) Path() string {
+	if c.To.Exists() {
+		return c.To.Path
+	}
+	return c.From.Path
+}
+
+// ObjectReader gives the diff engine access to the object database.
+type ObjectReader interface {
+	ReadObject(sha string) (objects.GitObject, error)
+}
+
+// Options controls the rename and copy detection of TreeDiff.
+// Copy detection implies rename detection.
+type Options struct {
+	Renames          bool
+	Copies           bool
+	FindCopiesHarder bool
+	RenameScore      int
+}
+
+// TreeDiff recursively compares the trees from and to and returns the changed
+// files sorted by path. An empty tree ID stands for an empty tree, so
+// comparing against it reports every file as added or deleted.
+//
+// Returns:
+//   - The list of changes needed to turn from into to.
+//   - An error if one of the trees or, with rename detection, one of the
+//     blobs can not be read.
+func TreeDiff(r ObjectReader, from string, to string, opts *Options) ([]Change, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	w := &treeWalker{r: r, keepUnchanged: opts.Copies && opts.FindCopiesHarder}
+	if err := w.compare("", from, to); err != nil {
+		return nil, err
+	}
+
+	changes := w.changes
+	if opts.Renames || opts.Copies {
+		var err error
+		changes, err = detectRenames(r, changes, w.unchanged, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	SortChanges(changes)
+	return changes, nil
+}
+
+// SortChanges orders changes by the path they are reported under.
+func SortChanges(changes []Change) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path() < changes[j].Path()
+	})
+}
+
+type treeWalker struct {
+	r             ObjectReader
+	changes       []Change
+	unchanged     []File
+	keepUnchanged bool
+}
+
+func (w *treeWalker) readTree(sha string) ([]objects.TreeEntry, error) {
+	if sha == "" {
+		return nil, nil
+	}
+	obj, err := w.r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	tree, ok := obj.(*objects.Tree)
+	if !ok {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", sha, obj.Format())
+	}
+	return tree.Entries, nil
+}
+
+func (w *treeWalker) compare(prefix string, from string, to string) error {
+	a, err := w.readTree(from)
+	if err != nil {
+		return err
+	}
+	b, err := w.readTree(to)
+	if err != nil {
+		return err
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || (i < len(a) && entryKey(a[i]) < entryKey(b[j])):
+			if err := w.side(prefix, a[i], Deleted); err != nil {
+				return err
+			}
+			i++
+		case i >= len(a) || entryKey(a[i]) > entryKey(b[j]):
+			if err := w.side(prefix, b[j], Added); err != nil {
+				return err
+			}
+			j++
+		default:
+			if err := w.both(prefix, a[i], b[j]); err != nil {
+				return err
+			}
+			i++
+			j++
+		}
+	}
+	return nil
+}
+
+// side records an entry present on only one side of the comparison.
+func (w *treeWalker) side(prefix string, e objects.TreeEntry, status Status) error {
+	name := path.Join(prefix, e.Name)
+	if e.IsTree() {
+		if status == Deleted {
+			return w.compare(name, e.Hash, "")
+		}
+		return w.compare(name, "", e.Hash)
+	}
+	f := File{Path: name, Mode: e.Mode, Hash: e.Hash}
+	if status == Deleted {
+		w.changes = append(w.changes, Change{Status: Deleted, From: f})
+	} else {
+		w.changes = append(w.changes, Change{Status: Added, To: f})
+	}
+	return nil
+}
+
+// both records the differences of an entry present on both sides.
+func (w *treeWalker) both(prefix string, a objects.TreeEntry, b objects.TreeEntry) error {
+	name := path.Join(prefix, a.Name)
+	if a.IsTree() {
+		if a.Hash == b.Hash && !w.keepUnchanged {
+			return nil
+		}
+		return w.compare(name, a.Hash, b.Hash)
+	}
+
+	from := File{Path: name, Mode: a.Mode, Hash: a.Hash}
+	to := File{Path: name, Mode: b.Mode, Hash: b.Hash}
+	switch {
+	case a.Hash == b.Hash && a.Mode == b.Mode:
+		if w.keepUnchanged {
+			w.unchanged = append(w.unchanged, from)
+		}
+	case kind(a.Mode) != kind(b.Mode):
+		w.changes = append(w.changes, Change{Status: TypeChanged, From: from, To: to})
+	default:
+		w.changes = append(w.changes, Change{Status: Modified, From: from, To: to})
+	}
+	return nil
+}
+
+// entryKey returns the name entries are ordered by inside a tree object.
+func entryKey(e objects.TreeEntry) string {
+	if e.IsTree() {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// kind groups modes into the file types git distinguishes when it
+// reports type changes.
+func kind(mode string) string {
+	switch mode {
+	case objects.ModeFile, objects.ModeExecutable:
+		return "file"
+	default:
+		return mode
+	}
+}
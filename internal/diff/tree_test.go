@@ -0,0 +1,128 @@
+package diff_test
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/objects"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memStore map[string]objects.GitObject
+
+func (m memStore) ReadObject(sha string) (objects.GitObject, error) {
+	obj, ok := m[sha]
+	if !ok {
+		return nil, fmt.Errorf("object not found")
+	}
+	return obj, nil
+}
+
+func (m memStore) write(o objects.GitObject) string {
+	sha, _ := o.Hash()
+	m[sha] = o
+	return sha
+}
+
+// tree writes a tree built from a map of slash separated paths to file
+// contents. Paths ending with "@x" are stored as executables and paths
+// ending with "@l" as symlinks.
+func (m memStore) tree(files map[string]string) string {
+	t := objects.NewTree()
+	subtrees := map[string]map[string]string{}
+	for name, data := range files {
+		if dir, rest, ok := strings.Cut(name, "/"); ok {
+			if subtrees[dir] == nil {
+				subtrees[dir] = map[string]string{}
+			}
+			subtrees[dir][rest] = data
+			continue
+		}
+		mode := objects.ModeFile
+		if n, ok := strings.CutSuffix(name, "@x"); ok {
+			name, mode = n, objects.ModeExecutable
+		} else if n, ok := strings.CutSuffix(name, "@l"); ok {
+			name, mode = n, objects.ModeSymlink
+		}
+		t.Entries = append(t.Entries, objects.TreeEntry{Mode: mode, Name: name, Hash: m.write(objects.NewBlob(data))})
+	}
+	dirs := make([]string, 0, len(subtrees))
+	for dir := range subtrees {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		t.Entries = append(t.Entries, objects.TreeEntry{Mode: objects.ModeTree, Name: dir, Hash: m.tree(subtrees[dir])})
+	}
+	t.Sort()
+	return m.write(t)
+}
+
+func statuses(changes []diff.Change) []string {
+	result := []string{}
+	for _, c := range changes {
+		result = append(result, c.StatusString()+" "+c.Path())
+	}
+	return result
+}
+
+func TestTreeDiff(t *testing.T) {
+	m := memStore{}
+	from := m.tree(map[string]string{
+		"README":       "readme\n",
+		"src/main.go":  "package main\n",
+		"src/util.go":  "package util\n",
+		"docs/old.txt": "old\n",
+		"run.sh":       "echo\n",
+		"link":         "target\n",
+	})
+	to := m.tree(map[string]string{
+		"README":        "readme, changed\n",
+		"src/main.go":   "package main\n",
+		"src/lib/a.go":  "package lib\n",
+		"run.sh@x":      "echo\n",
+		"link@l":        "target\n",
+		"docs/new.txt":  "new\n",
+		"src/util.go/x": "now a directory\n",
+	})
+
+	t.Run("Changes", func(t *testing.T) {
+		changes, err := diff.TreeDiff(m, from, to, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"M README",
+			"A docs/new.txt",
+			"D docs/old.txt",
+			"T link",
+			"M run.sh",
+			"A src/lib/a.go",
+			"D src/util.go",
+			"A src/util.go/x",
+		}, statuses(changes))
+	})
+
+	t.Run("Identical", func(t *testing.T) {
+		changes, err := diff.TreeDiff(m, from, from, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+
+	t.Run("EmptyTree", func(t *testing.T) {
+		changes, err := diff.TreeDiff(m, "", from, nil)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 6)
+		for _, c := range changes {
+			assert.Equal(t, diff.Added, c.Status)
+			assert.False(t, c.From.Exists())
+		}
+	})
+
+	t.Run("NotATree", func(t *testing.T) {
+		blob := m.write(objects.NewBlob("blob"))
+		_, err := diff.TreeDiff(m, blob, to, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,207 @@
+package diff
+
+import "strings"
+
+// wordStyleElem describes how a run of words of one kind is written.
+type wordStyleElem struct {
+	color  string
+	prefix string
+	suffix string
+}
+
+// wordStyle describes a word diff mode: how removed, added and common
+// words are marked and what ends a line.
+type wordStyle struct {
+	old     wordStyleElem
+	new     wordStyleElem
+	ctx     wordStyleElem
+	newline string
+}
+
+func (p *patch) wordStyle() wordStyle {
+	var s wordStyle
+	switch p.opts.WordDiff {
+	case WordDiffPorcelain:
+		s = wordStyle{
+			old:     wordStyleElem{prefix: "-", suffix: "\n"},
+			new:     wordStyleElem{prefix: "+", suffix: "\n"},
+			ctx:     wordStyleElem{prefix: " ", suffix: "\n"},
+			newline: "~\n",
+		}
+	case WordDiffPlain:
+		s = wordStyle{
+			old:     wordStyleElem{prefix: "[-", suffix: "-]"},
+			new:     wordStyleElem{prefix: "{+", suffix: "+}"},
+			newline: "\n",
+		}
+	default:
+		s = wordStyle{newline: "\n"}
+	}
+	if p.opts.Color {
+		s.old.color = colorOld
+		s.new.color = colorNew
+	}
+	return s
+}
+
+// write writes text line by line, wrapping every non-empty line in the
+// markers of el.
+func (s wordStyle) write(b *strings.Builder, el wordStyleElem, text string) {
+	for text != "" {
+		line, rest, found := strings.Cut(text, "\n")
+		if line != "" {
+			b.WriteString(el.color + el.prefix + line + el.suffix)
+			if el.color != "" {
+				b.WriteString(colorReset)
+			}
+		}
+		if !found {
+			return
+		}
+		b.WriteString(s.newline)
+		text = rest
+	}
+}
+
+// word is the byte range of a single word within a text.
+type word struct {
+	begin int
+	end   int
+}
+
+// splitWords splits text into words: matches of the word regex, cut at the
+// end of the line, or runs of non-whitespace without a regex.
+func (p *patch) splitWords(text string) []word {
+	words := []word{}
+	for i := 0; i < len(text); {
+		if p.words != nil {
+			loc := p.words.FindStringIndex(text[i:])
+			if loc == nil {
+				break
+			}
+			begin, end := i+loc[0], i+loc[1]
+			if nl := strings.IndexByte(text[begin:end], '\n'); nl >= 0 {
+				end = begin + nl
+			}
+			if begin == end {
+				i = begin + 1
+				continue
+			}
+			words = append(words, word{begin: begin, end: end})
+			i = end
+			continue
+		}
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		if i == len(text) {
+			break
+		}
+		begin := i
+		for i < len(text) && !isSpace(text[i]) {
+			i++
+		}
+		words = append(words, word{begin: begin, end: i})
+	}
+	return words
+}
+
+// wordHunk collects the removed and added lines between context lines and
+// shows them as a word diff.
+func (p *patch) wordHunk(edits []Edit) {
+	var minus, plus strings.Builder
+	flush := func() {
+		if minus.Len() > 0 || plus.Len() > 0 {
+			p.wordDiff(minus.String(), plus.String())
+		}
+		minus.Reset()
+		plus.Reset()
+	}
+	for _, e := range edits {
+		text := e.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		switch e.Op {
+		case Delete:
+			minus.WriteString(text)
+		case Insert:
+			plus.WriteString(text)
+		default:
+			flush()
+			p.lines = append(p.lines, patchLine{kind: lineWordsContext, text: strings.TrimSuffix(text, "\n")})
+		}
+	}
+	flush()
+}
+
+// wordDiff compares the words of the removed text minus with those of the
+// added text plus. Common words and the whitespace between words are taken
+// from plus.
+func (p *patch) wordDiff(minus string, plus string) {
+	style := p.wordStyle()
+	var b strings.Builder
+	if plus == "" {
+		style.write(&b, style.old, minus)
+		p.lines = append(p.lines, patchLine{kind: lineWords, text: b.String()})
+		return
+	}
+
+	minusWords, plusWords := p.splitWords(minus), p.splitWords(plus)
+	texts := func(text string, words []word) []string {
+		result := make([]string, len(words))
+		for i, w := range words {
+			result[i] = text[w.begin:w.end]
+		}
+		return result
+	}
+	edits := Compute(texts(minus, minusWords), texts(plus, plusWords))
+
+	// span returns the byte range of n words starting at first, or the end
+	// of the preceding word for an empty range.
+	span := func(words []word, first int, n int) (int, int) {
+		if n > 0 {
+			return words[first].begin, words[first+n-1].end
+		}
+		if first == 0 {
+			return 0, 0
+		}
+		return words[first-1].end, words[first-1].end
+	}
+
+	current, oldIndex, newIndex := 0, 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			oldIndex++
+			newIndex++
+			continue
+		}
+		deleted, inserted := 0, 0
+		for ; i < len(edits) && edits[i].Op != Equal; i++ {
+			if edits[i].Op == Delete {
+				deleted++
+			} else {
+				inserted++
+			}
+		}
+		minusBegin, minusEnd := span(minusWords, oldIndex, deleted)
+		plusBegin, plusEnd := span(plusWords, newIndex, inserted)
+		if current != plusBegin {
+			style.write(&b, style.ctx, plus[current:plusBegin])
+		}
+		if minusBegin != minusEnd {
+			style.write(&b, style.old, minus[minusBegin:minusEnd])
+		}
+		if plusBegin != plusEnd {
+			style.write(&b, style.new, plus[plusBegin:plusEnd])
+		}
+		current = plusEnd
+		oldIndex += deleted
+		newIndex += inserted
+	}
+	if current != len(plus) {
+		style.write(&b, style.ctx, plus[current:])
+	}
+	p.lines = append(p.lines, patchLine{kind: lineWords, text: b.String()})
+}
@@ -0,0 +1,350 @@
+package diff
+
+import "math"
+
+// Limits of the comparison of xdiff, git's diff library.
+const (
+	// maxEqLimit caps the number of matches above which a line matches too
+	// often to be compared when lines without a match surround it.
+	maxEqLimit = 1024
+	// simscanWindow caps the number of lines looked at around such lines.
+	simscanWindow = 100
+	kpdisRun      = 4
+	// The comparison gives up on an optimal script once it has cost
+	// heurMinCost edits and found a snake of snakeCount matches, or once it
+	// has cost the square root of the number of diagonals.
+	maxCostMin  = 256
+	heurMinCost = 256
+	snakeCount  = 20
+	kHeur       = 4
+)
+
+// bogoSqrt approximates the square root of n by a power of two.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// xdiff flags the lines of fa and fb the edit script turning fa into fb
+// deletes and inserts, the way xdiff computes it: lines without a match on
+// the other side, and lines matching too often among such lines, are left
+// out of the comparison and taken as changed, then the Myers comparison of
+// the other lines settles for a good enough script when an optimal one is
+// costly to find.
+func xdiff(fa *changeFile, fb *changeFile) {
+	ids := map[string]int{}
+	classify := func(lines []string) []int {
+		ha := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			ha[i] = id
+		}
+		return ha
+	}
+	ha1, ha2 := classify(fa.lines), classify(fb.lines)
+	count1, count2 := make([]int, len(ids)), make([]int, len(ids))
+	for _, id := range ha1 {
+		count1[id]++
+	}
+	for _, id := range ha2 {
+		count2[id]++
+	}
+
+	// The common lines at both ends are not compared.
+	n1, n2 := len(ha1), len(ha2)
+	start := 0
+	for start < min(n1, n2) && ha1[start] == ha2[start] {
+		start++
+	}
+	suffix := 0
+	for suffix < min(n1, n2)-start && ha1[n1-1-suffix] == ha2[n2-1-suffix] {
+		suffix++
+	}
+	r1 := fa.cleanup(ha1, count2, start, n1-suffix-1)
+	r2 := fb.cleanup(ha2, count1, start, n2-suffix-1)
+
+	x := &xdiffSplit{a: r1, b: r2, offset: len(r2.ha) + 1}
+	diagonals := len(r1.ha) + len(r2.ha) + 3
+	x.forward, x.backward = make([]int, diagonals), make([]int, diagonals)
+	x.maxCost = max(bogoSqrt(diagonals), maxCostMin)
+	x.compare(0, len(r1.ha), 0, len(r2.ha), false)
+}
+
+// xdiffLines are the lines of one side that take part in the comparison:
+// their classes and their indexes in the whole side.
+type xdiffLines struct {
+	f     *changeFile
+	ha    []int
+	index []int
+}
+
+// cleanup returns the lines from start to end, included, worth comparing
+// and flags the others as changed. other counts the matches of each class
+// of lines on the other side.
+func (f *changeFile) cleanup(ha []int, other []int, start int, end int) xdiffLines {
+	limit := min(bogoSqrt(len(ha)), maxEqLimit)
+	// 0 for the lines without a match, 2 for those matching too often.
+	discard := make([]byte, len(ha))
+	for i := start; i <= end; i++ {
+		switch matches := other[ha[i]]; {
+		case matches >= limit:
+			discard[i] = 2
+		case matches > 0:
+			discard[i] = 1
+		}
+	}
+	lines := xdiffLines{f: f}
+	for i := start; i <= end; i++ {
+		if discard[i] == 1 || discard[i] == 2 && !multimatchDiscarded(discard, i, start, end) {
+			lines.ha = append(lines.ha, ha[i])
+			lines.index = append(lines.index, i)
+		} else {
+			f.set(i, true)
+		}
+	}
+	return lines
+}
+
+// multimatchDiscarded reports whether the line i, which matches too often,
+// is in the middle of a run of lines without a match and is left out too.
+func multimatchDiscarded(discard []byte, i int, start int, end int) bool {
+	start, end = max(start, i-simscanWindow), min(end, i+simscanWindow)
+	before, multiBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if discard[i-r] == 0 {
+			before++
+		} else if discard[i-r] == 2 {
+			multiBefore++
+		} else {
+			break
+		}
+	}
+	if before == 0 {
+		return false
+	}
+	after, multiAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if discard[i+r] == 0 {
+			after++
+		} else if discard[i+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if after == 0 {
+		return false
+	}
+	multi := multiBefore + multiAfter
+	return multi*kpdisRun < multi+before+after
+}
+
+// xdiffSplit is the divide and conquer Myers comparison of xdiff. The
+// furthest reaching paths of each diagonal are indexed from offset.
+type xdiffSplit struct {
+	a, b              xdiffLines
+	forward, backward []int
+	offset            int
+	maxCost           int
+}
+
+// compare flags the changed lines of a[lo1:hi1] and b[lo2:hi2], looking
+// for an optimal script with minimal.
+func (x *xdiffSplit) compare(lo1 int, hi1 int, lo2 int, hi2 int, minimal bool) {
+	ha1, ha2 := x.a.ha, x.b.ha
+	for lo1 < hi1 && lo2 < hi2 && ha1[lo1] == ha2[lo2] {
+		lo1++
+		lo2++
+	}
+	for lo1 < hi1 && lo2 < hi2 && ha1[hi1-1] == ha2[hi2-1] {
+		hi1--
+		hi2--
+	}
+	switch {
+	case lo1 == hi1:
+		for ; lo2 < hi2; lo2++ {
+			x.b.f.set(x.b.index[lo2], true)
+		}
+	case lo2 == hi2:
+		for ; lo1 < hi1; lo1++ {
+			x.a.f.set(x.a.index[lo1], true)
+		}
+	default:
+		i1, i2, minLo, minHi := x.split(lo1, hi1, lo2, hi2, minimal)
+		x.compare(lo1, i1, lo2, i2, minLo)
+		x.compare(i1, hi1, i2, hi2, minHi)
+	}
+}
+
+// split finds where to divide the comparison of a[lo1:hi1] and b[lo2:hi2]:
+// the middle snake of an optimal path, or the end of a good enough snake
+// once the search is costly.
+//
+// Returns:
+//   - The point to divide at.
+//   - Whether the parts before and after it should be compared optimally.
+func (x *xdiffSplit) split(lo1 int, hi1 int, lo2 int, hi2 int, minimal bool) (int, int, bool, bool) {
+	ha1, ha2 := x.a.ha, x.b.ha
+	kf := func(d int) *int { return &x.forward[x.offset+d] }
+	kb := func(d int) *int { return &x.backward[x.offset+d] }
+	dmin, dmax := lo1-hi2, hi1-lo2
+	fmid, bmid := lo1-lo2, hi1-hi2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax, bmin, bmax := fmid, fmid, bmid, bmid
+	*kf(fmid) = lo1
+	*kb(bmid) = hi1
+
+	for cost := 1; ; cost++ {
+		snake := false
+		// Extend the diagonals by one, inward at the edges of the box.
+		if fmin > dmin {
+			fmin--
+			*kf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			i1 := *kf(d + 1)
+			if *kf(d - 1) >= *kf(d + 1) {
+				i1 = *kf(d - 1) + 1
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 < hi1 && i2 < hi2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev > snakeCount {
+				snake = true
+			}
+			*kf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kb(bmin - 1) = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kb(bmax + 1) = math.MaxInt
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			i1 := *kb(d + 1) - 1
+			if *kb(d - 1) < *kb(d + 1) {
+				i1 = *kb(d - 1)
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 > lo1 && i2 > lo2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev-i1 > snakeCount {
+				snake = true
+			}
+			*kb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if minimal {
+			continue
+		}
+
+		// Past heurMinCost edits, a path far from both the corner and the
+		// middle diagonal that ends with a long enough snake will do.
+		if snake && cost > heurMinCost {
+			best, s1, s2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := *kf(d)
+				i2 := i1 - d
+				v := i1 - lo1 + i2 - lo2 - abs(d-fmid)
+				if v > kHeur*cost && v > best && lo1+snakeCount <= i1 && i1 < hi1 && lo2+snakeCount <= i2 && i2 < hi2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == snakeCount {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, true, false
+			}
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := *kb(d)
+				i2 := i1 - d
+				v := hi1 - i1 + hi2 - i2 - abs(d-bmid)
+				if v > kHeur*cost && v > best && lo1 < i1 && i1 <= hi1-snakeCount && lo2 < i2 && i2 <= hi2-snakeCount {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == snakeCount-1 {
+							best, s1, s2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return s1, s2, false, true
+			}
+		}
+
+		// Past maxCost edits, the furthest reaching path will do.
+		if cost >= x.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(*kf(d), hi1)
+				i2 := i1 - d
+				if hi2 < i2 {
+					i1, i2 = hi2+d, hi2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(lo1, *kb(d))
+				i2 := i1 - d
+				if i2 < lo2 {
+					i1, i2 = lo2+d, lo2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if hi1+hi2-bbest < fbest-(lo1+lo2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package filesystem
+
+import "ggit/internal/factory"
+
+// Device returns the ID of the device holding path. Devices are not known
+// on this platform.
+func Device(fs factory.FS, path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"ggit/internal/factory"
+	"syscall"
+)
+
+// Device returns the ID of the device holding path.
+//
+// Returns:
+//   - The device ID.
+//   - False if the path can not be stated or the filesystem does not
+//     report devices, such as an in-memory one.
+func Device(fs factory.FS, path string) (uint64, bool) {
+	info, err := fs.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -1,11 +1,12 @@
 package filesystem
 
 import (
-	"bytes"
 	"fmt"
 	"ggit/internal/factory"
 	"os"
 	"path/filepath"
+
+	"github.com/spf13/afero"
 )
 
 // WriteToFile writes the specified data to a file at the given path.
@@ -50,25 +51,83 @@ func WriteBytesToFile(fs factory.FS, data []byte, path string) error {
 }
 
 // IsFile checks if a specified path is a file by using the IsDir function.
-// It returns true if the path is not a directory, and false if it is.
+// It returns true if the path exists and is not a directory.
 //
 // Returns:
 //   - A boolean indicating whether the specified path is a file.
 func IsFile(fs factory.FS, path string) bool {
-	return !IsDir(fs, path)
+	return Exists(fs, path) && !IsDir(fs, path)
 }
 
+// ReadFileData reads the whole content of the file at the given path.
+//
+// Returns:
+//   - The content of the file.
+//   - An error if the file does not exist or can not be read.
 func ReadFileData(fs factory.FS, path ...string) (string, error) {
 	filepath := filepath.Join(path...)
 	if !Exists(fs, filepath) {
 		return "", fmt.Errorf("file not found")
 	}
-	buffer := make([]byte, 1024)
-	buf := bytes.NewBuffer(buffer)
-	f, _ := fs.Open(filepath)
-	_, err := f.Read(buf.Bytes())
+	data, err := afero.ReadFile(fs, filepath)
 	if err != nil {
 		return "", err
 	}
-	return buf.String(), nil
+	return string(data), nil
+}
+
+// ReplaceFileData replaces the content of the file at the given path with
+// data, creating the file if it does not exist.
+//
+// Returns:
+//   - An error if the file can not be opened or written.
+func ReplaceFileData(fs factory.FS, data string, path string) error {
+	f, err := fs.OpenFile(path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// WriteFileAtomic writes data to a temporary file of the directory tmpdir,
+// syncs it to the disk and renames it to path, so that path never holds
+// partial data even when the process is interrupted or another one writes
+// it at the same time. tmpdir has to be on the same filesystem as path.
+// The file is made read-only, as it is not meant to change.
+//
+// Returns:
+//   - An error if the temporary file can not be written or renamed; the
+//     temporary file is removed then.
+func WriteFileAtomic(fs factory.FS, data string, path string, tmpdir string) error {
+	f, err := afero.TempFile(fs, tmpdir, "tmp_obj_")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.WriteString(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Chmod(tmp, 0444)
+	}
+	if err == nil {
+		err = fs.Rename(tmp, path)
+		// Another writer renaming the same file in first is fine on the
+		// systems refusing to replace it.
+		if err != nil && IsFile(fs, path) {
+			err = nil
+		}
+	}
+	if Exists(fs, tmp) {
+		fs.Remove(tmp)
+	}
+	return err
 }
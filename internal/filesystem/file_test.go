@@ -5,6 +5,7 @@ import (
 	"ggit/internal/filesystem"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -35,6 +36,13 @@ func TestIsFile(t *testing.T) {
 	}
 }
 
+func TestIsFileMissing(t *testing.T) {
+	fs := factory.NewTestFactory()
+	assert.False(t, filesystem.IsFile(fs, "./missing.go"))
+	fs.Create("./present.go")
+	assert.True(t, filesystem.IsFile(fs, "./present.go"))
+}
+
 func TestWriteToFile(t *testing.T) {
 	fs := factory.NewTestFactory()
 	type fileWriteTest struct {
@@ -57,3 +65,46 @@ func TestWriteToFile(t *testing.T) {
 		})
 	}
 }
+
+func TestReadFileData(t *testing.T) {
+	fs := factory.NewTestFactory()
+	data := strings.Repeat("0123456789", 500)
+	err := filesystem.WriteStringToFile(fs, data, "large.txt")
+	assert.NoError(t, err)
+
+	contents, err := filesystem.ReadFileData(fs, "large.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, data, contents)
+
+	_, err = filesystem.ReadFileData(fs, "missing.txt")
+	assert.Error(t, err)
+}
+
+func TestReplaceFileData(t *testing.T) {
+	fs := factory.NewTestFactory()
+	path := "./file.txt"
+
+	assert.NoError(t, filesystem.ReplaceFileData(fs, "first line\nsecond line\n", path))
+	assert.NoError(t, filesystem.ReplaceFileData(fs, "short\n", path))
+	data, err := filesystem.ReadFileData(fs, path)
+	assert.NoError(t, err)
+	assert.Equal(t, "short\n", data)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	fs := factory.NewTestFactory()
+	assert.NoError(t, fs.MkdirAll("/objects/ab", os.ModePerm))
+
+	assert.NoError(t, filesystem.WriteFileAtomic(fs, "first", "/objects/ab/cd", "/objects"))
+	assert.NoError(t, filesystem.WriteFileAtomic(fs, "second", "/objects/ab/cd", "/objects"))
+	data, err := filesystem.ReadFileData(fs, "/objects/ab/cd")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", data)
+	info, err := fs.Stat("/objects/ab/cd")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode().Perm())
+
+	files, err := afero.ReadDir(fs, "/objects")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "the temporary file is renamed")
+}
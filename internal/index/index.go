@@ -0,0 +1,317 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"sort"
+	"strconv"
+)
+
+const (
+	signature = "DIRC"
+	// headerSize is the size of the signature, the version and the number
+	// of entries.
+	headerSize = 12
+	// statSize is the size of the stat fields starting an entry, before
+	// its object ID.
+	statSize = 40
+	// flagsSize is the size of the flags following the object ID.
+	flagsSize = 2
+
+	flagAssumeValid = 0x8000
+	flagExtended    = 0x4000
+	flagStageMask   = 0x3000
+	flagStageShift  = 12
+	flagNameMask    = 0x0fff
+)
+
+// Stages of an entry. Merged entries are at stage 0, an unmerged path has
+// an entry for each side of the merge it exists on.
+const (
+	StageMerged = 0
+	StageBase   = 1
+	StageOurs   = 2
+	StageTheirs = 3
+)
+
+// Entry is a file of the index. The stat fields cache the state of the
+// file in the worktree when it was last written or added.
+type Entry struct {
+	CtimeSec      uint32
+	CtimeNsec     uint32
+	MtimeSec      uint32
+	MtimeNsec     uint32
+	Dev           uint32
+	Ino           uint32
+	Mode          string
+	UID           uint32
+	GID           uint32
+	Size          uint32
+	Hash          string
+	Stage         int
+	AssumeValid   bool
+	ExtendedFlags uint16
+	Path          string
+}
+
+// Index is the staging area: the content of the next commit, sorted by
+// path and stage.
+type Index struct {
+	Version int
+	Entries []Entry
+	// Hash is the algorithm of the object IDs and of the checksum.
+	Hash *objects.HashAlgorithm
+}
+
+func New() *Index {
+	return &Index{Version: 2, Hash: objects.SHA1}
+}
+
+// Read reads the index file at path, whose object IDs and checksum use
+// the given hash algorithm. A missing file is an empty index.
+// Versions 2 and 3 are supported; extensions are skipped.
+//
+// Returns:
+//   - The entries of the index.
+//   - An error if the file can not be read, is corrupt, uses an
+//     unsupported version or a required extension.
+func Read(fs factory.FS, path string, hash *objects.HashAlgorithm) (*Index, error) {
+	if !filesystem.IsFile(fs, path) {
+		idx := New()
+		idx.Hash = hash
+		return idx, nil
+	}
+	data, err := filesystem.ReadFileData(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	hashSize := hash.Size
+	if len(data) < headerSize+hashSize || data[:4] != signature {
+		return nil, fmt.Errorf("bad index file signature")
+	}
+	if hash.Sum([]byte(data[:len(data)-hashSize])) != hex.EncodeToString([]byte(data[len(data)-hashSize:])) {
+		return nil, fmt.Errorf("bad index file sha1 signature")
+	}
+	idx := &Index{Version: int(binary.BigEndian.Uint32([]byte(data[4:8]))), Hash: hash}
+	if idx.Version != 2 && idx.Version != 3 {
+		return nil, fmt.Errorf("index file version %d is not supported", idx.Version)
+	}
+	count := int(binary.BigEndian.Uint32([]byte(data[8:12])))
+	body := []byte(data[:len(data)-hashSize])
+	offset := headerSize
+	for i := 0; i < count; i++ {
+		e, size, err := readEntry(body[offset:], idx.Version, hashSize)
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries = append(idx.Entries, e)
+		offset += size
+	}
+	for offset < len(body) {
+		if len(body)-offset < 8 {
+			return nil, fmt.Errorf("index file corrupt: truncated extension")
+		}
+		name := body[offset : offset+4]
+		size := int(binary.BigEndian.Uint32(body[offset+4 : offset+8]))
+		if name[0] < 'A' || name[0] > 'Z' {
+			return nil, fmt.Errorf("index uses %s extension, which is not supported", name)
+		}
+		offset += 8 + size
+	}
+	return idx, nil
+}
+
+// readEntry decodes the entry at the start of data.
+//
+// Returns:
+//   - The entry.
+//   - The size of the entry, padding included.
+//   - An error if the entry is truncated.
+func readEntry(data []byte, version int, hashSize int) (Entry, int, error) {
+	entrySize := statSize + hashSize + flagsSize
+	if len(data) < entrySize {
+		return Entry{}, 0, fmt.Errorf("index file corrupt: truncated entry")
+	}
+	field := func(i int) uint32 {
+		return binary.BigEndian.Uint32(data[i*4 : i*4+4])
+	}
+	flags := binary.BigEndian.Uint16(data[statSize+hashSize : entrySize])
+	e := Entry{
+		CtimeSec:    field(0),
+		CtimeNsec:   field(1),
+		MtimeSec:    field(2),
+		MtimeNsec:   field(3),
+		Dev:         field(4),
+		Ino:         field(5),
+		Mode:        strconv.FormatUint(uint64(field(6)), 8),
+		UID:         field(7),
+		GID:         field(8),
+		Size:        field(9),
+		Hash:        hex.EncodeToString(data[statSize : statSize+hashSize]),
+		Stage:       int(flags&flagStageMask) >> flagStageShift,
+		AssumeValid: flags&flagAssumeValid != 0,
+	}
+	offset := entrySize
+	if flags&flagExtended != 0 {
+		if version < 3 || len(data) < offset+2 {
+			return Entry{}, 0, fmt.Errorf("index file corrupt: bad extended flags")
+		}
+		e.ExtendedFlags = binary.BigEndian.Uint16(data[offset : offset+2])
+		offset += 2
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return Entry{}, 0, fmt.Errorf("index file corrupt: unterminated path")
+	}
+	e.Path = string(data[offset : offset+end])
+	// Entries are padded with one to eight NUL bytes to a multiple of eight.
+	return e, (offset + end + 8) &^ 7, nil
+}
+
+// Write stores the index at path. The index is written next to path first
+// and renamed over it, so readers never see a partial index.
+//
+// Returns:
+//   - An error if the index can not be written.
+func (idx *Index) Write(fs factory.FS, path string) error {
+	idx.Sort()
+	version := 2
+	for _, e := range idx.Entries {
+		if e.ExtendedFlags != 0 {
+			version = 3
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString(signature)
+	binary.Write(&b, binary.BigEndian, uint32(version))
+	binary.Write(&b, binary.BigEndian, uint32(len(idx.Entries)))
+	for _, e := range idx.Entries {
+		if err := writeEntry(&b, e, idx.Hash.Size); err != nil {
+			return err
+		}
+	}
+	sum, _ := hex.DecodeString(idx.Hash.Sum(b.Bytes()))
+	b.Write(sum)
+
+	lock := path + ".lock"
+	if err := filesystem.ReplaceFileData(fs, b.String(), lock); err != nil {
+		return err
+	}
+	return fs.Rename(lock, path)
+}
+
+func writeEntry(b *bytes.Buffer, e Entry, hashSize int) error {
+	mode, err := strconv.ParseUint(e.Mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid mode %s of %s", e.Mode, e.Path)
+	}
+	hash, err := hex.DecodeString(e.Hash)
+	if err != nil || len(hash) != hashSize {
+		return fmt.Errorf("invalid object id %s of %s", e.Hash, e.Path)
+	}
+	start := b.Len()
+	for _, v := range []uint32{e.CtimeSec, e.CtimeNsec, e.MtimeSec, e.MtimeNsec, e.Dev, e.Ino, uint32(mode), e.UID, e.GID, e.Size} {
+		binary.Write(b, binary.BigEndian, v)
+	}
+	b.Write(hash)
+	flags := uint16(min(len(e.Path), flagNameMask)) | uint16(e.Stage<<flagStageShift)&flagStageMask
+	if e.AssumeValid {
+		flags |= flagAssumeValid
+	}
+	if e.ExtendedFlags != 0 {
+		flags |= flagExtended
+	}
+	binary.Write(b, binary.BigEndian, flags)
+	if e.ExtendedFlags != 0 {
+		binary.Write(b, binary.BigEndian, e.ExtendedFlags)
+	}
+	b.WriteString(e.Path)
+	size := b.Len() - start
+	b.Write(make([]byte, (size+8)&^7-size))
+	return nil
+}
+
+// Sort orders the entries by path and stage.
+func (idx *Index) Sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		a, b := idx.Entries[i], idx.Entries[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Stage < b.Stage
+	})
+}
+
+// Entry returns the entry of path at the given stage.
+func (idx *Index) Entry(path string, stage int) (Entry, bool) {
+	i := idx.search(path, stage)
+	if i < len(idx.Entries) && idx.Entries[i].Path == path && idx.Entries[i].Stage == stage {
+		return idx.Entries[i], true
+	}
+	return Entry{}, false
+}
+
+// Stages returns every entry of path, merged or not, by stage.
+func (idx *Index) Stages(path string) []Entry {
+	entries := []Entry{}
+	for i := idx.search(path, 0); i < len(idx.Entries) && idx.Entries[i].Path == path; i++ {
+		entries = append(entries, idx.Entries[i])
+	}
+	return entries
+}
+
+// Add adds or replaces an entry. Adding a merged entry resolves a conflict:
+// the unmerged entries of its path are removed, and the other way around.
+func (idx *Index) Add(e Entry) {
+	kept := idx.Entries[:0]
+	for _, o := range idx.Entries {
+		if o.Path != e.Path || (o.Stage != e.Stage && o.Stage != StageMerged && e.Stage != StageMerged) {
+			kept = append(kept, o)
+		}
+	}
+	idx.Entries = kept
+	i := idx.search(e.Path, e.Stage)
+	idx.Entries = append(idx.Entries, Entry{})
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = e
+}
+
+// Remove removes every stage of path.
+func (idx *Index) Remove(path string) {
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Path != path {
+			kept = append(kept, e)
+		}
+	}
+	idx.Entries = kept
+}
+
+// Conflicts returns the paths with unmerged entries, sorted.
+func (idx *Index) Conflicts() []string {
+	paths := []string{}
+	for _, e := range idx.Entries {
+		if e.Stage != StageMerged && (len(paths) == 0 || paths[len(paths)-1] != e.Path) {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths
+}
+
+// search returns the position of the entry of path at stage, or the
+// position it would be inserted at.
+func (idx *Index) search(path string, stage int) int {
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		e := idx.Entries[i]
+		if e.Path != path {
+			return e.Path > path
+		}
+		return e.Stage >= stage
+	})
+}
@@ -0,0 +1,114 @@
+package index_test
+
+import (
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	blobA = "78981922613b2afb6025042ff6bd878ac1994e85"
+	blobB = "61780798228d17af2d34fce4cfbdf35556832472"
+	blobC = "f2ad6c76f0115a6ba5b00456a849810e7ec0af20"
+)
+
+func TestIndex(t *testing.T) {
+	fs := factory.NewTestFactory()
+
+	t.Run("Missing", func(t *testing.T) {
+		idx, err := index.Read(fs, "/missing/index", objects.SHA1)
+		assert.NoError(t, err)
+		assert.Empty(t, idx.Entries)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		idx := index.New()
+		idx.Add(index.Entry{Mode: "100755", Hash: blobB, Path: "dir/script.sh", MtimeSec: 1700000000, Size: 2})
+		idx.Add(index.Entry{Mode: "100644", Hash: blobA, Path: "a.txt", ExtendedFlags: 0x4000})
+		idx.Add(index.Entry{Mode: "120000", Hash: blobC, Path: "a-very-long-name-that-needs-padding", AssumeValid: true})
+		assert.NoError(t, idx.Write(fs, "/repo/index"))
+		assert.False(t, filesystem.Exists(fs, "/repo/index.lock"))
+
+		read, err := index.Read(fs, "/repo/index", objects.SHA1)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, read.Version)
+		assert.Equal(t, idx.Entries, read.Entries)
+		assert.Equal(t, "a-very-long-name-that-needs-padding", read.Entries[0].Path)
+	})
+
+	t.Run("SHA256", func(t *testing.T) {
+		blob := objects.SHA256.HashObject("blob", "a\n")
+		idx := index.New()
+		idx.Hash = objects.SHA256
+		idx.Add(index.Entry{Mode: "100644", Hash: blob, Path: "a.txt"})
+		assert.NoError(t, idx.Write(fs, "/sha256/index"))
+
+		read, err := index.Read(fs, "/sha256/index", objects.SHA256)
+		assert.NoError(t, err)
+		assert.Equal(t, idx.Entries, read.Entries)
+		_, err = index.Read(fs, "/sha256/index", objects.SHA1)
+		assert.Error(t, err)
+
+		idx.Hash = objects.SHA1
+		assert.Error(t, idx.Write(fs, "/sha256/index"))
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		idx := index.New()
+		idx.Add(index.Entry{Mode: "100644", Hash: blobA, Path: "a"})
+		assert.NoError(t, idx.Write(fs, "/corrupt/index"))
+		data, err := filesystem.ReadFileData(fs, "/corrupt/index")
+		assert.NoError(t, err)
+
+		assert.NoError(t, filesystem.ReplaceFileData(fs, data[:20]+"x"+data[21:], "/corrupt/index"))
+		_, err = index.Read(fs, "/corrupt/index", objects.SHA1)
+		assert.ErrorContains(t, err, "sha1")
+
+		assert.NoError(t, filesystem.ReplaceFileData(fs, "XXXX"+data[4:], "/corrupt/index"))
+		_, err = index.Read(fs, "/corrupt/index", objects.SHA1)
+		assert.ErrorContains(t, err, "signature")
+	})
+
+	t.Run("InvalidEntry", func(t *testing.T) {
+		idx := index.New()
+		idx.Add(index.Entry{Mode: "100644", Hash: "abc", Path: "a"})
+		assert.Error(t, idx.Write(fs, "/invalid/index"))
+	})
+}
+
+func TestStages(t *testing.T) {
+	idx := index.New()
+	idx.Add(index.Entry{Mode: "100644", Hash: blobA, Path: "b"})
+	idx.Add(index.Entry{Mode: "100644", Hash: blobC, Path: "c"})
+	idx.Add(index.Entry{Mode: "100644", Hash: blobA, Path: "a", Stage: index.StageTheirs})
+	idx.Add(index.Entry{Mode: "100644", Hash: blobB, Path: "a", Stage: index.StageBase})
+	idx.Add(index.Entry{Mode: "100644", Hash: blobC, Path: "a", Stage: index.StageOurs})
+	idx.Add(index.Entry{Mode: "100644", Hash: blobB, Path: "c", Stage: index.StageOurs})
+
+	assert.Equal(t, []string{"a", "c"}, idx.Conflicts())
+	stages := idx.Stages("a")
+	assert.Len(t, stages, 3)
+	for i, e := range stages {
+		assert.Equal(t, i+1, e.Stage)
+	}
+	_, ok := idx.Entry("c", index.StageMerged)
+	assert.False(t, ok, "an unmerged entry replaces the merged one")
+
+	idx.Add(index.Entry{Mode: "100644", Hash: blobA, Path: "a"})
+	assert.Equal(t, []string{"c"}, idx.Conflicts())
+	e, ok := idx.Entry("a", index.StageMerged)
+	assert.True(t, ok)
+	assert.Equal(t, blobA, e.Hash)
+
+	idx.Remove("c")
+	assert.Empty(t, idx.Conflicts())
+	paths := []string{}
+	for _, e := range idx.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"a", "b"}, paths)
+}
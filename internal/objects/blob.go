@@ -1,13 +1,5 @@
 package objects
 
-import (
-	"crypto/sha1"
-	"encoding/hex"
-	"fmt"
-	"strconv"
-	"strings"
-)
-
 type Blob struct {
 	*object
 	data string
@@ -32,34 +24,14 @@ func (b *Blob) ReadData() string {
 }
 
 func (o *Blob) Serialize() string {
-	return fmt.Sprintf("%v %v%v%v", o.format, len(o.data), "\x00", o.data)
+	return o.data
 }
 
 func (o *Blob) Deserialize(data string) error {
-	x := strings.Index(data, " ")
-	format := data[0:x]
-
-	y := strings.Index(data, "\x00")
-	size, err := strconv.Atoi(data[x+1 : y])
-	if err != nil {
-		return fmt.Errorf("unable to read object size")
-	}
-
-	if size != len(data)-y-1 {
-		return fmt.Errorf("malformed object %s: bad length", data)
-	}
-	o.format = format
-	o.data = data[y+1:]
+	o.data = data
 	return nil
 }
 
 func (b *Blob) Hash() (string, error) {
-	data := b.Serialize()
-	hasher := sha1.New()
-	_, err := hasher.Write([]byte(data))
-	if err != nil {
-		return "", err
-	}
-	sha := hex.EncodeToString(hasher.Sum(nil))
-	return sha, nil
+	return hashData(b.HashAlgorithm(), b.format, b.Serialize())
 }
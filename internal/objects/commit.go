@@ -1,10 +1,5 @@
 package objects
 
-import (
-	"crypto/sha1"
-	"encoding/hex"
-)
-
 type Commit struct {
 	*object
 	KVLM kvlm
@@ -28,12 +23,5 @@ func (c *Commit) Deserialize(data string) error {
 	return nil
 }
 func (c *Commit) Hash() (string, error) {
-	data := c.Serialize()
-	hasher := sha1.New()
-	_, err := hasher.Write([]byte(data))
-	if err != nil {
-		return "", err
-	}
-	sha := hex.EncodeToString(hasher.Sum(nil))
-	return sha, nil
+	return hashData(c.HashAlgorithm(), c.format, c.Serialize())
 }
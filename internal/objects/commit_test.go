@@ -50,7 +50,7 @@ Q52UWybBzpaP9HEd4XnR+HuQ4k2K0ns2KgNImsNvIyFwbpMUyUWLMPimaV1DWUXo
 		c := objects.NewCommit()
 		c.Deserialize(validMessage)
 		assert.Equal(t, "29ff16c9c14e2652b22f8b78bb08a5a07930c147", c.KVLM.Tree)
-		assert.Equal(t, "206941306e8a8af65b66eaaaea388a7ae24d49a0", c.KVLM.Parent)
+		assert.Equal(t, []string{"206941306e8a8af65b66eaaaea388a7ae24d49a0"}, c.KVLM.Parents)
 		assert.Equal(t, "Neil Gaiman <cat@gaiman.net> 1527025023 +0200", c.KVLM.Author)
 		assert.Equal(t, "Neil Gaiman <cat@gaiman.net> 1527025044 +0200", c.KVLM.Comitter)
 		assert.Equal(t, key, c.KVLM.GPGSIG)
@@ -62,4 +62,24 @@ Q52UWybBzpaP9HEd4XnR+HuQ4k2K0ns2KgNImsNvIyFwbpMUyUWLMPimaV1DWUXo
 		c.Deserialize(validMessage)
 		assert.Equal(t, validMessage, c.Serialize())
 	})
+	t.Run("KVLM parents", func(t *testing.T) {
+		c := objects.NewCommit()
+		c.KVLM.Tree = objects.EmptyTreeHash
+		c.KVLM.Author = "A U Thor <author@example.com> 1527025023 +0200"
+		c.KVLM.Comitter = "C O Mitter <committer@example.com> 1527025044 +0200"
+		c.KVLM.Message = "root"
+		sha, err := c.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, "f67ee8d3243864a99a14adaf36b149490ff42720", sha)
+
+		c.KVLM.Parents = []string{sha, "f746423242cbc93eb0a7b74e9354c7e8b4f72211"}
+		c.KVLM.Message = "merge"
+		sha, err = c.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, "d02c5bb89ea0190f0eaab4bcbca005d4d54c722e", sha)
+
+		parsed := objects.NewCommit()
+		assert.NoError(t, parsed.Deserialize(c.Serialize()))
+		assert.Equal(t, c.KVLM, parsed.KVLM)
+	})
 }
@@ -0,0 +1,84 @@
+package objects
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// HashAlgorithm is the hash function object IDs are computed with. An ID
+// is the hex encoded hash of the encoded object, and trees store it raw.
+type HashAlgorithm struct {
+	// Name is the value of extensions.objectFormat selecting the algorithm.
+	Name string
+	// Size is the length of a raw object ID in bytes.
+	Size int
+	// EmptyTree is the ID of the tree without entries. Repositories can
+	// refer to it without storing it.
+	EmptyTree string
+	new       func() hash.Hash
+}
+
+var (
+	SHA1   = &HashAlgorithm{Name: "sha1", Size: sha1.Size, EmptyTree: EmptyTreeHash, new: sha1.New}
+	SHA256 = &HashAlgorithm{Name: "sha256", Size: sha256.Size, EmptyTree: "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321", new: sha256.New}
+)
+
+// LookupHashAlgorithm returns the algorithm with the given name, SHA-1 for
+// an empty one.
+//
+// Returns:
+//   - The hash algorithm.
+//   - An error if the name is not a known algorithm.
+func LookupHashAlgorithm(name string) (*HashAlgorithm, error) {
+	switch strings.ToLower(name) {
+	case "", SHA1.Name:
+		return SHA1, nil
+	case SHA256.Name:
+		return SHA256, nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm '%s'", name)
+}
+
+// HexSize returns the length of a hex encoded object ID.
+func (h *HashAlgorithm) HexSize() int {
+	return 2 * h.Size
+}
+
+// NullID returns the ID made of zeros, which stands for a missing object.
+func (h *HashAlgorithm) NullID() string {
+	return strings.Repeat("0", h.HexSize())
+}
+
+// IsID reports whether id is a full, lowercase hex encoded object ID.
+func (h *HashAlgorithm) IsID(id string) bool {
+	if len(id) != h.HexSize() {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// New returns a hash computing checksums with the algorithm.
+func (h *HashAlgorithm) New() hash.Hash {
+	return h.new()
+}
+
+// Sum returns the hex encoded hash of data.
+func (h *HashAlgorithm) Sum(data []byte) string {
+	hasher := h.new()
+	hasher.Write(data)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// HashObject computes the ID of an object of the given format and payload.
+func (h *HashAlgorithm) HashObject(format string, payload string) string {
+	return h.Sum([]byte(encode(format, payload)))
+}
@@ -0,0 +1,55 @@
+package objects
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ident identifies who did something and when, as recorded in the author
+// and committer headers of commits and in reflog entries:
+//
+//	A U Thor <author@example.com> 1527025023 +0200
+type Ident struct {
+	Name  string
+	Email string
+	When  int64
+	Zone  string
+}
+
+// ParseIdent parses an identity line.
+//
+// Returns:
+//   - The parsed identity.
+//   - An error if the email is not enclosed in angle brackets or if the
+//     timestamp or the time zone are malformed.
+func ParseIdent(s string) (Ident, error) {
+	lt := strings.IndexByte(s, '<')
+	gt := strings.IndexByte(s, '>')
+	if lt < 0 || gt < lt {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad email", s)
+	}
+	if strings.ContainsAny(s[lt+1:gt], "<\n") || strings.ContainsAny(s[:lt], ">\n") {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad email", s)
+	}
+	fields := strings.Fields(s[gt+1:])
+	if len(fields) != 2 {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad date", s)
+	}
+	when, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || when < 0 {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad date", s)
+	}
+	zone := fields[1]
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad time zone", s)
+	}
+	if _, err := strconv.Atoi(zone[1:]); err != nil {
+		return Ident{}, fmt.Errorf("malformed ident %q: bad time zone", s)
+	}
+	return Ident{Name: strings.TrimSpace(s[:lt]), Email: s[lt+1 : gt], When: when, Zone: zone}, nil
+}
+
+func (i Ident) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", i.Name, i.Email, i.When, i.Zone)
+}
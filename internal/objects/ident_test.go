@@ -0,0 +1,28 @@
+package objects_test
+
+import (
+	"ggit/internal/objects"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIdent(t *testing.T) {
+	ident, err := objects.ParseIdent("A U Thor <author@example.com> 1527025023 +0200")
+	assert.NoError(t, err)
+	assert.Equal(t, objects.Ident{Name: "A U Thor", Email: "author@example.com", When: 1527025023, Zone: "+0200"}, ident)
+	assert.Equal(t, "A U Thor <author@example.com> 1527025023 +0200", ident.String())
+
+	for _, invalid := range []string{
+		"A U Thor author@example.com 1527025023 +0200",
+		"A U Thor <author@example.com>",
+		"A U Thor <author@example.com> yesterday +0200",
+		"A U Thor <author@example.com> 1527025023 0200",
+		"A U Thor <author@example.com> 1527025023 +02",
+	} {
+		t.Run(invalid, func(t *testing.T) {
+			_, err := objects.ParseIdent(invalid)
+			assert.Error(t, err)
+		})
+	}
+}
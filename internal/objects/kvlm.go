@@ -5,10 +5,11 @@ import (
 	"strings"
 )
 
-// Key-Value List with Message
+// Key-Value List with Message. A commit has no parent when it is a root
+// commit and more than one when it is a merge.
 type kvlm struct {
 	Tree     string
-	Parent   string
+	Parents  []string
 	Author   string
 	Comitter string
 	GPGSIG   string
@@ -48,7 +49,7 @@ func (k *kvlm) Deserialize(data string) {
 		case "tree":
 			k.Tree = value
 		case "parent":
-			k.Parent = value
+			k.Parents = append(k.Parents, value)
 		case "author":
 			k.Author = value
 		case "committer":
@@ -61,10 +62,14 @@ func (k *kvlm) Deserialize(data string) {
 
 func (k *kvlm) Serialize() string {
 	value := fmt.Sprintf("%s %s\n", "tree", k.Tree)
-	value = value + fmt.Sprintf("%s %s\n", "parent", k.Parent)
+	for _, parent := range k.Parents {
+		value = value + fmt.Sprintf("%s %s\n", "parent", parent)
+	}
 	value = value + fmt.Sprintf("%s %s\n", "author", k.Author)
 	value = value + fmt.Sprintf("%s %s\n", "committer", k.Comitter)
-	value = value + fmt.Sprintf("%s %s\n", "gpgsig", strings.ReplaceAll(k.GPGSIG, "\n", "\n "))
+	if k.GPGSIG != "" {
+		value = value + fmt.Sprintf("%s %s\n", "gpgsig", strings.ReplaceAll(k.GPGSIG, "\n", "\n "))
+	}
 	value = value + fmt.Sprintf("\n%s\n", k.Message)
 	return value
 }
@@ -1,8 +1,7 @@
 package objects
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"fmt"
 )
 
 type GitObject interface {
@@ -10,10 +9,13 @@ type GitObject interface {
 	Deserialize(data string) error
 	Format() string
 	Hash() (string, error)
+	HashAlgorithm() *HashAlgorithm
+	SetHashAlgorithm(h *HashAlgorithm)
 }
 
 type object struct {
 	format string
+	hash   *HashAlgorithm
 }
 
 func (o *object) Format() string {
@@ -28,12 +30,42 @@ func (o *object) Deserialize(data string) error {
 }
 
 func (o *object) Hash() (string, error) {
-	data := o.Serialize()
-	hasher := sha1.New()
-	_, err := hasher.Write([]byte(data))
-	if err != nil {
-		return "", err
+	return hashData(o.HashAlgorithm(), o.format, o.Serialize())
+}
+
+// HashAlgorithm returns the algorithm the object ID is computed with,
+// SHA-1 unless another one was set.
+func (o *object) HashAlgorithm() *HashAlgorithm {
+	if o.hash == nil {
+		return SHA1
 	}
-	sha := hex.EncodeToString(hasher.Sum(nil))
-	return sha, nil
+	return o.hash
+}
+
+// SetHashAlgorithm sets the algorithm the object ID is computed with,
+// which also gives the size of the IDs a tree stores.
+func (o *object) SetHashAlgorithm(h *HashAlgorithm) {
+	o.hash = h
+}
+
+// Encode returns the stored representation of an object: a header made of
+// the object format and the payload size, a NUL byte and the payload itself.
+func Encode(o GitObject) string {
+	return encode(o.Format(), o.Serialize())
+}
+
+// EncodePayload returns the stored representation of a payload of the
+// given format, as Encode does for an object.
+func EncodePayload(format string, payload string) string {
+	return encode(format, payload)
+}
+
+func encode(format string, payload string) string {
+	return fmt.Sprintf("%v %v%v%v", format, len(payload), "\x00", payload)
+}
+
+// hashData computes the object ID of a payload of the given format.
+// The ID is the hex encoded hash of the encoded object, header included.
+func hashData(h *HashAlgorithm, format string, payload string) (string, error) {
+	return h.HashObject(format, payload), nil
 }
@@ -0,0 +1,114 @@
+package objects
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tree entry modes as they are stored inside tree objects.
+const (
+	ModeFile       = "100644"
+	ModeExecutable = "100755"
+	ModeSymlink    = "120000"
+	ModeTree       = "40000"
+	ModeGitlink    = "160000"
+)
+
+// EmptyTreeHash is the SHA-1 ID of the tree without entries. Repositories
+// can refer to it without storing it.
+const EmptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+type TreeEntry struct {
+	Mode string
+	Name string
+	Hash string
+}
+
+// IsTree reports whether the entry points to a subtree.
+func (e TreeEntry) IsTree() bool {
+	return e.Mode == ModeTree
+}
+
+// sortKey returns the name used to order entries inside a tree.
+// Subtrees are compared as if their name ended with a slash.
+func (e TreeEntry) sortKey() string {
+	if e.IsTree() {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+type Tree struct {
+	*object
+	Entries []TreeEntry
+}
+
+func NewTree() *Tree {
+	return &Tree{
+		object: &object{
+			format: "tree",
+		},
+	}
+}
+
+// Sort orders the tree entries the way they have to be stored.
+func (t *Tree) Sort() {
+	sort.SliceStable(t.Entries, func(i, j int) bool {
+		return t.Entries[i].sortKey() < t.Entries[j].sortKey()
+	})
+}
+
+// Entry returns the entry with the given name.
+func (t *Tree) Entry(name string) (TreeEntry, bool) {
+	for _, e := range t.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return TreeEntry{}, false
+}
+
+func (t *Tree) Serialize() string {
+	var b strings.Builder
+	for _, e := range t.Entries {
+		raw, _ := hex.DecodeString(e.Hash)
+		b.WriteString(e.Mode)
+		b.WriteString(" ")
+		b.WriteString(e.Name)
+		b.WriteString("\x00")
+		b.Write(raw)
+	}
+	return b.String()
+}
+
+func (t *Tree) Deserialize(data string) error {
+	size := t.HashAlgorithm().Size
+	entries := []TreeEntry{}
+	for data != "" {
+		space := strings.Index(data, " ")
+		if space < 0 {
+			return fmt.Errorf("malformed tree entry: missing mode")
+		}
+		null := strings.Index(data, "\x00")
+		if null < space {
+			return fmt.Errorf("malformed tree entry: missing name")
+		}
+		if len(data) < null+1+size {
+			return fmt.Errorf("malformed tree entry: truncated hash")
+		}
+		entries = append(entries, TreeEntry{
+			Mode: data[:space],
+			Name: data[space+1 : null],
+			Hash: hex.EncodeToString([]byte(data[null+1 : null+1+size])),
+		})
+		data = data[null+1+size:]
+	}
+	t.Entries = entries
+	return nil
+}
+
+func (t *Tree) Hash() (string, error) {
+	return hashData(t.HashAlgorithm(), t.format, t.Serialize())
+}
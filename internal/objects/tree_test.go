@@ -0,0 +1,80 @@
+package objects_test
+
+import (
+	"ggit/internal/objects"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	t.Run("EmptyTree", func(t *testing.T) {
+		tree := objects.NewTree()
+		assert.Equal(t, "tree", tree.Format())
+		sha, err := tree.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", sha)
+	})
+
+	t.Run("SortAndHash", func(t *testing.T) {
+		tree := objects.NewTree()
+		tree.Entries = []objects.TreeEntry{
+			{Mode: objects.ModeFile, Name: "hello", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+			{Mode: objects.ModeTree, Name: "d", Hash: "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2"},
+		}
+		tree.Sort()
+		assert.Equal(t, "d", tree.Entries[0].Name)
+		sha, err := tree.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, "33d3dc5cb51d3fadadae47a73739521805ba8ab1", sha)
+	})
+
+	t.Run("SortTreesWithSlash", func(t *testing.T) {
+		tree := objects.NewTree()
+		tree.Entries = []objects.TreeEntry{
+			{Mode: objects.ModeTree, Name: "a", Hash: "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2"},
+			{Mode: objects.ModeFile, Name: "a.txt", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+		}
+		tree.Sort()
+		assert.Equal(t, "a.txt", tree.Entries[0].Name)
+		assert.Equal(t, "a", tree.Entries[1].Name)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		tree := objects.NewTree()
+		tree.Entries = []objects.TreeEntry{
+			{Mode: objects.ModeTree, Name: "d", Hash: "a1dffc7a64c0b2d395484bf452e9aeb1da3a18f2"},
+			{Mode: objects.ModeFile, Name: "hello", Hash: "ce013625030ba8dba906f756967f9e9ca394464a"},
+		}
+		parsed := objects.NewTree()
+		err := parsed.Deserialize(tree.Serialize())
+		assert.NoError(t, err)
+		assert.Equal(t, tree.Entries, parsed.Entries)
+
+		entry, ok := parsed.Entry("d")
+		assert.True(t, ok)
+		assert.True(t, entry.IsTree())
+	})
+
+	t.Run("SHA256", func(t *testing.T) {
+		tree := objects.NewTree()
+		tree.SetHashAlgorithm(objects.SHA256)
+		sha, err := tree.Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, objects.SHA256.EmptyTree, sha)
+
+		tree.Entries = []objects.TreeEntry{
+			{Mode: objects.ModeFile, Name: "hello", Hash: objects.SHA256.HashObject("blob", "hello\n")},
+		}
+		parsed := objects.NewTree()
+		parsed.SetHashAlgorithm(objects.SHA256)
+		assert.NoError(t, parsed.Deserialize(tree.Serialize()))
+		assert.Equal(t, tree.Entries, parsed.Entries)
+		assert.Error(t, objects.NewTree().Deserialize(tree.Serialize()[:len(tree.Serialize())-8]))
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		tree := objects.NewTree()
+		assert.Error(t, tree.Deserialize("100644 file\x00abc"))
+	})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"ggit/internal/filesystem"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	alternatesFile = "objects/info/alternates"
+	// maxAlternateDepth limits how many alternates files are followed from
+	// the one of the repository.
+	maxAlternateDepth = 5
+)
+
+// Alternates lists the object directories the repository borrows objects
+// from: the ones of GGIT_ALTERNATE_OBJECT_DIRECTORIES, then the ones of
+// objects/info/alternates, then the ones these directories borrow from in
+// turn. A relative path of an alternates file is relative to the objects
+// directory holding it. Missing directories and comment lines are
+// skipped.
+//
+// Returns:
+//   - The absolute paths of the directories, in lookup order and without
+//     the objects directory of the repository itself.
+func (r *Repository) Alternates() []string {
+	own := r.path("objects")
+	seen := map[string]bool{filepath.Clean(own): true}
+	dirs := []string{}
+	var add func(dir string, depth int)
+	add = func(dir string, depth int) {
+		dir = filepath.Clean(dir)
+		if seen[dir] || !filesystem.IsDir(r.FS, dir) {
+			return
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+		if depth < maxAlternateDepth {
+			for _, alt := range r.readAlternates(dir) {
+				add(alt, depth+1)
+			}
+		}
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("GGIT_ALTERNATE_OBJECT_DIRECTORIES")) {
+		if dir == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			add(abs, 1)
+		}
+	}
+	for _, dir := range r.readAlternates(own) {
+		add(dir, 1)
+	}
+	return dirs
+}
+
+// readAlternates reads the info/alternates file of the objects directory
+// dir, an unreadable file listing no directory.
+func (r *Repository) readAlternates(dir string) []string {
+	data, err := filesystem.ReadFileData(r.FS, filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		return nil
+	}
+	dirs := []string{}
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+// AddAlternate adds the objects directory dir to objects/info/alternates,
+// unless it is listed already, and borrows its objects from then on.
+//
+// Returns:
+//   - An error if dir is not a directory or the file can not be written.
+func (r *Repository) AddAlternate(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !filesystem.IsDir(r.FS, dir) {
+		return &os.PathError{Op: "add alternate", Path: dir, Err: os.ErrNotExist}
+	}
+	if !slices.Contains(r.readAlternates(r.path("objects")), dir) {
+		if err := r.WriteTextToFile(dir+"\n", strings.Split(alternatesFile, "/")...); err != nil {
+			return err
+		}
+	}
+	r.Objects = r.openObjects()
+	return nil
+}
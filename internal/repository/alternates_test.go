@@ -0,0 +1,58 @@
+package repository_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAlternates(t *testing.T, r *repository.Repository, path string, data string) {
+	assert.NoError(t, afero.WriteFile(r.FS, path, []byte(data), 0644))
+}
+
+func TestAlternates(t *testing.T) {
+	t.Run("File", func(t *testing.T) {
+		r := newTestRepository(t)
+		assert.NoError(t, r.FS.MkdirAll("/a/objects", os.ModePerm))
+		assert.NoError(t, r.FS.MkdirAll("/b/objects", os.ModePerm))
+		writeAlternates(t, r, "/a/objects/info/alternates", "../../b/objects\n")
+		writeAlternates(t, r, r.Gitdir+"/objects/info/alternates", "# comment\n\n/a/objects\n/missing/objects\n/a/objects\n")
+		assert.Equal(t, []string{"/a/objects", "/b/objects"}, r.Alternates())
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		r := newTestRepository(t)
+		assert.NoError(t, r.FS.MkdirAll("/a/objects", os.ModePerm))
+		assert.NoError(t, r.FS.MkdirAll("/b/objects", os.ModePerm))
+		writeAlternates(t, r, r.Gitdir+"/objects/info/alternates", "/a/objects\n")
+		t.Setenv("GGIT_ALTERNATE_OBJECT_DIRECTORIES", "/b/objects")
+		assert.Equal(t, []string{"/b/objects", "/a/objects"}, r.Alternates())
+	})
+
+	t.Run("Borrow", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r, err := repository.NewRepository(src.FS, "/dst")
+		assert.NoError(t, err)
+		_, err = r.Create(false)
+		assert.NoError(t, err)
+		_, err = r.ReadObject(head)
+		assert.Error(t, err)
+
+		assert.NoError(t, r.AddAlternate("/src/.ggit/objects"))
+		assert.NoError(t, r.AddAlternate("/src/.ggit/objects"))
+		assert.Equal(t, []string{"/src/.ggit/objects"}, r.Alternates())
+		obj, err := r.ReadObject(head)
+		assert.NoError(t, err)
+		assert.Equal(t, "commit", obj.Format())
+
+		// Writing a borrowed object does not copy it.
+		sha, err := r.WriteObject(objects.NewBlob("read me\n"))
+		assert.NoError(t, err)
+		assert.False(t, hasLooseObject(r, sha))
+		assert.Error(t, r.AddAlternate("/missing/objects"))
+	})
+}
@@ -0,0 +1,692 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Minimum scores, in alphanumeric characters, of the lines blame follows
+// when they moved within a file or were copied from another one.
+const (
+	blameMoveScore = 20
+	blameCopyScore = 40
+)
+
+// notCommittedYet is the author of the worktree changes blame finds.
+const notCommittedYet = "Not Committed Yet"
+
+type Blame struct {
+	// Rev is the commit the file is blamed at, the worktree version is
+	// blamed when it is empty.
+	Rev  string
+	Path string
+	// Ranges limit the blamed lines, see parseBlameRange.
+	Ranges           []string
+	IgnoreWhitespace bool
+	// DetectMoves follows lines moved within the file, DetectCopies also
+	// follows lines copied from the other files changed by the same commit.
+	DetectMoves  bool
+	DetectCopies bool
+	Porcelain    bool
+}
+
+// blameCommit is a commit blame goes through. The worktree version of the
+// file is blamed on a fake commit, with the null object ID and no tree,
+// whose parent is HEAD.
+type blameCommit struct {
+	parents   []string
+	tree      string
+	author    objects.Ident
+	committer objects.Ident
+	summary   string
+	files     map[string]diff.File
+}
+
+// blameOrigin is the version of a file in a commit lines can be blamed on.
+// previous is the version in the first parent blame was passed to.
+type blameOrigin struct {
+	commit   string
+	path     string
+	blob     string
+	lines    []string
+	previous *blameOrigin
+}
+
+// blameEntry is a run of lines of the blamed file, from final, that come
+// from the run of lines of its origin from start. Lines are counted from
+// 0. Guilty entries are blamed on their origin for good.
+type blameEntry struct {
+	origin *blameOrigin
+	final  int
+	start  int
+	count  int
+	guilty bool
+}
+
+// blame passes the blame for the lines of a file from commit to parent,
+// newest commits first, until the lines are found in no parent.
+type blame struct {
+	r       *Repository
+	opts    *Blame
+	commits map[string]*blameCommit
+	origins map[string]*blameOrigin
+	entries []*blameEntry
+	// queue holds the commits with entries left to pass, oldest first for
+	// equal dates.
+	queue []string
+}
+
+// Blame finds the commit that introduced each line of a file. Starting
+// from the file at Rev, or in the worktree, the blame for the lines of a
+// commit is passed to its parents, following renames of the file, for the
+// lines a diff finds unchanged. The lines left are blamed on the commit.
+//
+// Returns:
+//   - The blamed lines, in git's default or porcelain format.
+//   - An error if the file does not exist at the revision, if a range is
+//     invalid or if an object can not be read.
+func (r *Repository) Blame(opts *Blame) (string, error) {
+	b := &blame{r: r, opts: opts, commits: map[string]*blameCommit{}, origins: map[string]*blameOrigin{}}
+	opts.Path = path.Clean(filepath.ToSlash(opts.Path))
+	final, err := b.start()
+	if err != nil {
+		return "", err
+	}
+	ranges, err := parseBlameRanges(opts.Ranges, len(final.lines), opts.Path)
+	if err != nil {
+		return "", err
+	}
+	for _, lines := range ranges {
+		if lines[0] == lines[1] {
+			continue
+		}
+		b.entries = append(b.entries, &blameEntry{origin: final, final: lines[0], start: lines[0], count: lines[1] - lines[0]})
+	}
+	b.push(final.commit)
+	for len(b.queue) > 0 {
+		if err := b.passCommit(b.pop()); err != nil {
+			return "", err
+		}
+	}
+	entries := b.coalesce()
+	if opts.Porcelain {
+		return b.formatPorcelain(entries, final.lines), nil
+	}
+	return b.format(entries, final.lines), nil
+}
+
+// start returns the version of the file blame starts from.
+func (b *blame) start() (*blameOrigin, error) {
+	rev := b.opts.Rev
+	if rev == "" {
+		rev = headFile
+	}
+	sha, err := b.r.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	files, err := b.files(sha)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := files[b.opts.Path]
+	if !ok {
+		return nil, fmt.Errorf("no such path '%s' in %s", b.opts.Path, rev)
+	}
+	head, err := b.origin(sha, f)
+	if err != nil || b.opts.Rev != "" {
+		return head, err
+	}
+
+	data, err := filesystem.ReadFileData(b.r.FS, b.r.worktreePath(b.opts.Path))
+	if err != nil {
+		return nil, err
+	}
+	if data == strings.Join(head.lines, "") {
+		return head, nil
+	}
+	now := time.Now()
+	ident := objects.Ident{Name: notCommittedYet, Email: "not.committed.yet", When: now.Unix(), Zone: now.Format("-0700")}
+	b.commits[b.r.ObjectFormat().NullID()] = &blameCommit{
+		parents:   []string{sha},
+		author:    ident,
+		committer: ident,
+		summary:   fmt.Sprintf("Version of %s from %s", b.opts.Path, b.opts.Path),
+	}
+	worktree := &blameOrigin{commit: b.r.ObjectFormat().NullID(), path: b.opts.Path, lines: diff.SplitLines(data)}
+	b.origins[b.r.ObjectFormat().NullID()+"\x00"+b.opts.Path] = worktree
+	return worktree, nil
+}
+
+// parseBlameRanges parses the -L ranges of the lines of a file of n lines
+// into sorted, disjoint ranges of line numbers from 0, end excluded. No
+// ranges stand for the whole file.
+func parseBlameRanges(specs []string, n int, name string) ([][2]int, error) {
+	if len(specs) == 0 {
+		return [][2]int{{0, n}}, nil
+	}
+	ranges := [][2]int{}
+	for _, spec := range specs {
+		start, end, err := parseBlameRange(spec, n, name)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := ranges[:1]
+	for _, lines := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if lines[0] <= last[1] {
+			last[1] = max(last[1], lines[1])
+		} else {
+			merged = append(merged, lines)
+		}
+	}
+	return merged, nil
+}
+
+// parseBlameRange parses a range of lines, numbered from 1, of a file of n
+// lines: "<start>,<end>", "<start>,+<count>", "<start>,-<count>" counting
+// backwards from start, or "<start>" and ",<end>" to and from the end of
+// the file.
+//
+// Returns:
+//   - The first line, from 0, and the line after the last one, within
+//     the file.
+//   - An error if the range is malformed or starts after the end of the
+//     file name.
+func parseBlameRange(spec string, n int, name string) (int, int, error) {
+	from, to, _ := strings.Cut(spec, ",")
+	number := func(s string) (int, error) {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid -L range: %s", spec)
+		}
+		if v < 1 {
+			return 0, fmt.Errorf("-L invalid line number: %d", v)
+		}
+		return v, nil
+	}
+	start, end := 1, n
+	var err error
+	if from != "" {
+		if start, err = number(from); err != nil {
+			return 0, 0, err
+		}
+	}
+	switch {
+	case strings.HasPrefix(to, "+"):
+		count, err := number(to[1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		end = start + count - 1
+	case strings.HasPrefix(to, "-"):
+		count, err := number(to[1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		start, end = max(start-count+1, 1), start
+	case to != "":
+		if end, err = number(to); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start > n {
+		return 0, 0, fmt.Errorf("file %s has only %d lines", name, n)
+	}
+	if start > end {
+		start, end = end, start
+	}
+	return start - 1, min(end, n), nil
+}
+
+// commit reads the commit sha, once.
+func (b *blame) commit(sha string) (*blameCommit, error) {
+	if c, ok := b.commits[sha]; ok {
+		return c, nil
+	}
+	commit, err := b.r.readCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	author, err := objects.ParseIdent(commit.KVLM.Author)
+	if err != nil {
+		return nil, err
+	}
+	committer, err := objects.ParseIdent(commit.KVLM.Comitter)
+	if err != nil {
+		return nil, err
+	}
+	c := &blameCommit{
+		parents:   commit.KVLM.Parents,
+		tree:      commit.KVLM.Tree,
+		author:    author,
+		committer: committer,
+		summary:   subject(commit.KVLM.Message),
+	}
+	b.commits[sha] = c
+	return c, nil
+}
+
+// files returns the files of the tree of the commit sha.
+func (b *blame) files(sha string) (map[string]diff.File, error) {
+	c, err := b.commit(sha)
+	if err != nil || c.files != nil {
+		return c.files, err
+	}
+	c.files, err = b.r.treeFiles(c.tree)
+	return c.files, err
+}
+
+// origin returns the version f of a file in the commit sha.
+func (b *blame) origin(sha string, f diff.File) (*blameOrigin, error) {
+	key := sha + "\x00" + f.Path
+	if o, ok := b.origins[key]; ok {
+		return o, nil
+	}
+	data, err := b.r.readBlob(f.Hash)
+	if err != nil {
+		return nil, err
+	}
+	o := &blameOrigin{commit: sha, path: f.Path, blob: f.Hash, lines: diff.SplitLines(data)}
+	b.origins[key] = o
+	return o, nil
+}
+
+// push queues the commit sha to pass the blame of its entries on.
+func (b *blame) push(sha string) {
+	if !slices.Contains(b.queue, sha) {
+		b.queue = append(b.queue, sha)
+	}
+}
+
+// pop removes the newest commit from the queue.
+func (b *blame) pop() string {
+	newest := 0
+	for i, sha := range b.queue {
+		if b.commits[sha].committer.When > b.commits[b.queue[newest]].committer.When {
+			newest = i
+		}
+	}
+	sha := b.queue[newest]
+	b.queue = slices.Delete(b.queue, newest, newest+1)
+	return sha
+}
+
+// suspects returns the entries blamed on the origin o for now.
+func (b *blame) suspects(o *blameOrigin) []*blameEntry {
+	entries := []*blameEntry{}
+	for _, e := range b.entries {
+		if e.origin == o && !e.guilty {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// passCommit passes the blame for the entries of the commit sha on to its
+// parents. The entries left are the commit's.
+func (b *blame) passCommit(sha string) error {
+	c, err := b.commit(sha)
+	if err != nil {
+		return err
+	}
+	origins := []*blameOrigin{}
+	for _, e := range b.entries {
+		if e.origin.commit == sha && !e.guilty && !slices.Contains(origins, e.origin) {
+			origins = append(origins, e.origin)
+		}
+	}
+	for _, o := range origins {
+		if err := b.pass(o, c); err != nil {
+			return err
+		}
+	}
+	for _, e := range b.entries {
+		if e.origin.commit == sha {
+			e.guilty = true
+		}
+	}
+	return nil
+}
+
+// pass passes the blame for the entries of the origin o, in the commit c,
+// on to the versions of the file in the parents of c. A parent with the
+// same version takes the blame for every line.
+func (b *blame) pass(o *blameOrigin, c *blameCommit) error {
+	parents := make([]*blameOrigin, len(c.parents))
+	for i, p := range c.parents {
+		po, err := b.findOrigin(p, o, c)
+		if err != nil {
+			return err
+		}
+		if po != nil && po.blob == o.blob && o.blob != "" {
+			for _, e := range b.suspects(o) {
+				e.origin = po
+			}
+			b.push(p)
+			return nil
+		}
+		parents[i] = po
+	}
+
+	entries := b.suspects(o)
+	for _, po := range parents {
+		if po == nil {
+			continue
+		}
+		if o.previous == nil {
+			o.previous = po
+		}
+		m := blameLineMap(diff.Hunks(b.keys(po.lines), b.keys(o.lines)), len(o.lines))
+		remaining := []*blameEntry{}
+		for _, e := range entries {
+			remaining = append(remaining, b.split(e, po, func(i int) int { return m[i] })...)
+		}
+		entries = remaining
+	}
+	if b.opts.DetectMoves || b.opts.DetectCopies {
+		for _, po := range parents {
+			if po != nil {
+				entries = b.passMatches(entries, po, blameMoveScore)
+			}
+		}
+	}
+	if !b.opts.DetectCopies || c.tree == "" {
+		return nil
+	}
+	for i, p := range c.parents {
+		pc, err := b.commit(p)
+		if err != nil {
+			return err
+		}
+		changes, err := diff.TreeDiff(b.r, pc.tree, c.tree, nil)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			from := change.From
+			if !from.Exists() || from.Mode == objects.ModeGitlink || (parents[i] != nil && from.Path == parents[i].path) {
+				continue
+			}
+			po, err := b.origin(p, from)
+			if err != nil {
+				return err
+			}
+			entries = b.passMatches(entries, po, blameCopyScore)
+		}
+	}
+	return nil
+}
+
+// findOrigin returns the version in the parent p of the file of the origin
+// o, in the commit c, following renames.
+//
+// Returns:
+//   - The version of the file, nil when the parent does not have it.
+//   - An error if a tree or the file can not be read.
+func (b *blame) findOrigin(p string, o *blameOrigin, c *blameCommit) (*blameOrigin, error) {
+	files, err := b.files(p)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := files[o.path]; ok {
+		return b.origin(p, f)
+	}
+	if c.tree == "" {
+		return nil, nil
+	}
+	changes, err := diff.TreeDiff(b.r, b.commits[p].tree, c.tree, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if change.Status == diff.Renamed && change.To.Path == o.path {
+			return b.origin(p, change.From)
+		}
+	}
+	return nil, nil
+}
+
+// keys returns the lines as they are compared: without whitespace when
+// it is ignored.
+func (b *blame) keys(lines []string) []string {
+	if !b.opts.IgnoreWhitespace {
+		return lines
+	}
+	keys := make([]string, len(lines))
+	for i, line := range lines {
+		keys[i] = strings.Join(strings.Fields(line), "")
+	}
+	return keys
+}
+
+// blameLineMap maps each of the n lines of the new side of hunks to its
+// line on the old side, or to -1 when the line changed.
+func blameLineMap(hunks []diff.Hunk, n int) []int {
+	m := make([]int, n)
+	line, old := 0, 0
+	for _, h := range hunks {
+		for ; line < h.NewStart; line, old = line+1, old+1 {
+			m[line] = old
+		}
+		for ; line < h.NewStart+h.NewCount; line++ {
+			m[line] = -1
+		}
+		old = h.OldStart + h.OldCount
+	}
+	for ; line < n; line, old = line+1, old+1 {
+		m[line] = old
+	}
+	return m
+}
+
+// split passes the blame for the lines of the entry e that m maps, from
+// their line in the origin of e, to the same lines of po, splitting e into
+// runs of lines.
+//
+// Returns:
+//   - The entries of the lines m does not map, still blamed on the
+//     origin of e.
+func (b *blame) split(e *blameEntry, po *blameOrigin, m func(int) int) []*blameEntry {
+	pieces := []*blameEntry{}
+	for i := 0; i < e.count; {
+		j := i + 1
+		if p := m(e.start + i); p < 0 {
+			for ; j < e.count && m(e.start+j) < 0; j++ {
+			}
+			pieces = append(pieces, &blameEntry{origin: e.origin, final: e.final + i, start: e.start + i, count: j - i})
+		} else {
+			for ; j < e.count && m(e.start+j) == p+j-i; j++ {
+			}
+			pieces = append(pieces, &blameEntry{origin: po, final: e.final + i, start: p, count: j - i})
+		}
+		i = j
+	}
+	*e = *pieces[0]
+	pieces[0] = e
+	b.entries = append(b.entries, pieces[1:]...)
+
+	remaining := []*blameEntry{}
+	for _, piece := range pieces {
+		if piece.origin == po {
+			b.push(po.commit)
+		} else {
+			remaining = append(remaining, piece)
+		}
+	}
+	return remaining
+}
+
+// passMatches passes the blame for the lines of the entries found as is
+// in the file of po, wherever they are, when the best run of matching
+// lines of an entry scores at least score.
+//
+// Returns:
+//   - The entries of the lines still blamed on their origin.
+func (b *blame) passMatches(entries []*blameEntry, po *blameOrigin, score int) []*blameEntry {
+	remaining := []*blameEntry{}
+	for len(entries) > 0 {
+		e := entries[0]
+		entries = entries[1:]
+		lines := e.origin.lines[e.start : e.start+e.count]
+		m := blameLineMap(diff.Hunks(b.keys(po.lines), b.keys(lines)), len(lines))
+		best, from, to := 0, 0, 0
+		for i := 0; i < len(m); {
+			if m[i] < 0 {
+				i++
+				continue
+			}
+			j := i + 1
+			for ; j < len(m) && m[j] == m[j-1]+1; j++ {
+			}
+			if s := alnumScore(lines[i:j]); s > best {
+				best, from, to = s, i, j
+			}
+			i = j
+		}
+		if best < score {
+			remaining = append(remaining, e)
+			continue
+		}
+		start := e.start
+		entries = append(entries, b.split(e, po, func(line int) int {
+			if i := line - start; i >= from && i < to {
+				return m[i]
+			}
+			return -1
+		})...)
+	}
+	return remaining
+}
+
+// alnumScore counts the alphanumeric characters of lines.
+func alnumScore(lines []string) int {
+	score := 0
+	for _, line := range lines {
+		for _, c := range line {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				score++
+			}
+		}
+	}
+	return score
+}
+
+// coalesce returns the entries by line, joining the runs of lines that
+// follow each other in the same origin.
+func (b *blame) coalesce() []*blameEntry {
+	sort.Slice(b.entries, func(i, j int) bool { return b.entries[i].final < b.entries[j].final })
+	entries := []*blameEntry{}
+	for _, e := range b.entries {
+		if n := len(entries); n > 0 {
+			last := entries[n-1]
+			if last.origin == e.origin && last.start+last.count == e.start && last.final+last.count == e.final {
+				last.count += e.count
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// boundary reports whether the commit sha is a root commit, whose lines
+// are shown with a caret.
+func (b *blame) boundary(sha string) bool {
+	return sha != b.r.ObjectFormat().NullID() && len(b.commits[sha].parents) == 0
+}
+
+// format renders the entries like git's default format: the commit, the
+// path when the file had other names, the author, the date, the line
+// number and the line.
+func (b *blame) format(entries []*blameEntry, lines []string) string {
+	showNames := false
+	nameWidth, authorWidth, last := 0, 0, 0
+	for _, e := range entries {
+		showNames = showNames || e.origin.path != b.opts.Path
+		nameWidth = max(nameWidth, len(e.origin.path))
+		authorWidth = max(authorWidth, utf8.RuneCountInString(b.commits[e.origin.commit].author.Name))
+		last = max(last, e.final+e.count)
+	}
+	digits := len(strconv.Itoa(last))
+
+	var out strings.Builder
+	for _, e := range entries {
+		c := b.commits[e.origin.commit]
+		id := e.origin.commit[:abbrevLength+1]
+		if b.boundary(e.origin.commit) {
+			id = "^" + e.origin.commit[:abbrevLength]
+		}
+		name := ""
+		if showNames {
+			name = fmt.Sprintf(" %-*s", nameWidth, e.origin.path)
+		}
+		pad := authorWidth - utf8.RuneCountInString(c.author.Name)
+		date := identTime(c.author).Format("2006-01-02 15:04:05 -0700")
+		for i := 0; i < e.count; i++ {
+			fmt.Fprintf(&out, "%s%s (%s%*s %s %*d) %s", id, name, c.author.Name, pad, "", date, digits, e.final+i+1, lines[e.final+i])
+			if !strings.HasSuffix(lines[e.final+i], "\n") {
+				out.WriteString("\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+// formatPorcelain renders the entries in git's porcelain format: a header
+// line per line, with the details of each commit the first time it shows,
+// followed by the line indented with a tab.
+func (b *blame) formatPorcelain(entries []*blameEntry, lines []string) string {
+	paths := map[string][]string{}
+	for _, e := range entries {
+		if !slices.Contains(paths[e.origin.commit], e.origin.path) {
+			paths[e.origin.commit] = append(paths[e.origin.commit], e.origin.path)
+		}
+	}
+	shown := map[string]bool{}
+	var out strings.Builder
+	for _, e := range entries {
+		sha := e.origin.commit
+		c := b.commits[sha]
+		fmt.Fprintf(&out, "%s %d %d %d\n", sha, e.start+1, e.final+1, e.count)
+		if !shown[sha] {
+			shown[sha] = true
+			fmt.Fprintf(&out, "author %s\nauthor-mail <%s>\nauthor-time %d\nauthor-tz %s\n", c.author.Name, c.author.Email, c.author.When, c.author.Zone)
+			fmt.Fprintf(&out, "committer %s\ncommitter-mail <%s>\ncommitter-time %d\ncommitter-tz %s\n", c.committer.Name, c.committer.Email, c.committer.When, c.committer.Zone)
+			fmt.Fprintf(&out, "summary %s\n", c.summary)
+			if b.boundary(sha) {
+				out.WriteString("boundary\n")
+			}
+			if p := e.origin.previous; p != nil {
+				fmt.Fprintf(&out, "previous %s %s\n", p.commit, p.path)
+			}
+			fmt.Fprintf(&out, "filename %s\n", e.origin.path)
+		} else if len(paths[sha]) > 1 {
+			fmt.Fprintf(&out, "filename %s\n", e.origin.path)
+		}
+		for i := 0; i < e.count; i++ {
+			if i > 0 {
+				fmt.Fprintf(&out, "%s %d %d\n", sha, e.start+i+1, e.final+i+1)
+			}
+			out.WriteString("\t" + lines[e.final+i])
+			if !strings.HasSuffix(lines[e.final+i], "\n") {
+				out.WriteString("\n")
+			}
+		}
+	}
+	return out.String()
+}
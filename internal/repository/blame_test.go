@@ -0,0 +1,141 @@
+package repository_test
+
+import (
+	"fmt"
+	"ggit/internal/repository"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// commitAs commits paths like commitWorktree, authored by name at the
+// given time.
+func commitAs(t *testing.T, r *repository.Repository, name string, when int, message string, paths ...string) string {
+	t.Setenv("GGIT_AUTHOR_NAME", name)
+	t.Setenv("GGIT_AUTHOR_EMAIL", strings.ToLower(name)+"@example.com")
+	t.Setenv("GGIT_AUTHOR_DATE", fmt.Sprintf("%d +0000", when))
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	t.Setenv("GGIT_COMMITTER_DATE", fmt.Sprintf("%d +0000", when))
+	return commitWorktree(t, r, message, paths...)
+}
+
+// newBlameRepository returns a repository whose file f was created by
+// Ann, then had its second line changed by Bob.
+func newBlameRepository(t *testing.T) (*repository.Repository, string, string) {
+	r := newTestRepository(t)
+	writeWorktreeFile(t, r, "f", "first line of the file\nsecond line\nthird line\n")
+	base := commitAs(t, r, "Ann", 1000, "base", "f")
+	writeWorktreeFile(t, r, "f", "first line of the file\nsecond line, changed\nthird line\n")
+	change := commitAs(t, r, "Bob", 2000, "change", "f")
+	return r, base, change
+}
+
+func TestBlame(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) {
+		r, base, change := newBlameRepository(t)
+		out, err := r.Blame(&repository.Blame{Path: "f"})
+		assert.NoError(t, err)
+		assert.Equal(t, "^"+base[:7]+" (Ann 1970-01-01 00:16:40 +0000 1) first line of the file\n"+
+			change[:8]+" (Bob 1970-01-01 00:33:20 +0000 2) second line, changed\n"+
+			"^"+base[:7]+" (Ann 1970-01-01 00:16:40 +0000 3) third line\n", out)
+
+		out, err = r.Blame(&repository.Blame{Rev: "HEAD~1", Path: "f", Ranges: []string{"2,+1"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "^"+base[:7]+" (Ann 1970-01-01 00:16:40 +0000 2) second line\n", out)
+
+		_, err = r.Blame(&repository.Blame{Path: "nope"})
+		assert.EqualError(t, err, "no such path 'nope' in HEAD")
+	})
+
+	t.Run("Ranges", func(t *testing.T) {
+		r, _, _ := newBlameRepository(t)
+		for spec, lines := range map[string]string{"2,3": "23", "2": "23", ",2": "12", "3,-2": "23", "2,9": "23", "3,1": "123"} {
+			out, err := r.Blame(&repository.Blame{Path: "f", Ranges: []string{spec}})
+			assert.NoError(t, err)
+			numbers := ""
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+				numbers += line[strings.Index(line, ")")-1 : strings.Index(line, ")")]
+			}
+			assert.Equal(t, lines, numbers, spec)
+		}
+
+		_, err := r.Blame(&repository.Blame{Path: "f", Ranges: []string{"5"}})
+		assert.EqualError(t, err, "file f has only 3 lines")
+		_, err = r.Blame(&repository.Blame{Path: "f", Ranges: []string{"0,1"}})
+		assert.EqualError(t, err, "-L invalid line number: 0")
+	})
+
+	t.Run("Porcelain", func(t *testing.T) {
+		r, base, change := newBlameRepository(t)
+		out, err := r.Blame(&repository.Blame{Path: "f", Porcelain: true})
+		assert.NoError(t, err)
+		assert.Equal(t, base+" 1 1 1\n"+
+			"author Ann\nauthor-mail <ann@example.com>\nauthor-time 1000\nauthor-tz +0000\n"+
+			"committer C O Mitter\ncommitter-mail <committer@example.com>\ncommitter-time 1000\ncommitter-tz +0000\n"+
+			"summary base\nboundary\nfilename f\n\tfirst line of the file\n"+
+			change+" 2 2 1\n"+
+			"author Bob\nauthor-mail <bob@example.com>\nauthor-time 2000\nauthor-tz +0000\n"+
+			"committer C O Mitter\ncommitter-mail <committer@example.com>\ncommitter-time 2000\ncommitter-tz +0000\n"+
+			"summary change\nprevious "+base+" f\nfilename f\n\tsecond line, changed\n"+
+			base+" 3 3 1\n\tthird line\n", out)
+	})
+
+	t.Run("IgnoreWhitespace", func(t *testing.T) {
+		r, base, change := newBlameRepository(t)
+		writeWorktreeFile(t, r, "f", "first  line of\tthe file\nsecond line, changed\nthird line\n")
+		commitAs(t, r, "Cid", 3000, "spaces", "f")
+		out, err := r.Blame(&repository.Blame{Path: "f", IgnoreWhitespace: true, Ranges: []string{"1,2"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "^"+base[:7]+" (Ann 1970-01-01 00:16:40 +0000 1) first  line of\tthe file\n"+
+			change[:8]+" (Bob 1970-01-01 00:33:20 +0000 2) second line, changed\n", out)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		r, base, _ := newBlameRepository(t)
+		assert.NoError(t, r.FS.Rename(filepath.Join(r.Worktree, "f"), filepath.Join(r.Worktree, "g")))
+		writeWorktreeFile(t, r, "g", "first line of the file\nsecond line, changed\nthird line\nfourth line\n")
+		rename := commitAs(t, r, "Cid", 3000, "rename", "f", "g")
+		out, err := r.Blame(&repository.Blame{Path: "g", Ranges: []string{"3,"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "^"+base[:7]+" f (Ann 1970-01-01 00:16:40 +0000 3) third line\n"+
+			rename[:8]+" g (Cid 1970-01-01 00:50:00 +0000 4) fourth line\n", out)
+	})
+
+	t.Run("Moves", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeWorktreeFile(t, r, "f", "alpha beta gamma delta\nepsilon zeta eta theta\nthe end of the file with enough words\n")
+		writeWorktreeFile(t, r, "h", "iota kappa lambda mu nu xi\nomicron pi rho sigma tau\n")
+		base := commitAs(t, r, "Ann", 1000, "base", "f", "h")
+		writeWorktreeFile(t, r, "f", "the end of the file with enough words\nalpha beta gamma delta\nepsilon zeta eta theta\niota kappa lambda mu nu xi\nomicron pi rho sigma tau\n")
+		writeWorktreeFile(t, r, "h", "changed\n")
+		move := commitAs(t, r, "Bob", 2000, "move", "f", "h")
+
+		blamed := func(opts *repository.Blame) []string {
+			out, err := r.Blame(opts)
+			assert.NoError(t, err)
+			commits := []string{}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+				commits = append(commits, strings.TrimPrefix(line, "^")[:7])
+			}
+			return commits
+		}
+		assert.Equal(t, []string{move[:7], base[:7], base[:7], move[:7], move[:7]}, blamed(&repository.Blame{Path: "f"}))
+		assert.Equal(t, []string{base[:7], base[:7], base[:7], move[:7], move[:7]}, blamed(&repository.Blame{Path: "f", DetectMoves: true}))
+		assert.Equal(t, []string{base[:7], base[:7], base[:7], base[:7], base[:7]}, blamed(&repository.Blame{Path: "f", DetectCopies: true}))
+	})
+
+	t.Run("Worktree", func(t *testing.T) {
+		r, base, _ := newBlameRepository(t)
+		writeWorktreeFile(t, r, "f", "first line of the file\nsecond line, changed\nthird line, again\n")
+		out, err := r.Blame(&repository.Blame{Path: "f", Ranges: []string{"3"}})
+		assert.NoError(t, err)
+		assert.Regexp(t, `^00000000 \(Not Committed Yet \S+ \S+ \S+ 3\) third line, again\n$`, out)
+
+		out, err = r.Blame(&repository.Blame{Path: "f", Ranges: []string{"1"}, Porcelain: true})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, base+" 1 1 1\n"))
+	})
+}
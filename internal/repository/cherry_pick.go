@@ -0,0 +1,547 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Actions of the sequencer, as written in its todo list.
+const (
+	ActionPick   = "pick"
+	ActionRevert = "revert"
+)
+
+// Files recording a cherry-pick or a revert that stopped before committing.
+const (
+	cherryPickHeadFile = "CHERRY_PICK_HEAD"
+	revertHeadFile     = "REVERT_HEAD"
+)
+
+type CherryPick struct {
+	Action  string
+	Commits []string
+	// RecordOrigin appends a "(cherry picked from commit ...)" line to the
+	// messages of picked commits.
+	RecordOrigin bool
+	// Mainline is the number of the parent, from 1, merge commits are
+	// picked or reverted against.
+	Mainline int
+	NoCommit bool
+	Continue bool
+	Skip     bool
+	Abort    bool
+}
+
+// commandName returns the command running an action.
+func commandName(action string) string {
+	if action == ActionRevert {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+// CherryPick applies the changes of commits to the current branch, one
+// commit at a time, or reverts them with ActionRevert. Each commit is
+// three-way merged with HEAD, from its parent, and committed. Commits are
+// given one by one or as ranges, e.g. "a..b" or "^a b", which are applied
+// oldest first.
+//
+// The commits left to apply are kept in the sequencer state: a conflict
+// stops the sequence, which resumes with Continue once it is resolved,
+// goes on without the conflicted commit with Skip and is undone with
+// Abort.
+//
+// Returns:
+//   - The messages of the merges and the summaries of the new commits.
+//   - Whether the sequence is complete; conflicts stop it.
+//   - An error if there is nothing to apply, another sequence is in
+//     progress or a commit can not be applied, e.g. because of local
+//     changes.
+func (r *Repository) CherryPick(opts *CherryPick) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	command := commandName(opts.Action)
+	switch {
+	case opts.Continue:
+		return r.sequencerContinue()
+	case opts.Skip && !r.sequencerInProgress():
+		return "", false, fmt.Errorf("no %s in progress", command)
+	case opts.Skip:
+		return r.sequencerSkip()
+	case opts.Abort:
+		out, err := r.sequencerAbort()
+		return out, err == nil, err
+	case r.sequencerInProgress():
+		return "", false, fmt.Errorf("a cherry-pick or revert is already in progress\nhint: try \"ggit %s (--continue | --skip | --abort)\"", command)
+	case opts.Mainline < 0:
+		return "", false, fmt.Errorf("mainline must be a positive number")
+	}
+
+	commits, err := r.sequenceCommits(opts.Commits)
+	if err != nil {
+		return "", false, err
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	if !opts.NoCommit {
+		headTree, err := r.headTree(head)
+		if err != nil {
+			return "", false, err
+		}
+		headFiles, err := r.treeFiles(headTree)
+		if err != nil {
+			return "", false, err
+		}
+		idx, err := r.ReadIndex()
+		if err != nil {
+			return "", false, err
+		}
+		if len(indexChanges(idx, headFiles)) > 0 || len(idx.Conflicts()) > 0 {
+			return "", false, fmt.Errorf("your local changes would be overwritten by %s.\nhint: commit your changes or stash them to proceed.", command)
+		}
+	}
+
+	steps := make([]sequencerStep, len(commits))
+	for i, sha := range commits {
+		commit, err := r.readCommit(sha)
+		if err != nil {
+			return "", false, err
+		}
+		if len(commit.KVLM.Parents) > 1 && opts.Mainline == 0 {
+			return "", false, fmt.Errorf("commit %s is a merge but no -m option was given.", sha)
+		}
+		steps[i] = sequencerStep{action: opts.Action, commit: sha, subject: subject(commit.KVLM.Message)}
+	}
+	state := &sequencerState{head: head, recordOrigin: opts.RecordOrigin, mainline: opts.Mainline, noCommit: opts.NoCommit}
+	if err := r.writeSequencerState(state, steps); err != nil {
+		return "", false, err
+	}
+	out, done, err := r.runSequencer(&strings.Builder{})
+	if err != nil {
+		// Nothing to go on with or abort when the first step failed.
+		if current, _ := r.headCommit(); current == head {
+			if err := r.removeSequencerState(); err != nil {
+				return "", false, err
+			}
+		}
+	}
+	return out, done, err
+}
+
+// sequenceCommits resolves the commits to apply, in order. When a range is
+// given, e.g. "a..b" or "^a", the commits are listed like rev-list does,
+// oldest first; otherwise they are taken as given.
+//
+// Returns:
+//   - The IDs of the commits.
+//   - An error if a revision is invalid or the set is empty.
+func (r *Repository) sequenceCommits(revs []string) ([]string, error) {
+	include, exclude := []string{}, []string{}
+	walk := false
+	for _, rev := range revs {
+		from, to, isRange := strings.Cut(rev, "..")
+		switch {
+		case isRange:
+			walk = true
+			if from == "" {
+				from = headFile
+			}
+			if to == "" {
+				to = headFile
+			}
+			fromSHA, err := r.ResolveCommit(from)
+			if err != nil {
+				return nil, err
+			}
+			exclude = append(exclude, fromSHA)
+			rev = to
+		case strings.HasPrefix(rev, "^"):
+			walk = true
+			sha, err := r.ResolveCommit(rev[1:])
+			if err != nil {
+				return nil, err
+			}
+			exclude = append(exclude, sha)
+			continue
+		}
+		sha, err := r.ResolveCommit(rev)
+		if err != nil {
+			return nil, err
+		}
+		include = append(include, sha)
+	}
+
+	commits := include
+	if walk {
+		var err error
+		if commits, err = r.RevList(include, exclude); err != nil {
+			return nil, err
+		}
+		slices.Reverse(commits)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("empty commit set passed")
+	}
+	return commits, nil
+}
+
+// pickCommit applies one step of a sequence to HEAD, or only to the index
+// and the worktree with noCommit.
+//
+// Returns:
+//   - Whether the step is done; it is not when it conflicts or its result is
+//     empty, in which case the sequence stops.
+//   - An error if the commit can not be applied.
+func (r *Repository) pickCommit(b *strings.Builder, step sequencerStep, state *sequencerState) (bool, error) {
+	command := commandName(step.action)
+	commit, err := r.readCommit(step.commit)
+	if err != nil {
+		return false, err
+	}
+	parents := commit.KVLM.Parents
+	parent := ""
+	switch {
+	case len(parents) > 1 && state.mainline == 0:
+		return false, fmt.Errorf("commit %s is a merge but no -m option was given.", step.commit)
+	case len(parents) > 1 && state.mainline > len(parents):
+		return false, fmt.Errorf("commit %s does not have parent %d", step.commit, state.mainline)
+	case len(parents) > 1:
+		parent = parents[state.mainline-1]
+	case len(parents) == 1:
+		parent = parents[0]
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return false, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return false, err
+	}
+	ours := headTree
+	if state.noCommit {
+		if len(idx.Conflicts()) > 0 {
+			return false, fmt.Errorf("%s is not possible because you have unmerged files.", command)
+		}
+		if ours, err = r.WriteTree(idx); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := r.applyCommit(step.action, step.commit, step.subject, parent, idx, ours)
+	if err != nil {
+		return false, err
+	}
+	message := commit.KVLM.Message + "\n"
+	if step.action == ActionRevert {
+		message = revertMessage(commit, step.commit, parent)
+	} else if state.recordOrigin {
+		message = appendTrailer(message, fmt.Sprintf("(cherry picked from commit %s)", step.commit))
+	}
+	b.WriteString(m.report())
+
+	if len(m.conflicts) > 0 {
+		if err := r.writeSequencerMessage(message, m.conflicts); err != nil {
+			return false, err
+		}
+		if !state.noCommit {
+			if err := r.ReplaceTextFile(step.commit+"\n", pickHeadFile(step.action)); err != nil {
+				return false, err
+			}
+		}
+		verb := "apply"
+		if step.action == ActionRevert {
+			verb = "revert"
+		}
+		fmt.Fprintf(b, "error: could not %s %s... %s\n", verb, shortID(step.commit), step.subject)
+		fmt.Fprintf(b, "hint: After resolving the conflicts, mark them with\nhint: \"ggit add/rm <pathspec>\", then run\nhint: \"ggit %s --continue\".\n"+
+			"hint: You can instead skip this commit with \"ggit %s --skip\".\nhint: To abort and get back to the state before \"ggit %s\",\nhint: run \"ggit %s --abort\".\n",
+			command, command, command, command)
+		return false, nil
+	}
+	if state.noCommit {
+		return true, r.writeSequencerMessage(message, nil)
+	}
+
+	tree, err := r.writeFiles(m.files)
+	if err != nil {
+		return false, err
+	}
+	if tree == headTree {
+		if err := r.writeSequencerMessage(message, nil); err != nil {
+			return false, err
+		}
+		if err := r.ReplaceTextFile(step.commit+"\n", pickHeadFile(step.action)); err != nil {
+			return false, err
+		}
+		b.WriteString(emptyPickMessage(command))
+		return false, nil
+	}
+	var sha string
+	if step.action == ActionRevert {
+		sha, err = r.CommitTree(tree, headParents(head), message)
+	} else {
+		sha, err = r.commitTreeKeepingAuthor(tree, headParents(head), message, commit)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := r.UpdateHead(sha, fmt.Sprintf("%s: %s", command, subject(message))); err != nil {
+		return false, err
+	}
+	summary, err := r.commitSummary(sha, headTree, true)
+	if err != nil {
+		return false, err
+	}
+	b.WriteString(summary)
+	return true, r.runPostHook(b, "post-commit")
+}
+
+// applyCommit merges the changes a commit made over parent into the tree
+// ours, or their reverse with ActionRevert, then checks the result out over
+// the index idx. The sides of the conflicts are labelled after the commit
+// and its subject.
+//
+// Returns:
+//   - The merge, with its conflicts and messages.
+//   - An error if a tree can not be read or the worktree can not be updated.
+func (r *Repository) applyCommit(action string, sha string, subject string, parent string, idx *index.Index, ours string) (*treeMerge, error) {
+	commitTree, err := r.peelTree(sha)
+	if err != nil {
+		return nil, err
+	}
+	parentTree := r.ObjectFormat().EmptyTree
+	if parent != "" {
+		if parentTree, err = r.peelTree(parent); err != nil {
+			return nil, err
+		}
+	}
+	style, err := r.conflictStyle("")
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("%s (%s)", shortID(sha), subject)
+	var m *treeMerge
+	if action == ActionRevert {
+		m = r.newTreeMerge(headFile, "parent of "+label, style)
+		m.base = label
+		err = m.merge(commitTree, ours, parentTree)
+	} else {
+		m = r.newTreeMerge(headFile, label, style)
+		m.base = "parent of " + label
+		err = m.merge(parentTree, ours, commitTree)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkout(indexFiles(idx), m.files, false, "merge"); err != nil {
+		return nil, err
+	}
+	if err := r.WriteIndex(r.buildIndex(m.files, m.stages, idx)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// pickHeadFile returns the file recording the commit a stopped action was
+// applying.
+func pickHeadFile(action string) string {
+	if action == ActionRevert {
+		return revertHeadFile
+	}
+	return cherryPickHeadFile
+}
+
+func headParents(head string) []string {
+	if head == "" {
+		return nil
+	}
+	return []string{head}
+}
+
+func emptyPickMessage(command string) string {
+	return fmt.Sprintf("The previous %s is now empty, possibly due to conflict resolution.\n"+
+		"If you wish to commit it anyway, use:\n\n    ggit commit --allow-empty\n\nOtherwise, please use 'ggit %s --skip'\n", command, command)
+}
+
+// commitTreeKeepingAuthor creates a commit like CommitTree, authored by the
+// author of original.
+func (r *Repository) commitTreeKeepingAuthor(tree string, parents []string, message string, original *objects.Commit) (string, error) {
+	author, err := objects.ParseIdent(original.KVLM.Author)
+	if err != nil {
+		return "", err
+	}
+	return r.commitTreeAs(tree, parents, message, author)
+}
+
+// revertMessage returns the default message of the commit reverting commit
+// sha. Reverted merges also name the parent they are reverted against.
+func revertMessage(commit *objects.Commit, sha string, parent string) string {
+	message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", subject(commit.KVLM.Message), sha)
+	if len(commit.KVLM.Parents) > 1 {
+		message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+	}
+	return message + ".\n"
+}
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9-]+: |^\(cherry picked from commit [0-9a-f]+\)$`)
+
+// appendTrailer appends a line to the trailers of a message: to its last
+// paragraph when it is made of trailers, otherwise to a new one.
+func appendTrailer(message string, line string) string {
+	message = strings.TrimRight(message, "\n")
+	paragraphs := strings.Split(message, "\n\n")
+	last := paragraphs[len(paragraphs)-1]
+	trailers := len(paragraphs) > 1
+	for _, l := range strings.Split(last, "\n") {
+		if !trailerLine.MatchString(l) {
+			trailers = false
+		}
+	}
+	if trailers {
+		return message + "\n" + line + "\n"
+	}
+	return message + "\n\n" + line + "\n"
+}
+
+// writeSequencerMessage prepares the message of the commit of a stopped
+// step, listing the conflicts as comments like merges do.
+func (r *Repository) writeSequencerMessage(message string, conflicts []string) error {
+	var b strings.Builder
+	b.WriteString(message)
+	if len(conflicts) > 0 {
+		b.WriteString("\n# Conflicts:\n")
+		for _, c := range conflicts {
+			fmt.Fprintf(&b, "#\t%s\n", c)
+		}
+	}
+	return r.ReplaceTextFile(b.String(), mergeMsgFile)
+}
+
+// commitSummary describes a new commit as its committing commands do: the
+// branch, the abbreviated ID and the subject, the author when someone else
+// committed it, the author date with showDate and the diffstat summary
+// against from.
+func (r *Repository) commitSummary(sha string, from string, showDate bool) (string, error) {
+	commit, err := r.readCommit(sha)
+	if err != nil {
+		return "", err
+	}
+	author, err := objects.ParseIdent(commit.KVLM.Author)
+	if err != nil {
+		return "", err
+	}
+	committer, err := objects.ParseIdent(commit.KVLM.Comitter)
+	if err != nil {
+		return "", err
+	}
+	branch := r.branchName()
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s %s] %s\n", branch, shortID(sha), subject(commit.KVLM.Message))
+	if author.Name != committer.Name || author.Email != committer.Email {
+		fmt.Fprintf(&b, " Author: %s <%s>\n", author.Name, author.Email)
+	}
+	if showDate {
+		fmt.Fprintf(&b, " Date: %s\n", formatDate(author))
+	}
+
+	changes, err := diff.TreeDiff(r, from, commit.KVLM.Tree, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	if err != nil {
+		return "", err
+	}
+	stats, err := diff.Stats(r, changes)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(diff.FormatShortstat(stats) + diff.FormatSummary(changes))
+	return b.String(), nil
+}
+
+// stoppedPick returns the commit a stopped step was applying and its
+// action, or an empty string when no step is stopped.
+func (r *Repository) stoppedPick() (string, string, error) {
+	for _, action := range []string{ActionPick, ActionRevert} {
+		if r.hasFile(pickHeadFile(action)) {
+			data, err := r.readFile(pickHeadFile(action))
+			return strings.TrimSpace(data), action, err
+		}
+	}
+	return "", "", nil
+}
+
+// commitStoppedPick commits the resolved index for a stopped step, with
+// the prepared message.
+func (r *Repository) commitStoppedPick(b *strings.Builder, idx *index.Index, sha string, action string) (bool, error) {
+	if len(idx.Conflicts()) > 0 {
+		return false, fmt.Errorf("Committing is not possible because you have unmerged files.")
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return false, err
+	}
+	tree, err := r.WriteTree(idx)
+	if err != nil {
+		return false, err
+	}
+	if tree == headTree {
+		b.WriteString(emptyPickMessage(commandName(action)))
+		return false, nil
+	}
+	message := ""
+	if r.hasFile(mergeMsgFile) {
+		if message, err = r.readFile(mergeMsgFile); err != nil {
+			return false, err
+		}
+	}
+	message = CleanupMessage(message)
+	if message == "" {
+		return false, fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+
+	var commit string
+	reflog := "commit: "
+	if action == ActionRevert {
+		commit, err = r.CommitTree(tree, headParents(head), message)
+	} else {
+		var original *objects.Commit
+		if original, err = r.readCommit(sha); err != nil {
+			return false, err
+		}
+		commit, err = r.commitTreeKeepingAuthor(tree, headParents(head), message, original)
+		reflog = "commit (cherry-pick): "
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := r.UpdateHead(commit, reflog+subject(message)); err != nil {
+		return false, err
+	}
+	if err := r.removeFiles(pickHeadFile(action), mergeMsgFile); err != nil {
+		return false, err
+	}
+	summary, err := r.commitSummary(commit, headTree, action != ActionRevert)
+	if err != nil {
+		return false, err
+	}
+	b.WriteString(summary)
+	return true, r.runPostHook(b, "post-commit")
+}
@@ -0,0 +1,140 @@
+package repository_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func readHeadCommit(t *testing.T, r *repository.Repository) (string, *objects.Commit) {
+	head, err := r.ResolveRef("HEAD")
+	assert.NoError(t, err)
+	obj, err := r.ReadObject(head)
+	assert.NoError(t, err)
+	return head, obj.(*objects.Commit)
+}
+
+func TestCherryPick(t *testing.T) {
+	t.Run("Pick", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		out, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic"}, RecordOrigin: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		head, commit := readHeadCommit(t, r)
+		assert.Equal(t, "Auto-merging f\n[master "+head[:7]+"] topic\n Author: A U Thor <author@example.com>\n Date: Thu Jan 1 00:16:40 1970 +0000\n"+
+			" 2 files changed, 2 insertions(+), 1 deletion(-)\n create mode 100644 t\n", out)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "topic\n\n(cherry picked from commit "+topic+")", commit.KVLM.Message)
+		assert.Equal(t, "1\nM\n3\n4\n5\nT\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "topic only\n", readWorktreeFile(t, r, "t"))
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Gitdir, "sequencer"))
+		assert.NoError(t, err)
+		assert.False(t, exists, "the sequencer state is removed")
+
+		// Picked again, the commit changes nothing.
+		out, done, err = r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.False(t, done)
+		assert.Contains(t, out, "The previous cherry-pick is now empty")
+		_, done, err = r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Skip: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+	})
+
+	t.Run("Revert", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionRevert, Commits: []string{"HEAD"}})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "Revert \"master\"\n\nThis reverts commit "+master+".", commit.KVLM.Message)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		second := commitChange(t, r, "topic", "h", "second\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/topic", second, topic, "commit: second"))
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"master..topic"}})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		head, commit := readHeadCommit(t, r)
+		assert.Equal(t, "change h", commit.KVLM.Message)
+		assert.Equal(t, "topic", mustReadCommit(t, r, commit.KVLM.Parents[0]).KVLM.Message)
+		assert.Equal(t, []string{master}, mustReadCommit(t, r, head+"~1").KVLM.Parents)
+
+		_, _, err = r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic..topic"}})
+		assert.EqualError(t, err, "empty commit set passed")
+	})
+
+	t.Run("Mainline", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		merge := mustResolve(t, r, "HEAD")
+
+		_, _, err = r.CherryPick(&repository.CherryPick{Action: repository.ActionRevert, Commits: []string{"HEAD"}})
+		assert.EqualError(t, err, "commit "+merge+" is a merge but no -m option was given.")
+		_, _, err = r.CherryPick(&repository.CherryPick{Action: repository.ActionRevert, Commits: []string{"HEAD"}, Mainline: 3})
+		assert.EqualError(t, err, "commit "+merge+" does not have parent 3")
+
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionRevert, Commits: []string{"HEAD"}, Mainline: 1})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, "Revert \"Merge branch 'topic'\"\n\nThis reverts commit "+merge+", reversing\nchanges made to "+master+".",
+			commit.KVLM.Message)
+		assert.Equal(t, "1\nM\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, "t"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		assert.NotEqual(t, topic, commit.KVLM.Parents[0])
+	})
+
+	t.Run("NoCommit", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic"}, NoCommit: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, "1\nM\n3\n4\n5\nT\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{0}, readIndexStages(t, r, "t"))
+		message, err := afero.ReadFile(r.FS, filepath.Join(r.Gitdir, "MERGE_MSG"))
+		assert.NoError(t, err)
+		assert.Equal(t, "topic\n", string(message))
+	})
+
+	t.Run("Renamed", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\n2\n3\n4\n5\nT\n7\n")
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "f")))
+		writeWorktreeFile(t, r, "moved", "1\n2\n3\n4\n5\n6\n7\n")
+		commitWorktree(t, r, "rename", "f", "moved")
+
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, "1\n2\n3\n4\n5\nT\n7\n", readWorktreeFile(t, r, "moved"))
+		assertNoWorktreeFile(t, r, "f")
+		assert.Empty(t, readIndexHash(t, r, "f"))
+	})
+
+	t.Run("LocalChanges", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		writeWorktreeFile(t, r, "g", "staged\n")
+		assert.NoError(t, r.Add([]string{"g"}))
+		_, _, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionPick, Commits: []string{"topic"}})
+		assert.EqualError(t, err, "your local changes would be overwritten by cherry-pick.\nhint: commit your changes or stash them to proceed.")
+	})
+}
+
+func mustReadCommit(t *testing.T, r *repository.Repository, rev string) *objects.Commit {
+	obj, err := r.ReadObject(mustResolve(t, r, rev))
+	assert.NoError(t, err)
+	return obj.(*objects.Commit)
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const defaultRemote = "origin"
+
+type Clone struct {
+	// Source is the path or the file:// URL of the repository to clone.
+	Source string
+	Bare   bool
+	// Shared borrows the objects of the source through the alternates
+	// instead of copying them.
+	Shared bool
+	// Reference is a repository whose objects are borrowed, only the ones
+	// it does not have being copied from the source.
+	Reference string
+}
+
+// CloneDirectory returns the directory a repository is cloned into when
+// none is given: the last component of its path without the .ggit or .git
+// suffix, with a .ggit suffix for a bare clone.
+func CloneDirectory(source string, bare bool) string {
+	name := strings.TrimRight(filepath.ToSlash(source), "/")
+	for _, suffix := range []string{"/" + gitdir, "/.git"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	name = path.Base(name)
+	for _, suffix := range []string{gitdir, ".git"} {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != "" {
+			name = trimmed
+		}
+	}
+	if bare {
+		name += gitdir
+	}
+	return name
+}
+
+// OpenRepository opens the repository at dir, which is either a worktree
+// holding a .ggit directory or file, or a bare repository. Unlike
+// FindRepository, the parents of dir are not searched.
+//
+// Returns:
+//   - The repository.
+//   - An error if dir is not a repository.
+func OpenRepository(fs factory.FS, dir string) (*Repository, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Repository{FS: fs, Worktree: dir, Gitdir: filepath.Join(dir, gitdir)}
+	switch {
+	case filesystem.IsDir(fs, r.Gitdir):
+	case filesystem.IsFile(fs, r.Gitdir):
+		if r.Gitdir, err = readGitfile(fs, r.Gitdir); err != nil {
+			return nil, err
+		}
+	case isGitdir(fs, dir):
+		r.Worktree, r.Gitdir = "", dir
+	default:
+		return nil, fmt.Errorf("repository '%s' does not exist", dir)
+	}
+	r.Config = *NewConfig(r.Gitdir, r.FS)
+	r.Config.Load()
+	if _, err := objects.LookupHashAlgorithm(r.Config.Get("extensions", "objectformat")); err != nil {
+		return nil, err
+	}
+	r.Objects = r.openObjects()
+	return r, nil
+}
+
+// Clone creates a repository in the worktree path, which must be missing
+// or empty, as a copy of the source repository. The branches of the source
+// become the remote-tracking branches of origin and its tags are copied;
+// the branch the source HEAD points to is checked out. A bare clone copies
+// the branches as they are and has no worktree.
+//
+// The objects of the source are copied, unless Shared borrows them through
+// objects/info/alternates. Reference borrows the objects of another
+// repository the same way, only the objects it lacks being copied.
+//
+// Returns:
+//   - A warning when the source has no commit.
+//   - An error if a repository can not be opened or the clone can not be
+//     written.
+func (r *Repository) Clone(opts *Clone) (string, error) {
+	source, err := r.openRemote(opts.Source)
+	if err != nil {
+		return "", err
+	}
+	var reference *Repository
+	if opts.Reference != "" {
+		if reference, err = OpenRepository(r.FS, opts.Reference); err != nil {
+			return "", fmt.Errorf("reference repository '%s' is not a local repository.", opts.Reference)
+		}
+	}
+	if entries, err := afero.ReadDir(r.FS, r.Worktree); err == nil && len(entries) > 0 {
+		return "", fmt.Errorf("destination path '%s' already exists and is not an empty directory.", r.Worktree)
+	}
+	if err := r.FS.MkdirAll(r.Worktree, os.ModePerm); err != nil {
+		return "", err
+	}
+	if _, err := r.Init(&Init{Bare: opts.Bare, ObjectFormat: source.ObjectFormat().Name}); err != nil {
+		return "", err
+	}
+
+	if reference != nil {
+		if err := r.AddAlternate(reference.path("objects")); err != nil {
+			return "", err
+		}
+	}
+	if opts.Shared {
+		if err := r.AddAlternate(source.path("objects")); err != nil {
+			return "", err
+		}
+	}
+	if err := r.copyObjects(source.Objects); err != nil {
+		return "", err
+	}
+
+	url := source.Worktree
+	if url == "" {
+		url = source.Gitdir
+	}
+	if strings.HasPrefix(opts.Source, fileURLPrefix) {
+		url = opts.Source
+	}
+	if err := r.Config.Set(ConfigLocal, "remote."+defaultRemote, "url", url); err != nil {
+		return "", err
+	}
+	if !opts.Bare {
+		if err := r.Config.Set(ConfigLocal, "remote."+defaultRemote, "fetch", defaultFetchRefspec(defaultRemote)); err != nil {
+			return "", err
+		}
+	}
+	message := "clone: from " + url
+	if err := r.cloneRefs(source, opts.Bare, message); err != nil {
+		return "", err
+	}
+	return r.cloneHead(source, opts.Bare, message)
+}
+
+// copyObjects writes the objects of src the repository does not have yet,
+// borrowed ones included.
+func (r *Repository) copyObjects(src store.ObjectStore) error {
+	return src.Iterate(func(id string) error {
+		if r.Objects.Has(id) {
+			return nil
+		}
+		o, err := src.Read(id)
+		if err != nil {
+			return err
+		}
+		_, err = r.Objects.Write(o)
+		return err
+	})
+}
+
+// cloneRefs copies the tags of source, and its branches as the
+// remote-tracking branches of origin, or as branches for a bare clone.
+func (r *Repository) cloneRefs(source *Repository, bare bool, message string) error {
+	refs, err := source.listRefs()
+	if err != nil {
+		return err
+	}
+	for _, name := range refs {
+		target := name
+		if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok && !bare {
+			target = "refs/remotes/" + defaultRemote + "/" + branch
+		} else if !ok && !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		sha, err := source.ResolveRef(name)
+		if err != nil {
+			return err
+		}
+		if err := r.UpdateRef(target, sha, "", message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneHead points HEAD to the branch the HEAD of source points to, or to
+// its commit when it is detached, and checks it out unless bare is set.
+//
+// Returns:
+//   - A warning when the source has no commit, or the output of the
+//     post-checkout hook.
+//   - An error if HEAD or the worktree can not be written.
+func (r *Repository) cloneHead(source *Repository, bare bool, message string) (string, error) {
+	head, err := source.headCommit()
+	if err != nil {
+		return "", err
+	}
+	branch, err := source.SymbolicRef(headFile)
+	if err != nil {
+		branch = ""
+	}
+	if head == "" {
+		if branch != "" {
+			if err := r.SetSymbolicRef(headFile, branch); err != nil {
+				return "", err
+			}
+		}
+		return "warning: You appear to have cloned an empty repository.\n", nil
+	}
+
+	if short, ok := strings.CutPrefix(branch, "refs/heads/"); ok {
+		if !bare {
+			tracking := "refs/remotes/" + defaultRemote + "/"
+			if err := r.SetSymbolicRef(tracking+"HEAD", tracking+short); err != nil {
+				return "", err
+			}
+			if err := r.Config.Set(ConfigLocal, "branch."+short, "remote", defaultRemote); err != nil {
+				return "", err
+			}
+			if err := r.Config.Set(ConfigLocal, "branch."+short, "merge", branch); err != nil {
+				return "", err
+			}
+		}
+		if err := r.SetSymbolicRef(headFile, branch); err != nil {
+			return "", err
+		}
+		if err := r.UpdateRef(headFile, head, "", message); err != nil {
+			return "", err
+		}
+	} else if err := r.DetachHead(head, message); err != nil {
+		return "", err
+	}
+	if bare {
+		return "", nil
+	}
+
+	tree, err := r.headTree(head)
+	if err != nil {
+		return "", err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return "", err
+	}
+	if err := r.checkout(map[string]diff.File{}, files, true, "clone"); err != nil {
+		return "", err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", err
+	}
+	if err := r.WriteIndex(r.buildIndex(files, nil, idx)); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := r.runPostHook(&b, "post-checkout", r.ObjectFormat().NullID(), head, "1"); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,127 @@
+package repository_test
+
+import (
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCloneSource creates a repository at /src with a commit on master and
+// a tag.
+func newCloneSource(t *testing.T) (*repository.Repository, string) {
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	r, err := repository.NewRepository(factory.NewTestFactory(), "/src")
+	assert.NoError(t, err)
+	_, err = r.Create(false)
+	assert.NoError(t, err)
+	writeWorktreeFile(t, r, "README", "read me\n")
+	writeWorktreeFile(t, r, "src/main.go", "package main\n")
+	head := commitWorktree(t, r, "initial", "README", "src")
+	writeRef(t, r, "refs/tags/v1", head)
+	return r, head
+}
+
+// cloneRepository clones /src into dir.
+func cloneRepository(t *testing.T, src *repository.Repository, dir string, opts *repository.Clone) *repository.Repository {
+	r, err := repository.NewRepository(src.FS, dir)
+	assert.NoError(t, err)
+	opts.Source = "/src"
+	_, err = r.Clone(opts)
+	assert.NoError(t, err)
+	return r
+}
+
+// hasLooseObject reports whether the repository itself stores the object
+// sha, rather than borrowing it.
+func hasLooseObject(r *repository.Repository, sha string) bool {
+	return filesystem.IsFile(r.FS, filepath.Join(r.Gitdir, "objects", sha[:2], sha[2:]))
+}
+
+func TestClone(t *testing.T) {
+	t.Run("Copy", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		assert.Empty(t, r.Alternates())
+		assert.Equal(t, head, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/origin/master"))
+		assert.Equal(t, head, mustResolve(t, r, "refs/tags/v1"))
+		branch, err := r.SymbolicRef("refs/remotes/origin/HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "refs/remotes/origin/master", branch)
+		assert.Equal(t, "/src", r.Config.Get("remote.origin", "url"))
+		assert.Equal(t, "+refs/heads/*:refs/remotes/origin/*", r.Config.Get("remote.origin", "fetch"))
+		assert.Equal(t, "refs/heads/master", r.Config.Get("branch.master", "merge"))
+		assert.Equal(t, "read me\n", readWorktreeFile(t, r, "README"))
+		assert.Equal(t, "package main\n", readWorktreeFile(t, r, "src/main.go"))
+		assert.True(t, hasLooseObject(r, head))
+
+		reflog, err := r.Reflog("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "clone: from /src", reflog[0].Message)
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("Shared", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{Shared: true})
+		assert.Equal(t, []string{"/src/.ggit/objects"}, r.Alternates())
+		assert.False(t, hasLooseObject(r, head))
+		assert.Equal(t, "read me\n", readWorktreeFile(t, r, "README"))
+		_, err := r.ReadObject(head)
+		assert.NoError(t, err)
+
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("Reference", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		other := cloneRepository(t, src, "/other", &repository.Clone{})
+		writeWorktreeFile(t, src, "NEWS", "news\n")
+		head := commitWorktree(t, src, "news", "NEWS")
+
+		r := cloneRepository(t, src, "/dst", &repository.Clone{Reference: other.Worktree})
+		assert.Equal(t, []string{"/other/.ggit/objects"}, r.Alternates())
+		assert.Equal(t, head, mustResolve(t, r, "HEAD"))
+		assert.True(t, hasLooseObject(r, head))
+		readme := r.ObjectFormat().HashObject("blob", "read me\n")
+		assert.False(t, hasLooseObject(r, readme))
+		assert.Equal(t, "news\n", readWorktreeFile(t, r, "NEWS"))
+	})
+
+	t.Run("Bare", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst.ggit", &repository.Clone{Bare: true})
+		assert.True(t, r.IsBare())
+		assert.Equal(t, "/dst.ggit", r.Gitdir)
+		assert.Equal(t, head, mustResolve(t, r, "refs/heads/master"))
+		assert.Empty(t, r.Config.Get("remote.origin", "fetch"))
+	})
+
+	t.Run("NotEmpty", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		r, err := repository.NewRepository(src.FS, "/src")
+		assert.NoError(t, err)
+		_, err = r.Clone(&repository.Clone{Source: "/src"})
+		assert.EqualError(t, err, "destination path '/src' already exists and is not an empty directory.")
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		assert.Equal(t, "repo", repository.CloneDirectory("/path/to/repo/", false))
+		assert.Equal(t, "repo", repository.CloneDirectory("/path/to/repo/.ggit", false))
+		assert.Equal(t, "repo", repository.CloneDirectory("repo.git", false))
+		assert.Equal(t, "repo.ggit", repository.CloneDirectory("../repo", true))
+	})
+}
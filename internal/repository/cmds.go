@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"ggit/internal/filesystem"
 	"ggit/internal/objects"
+	"strings"
 )
 
 func (r *Repository) CatObject(sha string) (string, error) {
@@ -12,7 +13,24 @@ func (r *Repository) CatObject(sha string) (string, error) {
 		return "", err
 	}
 
-	return obj.(*objects.Blob).ReadData(), nil
+	switch o := obj.(type) {
+	case *objects.Blob:
+		return o.ReadData(), nil
+	case *objects.Tree:
+		lines := make([]string, 0, len(o.Entries))
+		for _, e := range o.Entries {
+			format := "blob"
+			if e.IsTree() {
+				format = "tree"
+			} else if e.Mode == objects.ModeGitlink {
+				format = "commit"
+			}
+			lines = append(lines, fmt.Sprintf("%06s %s %s\t%s", e.Mode, format, e.Hash, e.Name))
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		return obj.Serialize(), nil
+	}
 }
 
 type HashObject struct {
@@ -38,5 +56,6 @@ func (r *Repository) HashObject(obj *HashObject) (string, error) {
 	if obj.Write {
 		return r.WriteObject(gitObject)
 	}
+	gitObject.SetHashAlgorithm(r.ObjectFormat())
 	return gitObject.Hash()
 }
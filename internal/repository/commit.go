@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Roles of the identities recorded in a commit.
+const (
+	RoleAuthor    = "AUTHOR"
+	RoleCommitter = "COMMITTER"
+)
+
+// Ident returns the identity of the author or the committer of a new
+// commit. The GGIT_<role>_NAME, GGIT_<role>_EMAIL and GGIT_<role>_DATE
+// environment variables override the user.name and user.email settings and
+// the current time.
+//
+// Returns:
+//   - The identity.
+//   - An error if no name or email is configured or the date is malformed.
+func (r *Repository) Ident(role string) (objects.Ident, error) {
+	ident := objects.Ident{
+		Name:  os.Getenv("GGIT_" + role + "_NAME"),
+		Email: os.Getenv("GGIT_" + role + "_EMAIL"),
+	}
+	if ident.Name == "" {
+		ident.Name = r.Config.Get("user", "name")
+	}
+	if ident.Email == "" {
+		ident.Email = r.Config.Get("user", "email")
+	}
+	if ident.Name == "" || ident.Email == "" {
+		return objects.Ident{}, fmt.Errorf("%s identity unknown: please set user.name and user.email", strings.ToLower(role))
+	}
+
+	if date := os.Getenv("GGIT_" + role + "_DATE"); date != "" {
+		when, zone, err := parseDate(date)
+		if err != nil {
+			return objects.Ident{}, err
+		}
+		ident.When, ident.Zone = when, zone
+	} else {
+		now := time.Now()
+		ident.When, ident.Zone = now.Unix(), now.Format("-0700")
+	}
+	return ident, nil
+}
+
+// parseDate parses a date in git's internal format, "<unix time> <zone>",
+// optionally prefixed by an @. The zone defaults to UTC.
+func parseDate(date string) (int64, string, error) {
+	fields := strings.Fields(strings.TrimPrefix(date, "@"))
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, "", fmt.Errorf("invalid date format: %s", date)
+	}
+	when, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid date format: %s", date)
+	}
+	zone := "+0000"
+	if len(fields) == 2 {
+		zone = fields[1]
+	}
+	if _, err := objects.ParseIdent(fmt.Sprintf("x <x> %d %s", when, zone)); err != nil {
+		return 0, "", fmt.Errorf("invalid date format: %s", date)
+	}
+	return when, zone, nil
+}
+
+// reflogIdent returns the committer identity recorded in reflog entries.
+// Unlike commits, ref updates do not fail for lack of an identity.
+func (r *Repository) reflogIdent() objects.Ident {
+	ident, err := r.Ident(RoleCommitter)
+	if err == nil {
+		return ident
+	}
+	name := os.Getenv("USER")
+	if name == "" {
+		name = "unknown"
+	}
+	now := time.Now()
+	return objects.Ident{Name: name, Email: name + "@localhost", When: now.Unix(), Zone: now.Format("-0700")}
+}
+
+// CommitTree creates a commit of tree with the given parents, authored and
+// committed by the current identities.
+//
+// Returns:
+//   - The ID of the new commit.
+//   - An error if an identity is unknown or the commit can not be written.
+func (r *Repository) CommitTree(tree string, parents []string, message string) (string, error) {
+	author, err := r.Ident(RoleAuthor)
+	if err != nil {
+		return "", err
+	}
+	return r.commitTreeAs(tree, parents, message, author)
+}
+
+// commitTreeAs creates a commit like CommitTree, keeping the given author.
+func (r *Repository) commitTreeAs(tree string, parents []string, message string, author objects.Ident) (string, error) {
+	committer, err := r.Ident(RoleCommitter)
+	if err != nil {
+		return "", err
+	}
+	commit := objects.NewCommit()
+	commit.KVLM.Tree = tree
+	commit.KVLM.Parents = parents
+	commit.KVLM.Author = author.String()
+	commit.KVLM.Comitter = committer.String()
+	commit.KVLM.Message = strings.TrimSuffix(message, "\n")
+	return r.WriteObject(commit)
+}
+
+// CleanupMessage strips the comment lines and the trailing whitespace of a
+// commit message, collapses consecutive empty lines and removes the leading
+// and trailing ones.
+func CleanupMessage(message string) string {
+	lines := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// subject returns the first line of a commit message.
+func subject(message string) string {
+	line, _, _ := strings.Cut(strings.TrimLeft(message, "\n"), "\n")
+	return line
+}
@@ -0,0 +1,56 @@
+package repository_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdent(t *testing.T) {
+	r := newTestRepository(t)
+	t.Setenv("GGIT_AUTHOR_NAME", "")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "")
+	_, err := r.Ident(repository.RoleAuthor)
+	assert.EqualError(t, err, "author identity unknown: please set user.name and user.email")
+
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_AUTHOR_DATE", "@1112911993 -0700")
+	ident, err := r.Ident(repository.RoleAuthor)
+	assert.NoError(t, err)
+	assert.Equal(t, "A U Thor <author@example.com> 1112911993 -0700", ident.String())
+
+	t.Setenv("GGIT_AUTHOR_DATE", "yesterday")
+	_, err = r.Ident(repository.RoleAuthor)
+	assert.Error(t, err)
+}
+
+func TestCommitTree(t *testing.T) {
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_AUTHOR_DATE", "1000 +0000")
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	t.Setenv("GGIT_COMMITTER_DATE", "2000 +0100")
+	r := newTestRepository(t)
+	parent := writeCommit(t, r, 500)
+
+	sha, err := r.CommitTree(objects.EmptyTreeHash, []string{parent}, "subject\n\nbody\n")
+	assert.NoError(t, err)
+	obj, err := r.ReadObject(sha)
+	assert.NoError(t, err)
+	commit := obj.(*objects.Commit)
+	assert.Equal(t, objects.EmptyTreeHash, commit.KVLM.Tree)
+	assert.Equal(t, []string{parent}, commit.KVLM.Parents)
+	assert.Equal(t, "A U Thor <author@example.com> 1000 +0000", commit.KVLM.Author)
+	assert.Equal(t, "C O Mitter <committer@example.com> 2000 +0100", commit.KVLM.Comitter)
+	assert.Equal(t, "subject\n\nbody", commit.KVLM.Message)
+}
+
+func TestCleanupMessage(t *testing.T) {
+	assert.Equal(t, "Merge branch 'topic'\n\nbody\n",
+		repository.CleanupMessage("\n\nMerge branch 'topic'  \n\n\n# Conflicts:\n#\tf\nbody\n\n"))
+	assert.Equal(t, "", repository.CleanupMessage("# only comments\n\n"))
+}
@@ -1,35 +1,329 @@
 package repository
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"ggit/internal/factory"
 	"ggit/internal/filesystem"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"gopkg.in/ini.v1"
 )
 
 const ConfigName = "config"
 
+// Scopes of the configuration files, from the lowest to the highest
+// priority.
+const (
+	ConfigSystem   = "system"
+	ConfigGlobal   = "global"
+	ConfigLocal    = "local"
+	ConfigWorktree = "worktree"
+)
+
+const (
+	systemConfigPath   = "/etc/ggitconfig"
+	globalConfigName   = ".ggitconfig"
+	worktreeConfigName = "config.worktree"
+	// maxIncludeDepth limits how deeply configuration files can include
+	// each other.
+	maxIncludeDepth = 10
+)
+
+// ConfigMultipleValuesError reports a variable with several values where
+// a single one is expected.
+type ConfigMultipleValuesError struct {
+	Name string
+}
+
+func (e ConfigMultipleValuesError) Error() string {
+	return e.Name + " has multiple values"
+}
+
+// ConfigEntry is a variable set by a configuration file.
+type ConfigEntry struct {
+	// Name is the full name of the variable, e.g. "remote.origin.url", with
+	// the section and the key lowercased.
+	Name  string
+	Value string
+	Scope string
+	// Origin is the path of the file setting the variable.
+	Origin string
+}
+
 type config struct {
 	Path string
+	// Data holds the repository configuration file.
 	Data *ini.File
 	FS   factory.FS
 	Save bool
+	// Entries are the variables of every configuration file, from the
+	// lowest to the highest priority.
+	Entries []ConfigEntry
 }
 
 func NewConfig(gitpath string, fs factory.FS) *config {
 	return &config{Path: filepath.Join(gitpath, ConfigName), FS: fs, Save: true}
 }
 
-// Load loads the configuration data from the path specified in config struct.
-// If an error occurs during loading, it initializes the config data to an empty state.
+// Load loads the configuration files, from the system one to the one of
+// the worktree, with the files they include. Files that are missing or
+// can not be parsed are skipped, the repository one is then empty.
 func (c *config) Load() {
-	data, err := ini.Load(c.Path)
-	if err != nil {
+	c.Data = c.readFile(c.Path)
+	if c.Data == nil {
 		c.Data = ini.Empty()
+	}
+	c.Entries = nil
+	for _, scope := range []string{ConfigSystem, ConfigGlobal, ConfigLocal, ConfigWorktree} {
+		path, err := c.ScopePath(scope)
+		if err != nil || (scope == ConfigWorktree && path == c.Path) {
+			continue
+		}
+		c.loadFile(scope, path, 0)
+	}
+}
+
+// ScopePath returns the path of the configuration file of a scope. The
+// system and global files can be moved with GGIT_CONFIG_SYSTEM and
+// GGIT_CONFIG_GLOBAL. The worktree file is the repository one unless
+// extensions.worktreeConfig is set.
+//
+// Returns:
+//   - The path of the file, which may not exist.
+//   - An error if the scope is unknown or the home directory is not set.
+func (c *config) ScopePath(scope string) (string, error) {
+	switch scope {
+	case ConfigSystem:
+		if path := os.Getenv("GGIT_CONFIG_SYSTEM"); path != "" {
+			return path, nil
+		}
+		return systemConfigPath, nil
+	case ConfigGlobal:
+		if path := os.Getenv("GGIT_CONFIG_GLOBAL"); path != "" {
+			return path, nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, globalConfigName), nil
+	case ConfigLocal, "":
+		return c.Path, nil
+	case ConfigWorktree:
+		if enabled, _ := c.GetBool("extensions", "worktreeConfig", false); enabled {
+			return filepath.Join(filepath.Dir(c.Path), worktreeConfigName), nil
+		}
+		return c.Path, nil
+	}
+	return "", fmt.Errorf("unknown config scope %s", scope)
+}
+
+// readFile parses a configuration file, nil when it is missing or
+// malformed.
+func (c *config) readFile(path string) *ini.File {
+	if !filesystem.IsFile(c.FS, path) {
+		return nil
+	}
+	data, err := filesystem.ReadFileData(c.FS, path)
+	if err != nil {
+		return nil
+	}
+	file, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true, AllowBooleanKeys: true}, []byte(data))
+	if err != nil {
+		return nil
+	}
+	return file
+}
+
+// loadFile appends the variables of a configuration file to the entries,
+// followed at each include by the variables of the included file.
+func (c *config) loadFile(scope string, path string, depth int) {
+	file := c.readFile(path)
+	if path == c.Path {
+		file = c.Data
+	}
+	if file == nil || depth > maxIncludeDepth {
 		return
 	}
-	c.Data = data
+	for _, s := range file.Sections() {
+		if s.Name() == ini.DefaultSection {
+			continue
+		}
+		section := configSectionName(s.Name())
+		for _, k := range s.Keys() {
+			name := section + "." + strings.ToLower(k.Name())
+			for _, value := range k.ValueWithShadows() {
+				c.Entries = append(c.Entries, ConfigEntry{Name: name, Value: value, Scope: scope, Origin: path})
+				if c.includes(name, path) {
+					c.loadFile(scope, c.includePath(value, path), depth+1)
+				}
+			}
+		}
+	}
+}
+
+// includes reports whether the variable name of the file at path includes
+// another file: include.path always does, includeIf.<condition>.path when
+// the condition holds.
+func (c *config) includes(name string, path string) bool {
+	if name == "include.path" {
+		return true
+	}
+	condition, ok := strings.CutPrefix(name, "includeif.")
+	if !ok || !strings.HasSuffix(condition, ".path") {
+		return false
+	}
+	condition = strings.TrimSuffix(condition, ".path")
+	if pattern, ok := strings.CutPrefix(condition, "gitdir:"); ok {
+		return c.matchesGitdir(pattern, path, false)
+	}
+	if pattern, ok := strings.CutPrefix(condition, "gitdir/i:"); ok {
+		return c.matchesGitdir(pattern, path, true)
+	}
+	if pattern, ok := strings.CutPrefix(condition, "onbranch:"); ok {
+		return c.onBranch(pattern)
+	}
+	return false
+}
+
+// includePath returns the path of a file included by the file at from:
+// relative paths are relative to its directory.
+func (c *config) includePath(value string, from string) string {
+	path, err := expandPath(value)
+	if err != nil || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(from), path)
+}
+
+// matchesGitdir reports whether the repository directory matches the
+// pattern of a gitdir include condition. Patterns starting with "./" are
+// relative to the directory of the file at from, other relative patterns
+// match at any depth, and patterns ending with a slash match everything
+// below.
+func (c *config) matchesGitdir(pattern string, from string, fold bool) bool {
+	gitdir, err := filepath.Abs(filepath.Dir(c.Path))
+	if err != nil {
+		return false
+	}
+	if rest, ok := strings.CutPrefix(pattern, "./"); ok {
+		dir, err := filepath.Abs(filepath.Dir(from))
+		if err != nil {
+			return false
+		}
+		pattern = filepath.ToSlash(dir) + "/" + rest
+	} else if pattern, err = expandPath(pattern); err != nil {
+		return false
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return matchConfigPattern(pattern, filepath.ToSlash(gitdir), fold)
+}
+
+// onBranch reports whether the current branch matches the pattern of an
+// onbranch include condition.
+func (c *config) onBranch(pattern string) bool {
+	head, err := filesystem.ReadFileData(c.FS, filepath.Join(filepath.Dir(c.Path), headFile))
+	if err != nil {
+		return false
+	}
+	ref, ok := strings.CutPrefix(strings.TrimSpace(head), symrefPrefix)
+	if !ok {
+		return false
+	}
+	return matchConfigPattern(pattern, strings.TrimPrefix(strings.TrimSpace(ref), "refs/heads/"), false)
+}
+
+// matchConfigPattern matches s against the wildcard pattern of an include
+// condition, in which "*" does not match slashes but "**" does. A pattern
+// ending with a slash matches everything below.
+func matchConfigPattern(pattern string, s string, fold bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	matched, err := regexp.MatchString(b.String(), s)
+	return err == nil && matched
+}
+
+// configSectionName returns the name of a section as used in variable
+// names: `remote "origin"` becomes remote.origin. Section names are case
+// insensitive, subsection names are not.
+func configSectionName(name string) string {
+	section, sub, ok := strings.Cut(name, " ")
+	if !ok {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(section) + "." + strings.Trim(strings.TrimSpace(sub), `"`)
+}
+
+// iniSectionName returns the header of a section, such as
+// `remote "origin"` for the section remote.origin.
+func iniSectionName(section string) string {
+	name, sub, ok := strings.Cut(section, ".")
+	if !ok {
+		return name
+	}
+	return fmt.Sprintf("%s %q", name, sub)
+}
+
+// configName returns the full name of a variable, in the form of the names
+// of the entries.
+func configName(section string, key string) string {
+	name, sub, ok := strings.Cut(section, ".")
+	if !ok {
+		return strings.ToLower(section) + "." + strings.ToLower(key)
+	}
+	return strings.ToLower(name) + "." + sub + "." + strings.ToLower(key)
+}
+
+var configKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// ParseConfigName splits the full name of a variable, such as
+// remote.origin.url, into its section, with its subsection, and its key.
+//
+// Returns:
+//   - The section and the key.
+//   - An error if the name has no section or the key is not made of
+//     letters, digits and dashes, starting with a letter.
+func ParseConfigName(name string) (string, string, error) {
+	dot := strings.LastIndex(name, ".")
+	if dot <= 0 {
+		return "", "", fmt.Errorf("key does not contain a section: %s", name)
+	}
+	section, key := name[:dot], name[dot+1:]
+	if !configKey.MatchString(key) || strings.ContainsAny(section, "\n") {
+		return "", "", fmt.Errorf("invalid key: %s", name)
+	}
+	return section, key, nil
 }
 
 // Empty checks whether the configuration data is empty.
@@ -44,7 +338,8 @@ func (c *config) Empty() bool {
 // configuration file does not exist at the specified path (c.Path).
 // If the file is missing, it creates a new file with an empty initial content.
 // After ensuring the file exists, it loads the configuration data.
-// It then creates a new section named "core" and adds three default keys:
+// It then creates a new section named "core" and adds the default keys it
+// is missing:
 //   - "repositoryformatversion" with a value of "0"
 //   - "filemode" with a value of "false"
 //   - "bare" with a value of "false"
@@ -64,24 +359,408 @@ func (c *config) DefaultConfig() error {
 		return err
 	}
 
-	_, err = core.NewKey("repositoryformatversion", "0")
-	if err != nil {
+	for _, key := range []string{"repositoryformatversion", "filemode", "bare"} {
+		if core.HasKey(key) {
+			continue
+		}
+		value := "false"
+		if key == "repositoryformatversion" {
+			value = "0"
+		}
+		if _, err := core.NewKey(key, value); err != nil {
+			return err
+		}
+	}
+
+	if c.Save {
+		if err = c.writeFile(c.Data, c.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile replaces a configuration file.
+func (c *config) writeFile(file *ini.File, path string) error {
+	var b bytes.Buffer
+	if _, err := file.WriteTo(&b); err != nil {
 		return err
 	}
-	_, err = core.NewKey("filemode", "false")
-	if err != nil {
+	if err := c.FS.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
 		return err
 	}
+	return filesystem.ReplaceFileData(c.FS, b.String(), path)
+}
+
+// Get returns the value of key in section, or an empty string when it is
+// not set. Section and key names are matched case-insensitively, as git
+// does, subsection names such as origin in remote.origin are not.
+func (c *config) Get(section string, key string) string {
+	value, _ := c.Lookup(section, key)
+	return value
+}
 
-	_, err = core.NewKey("bare", "false")
+// Lookup returns the value of key in section set by the configuration
+// file with the highest priority.
+//
+// Returns:
+//   - The value of the variable.
+//   - Whether the variable is set.
+func (c *config) Lookup(section string, key string) (string, bool) {
+	values := c.GetAll(section, key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// List returns the entries of the configuration files of a scope, or of
+// every file when scope is empty.
+func (c *config) List(scope string) []ConfigEntry {
+	entries := []ConfigEntry{}
+	for _, e := range c.Entries {
+		if scope == "" || e.Scope == scope {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// GetAll returns every value of a multi-valued variable, from the lowest
+// to the highest priority.
+func (c *config) GetAll(section string, key string) []string {
+	values := []string{}
+	for _, e := range c.Find("", section, key) {
+		values = append(values, e.Value)
+	}
+	return values
+}
+
+// Find returns the entries setting key in section in the configuration
+// files of a scope, or of every file when scope is empty.
+func (c *config) Find(scope string, section string, key string) []ConfigEntry {
+	name := configName(section, key)
+	entries := []ConfigEntry{}
+	for _, e := range c.List(scope) {
+		if e.Name == name {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// GetBool returns the value of key in section as a boolean, def when it
+// is not set.
+//
+// Returns:
+//   - The boolean value.
+//   - An error if the value is not a boolean.
+func (c *config) GetBool(section string, key string, def bool) (bool, error) {
+	value, ok := c.Lookup(section, key)
+	if !ok {
+		return def, nil
+	}
+	return ParseConfigBool(configName(section, key), value)
+}
+
+// GetInt returns the value of key in section as an integer, def when it
+// is not set.
+//
+// Returns:
+//   - The integer value.
+//   - An error if the value is not an integer.
+func (c *config) GetInt(section string, key string, def int64) (int64, error) {
+	value, ok := c.Lookup(section, key)
+	if !ok {
+		return def, nil
+	}
+	return ParseConfigInt(configName(section, key), value)
+}
+
+// GetPath returns the value of key in section as a path, with a leading
+// "~/" expanded to the home directory. It is empty when it is not set.
+//
+// Returns:
+//   - The path.
+//   - An error if the home directory is not known.
+func (c *config) GetPath(section string, key string) (string, error) {
+	value, ok := c.Lookup(section, key)
+	if !ok {
+		return "", nil
+	}
+	return expandPath(value)
+}
+
+// ParseConfigBool parses the boolean value of the variable name: true,
+// yes, on and the non-zero integers are true, false, no, off, zero and the
+// empty string are false.
+//
+// Returns:
+//   - The boolean value.
+//   - An error if the value is none of them.
+func ParseConfigBool(name string, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+	n, err := ParseConfigInt(name, value)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("bad boolean config value '%s' for '%s'", value, name)
 	}
+	return n != 0, nil
+}
 
-	if c.Save {
-		if err = c.Data.SaveTo(c.Path); err != nil {
+// ParseConfigInt parses the integer value of the variable name, which may
+// be scaled by 1024 with a k suffix, 1024² with m, 1024³ with g.
+//
+// Returns:
+//   - The integer value.
+//   - An error if the value is not an integer or does not fit.
+func ParseConfigInt(name string, value string) (int64, error) {
+	number, scale := strings.TrimSpace(value), int64(1)
+	if number != "" {
+		switch strings.ToLower(number[len(number)-1:]) {
+		case "k":
+			scale = 1 << 10
+		case "m":
+			scale = 1 << 20
+		case "g":
+			scale = 1 << 30
+		}
+		if scale != 1 {
+			number = number[:len(number)-1]
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, fmt.Errorf("bad numeric config value '%s' for '%s': out of range", value, name)
+		}
+		return 0, fmt.Errorf("bad numeric config value '%s' for '%s': invalid unit", value, name)
+	}
+	if n > (1<<63-1)/scale || n < -(1<<63-1)/scale {
+		return 0, fmt.Errorf("bad numeric config value '%s' for '%s': out of range", value, name)
+	}
+	return n * scale, nil
+}
+
+// FormatConfigValue returns the canonical form of the value of the
+// variable name for a type: "bool" gives true or false, "int" the scaled
+// number and "path" the expanded path. Without a type, the value is
+// returned as is.
+//
+// Returns:
+//   - The formatted value.
+//   - An error if the value is not of the type, or the type is unknown.
+func FormatConfigValue(name string, value string, kind string) (string, error) {
+	switch kind {
+	case "":
+		return value, nil
+	case "bool":
+		b, err := ParseConfigBool(name, value)
+		return strconv.FormatBool(b), err
+	case "int":
+		n, err := ParseConfigInt(name, value)
+		return strconv.FormatInt(n, 10), err
+	case "path":
+		return expandPath(value)
+	}
+	return "", fmt.Errorf("unrecognized --type argument, %s", kind)
+}
+
+// expandPath expands a leading "~/" of a path to the home directory.
+func expandPath(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		if strings.HasPrefix(path, "~") {
+			return "", fmt.Errorf("failed to expand user dir in: '%s'", path)
+		}
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to expand user dir in: '%s'", path)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// Set sets key in section to value in the configuration file of a scope,
+// replacing its value when it is already set there.
+//
+// Returns:
+//   - ConfigMultipleValuesError if the variable has several values in the
+//     file, or an error if the file can not be written.
+func (c *config) Set(scope string, section string, key string, value string) error {
+	return c.edit(scope, section, key, func(s *ini.Section, k *ini.Key) error {
+		if k == nil {
+			_, err := s.NewKey(key, value)
+			return err
+		}
+		if len(k.ValueWithShadows()) > 1 {
+			return ConfigMultipleValuesError{Name: configName(section, key)}
+		}
+		k.SetValue(value)
+		return nil
+	})
+}
+
+// Add adds a value to key in section in the configuration file of a
+// scope, keeping the values it already has.
+//
+// Returns:
+//   - An error if the file can not be written.
+func (c *config) Add(scope string, section string, key string, value string) error {
+	return c.edit(scope, section, key, func(s *ini.Section, k *ini.Key) error {
+		if k == nil {
+			_, err := s.NewKey(key, value)
 			return err
 		}
+		return k.AddShadow(value)
+	})
+}
+
+// Unset removes key in section from the configuration file of a scope.
+// With all, every value of a multi-valued variable is removed.
+//
+// Returns:
+//   - ErrorConfigNotFound if the variable is not set in the file,
+//     ConfigMultipleValuesError if it has several values and all is not
+//     set, or an error if the file can not be written.
+func (c *config) Unset(scope string, section string, key string, all bool) error {
+	return c.edit(scope, section, key, func(s *ini.Section, k *ini.Key) error {
+		if k == nil {
+			return ErrorConfigNotFound
+		}
+		if len(k.ValueWithShadows()) > 1 && !all {
+			return ConfigMultipleValuesError{Name: configName(section, key)}
+		}
+		s.DeleteKey(k.Name())
+		return nil
+	})
+}
+
+// edit applies a change to the variable key in section of the
+// configuration file of a scope, creating the section when it is missing,
+// writes the file back and reloads the configuration. The change is given
+// a nil key when the variable is not set in the file.
+func (c *config) edit(scope string, section string, key string, change func(*ini.Section, *ini.Key) error) error {
+	return c.editFile(scope, func(file *ini.File) error {
+		want := configSectionName(iniSectionName(section))
+		var s *ini.Section
+		var k *ini.Key
+		for _, candidate := range file.Sections() {
+			if configSectionName(candidate.Name()) != want {
+				continue
+			}
+			s = candidate
+			for _, existing := range candidate.Keys() {
+				if strings.EqualFold(existing.Name(), key) {
+					k = existing
+				}
+			}
+			if k != nil {
+				break
+			}
+		}
+		if s == nil {
+			var err error
+			if s, err = file.NewSection(iniSectionName(section)); err != nil {
+				return err
+			}
+		}
+		return change(s, k)
+	})
+}
+
+// editFile applies a change to the configuration file of a scope, an
+// empty one when it is missing, writes it back and reloads the
+// configuration.
+func (c *config) editFile(scope string, change func(*ini.File) error) error {
+	path, err := c.ScopePath(scope)
+	if err != nil {
+		return err
 	}
+	file := c.readFile(path)
+	if file == nil {
+		if filesystem.IsFile(c.FS, path) {
+			return fmt.Errorf("invalid config file %s", path)
+		}
+		file = ini.Empty(ini.LoadOptions{AllowShadows: true, AllowBooleanKeys: true})
+	}
+	if err := change(file); err != nil {
+		return err
+	}
+	if err := c.writeFile(file, path); err != nil {
+		return err
+	}
+	c.Load()
 	return nil
 }
+
+// sections returns the sections of a file named section, such as
+// remote.origin.
+func sections(file *ini.File, section string) []*ini.Section {
+	want := configSectionName(iniSectionName(section))
+	found := []*ini.Section{}
+	for _, s := range file.Sections() {
+		if configSectionName(s.Name()) == want {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// RemoveSection removes section, with all its variables, from the
+// configuration file of a scope.
+//
+// Returns:
+//   - ErrorConfigNotFound if the file has no such section, or an error if
+//     it can not be written.
+func (c *config) RemoveSection(scope string, section string) error {
+	return c.editFile(scope, func(file *ini.File) error {
+		found := sections(file, section)
+		if len(found) == 0 {
+			return ErrorConfigNotFound
+		}
+		for _, s := range found {
+			file.DeleteSection(s.Name())
+		}
+		return nil
+	})
+}
+
+// RenameSection renames section to name in the configuration file of a
+// scope, keeping its variables.
+//
+// Returns:
+//   - ErrorConfigNotFound if the file has no such section, or an error if
+//     it can not be written.
+func (c *config) RenameSection(scope string, section string, name string) error {
+	return c.editFile(scope, func(file *ini.File) error {
+		found := sections(file, section)
+		if len(found) == 0 {
+			return ErrorConfigNotFound
+		}
+		renamed, err := file.NewSection(iniSectionName(name))
+		if err != nil {
+			return err
+		}
+		for _, s := range found {
+			for _, k := range s.Keys() {
+				for _, value := range k.ValueWithShadows() {
+					if existing, err := renamed.GetKey(k.Name()); err == nil {
+						err = existing.AddShadow(value)
+					} else {
+						_, err = renamed.NewKey(k.Name(), value)
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+			file.DeleteSection(s.Name())
+		}
+		return nil
+	})
+}
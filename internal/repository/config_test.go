@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"ggit/internal/factory"
 	"ggit/internal/repository"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -45,3 +46,129 @@ func TestConfig(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+// writeConfigFile writes a configuration file and reloads the
+// configuration of r.
+func writeConfigFile(t *testing.T, r *repository.Repository, path string, data string) {
+	assert.NoError(t, afero.WriteFile(r.FS, path, []byte(data), 0644))
+	r.Config.Load()
+}
+
+func TestLayeredConfig(t *testing.T) {
+	t.Run("Layers", func(t *testing.T) {
+		t.Setenv("GGIT_CONFIG_SYSTEM", "/etc/system")
+		t.Setenv("GGIT_CONFIG_GLOBAL", "/home/global")
+		r := newTestRepository(t)
+		writeConfigFile(t, r, "/etc/system", "[user]\n\tname = System\n\temail = system@example.com\n[core]\n\teditor = vi\n")
+		writeConfigFile(t, r, "/home/global", "[user]\n\tname = Global\n")
+		assert.NoError(t, r.Config.Set(repository.ConfigLocal, "user", "name", "Local"))
+
+		assert.Equal(t, "Local", r.Config.Get("user", "name"))
+		assert.Equal(t, "system@example.com", r.Config.Get("User", "Email"))
+		assert.Equal(t, []string{"System", "Global", "Local"}, r.Config.GetAll("user", "name"))
+		global := r.Config.Find(repository.ConfigGlobal, "user", "name")
+		assert.Equal(t, []repository.ConfigEntry{{Name: "user.name", Value: "Global", Scope: repository.ConfigGlobal, Origin: "/home/global"}}, global)
+
+		assert.NoError(t, r.Config.Set(repository.ConfigGlobal, "core", "editor", "nano"))
+		assert.Equal(t, "nano", r.Config.Get("core", "editor"))
+		data, err := afero.ReadFile(r.FS, "/home/global")
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "editor = nano")
+	})
+
+	t.Run("Include", func(t *testing.T) {
+		t.Setenv("GGIT_CONFIG_SYSTEM", "/etc/system")
+		t.Setenv("GGIT_CONFIG_GLOBAL", "/home/global")
+		r := newTestRepository(t)
+		assert.NoError(t, afero.WriteFile(r.FS, "/home/always", []byte("[a]\n\tx = always\n"), 0644))
+		assert.NoError(t, afero.WriteFile(r.FS, "/home/repo", []byte("[a]\n\ty = repo\n"), 0644))
+		assert.NoError(t, afero.WriteFile(r.FS, "/home/branch", []byte("[a]\n\tz = branch\n"), 0644))
+		assert.NoError(t, afero.WriteFile(r.FS, "/home/other", []byte("[a]\n\ty = other\n\tz = other\n"), 0644))
+		writeConfigFile(t, r, "/home/global", "[include]\n\tpath = always\n"+
+			"[includeIf \"gitdir:test/path/.ggit\"]\n\tpath = repo\n"+
+			"[includeIf \"gitdir:/elsewhere/\"]\n\tpath = other\n"+
+			"[includeIf \"onbranch:ma*\"]\n\tpath = /home/branch\n"+
+			"[includeIf \"onbranch:topic\"]\n\tpath = other\n")
+
+		assert.Equal(t, "always", r.Config.Get("a", "x"))
+		assert.Equal(t, "repo", r.Config.Get("a", "y"))
+		assert.Equal(t, "branch", r.Config.Get("a", "z"))
+		entries := r.Config.Find("", "a", "x")
+		assert.Equal(t, "/home/always", entries[0].Origin)
+		assert.Equal(t, repository.ConfigGlobal, entries[0].Scope)
+	})
+
+	t.Run("SetAndUnset", func(t *testing.T) {
+		r := newTestRepository(t)
+		assert.NoError(t, r.Config.Set("", "remote.origin", "url", "/somewhere"))
+		assert.NoError(t, r.Config.Add("", "remote.origin", "fetch", "+refs/heads/*:refs/remotes/origin/*"))
+		assert.NoError(t, r.Config.Add("", "remote.origin", "fetch", "^refs/heads/wip"))
+		assert.Equal(t, "/somewhere", r.Config.Get("remote.origin", "url"))
+		assert.Empty(t, r.Config.Get("remote.Origin", "url"))
+		assert.Len(t, r.Config.GetAll("remote.origin", "fetch"), 2)
+
+		err := r.Config.Set("", "remote.origin", "fetch", "x")
+		assert.EqualError(t, err, "remote.origin.fetch has multiple values")
+		assert.ErrorAs(t, r.Config.Unset("", "remote.origin", "fetch", false), &repository.ConfigMultipleValuesError{})
+		assert.NoError(t, r.Config.Unset("", "remote.origin", "fetch", true))
+		assert.Empty(t, r.Config.GetAll("remote.origin", "fetch"))
+		assert.ErrorIs(t, r.Config.Unset("", "remote.origin", "fetch", false), repository.ErrorConfigNotFound)
+
+		data, err := afero.ReadFile(r.FS, r.Config.Path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "[remote \"origin\"]\nurl = /somewhere\n")
+	})
+
+	t.Run("Sections", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeConfigFile(t, r, r.Config.Path, "[remote \"origin\"]\n\turl = /somewhere\n\tfetch = a\n\tfetch = b\n[core]\n\tbare = false\n")
+		assert.NoError(t, r.Config.RenameSection("", "remote.origin", "remote.upstream"))
+		assert.Empty(t, r.Config.Get("remote.origin", "url"))
+		assert.Equal(t, "/somewhere", r.Config.Get("remote.upstream", "url"))
+		assert.Equal(t, []string{"a", "b"}, r.Config.GetAll("remote.upstream", "fetch"))
+
+		assert.NoError(t, r.Config.RemoveSection("", "remote.upstream"))
+		assert.Empty(t, r.Config.GetAll("remote.upstream", "fetch"))
+		assert.Equal(t, "false", r.Config.Get("core", "bare"))
+		assert.ErrorIs(t, r.Config.RemoveSection("", "remote.upstream"), repository.ErrorConfigNotFound)
+		assert.ErrorIs(t, r.Config.RenameSection("", "remote.upstream", "remote.x"), repository.ErrorConfigNotFound)
+	})
+
+	t.Run("Typed", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeConfigFile(t, r, r.Config.Path, "[a]\n\tyes = on\n\tno = 0\n\tbare\n\tsize = 2k\n\tbig = 3G\n\tbad = maybe\n\thome = ~/x\n")
+
+		for key, expected := range map[string]bool{"yes": true, "no": false, "bare": true, "unset": true} {
+			b, err := r.Config.GetBool("a", key, true)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, b, key)
+		}
+		_, err := r.Config.GetBool("a", "bad", false)
+		assert.EqualError(t, err, "bad boolean config value 'maybe' for 'a.bad'")
+
+		n, err := r.Config.GetInt("a", "size", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2048), n)
+		n, err = r.Config.GetInt("a", "big", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3<<30), n)
+		_, err = r.Config.GetInt("a", "bad", 0)
+		assert.EqualError(t, err, "bad numeric config value 'maybe' for 'a.bad': invalid unit")
+
+		t.Setenv("HOME", "/home/user")
+		p, err := r.Config.GetPath("a", "home")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join("/home/user", "x"), p)
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		section, key, err := repository.ParseConfigName("remote.Origin.URL")
+		assert.NoError(t, err)
+		assert.Equal(t, "remote.Origin", section)
+		assert.Equal(t, "URL", key)
+		_, _, err = repository.ParseConfigName("foo")
+		assert.EqualError(t, err, "key does not contain a section: foo")
+		_, _, err = repository.ParseConfigName("a.b c")
+		assert.EqualError(t, err, "invalid key: a.b c")
+	})
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Output formats supported by DiffTree.
+const (
+	DiffFormatRaw        = "raw"
+	DiffFormatNameStatus = "name-status"
+	DiffFormatNumstat    = "numstat"
+	DiffFormatStat       = "stat"
+	DiffFormatShortstat  = "shortstat"
+	DiffFormatDirstat    = "dirstat"
+	DiffFormatPatch      = "patch"
+)
+
+// diffFormats lists the output formats in the order they are printed.
+func diffFormats() []string {
+	return []string{DiffFormatRaw, DiffFormatNameStatus, DiffFormatNumstat, DiffFormatStat, DiffFormatShortstat, DiffFormatDirstat, DiffFormatPatch}
+}
+
+type DiffTree struct {
+	From             string
+	To               string
+	Formats          []string
+	FindRenames      string
+	FindCopies       string
+	FindCopiesHarder bool
+	Stat             diff.StatOptions
+	Dirstat          string
+	Patch            diff.PatchOptions
+}
+
+// diffOptions translates the rename and copy flags of a diff command into
+// options of the diff engine. Empty flags leave the detection disabled.
+func diffOptions(renames string, copies string, copiesHarder bool) (*diff.Options, error) {
+	opts := &diff.Options{}
+	score := renames
+	if copies != "" {
+		opts.Copies = true
+		opts.FindCopiesHarder = copiesHarder
+		score = copies
+	}
+	if renames != "" || copies != "" {
+		s, err := diff.ParseScore(score)
+		if err != nil {
+			return nil, err
+		}
+		opts.Renames = true
+		opts.RenameScore = s
+	}
+	return opts, nil
+}
+
+// patchSeparated reports whether the patch follows output that git
+// separates from it with an empty line: the raw or name-status formats or
+// any line based statistics.
+func patchSeparated(formats []string, dirstat diff.DirstatOptions) bool {
+	if lo.Contains(formats, DiffFormatDirstat) && dirstat.Mode == diff.DirstatLines {
+		return true
+	}
+	return lo.Some(formats, []string{DiffFormatRaw, DiffFormatNameStatus, DiffFormatNumstat, DiffFormatStat, DiffFormatShortstat})
+}
+
+// DiffTree compares the trees of two tree-ish objects recursively.
+// Every requested format is rendered, in git's order; without a format the
+// raw format is used.
+//
+// Returns:
+//   - The changes rendered in the requested formats.
+//   - An error if either side can not be resolved to a tree, or if a format,
+//     a similarity score, the dirstat parameters or the patch options are
+//     invalid.
+func (r *Repository) DiffTree(opts *DiffTree) (string, error) {
+	formats := opts.Formats
+	if len(formats) == 0 {
+		formats = []string{DiffFormatRaw}
+	}
+	for _, f := range formats {
+		if !lo.Contains(diffFormats(), f) {
+			return "", fmt.Errorf("unknown diff format %s", f)
+		}
+	}
+	options, err := diffOptions(opts.FindRenames, opts.FindCopies, opts.FindCopiesHarder)
+	if err != nil {
+		return "", err
+	}
+	dirstat, err := diff.ParseDirstat(opts.Dirstat)
+	if err != nil {
+		return "", err
+	}
+
+	from, err := r.ResolveTree(opts.From)
+	if err != nil {
+		return "", err
+	}
+	to, err := r.ResolveTree(opts.To)
+	if err != nil {
+		return "", err
+	}
+	changes, err := diff.TreeDiff(r, from, to, options)
+	if err != nil {
+		return "", err
+	}
+
+	var stats []diff.FileStat
+	if lo.Some(formats, []string{DiffFormatNumstat, DiffFormatStat, DiffFormatShortstat}) {
+		stats, err = diff.Stats(r, changes)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	for _, f := range diffFormats() {
+		if !lo.Contains(formats, f) {
+			continue
+		}
+		switch f {
+		case DiffFormatRaw:
+			b.WriteString(diff.FormatRaw(changes))
+		case DiffFormatNameStatus:
+			b.WriteString(diff.FormatNameStatus(changes))
+		case DiffFormatDirstat:
+			out, err := diff.FormatDirstat(r, changes, dirstat)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(out)
+		case DiffFormatNumstat:
+			b.WriteString(diff.FormatNumstat(stats))
+		case DiffFormatStat:
+			b.WriteString(diff.FormatStat(stats, opts.Stat))
+		case DiffFormatShortstat:
+			if len(stats) > 0 {
+				b.WriteString(diff.FormatShortstat(stats))
+			}
+		case DiffFormatPatch:
+			out, err := diff.FormatPatch(r, changes, opts.Patch)
+			if err != nil {
+				return "", err
+			}
+			if out != "" && patchSeparated(formats, dirstat) {
+				b.WriteString("\n")
+			}
+			b.WriteString(out)
+		}
+	}
+	return b.String(), nil
+}
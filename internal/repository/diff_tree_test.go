@@ -0,0 +1,165 @@
+package repository_test
+
+import (
+	"ggit/internal/diff"
+	"ggit/internal/factory"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRepository(t *testing.T) *repository.Repository {
+	cwd := "./test/path"
+	fs := factory.NewTestFactory()
+	fs.MkdirAll(cwd, os.ModePerm)
+
+	r, err := repository.NewRepository(fs, cwd)
+	assert.NoError(t, err)
+	_, err = r.Create(false)
+	assert.NoError(t, err)
+	return r
+}
+
+func writeTree(t *testing.T, r *repository.Repository, entries ...objects.TreeEntry) string {
+	tree := objects.NewTree()
+	tree.Entries = entries
+	tree.Sort()
+	sha, err := r.WriteObject(tree)
+	assert.NoError(t, err)
+	return sha
+}
+
+func writeBlob(t *testing.T, r *repository.Repository, data string) string {
+	sha, err := r.WriteObject(objects.NewBlob(data))
+	assert.NoError(t, err)
+	return sha
+}
+
+func TestDiffTree(t *testing.T) {
+	r := newTestRepository(t)
+
+	content := "first line\nsecond line\nthird line\nfourth line\n"
+	kept := writeBlob(t, r, "kept\n")
+	original := writeBlob(t, r, content)
+	moved := writeBlob(t, r, content+"fifth line\n")
+
+	lib := writeTree(t, r, objects.TreeEntry{Mode: objects.ModeFile, Name: "file.txt", Hash: original})
+	from := writeTree(t, r,
+		objects.TreeEntry{Mode: objects.ModeFile, Name: "kept.txt", Hash: kept},
+		objects.TreeEntry{Mode: objects.ModeTree, Name: "lib", Hash: lib},
+	)
+	to := writeTree(t, r,
+		objects.TreeEntry{Mode: objects.ModeFile, Name: "kept.txt", Hash: kept},
+		objects.TreeEntry{Mode: objects.ModeFile, Name: "moved.txt", Hash: moved},
+	)
+
+	t.Run("Raw", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{From: from, To: to})
+		assert.NoError(t, err)
+		assert.Equal(t,
+			":100644 000000 "+original+" 0000000000000000000000000000000000000000 D\tlib/file.txt\n"+
+				":000000 100644 0000000000000000000000000000000000000000 "+moved+" A\tmoved.txt\n",
+			out)
+	})
+
+	t.Run("NameStatusRenames", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{From: from[:7], To: to[:7], Formats: []string{repository.DiffFormatNameStatus}, FindRenames: "50%"})
+		assert.NoError(t, err)
+		assert.Equal(t, "R080\tlib/file.txt\tmoved.txt\n", out)
+	})
+
+	t.Run("CommitPeeling", func(t *testing.T) {
+		commit := objects.NewCommit()
+		commit.KVLM.Tree = to
+		commit.KVLM.Author = "A U Thor <author@example.com> 1527025023 +0200"
+		commit.KVLM.Comitter = commit.KVLM.Author
+		commit.KVLM.Message = "message"
+		sha, err := r.WriteObject(commit)
+		assert.NoError(t, err)
+
+		out, err := r.DiffTree(&repository.DiffTree{From: to, To: sha})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{
+			From:        from,
+			To:          to,
+			Formats:     []string{repository.DiffFormatShortstat, repository.DiffFormatNumstat, repository.DiffFormatStat},
+			FindRenames: "50%",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "1\t0\tlib/file.txt => moved.txt\n"+
+			" lib/file.txt => moved.txt | 1 +\n"+
+			" 1 file changed, 1 insertion(+)\n"+
+			" 1 file changed, 1 insertion(+)\n", out)
+	})
+
+	t.Run("Dirstat", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{From: from, To: to, Formats: []string{repository.DiffFormatDirstat}, Dirstat: "files"})
+		assert.NoError(t, err)
+		assert.Equal(t, "  50.0% lib/\n", out)
+
+		out, err = r.DiffTree(&repository.DiffTree{From: from, To: to, Formats: []string{repository.DiffFormatDirstat, repository.DiffFormatStat}, Dirstat: "files"})
+		assert.NoError(t, err)
+		assert.Equal(t, " lib/file.txt | 4 ----\n"+
+			" moved.txt    | 5 +++++\n"+
+			" 2 files changed, 5 insertions(+), 4 deletions(-)\n"+
+			"  50.0% lib/\n", out)
+
+		_, err = r.DiffTree(&repository.DiffTree{From: from, To: to, Formats: []string{repository.DiffFormatDirstat}, Dirstat: "bogus"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{
+			From:        from,
+			To:          to,
+			Formats:     []string{repository.DiffFormatPatch, repository.DiffFormatNameStatus},
+			FindRenames: "50%",
+			Patch:       diff.PatchOptions{Context: 3, WordDiff: diff.WordDiffPlain},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "R080\tlib/file.txt\tmoved.txt\n"+
+			"\n"+
+			"diff --git a/lib/file.txt b/moved.txt\n"+
+			"similarity index 80%\n"+
+			"rename from lib/file.txt\n"+
+			"rename to moved.txt\n"+
+			"index "+original[:7]+".."+moved[:7]+" 100644\n"+
+			"--- a/lib/file.txt\n"+
+			"+++ b/moved.txt\n"+
+			"@@ -2,3 +2,4 @@ first line\n"+
+			"second line\n"+
+			"third line\n"+
+			"fourth line\n"+
+			"{+fifth line+}\n", out)
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		_, err := r.DiffTree(&repository.DiffTree{From: from, To: to, Formats: []string{"summary"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("EmptyTree", func(t *testing.T) {
+		out, err := r.DiffTree(&repository.DiffTree{From: objects.EmptyTreeHash, To: to, Formats: []string{repository.DiffFormatNameStatus}})
+		assert.NoError(t, err)
+		assert.Equal(t, "A\tkept.txt\nA\tmoved.txt\n", out)
+	})
+
+	t.Run("InvalidObject", func(t *testing.T) {
+		_, err := r.DiffTree(&repository.DiffTree{From: "zzzz", To: to})
+		assert.Error(t, err)
+		_, err = r.DiffTree(&repository.DiffTree{From: kept, To: to})
+		assert.Error(t, err)
+	})
+
+	t.Run("InvalidScore", func(t *testing.T) {
+		_, err := r.DiffTree(&repository.DiffTree{From: from, To: to, FindRenames: "x"})
+		assert.Error(t, err)
+	})
+}
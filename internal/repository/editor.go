@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/afero"
+)
+
+// editor returns the command editing commit messages: GGIT_EDITOR, then
+// core.editor, VISUAL and EDITOR, falling back to vi.
+func (r *Repository) editor() string {
+	if e := os.Getenv("GGIT_EDITOR"); e != "" {
+		return e
+	}
+	if e := r.Config.Get("core", "editor"); e != "" {
+		return e
+	}
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if e := os.Getenv(name); e != "" {
+			return e
+		}
+	}
+	return "vi"
+}
+
+// sequenceEditor returns the command editing rebase todo lists:
+// GGIT_SEQUENCE_EDITOR, then sequence.editor, falling back to the editor of
+// commit messages.
+func (r *Repository) sequenceEditor() string {
+	if e := os.Getenv("GGIT_SEQUENCE_EDITOR"); e != "" {
+		return e
+	}
+	if e := r.Config.Get("sequence", "editor"); e != "" {
+		return e
+	}
+	return r.editor()
+}
+
+// runEditor runs an editor on a file of the repository directory. The
+// editor is run by the shell, so that it may hold arguments, with the path
+// of the file appended; ":" leaves the file as it is. Files of a
+// filesystem other than the operating system's are edited through a
+// temporary copy.
+//
+// Returns:
+//   - An error if the editor fails.
+func (r *Repository) runEditor(editor string, name string) error {
+	if editor == ":" {
+		return nil
+	}
+	return r.withNativeFile(name, func(path string) error {
+		cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("there was a problem with the editor '%s'", editor)
+		}
+		return nil
+	})
+}
+
+// runShell runs a command with the shell in the worktree, as exec lines of
+// rebase todo lists are.
+//
+// Returns:
+//   - The combined output of the command.
+//   - An error if the command fails.
+func (r *Repository) runShell(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if _, native := r.FS.Fs.(*afero.OsFs); native {
+		cmd.Dir = r.Worktree
+	}
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
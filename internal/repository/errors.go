@@ -1,5 +1,24 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrorUninitiate = errors.New("ggit repo uninitiate, please initiate one first")
+
+var ErrorBare = errors.New("this operation must be run in a work tree")
+
+var ErrorRefNotFound = errors.New("ref not found")
+
+var ErrorConfigNotFound = errors.New("config key not found")
+
+// ExitError makes a command exit with Code without printing an error, for
+// commands whose exit status is their answer.
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
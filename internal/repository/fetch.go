@@ -0,0 +1,504 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"slices"
+	"strings"
+)
+
+const (
+	fetchHeadFile = "FETCH_HEAD"
+	fileURLPrefix = "file://"
+)
+
+type Fetch struct {
+	// Remote is the name of a remote, or the path or file:// URL of a
+	// repository. The remote of the current branch, or origin, when empty.
+	Remote string
+	// Refspecs are fetched instead of the remote.<name>.fetch ones.
+	Refspecs []string
+}
+
+// fetchedRef is a ref of a remote a fetch brings in.
+type fetchedRef struct {
+	// remote is the full name of the ref in the remote, or HEAD.
+	remote string
+	sha    string
+	// local is the ref it updates, empty when it is only recorded in
+	// FETCH_HEAD.
+	local string
+	force bool
+	// merge marks the refs pull merges.
+	merge bool
+}
+
+// describe returns how FETCH_HEAD and merge messages name the ref, e.g.
+// "branch 'master'", empty for HEAD.
+func (f fetchedRef) describe() string {
+	if branch, ok := strings.CutPrefix(f.remote, "refs/heads/"); ok {
+		return "branch '" + branch + "'"
+	}
+	if tag, ok := strings.CutPrefix(f.remote, "refs/tags/"); ok {
+		return "tag '" + tag + "'"
+	}
+	if f.remote == headFile {
+		return ""
+	}
+	return "'" + f.remote + "'"
+}
+
+// defaultRemoteName returns the remote of the current branch, or origin.
+func (r *Repository) defaultRemoteName() string {
+	if branch := r.branchName(); branch != "" {
+		if name := r.Config.Get("branch."+branch, "remote"); name != "" {
+			return name
+		}
+	}
+	return defaultRemote
+}
+
+// remoteURL returns the URL of the remote name, or name itself when no
+// remote of that name is configured, rewritten by url.<base>.insteadOf.
+//
+// Returns:
+//   - The URL.
+//   - Whether name is a configured remote.
+func (r *Repository) remoteURL(name string) (string, bool) {
+	if url := r.Config.Get("remote."+name, "url"); url != "" {
+		return r.rewriteURL(url, false), true
+	}
+	return r.rewriteURL(name, false), false
+}
+
+// openRemote opens the repository at url: a path or a file:// URL.
+//
+// Returns:
+//   - The repository.
+//   - An error if the protocol is not supported or the path is not a
+//     repository.
+func (r *Repository) openRemote(url string) (*Repository, error) {
+	path := strings.TrimPrefix(url, fileURLPrefix)
+	if scheme, _, ok := strings.Cut(path, "://"); ok {
+		return nil, fmt.Errorf("protocol '%s' is not supported", scheme)
+	}
+	remote, err := OpenRepository(r.FS, path)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' does not appear to be a ggit repository", url)
+	}
+	return remote, nil
+}
+
+// checkObjectFormat checks a remote names its objects with the object
+// format of the repository, for their object IDs to mean the same objects.
+func (r *Repository) checkObjectFormat(remote *Repository) error {
+	if ours, theirs := r.ObjectFormat().Name, remote.ObjectFormat().Name; ours != theirs {
+		return fmt.Errorf("mismatched algorithms: client %s; server %s", ours, theirs)
+	}
+	return nil
+}
+
+// Fetch brings the refs of another repository and the objects they need
+// into the repository: only the objects it does not have are copied. The
+// refs are mapped to local refs by the refspecs, remote.<name>.fetch for a
+// configured remote, which sets up its remote-tracking branches under
+// refs/remotes/<name>/; negative refspecs leave refs out. Without
+// refspecs, the HEAD of an unconfigured repository is fetched. The URL is
+// rewritten by url.<base>.insteadOf. The tags of the remote pointing to fetched
+// objects follow. What was fetched is recorded in FETCH_HEAD, where the
+// upstream branch of the current branch is marked for merging.
+//
+// A ref is only updated if that is a fast-forward, unless the refspec
+// starts with "+". Tags are never updated.
+//
+// Returns:
+//   - The report of the updated refs.
+//   - Whether all the refs could be updated.
+//   - An error if the remote can not be read or a ref can not be written.
+func (r *Repository) Fetch(opts *Fetch) (string, bool, error) {
+	out, clean, _, err := r.fetch(opts)
+	return out, clean, err
+}
+
+func (r *Repository) fetch(opts *Fetch) (string, bool, []fetchedRef, error) {
+	if !r.IsInitiated() {
+		return "", false, nil, ErrorUninitiate
+	}
+	name := opts.Remote
+	if name == "" {
+		name = r.defaultRemoteName()
+	}
+	url, configured := r.remoteURL(name)
+	remote, err := r.openRemote(url)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if err := r.checkObjectFormat(remote); err != nil {
+		return "", false, nil, err
+	}
+	refs, err := remote.remoteRefs()
+	if err != nil {
+		return "", false, nil, err
+	}
+	fetched, err := r.fetchedRefs(name, configured, refs, opts.Refspecs)
+	if err != nil {
+		return "", false, nil, err
+	}
+	tips := []string{}
+	for _, f := range fetched {
+		tips = append(tips, f.sha)
+	}
+	if err := r.fetchObjects(remote, tips); err != nil {
+		return "", false, nil, err
+	}
+	if configured && len(opts.Refspecs) == 0 {
+		tags, err := r.followTags(remote, refs)
+		if err != nil {
+			return "", false, nil, err
+		}
+		fetched = append(fetched, tags...)
+	}
+
+	var b strings.Builder
+	clean := true
+	for _, f := range fetched {
+		line, ok, err := r.storeFetchedRef(name, f)
+		if err != nil {
+			return "", false, nil, err
+		}
+		b.WriteString(line)
+		clean = clean && ok
+	}
+	if err := r.writeFetchHead(url, fetched); err != nil {
+		return "", false, nil, err
+	}
+	report := b.String()
+	if report != "" {
+		report = "From " + url + "\n" + report
+	}
+	if !clean {
+		report += "error: some local refs could not be updated\n"
+	}
+	return report, clean, fetched, nil
+}
+
+// remoteRefs returns the refs of the repository and HEAD, by name.
+func (r *Repository) remoteRefs() (map[string]string, error) {
+	names, err := r.listRefs()
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]string{}
+	for _, name := range append(names, headFile) {
+		sha, err := r.ResolveRef(name)
+		if errors.Is(err, ErrorRefNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		refs[name] = sha
+	}
+	return refs, nil
+}
+
+// fetchedRefs lists the refs of a remote the refspecs fetch, the ones of
+// remote.<name>.fetch when none are given, but the ones their negative
+// refspecs exclude. The refs given by name only also update the
+// remote-tracking branch the configured refspecs map them to, and are
+// marked for merging.
+func (r *Repository) fetchedRefs(name string, configured bool, refs map[string]string, specs []string) ([]fetchedRef, error) {
+	tracking := []*Refspec{}
+	if configured {
+		var err error
+		if tracking, err = parseRefspecs(r.Config.GetAll("remote."+name, "fetch"), true); err != nil {
+			return nil, err
+		}
+	}
+	explicit := len(specs) > 0
+	parsed, err := parseRefspecs(specs, true)
+	if err != nil {
+		return nil, err
+	}
+	if !explicit {
+		parsed = tracking
+		if !configured {
+			parsed = []*Refspec{{Src: headFile}}
+		}
+	}
+	upstream := ""
+	if branch := r.branchName(); branch != "" && r.Config.Get("branch."+branch, "remote") == name {
+		upstream = r.Config.Get("branch."+branch, "merge")
+	}
+
+	names := make([]string, 0, len(refs))
+	for ref := range refs {
+		names = append(names, ref)
+	}
+	slices.Sort(names)
+	fetched := []fetchedRef{}
+	seen := map[string]bool{}
+	for _, spec := range parsed {
+		if spec.Negative {
+			continue
+		}
+		s := *spec
+		if !s.IsGlob() {
+			src, ok := dwimRemoteRef(s.Src, refs)
+			if !ok {
+				return nil, fmt.Errorf("couldn't find remote ref %s", s.Src)
+			}
+			s.Src = src
+		}
+		for _, ref := range names {
+			local, ok := s.Match(ref)
+			if !ok || seen[ref] || excludedRef(parsed, ref) {
+				continue
+			}
+			seen[ref] = true
+			f := fetchedRef{remote: ref, sha: refs[ref], local: local, force: s.Force}
+			if explicit {
+				f.merge = !s.IsGlob()
+				for _, t := range tracking {
+					if local, ok := t.Match(ref); ok && !t.Negative && f.local == "" && !excludedRef(tracking, ref) {
+						f.local, f.force = local, t.Force
+					}
+				}
+			} else {
+				f.merge = ref == upstream || !configured
+			}
+			fetched = append(fetched, f)
+		}
+	}
+	return fetched, nil
+}
+
+// dwimRemoteRef expands a short ref name the way the refs of the
+// repository are looked up, among the refs of a remote.
+func dwimRemoteRef(name string, refs map[string]string) (string, bool) {
+	for _, rule := range refRules() {
+		full := fmt.Sprintf(rule, name)
+		if _, ok := refs[full]; ok {
+			return full, true
+		}
+	}
+	return "", false
+}
+
+// fetchObjects copies the objects reachable from tips in remote that the
+// repository does not have. The objects an object the repository has
+// refers to are taken to be there too, so the objects are all read first,
+// then written the objects they refer to first: a failed fetch leaves no
+// object without the objects it refers to.
+func (r *Repository) fetchObjects(remote *Repository, tips []string) error {
+	type step struct {
+		sha      string
+		expanded bool
+	}
+	pending := []step{}
+	for _, sha := range tips {
+		pending = append(pending, step{sha: sha})
+	}
+	read := map[string]store.Object{}
+	written := map[string]bool{}
+	order := []string{}
+	for len(pending) > 0 {
+		top := pending[len(pending)-1]
+		if top.expanded {
+			pending = pending[:len(pending)-1]
+			if !written[top.sha] {
+				written[top.sha] = true
+				order = append(order, top.sha)
+			}
+			continue
+		}
+		if _, ok := read[top.sha]; ok || r.Objects.Has(top.sha) {
+			pending = pending[:len(pending)-1]
+			continue
+		}
+		o, err := remote.Objects.Read(top.sha)
+		if errors.Is(err, store.ErrNotFound) && top.sha == r.ObjectFormat().EmptyTree {
+			// Like the repositories, the empty tree can be referred to
+			// without being stored.
+			pending = pending[:len(pending)-1]
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("remote object %s: %w", top.sha, err)
+		}
+		links, err := remote.objectLinks(top.sha, o.Format, o.Data)
+		if err != nil {
+			return err
+		}
+		read[top.sha] = o
+		pending[len(pending)-1].expanded = true
+		for _, link := range links {
+			pending = append(pending, step{sha: link})
+		}
+	}
+	for _, sha := range order {
+		if _, err := r.Objects.Write(read[sha]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectLinks returns the objects an object refers to: the tree and the
+// parents of a commit, the entries of a tree but submodules, or the target
+// of a tag.
+func (r *Repository) objectLinks(sha string, format string, payload string) ([]string, error) {
+	switch format {
+	case "tag":
+		target, ok := tagTarget(payload)
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %s", sha)
+		}
+		return []string{target}, nil
+	case "commit", "tree":
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return nil, err
+		}
+		switch obj := obj.(type) {
+		case *objects.Commit:
+			return append([]string{obj.KVLM.Tree}, obj.KVLM.Parents...), nil
+		case *objects.Tree:
+			links := []string{}
+			for _, e := range obj.Entries {
+				if e.Mode != objects.ModeGitlink {
+					links = append(links, e.Hash)
+				}
+			}
+			return links, nil
+		}
+	}
+	return nil, nil
+}
+
+// tagTarget returns the object of the "object" header of a tag.
+func tagTarget(payload string) (string, bool) {
+	line, _, _ := strings.Cut(payload, "\n")
+	return strings.CutPrefix(line, "object ")
+}
+
+// followTags returns the tags of a remote the repository does not have
+// whose target it has, after the objects of a fetch were copied, and
+// copies their tag objects.
+func (r *Repository) followTags(remote *Repository, refs map[string]string) ([]fetchedRef, error) {
+	tags := []fetchedRef{}
+	for name, sha := range refs {
+		if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		if _, err := r.ResolveRef(name); err == nil {
+			continue
+		}
+		target := sha
+		if o, err := remote.Objects.Read(sha); err == nil && o.Format == "tag" {
+			target, _ = tagTarget(o.Data)
+		}
+		if !r.Objects.Has(target) {
+			continue
+		}
+		if err := r.fetchObjects(remote, []string{sha}); err != nil {
+			return nil, err
+		}
+		tags = append(tags, fetchedRef{remote: name, sha: sha, local: name})
+	}
+	slices.SortFunc(tags, func(a, b fetchedRef) int { return strings.Compare(a.remote, b.remote) })
+	return tags, nil
+}
+
+// storeFetchedRef updates the local ref of a fetched ref, when it has one.
+// Updates that are no fast-forward are rejected unless forced, as are the
+// updates of tags and of the branch checked out.
+//
+// Returns:
+//   - The line of the report about the ref, empty when it is up to date.
+//   - Whether the ref could be updated.
+//   - An error if the ref can not be written.
+func (r *Repository) storeFetchedRef(remote string, f fetchedRef) (string, bool, error) {
+	if f.local == "" {
+		return "", true, nil
+	}
+	src, dst := shortRefName(f.remote), shortRefName(f.local)
+	current, err := r.ResolveRef(f.local)
+	if err != nil && !errors.Is(err, ErrorRefNotFound) {
+		return "", false, err
+	}
+	if current == f.sha {
+		return "", true, nil
+	}
+	line := func(flag byte, summary string, reason string) string {
+		return fmt.Sprintf(" %c %-17s %-10s -> %s%s\n", flag, summary, src, dst, reason)
+	}
+	if head, err := r.SymbolicRef(headFile); err == nil && head == f.local && !r.IsBare() {
+		return line('!', "[rejected]", "  (refusing to fetch into branch checked out)"), false, nil
+	}
+	message := fmt.Sprintf("fetch %s: ", remote)
+	if current == "" {
+		summary := "[new ref]"
+		switch {
+		case strings.HasPrefix(f.local, "refs/tags/"):
+			summary = "[new tag]"
+		case strings.HasPrefix(f.remote, "refs/heads/"):
+			summary = "[new branch]"
+		}
+		if err := r.UpdateRef(f.local, f.sha, "", message+"storing head"); err != nil {
+			return "", false, err
+		}
+		return line('*', summary, ""), true, nil
+	}
+	if strings.HasPrefix(f.local, "refs/tags/") && !f.force {
+		return line('!', "[rejected]", "  (would clobber existing tag)"), false, nil
+	}
+	ff, err := r.IsAncestor(current, f.sha)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case ff:
+		if err := r.UpdateRef(f.local, f.sha, current, message+"fast-forward"); err != nil {
+			return "", false, err
+		}
+		return line(' ', shortID(current)+".."+shortID(f.sha), ""), true, nil
+	case f.force:
+		if err := r.UpdateRef(f.local, f.sha, current, message+"forced-update"); err != nil {
+			return "", false, err
+		}
+		return line('+', shortID(current)+"..."+shortID(f.sha), "  (forced update)"), true, nil
+	}
+	return line('!', "[rejected]", "  (non-fast-forward)"), false, nil
+}
+
+// shortRefName strips the refs/heads/, refs/tags/ or refs/remotes/ prefix
+// of a ref name.
+func shortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
+
+// writeFetchHead records the fetched refs in FETCH_HEAD, the ones to merge
+// first, the others marked not-for-merge.
+func (r *Repository) writeFetchHead(url string, fetched []fetchedRef) error {
+	var merge, other strings.Builder
+	for _, f := range fetched {
+		what := url
+		if d := f.describe(); d != "" {
+			what = d + " of " + url
+		}
+		if f.merge {
+			fmt.Fprintf(&merge, "%s\t\t%s\n", f.sha, what)
+		} else {
+			fmt.Fprintf(&other, "%s\tnot-for-merge\t%s\n", f.sha, what)
+		}
+	}
+	return r.ReplaceTextFile(merge.String()+other.String(), fetchHeadFile)
+}
@@ -0,0 +1,146 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch(t *testing.T) {
+	t.Run("Remote", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, src, "master", "NEWS", "news\n")
+		assert.NoError(t, src.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		topic := commitChange(t, src, "master", "topic", "topic\n")
+		writeRef(t, src, "refs/heads/topic", topic)
+		writeRef(t, src, "refs/tags/v2", topic)
+		writeRef(t, src, "refs/tags/unrelated", writeCommit(t, src, 1))
+
+		out, clean, err := r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "From /src\n"+
+			"   "+head[:7]+".."+next[:7]+"  master     -> origin/master\n"+
+			" * [new branch]      topic      -> origin/topic\n"+
+			" * [new tag]         v2         -> v2\n", out)
+		assert.Equal(t, next, mustResolve(t, r, "refs/remotes/origin/master"))
+		assert.Equal(t, topic, mustResolve(t, r, "refs/remotes/origin/topic"))
+		assert.Equal(t, head, mustResolve(t, r, "HEAD"))
+		assert.True(t, r.Objects.Has(topic))
+		assert.Equal(t, next+"\t\tbranch 'master' of /src\n"+
+			topic+"\tnot-for-merge\tbranch 'topic' of /src\n"+
+			topic+"\tnot-for-merge\ttag 'v2' of /src\n", readGitFile(t, r, "FETCH_HEAD"))
+		_, err = r.ResolveRef("refs/tags/unrelated")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+
+		out, clean, err = r.Fetch(&repository.Fetch{Remote: "origin"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "", out)
+	})
+
+	t.Run("MissingObjectsOnly", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, src, "master", "NEWS", "news\n")
+		assert.NoError(t, src.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		unreachable := writeBlob(t, src, "unreachable\n")
+
+		_, _, err := r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		assert.True(t, hasLooseObject(r, next))
+		assert.False(t, r.Objects.Has(unreachable))
+	})
+
+	t.Run("RemoteMissingObject", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, src, "master", "NEWS", "news\n")
+		assert.NoError(t, src.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		blob := src.ObjectFormat().HashObject("blob", "news\n")
+		path := filepath.Join(src.Gitdir, "objects", blob[:2], blob[2:])
+		data, err := afero.ReadFile(src.FS, path)
+		assert.NoError(t, err)
+		assert.NoError(t, src.FS.Remove(path))
+
+		_, _, err = r.Fetch(&repository.Fetch{})
+		assert.ErrorContains(t, err, "remote object "+blob)
+		assert.False(t, r.Objects.Has(next))
+		assert.False(t, r.Objects.Has(mustReadCommit(t, src, next).KVLM.Tree))
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/origin/master"))
+
+		assert.NoError(t, afero.WriteFile(src.FS, path, data, 0o444))
+		_, clean, err := r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.True(t, r.Objects.Has(blob))
+		assert.Equal(t, next, mustResolve(t, r, "refs/remotes/origin/master"))
+	})
+
+	t.Run("NonFastForward", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		rewritten := writeCommit(t, src, 5)
+		assert.NoError(t, src.UpdateRef("refs/heads/master", rewritten, head, "reset: rewrite"))
+
+		out, clean, err := r.Fetch(&repository.Fetch{Refspecs: []string{"refs/heads/master:refs/remotes/origin/master"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        master     -> origin/master  (non-fast-forward)\n")
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/origin/master"))
+
+		out, clean, err = r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, " + "+head[:7]+"..."+rewritten[:7]+" master     -> origin/master  (forced update)\n")
+		assert.Equal(t, rewritten, mustResolve(t, r, "refs/remotes/origin/master"))
+	})
+
+	t.Run("Path", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := newTestRepository(t)
+		r.FS = src.FS
+		_, err := r.Create(false)
+		assert.NoError(t, err)
+
+		out, clean, err := r.Fetch(&repository.Fetch{Remote: "file:///src"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "", out)
+		assert.Equal(t, head+"\t\tfile:///src\n", readGitFile(t, r, "FETCH_HEAD"))
+		assert.True(t, r.Objects.Has(head))
+
+		out, _, err = r.Fetch(&repository.Fetch{Remote: "/src", Refspecs: []string{"master:refs/heads/mirror"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "From /src\n * [new branch]      master     -> mirror\n", out)
+		assert.Equal(t, head, mustResolve(t, r, "refs/heads/mirror"))
+
+		_, _, err = r.Fetch(&repository.Fetch{Remote: "/src", Refspecs: []string{"missing"}})
+		assert.EqualError(t, err, "couldn't find remote ref missing")
+		_, _, err = r.Fetch(&repository.Fetch{Remote: "/nowhere"})
+		assert.EqualError(t, err, "'/nowhere' does not appear to be a ggit repository")
+		_, _, err = r.Fetch(&repository.Fetch{Remote: "https://example.com/repo"})
+		assert.EqualError(t, err, "protocol 'https' is not supported")
+	})
+
+	t.Run("ObjectFormat", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r, err := repository.NewRepository(src.FS, "/dst")
+		assert.NoError(t, err)
+		_, err = r.Init(&repository.Init{ObjectFormat: "sha256"})
+		assert.NoError(t, err)
+
+		_, _, err = r.Fetch(&repository.Fetch{Remote: "/src", Refspecs: []string{"refs/heads/master:refs/heads/x"}})
+		assert.EqualError(t, err, "mismatched algorithms: client sha256; server sha1")
+		_, err = r.ResolveRef("refs/heads/x")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		assert.False(t, r.Objects.Has(head))
+
+		_, _, err = src.Push(&repository.Push{Remote: "/dst", Refspecs: []string{"master:refs/heads/x"}})
+		assert.EqualError(t, err, "mismatched algorithms: client sha1; server sha256")
+	})
+}
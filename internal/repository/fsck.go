@@ -0,0 +1,548 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Bits of the exit code of a check, telling what kind of problem it found.
+const (
+	// FsckErrorObject is set when an object is corrupt or malformed.
+	FsckErrorObject = 1
+	// FsckErrorReachable is set when an object that should be there is
+	// missing, or a ref points to no object.
+	FsckErrorReachable = 2
+)
+
+type Fsck struct {
+	// NoReflogs does not count the reflog entries as references, so that
+	// the commits only the reflog knows of are reported as dangling.
+	NoReflogs bool
+}
+
+// fsckLink is a reference from an object to another one.
+type fsckLink struct {
+	format string
+	sha    string
+}
+
+// fsckObject is an object of the database that could be read.
+type fsckObject struct {
+	format string
+	links  []fsckLink
+}
+
+// fsck holds the state of a check of the object database.
+type fsck struct {
+	r       *Repository
+	opts    *Fsck
+	objects map[string]*fsckObject
+	roots   []fsckLink
+	out     strings.Builder
+	code    int
+}
+
+// Fsck verifies the object database: it recomputes the ID of every object,
+// validates the format of trees, commits and tags, and checks that the
+// objects reachable from HEAD, the refs, the reflogs and the index are all
+// there. Objects nothing refers to are reported as dangling.
+//
+// Returns:
+//   - The problems found, one per line.
+//   - The exit code: zero when only dangling objects were found, otherwise
+//     a combination of FsckErrorObject and FsckErrorReachable.
+//   - An error if the repository can not be read.
+func (r *Repository) Fsck(opts *Fsck) (string, int, error) {
+	f := &fsck{r: r, opts: opts, objects: map[string]*fsckObject{}}
+	if err := f.scanObjects(); err != nil {
+		return "", 0, err
+	}
+	if err := f.checkRefs(); err != nil {
+		return "", 0, err
+	}
+	if err := f.checkIndex(); err != nil {
+		return "", 0, err
+	}
+	f.checkConnectivity()
+	return f.out.String(), f.code, nil
+}
+
+// scanObjects reads and validates every object of the repository.
+func (f *fsck) scanObjects() error {
+	return f.r.Objects.Iterate(f.checkObject)
+}
+
+// checkObject reads the object sha, verifies its ID and its format, and
+// records it with the objects it refers to.
+func (f *fsck) checkObject(sha string) error {
+	raw, err := f.r.Objects.Read(sha)
+	var corrupt *store.CorruptError
+	if errors.As(err, &corrupt) {
+		f.errorf(FsckErrorObject, "%s: object corrupt or missing: %s", sha, f.source(sha, corrupt.Source))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	format, payload := raw.Format, raw.Data
+	if real := f.r.ObjectFormat().HashObject(format, payload); real != sha {
+		f.errorf(FsckErrorObject, "%s: hash-path mismatch, found at: %s", real, f.source(sha, ""))
+		return nil
+	}
+
+	o := &fsckObject{format: format}
+	switch format {
+	case "blob":
+	case "tree":
+		o.links = f.checkTree(sha, payload)
+	case "commit":
+		o.links = f.checkCommit(sha, payload)
+	case "tag":
+		o.links = f.checkTag(sha, payload)
+	default:
+		f.errorf(FsckErrorObject, "%s: object corrupt or missing: %s", sha, f.source(sha, ""))
+		return nil
+	}
+	f.objects[sha] = o
+	return nil
+}
+
+// source returns the file holding the object sha, relative to the
+// worktree when it is inside, or the ID for stores without files.
+func (f *fsck) source(sha string, path string) string {
+	if path == "" {
+		info, err := f.r.Objects.Stat(sha)
+		if err != nil || info.Source == "" {
+			return sha
+		}
+		path = info.Source
+	}
+	if rel, err := filepath.Rel(f.r.Worktree, path); f.r.Worktree != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// checkTree validates the entries of a tree. Each kind of problem is
+// reported once per tree, in the order of treeProblems.
+//
+// Returns:
+//   - The objects the entries point to, submodule commits excepted.
+func (f *fsck) checkTree(sha string, payload string) []fsckLink {
+	tree := objects.NewTree()
+	tree.SetHashAlgorithm(f.r.ObjectFormat())
+	if err := tree.Deserialize(payload); err != nil {
+		f.objectError("tree", sha, "badTree", "cannot be parsed as a tree")
+		return nil
+	}
+	found := map[string]bool{}
+	links := []fsckLink{}
+	for i, e := range tree.Entries {
+		switch {
+		case e.Name == "":
+			found["emptyName"] = true
+		case strings.Contains(e.Name, "/"):
+			found["fullPathname"] = true
+		case e.Name == ".":
+			found["hasDot"] = true
+		case e.Name == "..":
+			found["hasDotdot"] = true
+		case strings.EqualFold(e.Name, gitdir) || strings.EqualFold(e.Name, ".git"):
+			found["hasDotgit"] = true
+		}
+		switch e.Mode {
+		case objects.ModeFile, objects.ModeExecutable, objects.ModeSymlink, objects.ModeTree, objects.ModeGitlink, "100664":
+		default:
+			if strings.HasPrefix(e.Mode, "0") {
+				found["zeroPaddedFilemode"] = true
+			} else {
+				found["badFilemode"] = true
+			}
+		}
+		if e.Hash == f.r.ObjectFormat().NullID() {
+			found["nullSha1"] = true
+		}
+		if i > 0 {
+			prev := tree.Entries[i-1]
+			if prev.Name == e.Name {
+				found["duplicateEntries"] = true
+			} else if treeEntryKey(prev) > treeEntryKey(e) {
+				found["treeNotSorted"] = true
+			}
+		}
+
+		switch {
+		case e.Mode == objects.ModeGitlink:
+		case e.IsTree():
+			links = append(links, fsckLink{format: "tree", sha: e.Hash})
+		default:
+			links = append(links, fsckLink{format: "blob", sha: e.Hash})
+		}
+	}
+	for _, problem := range treeProblems {
+		switch {
+		case !found[problem.id]:
+		case problem.fatal:
+			f.objectError("tree", sha, problem.id, problem.message)
+		default:
+			f.warnf("tree", sha, problem.id, problem.message)
+		}
+	}
+	return links
+}
+
+// treeProblems are the problems a tree can have, in the order they are
+// reported.
+var treeProblems = []struct {
+	id      string
+	message string
+	fatal   bool
+}{
+	{"nullSha1", "contains entries pointing to null sha1", false},
+	{"fullPathname", "contains full pathnames", false},
+	{"emptyName", "empty filename in tree entry", false},
+	{"hasDot", "contains '.'", false},
+	{"hasDotdot", "contains '..'", false},
+	{"hasDotgit", "contains '.git'", false},
+	{"zeroPaddedFilemode", "contains zero-padded file modes", false},
+	{"badFilemode", "contains bad file modes", false},
+	{"duplicateEntries", "contains duplicate file entries", true},
+	{"treeNotSorted", "not properly sorted", true},
+}
+
+// treeEntryKey returns the name tree entries are sorted by: subtrees sort
+// as if their name ended with a slash.
+func treeEntryKey(e objects.TreeEntry) string {
+	if e.IsTree() {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// checkCommit validates the headers of a commit.
+//
+// Returns:
+//   - The tree and the parents of the commit, as far as they could be
+//     parsed.
+func (f *fsck) checkCommit(sha string, payload string) []fsckLink {
+	links := []fsckLink{}
+	lines, ok := fsckHeaders(payload)
+	if !ok {
+		f.objectError("commit", sha, "unterminatedHeader", "unterminated header")
+		return links
+	}
+
+	tree, ok := strings.CutPrefix(headerLine(lines, 0), "tree ")
+	if !ok {
+		f.objectError("commit", sha, "missingTree", "invalid format - expected 'tree' line")
+		return links
+	}
+	if !f.r.ObjectFormat().IsID(tree) {
+		f.objectError("commit", sha, "badTreeSha1", "invalid 'tree' line format - bad sha1")
+		return links
+	}
+	links = append(links, fsckLink{format: "tree", sha: tree})
+	i := 1
+	for ; strings.HasPrefix(headerLine(lines, i), "parent "); i++ {
+		parent := strings.TrimPrefix(lines[i], "parent ")
+		if !f.r.ObjectFormat().IsID(parent) {
+			f.objectError("commit", sha, "badParentSha1", "invalid 'parent' line format - bad sha1")
+			return links
+		}
+		links = append(links, fsckLink{format: "commit", sha: parent})
+	}
+	for _, role := range []string{"author", "committer"} {
+		ident, ok := strings.CutPrefix(headerLine(lines, i), role+" ")
+		if !ok {
+			f.objectError("commit", sha, "missing"+strings.ToUpper(role[:1])+role[1:], "invalid format - expected '"+role+"' line")
+			return links
+		}
+		if id, message := fsckIdent(ident); id != "" {
+			f.objectError("commit", sha, id, message)
+			return links
+		}
+		i++
+	}
+	return links
+}
+
+// checkTag validates the headers of an annotated tag.
+//
+// Returns:
+//   - The object the tag points to, if it could be parsed.
+func (f *fsck) checkTag(sha string, payload string) []fsckLink {
+	lines, ok := fsckHeaders(payload)
+	if !ok {
+		f.objectError("tag", sha, "unterminatedHeader", "unterminated header")
+		return nil
+	}
+	object, ok := strings.CutPrefix(headerLine(lines, 0), "object ")
+	if !ok {
+		f.objectError("tag", sha, "missingObject", "invalid format - expected 'object' line")
+		return nil
+	}
+	if !f.r.ObjectFormat().IsID(object) {
+		f.objectError("tag", sha, "badObjectSha1", "invalid 'object' line format - bad sha1")
+		return nil
+	}
+	format, ok := strings.CutPrefix(headerLine(lines, 1), "type ")
+	if !ok {
+		f.objectError("tag", sha, "missingTypeEntry", "invalid format - expected 'type' line")
+		return nil
+	}
+	if !slices.Contains([]string{"blob", "tree", "commit", "tag"}, format) {
+		f.objectError("tag", sha, "badType", "invalid 'type' value")
+		return nil
+	}
+	links := []fsckLink{{format: format, sha: object}}
+	if !strings.HasPrefix(headerLine(lines, 2), "tag ") {
+		f.objectError("tag", sha, "missingTagEntry", "invalid format - expected 'tag' line")
+		return links
+	}
+	if tagger, ok := strings.CutPrefix(headerLine(lines, 3), "tagger "); ok {
+		if id, message := fsckIdent(tagger); id != "" {
+			f.objectError("tag", sha, id, message)
+		}
+	}
+	return links
+}
+
+// fsckHeaders splits the headers of a commit or a tag into lines.
+//
+// Returns:
+//   - The header lines.
+//   - False if the headers are not terminated by a newline.
+func fsckHeaders(payload string) ([]string, bool) {
+	headers, _, found := strings.Cut(payload, "\n\n")
+	if !found {
+		if !strings.HasSuffix(payload, "\n") {
+			return nil, false
+		}
+		headers = strings.TrimSuffix(payload, "\n")
+	}
+	return strings.Split(headers, "\n"), true
+}
+
+// headerLine returns the i-th header line, empty past the last one.
+func headerLine(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+// fsckIdent validates an identity line the way git does, more strictly
+// than objects.ParseIdent.
+//
+// Returns:
+//   - The ID and the message of the first problem found, empty if the
+//     identity is well-formed.
+func fsckIdent(s string) (string, string) {
+	const prefix = "invalid author/committer line - "
+	if strings.HasPrefix(s, "<") {
+		return "missingNameBeforeEmail", prefix + "missing name before email"
+	}
+	p := strings.IndexAny(s, "<>")
+	if p < 0 {
+		return "missingEmail", prefix + "missing email"
+	}
+	if s[p] == '>' {
+		return "badName", prefix + "bad name"
+	}
+	if s[p-1] != ' ' {
+		return "missingSpaceBeforeEmail", prefix + "missing space before email"
+	}
+	s = s[p+1:]
+	p = strings.IndexAny(s, "<>")
+	if p < 0 || s[p] != '>' {
+		return "badEmail", prefix + "bad email"
+	}
+	s = s[p+1:]
+	if !strings.HasPrefix(s, " ") {
+		return "missingSpaceBeforeDate", prefix + "missing space before date"
+	}
+	s = s[1:]
+	if len(s) > 1 && s[0] == '0' && s[1] != ' ' {
+		return "zeroPaddedDate", prefix + "zero-padded date"
+	}
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if digits == 0 || !strings.HasPrefix(s[digits:], " ") {
+		return "badDate", prefix + "bad date"
+	}
+	if _, err := strconv.ParseInt(s[:digits], 10, 64); err != nil {
+		return "badDateOverflow", prefix + "date causes integer overflow"
+	}
+	zone := s[digits+1:]
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') || strings.Trim(zone[1:], "0123456789") != "" {
+		return "badTimezone", prefix + "bad time zone"
+	}
+	return "", ""
+}
+
+// checkRefs checks that HEAD, the refs and, unless NoReflogs is set, the
+// reflog entries point to objects, and records them as the roots of the
+// reachable objects.
+func (f *fsck) checkRefs() error {
+	refs, err := f.r.listRefs()
+	if err != nil {
+		return err
+	}
+	head, symbolic, err := f.r.readRef(headFile)
+	if err == nil && symbolic {
+		if _, err := f.r.ResolveRef(head); err != nil {
+			f.printf("notice: HEAD points to an unborn branch (%s)\n", strings.TrimPrefix(head, "refs/heads/"))
+		}
+	} else if err == nil {
+		f.checkRef(headFile, head)
+	} else {
+		f.errorf(FsckErrorReachable, "HEAD: invalid HEAD")
+	}
+	if len(refs) == 0 {
+		f.printf("notice: No default references\n")
+	}
+	for _, name := range refs {
+		sha, err := f.r.ResolveRef(name)
+		if err != nil {
+			f.errorf(FsckErrorReachable, "%s: %s", name, err)
+			continue
+		}
+		f.checkRef(name, sha)
+	}
+	if f.opts.NoReflogs {
+		return nil
+	}
+
+	logs, err := f.r.listFiles(logsDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		entries, err := f.r.Reflog(name)
+		if err != nil {
+			f.errorf(FsckErrorReachable, "%s", err)
+			continue
+		}
+		for _, e := range entries {
+			for _, sha := range []string{e.Old, e.New} {
+				if sha == f.r.ObjectFormat().NullID() {
+					continue
+				}
+				if _, ok := f.objects[sha]; !ok {
+					f.errorf(FsckErrorReachable, "%s: invalid reflog entry %s", name, sha)
+					continue
+				}
+				f.roots = append(f.roots, fsckLink{format: f.objects[sha].format, sha: sha})
+			}
+		}
+	}
+	return nil
+}
+
+// checkRef checks that the ref name points to an object.
+func (f *fsck) checkRef(name string, sha string) {
+	o, ok := f.objects[sha]
+	if !ok {
+		f.errorf(FsckErrorReachable, "%s: invalid sha1 pointer %s", name, sha)
+		return
+	}
+	f.roots = append(f.roots, fsckLink{format: o.format, sha: sha})
+}
+
+// checkIndex records the blobs of the index as reachable.
+func (f *fsck) checkIndex() error {
+	idx, err := f.r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	for _, e := range idx.Entries {
+		if e.Mode != objects.ModeGitlink {
+			f.roots = append(f.roots, fsckLink{format: "blob", sha: e.Hash})
+		}
+	}
+	return nil
+}
+
+// checkConnectivity walks the objects reachable from the roots, then
+// reports the unreachable objects no other object refers to as dangling.
+// The objects borrowed from alternates are checked like the others.
+func (f *fsck) checkConnectivity() {
+	reachable := f.reachable()
+
+	used := map[string]bool{}
+	for _, o := range f.objects {
+		for _, link := range o.links {
+			used[link.sha] = true
+		}
+	}
+	for _, sha := range slices.Sorted(maps.Keys(f.objects)) {
+		if !reachable[sha] && !used[sha] {
+			f.printf("dangling %s %s\n", f.objects[sha].format, sha)
+		}
+	}
+}
+
+// reachable walks the objects reachable from the roots, reporting the
+// missing ones and the ones of an unexpected type.
+//
+// Returns:
+//   - The IDs of the reachable objects the database has.
+func (f *fsck) reachable() map[string]bool {
+	reachable := map[string]bool{}
+	missing := map[string]string{}
+	mistyped := map[fsckLink]bool{}
+	queue := slices.Clone(f.roots)
+	for len(queue) > 0 {
+		link := queue[0]
+		queue = queue[1:]
+		o, ok := f.objects[link.sha]
+		if !ok {
+			if link.sha != f.r.ObjectFormat().EmptyTree || link.format != "tree" {
+				missing[link.sha] = link.format
+			}
+			continue
+		}
+		if o.format != link.format && !mistyped[link] {
+			mistyped[link] = true
+			f.errorf(FsckErrorObject, "object %s is a %s, not a %s", link.sha, o.format, link.format)
+		}
+		if reachable[link.sha] {
+			continue
+		}
+		reachable[link.sha] = true
+		queue = append(queue, o.links...)
+	}
+	for _, sha := range slices.Sorted(maps.Keys(missing)) {
+		f.printf("missing %s %s\n", missing[sha], sha)
+		f.code |= FsckErrorReachable
+	}
+	return reachable
+}
+
+func (f *fsck) printf(format string, args ...any) {
+	fmt.Fprintf(&f.out, format, args...)
+}
+
+// errorf reports a problem with the object database, setting the bit of
+// the exit code telling its kind.
+func (f *fsck) errorf(bit int, format string, args ...any) {
+	f.printf("error: "+format+"\n", args...)
+	f.code |= bit
+}
+
+// objectError reports a malformed object.
+func (f *fsck) objectError(format string, sha string, id string, message string) {
+	f.printf("error in %s %s: %s: %s\n", format, sha, id, message)
+	f.code |= FsckErrorObject
+}
+
+// warnf reports a suspicious but valid object.
+func (f *fsck) warnf(format string, sha string, id string, message string) {
+	f.printf("warning in %s %s: %s: %s\n", format, sha, id, message)
+}
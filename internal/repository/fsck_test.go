@@ -0,0 +1,155 @@
+package repository_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"ggit/internal/store"
+	"ggit/internal/util"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// looseObjectPath returns the file of the loose object sha.
+func looseObjectPath(r *repository.Repository, sha string) string {
+	return store.NewLooseStore(r.FS, filepath.Join(r.Gitdir, "objects"), r.ObjectFormat()).Path(sha)
+}
+
+// writeLooseFile compresses data into the file of the loose object sha,
+// whatever data holds.
+func writeLooseFile(t *testing.T, r *repository.Repository, sha string, data string) {
+	path := looseObjectPath(r, sha)
+	compressed, err := util.Compress(data)
+	assert.NoError(t, err)
+	assert.NoError(t, r.FS.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, afero.WriteFile(r.FS, path, []byte(compressed), 0o444))
+}
+
+// writeRawObject writes an object without validating its payload.
+func writeRawObject(t *testing.T, r *repository.Repository, format string, payload string) string {
+	data := fmt.Sprintf("%s %d\x00%s", format, len(payload), payload)
+	sum := sha1.Sum([]byte(data))
+	sha := hex.EncodeToString(sum[:])
+	writeLooseFile(t, r, sha, data)
+	return sha
+}
+
+// rawTreeEntry encodes a tree entry the way it is stored.
+func rawTreeEntry(mode string, name string, sha string) string {
+	raw, _ := hex.DecodeString(sha)
+	return mode + " " + name + "\x00" + string(raw)
+}
+
+func TestFsck(t *testing.T) {
+	t.Run("Clean", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("Unborn", func(t *testing.T) {
+		r := newTestRepository(t)
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Equal(t, "notice: HEAD points to an unborn branch (master)\nnotice: No default references\n", out)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("Dangling", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\n3\n4\n5\n6\nM\n", "1\nT\n3\n4\n5\n6\n7\n")
+		blob := writeBlob(t, r, "loose\n")
+		_, err := r.Reset(&repository.Reset{Mode: repository.ResetHard, Commit: "HEAD~1"})
+		assert.NoError(t, err)
+
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Equal(t, "dangling blob "+blob+"\n", out)
+		assert.Equal(t, 0, code)
+
+		out, _, err = r.Fsck(&repository.Fsck{NoReflogs: true})
+		assert.NoError(t, err)
+		assert.Contains(t, out, "dangling commit "+master+"\n")
+		assert.NotContains(t, out, "dangling tree")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		blob := writeBlob(t, r, "topic only\n")
+		assert.NoError(t, r.FS.Remove(looseObjectPath(r, blob)))
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Equal(t, "missing blob "+blob+"\n", out)
+		assert.Equal(t, repository.FsckErrorReachable, code)
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		blob := writeBlob(t, r, "topic only\n")
+		path := looseObjectPath(r, blob)
+		assert.NoError(t, r.FS.Remove(path))
+		writeLooseFile(t, r, blob, "blob 6\x00other\n")
+
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Contains(t, out, ": hash-path mismatch, found at: ")
+		assert.Contains(t, out, "missing blob "+blob+"\n")
+		assert.Equal(t, repository.FsckErrorObject|repository.FsckErrorReachable, code)
+	})
+
+	t.Run("BadRef", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		writeRef(t, r, "refs/heads/bad", "0123456789012345678901234567890123456789")
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Equal(t, "error: refs/heads/bad: invalid sha1 pointer 0123456789012345678901234567890123456789\n", out)
+		assert.Equal(t, repository.FsckErrorReachable, code)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		r := newTestRepository(t)
+		for payload, problem := range map[string]string{
+			"author A <a@x> 1 +0000\n\nm\n": "missingTree: invalid format - expected 'tree' line",
+			"tree " + objects.EmptyTreeHash + "\nauthor A <a@x 1 +0000\ncommitter A <a@x> 1 +0000\n\nm\n":   "badEmail: invalid author/committer line - bad email",
+			"tree " + objects.EmptyTreeHash + "\nauthor A <a@x> 1 +0000\n\nm\n":                             "missingCommitter: invalid format - expected 'committer' line",
+			"tree " + objects.EmptyTreeHash + "\nauthor A <a@x> 01 +0000\ncommitter A <a@x> 1 +0000\n\nm\n": "zeroPaddedDate: invalid author/committer line - zero-padded date",
+			"tree " + objects.EmptyTreeHash + "\nauthor A <a@x> 1 +00\ncommitter A <a@x> 1 +0000\n\nm\n":    "badTimezone: invalid author/committer line - bad time zone",
+		} {
+			sha := writeRawObject(t, r, "commit", payload)
+			out, code, err := r.Fsck(&repository.Fsck{})
+			assert.NoError(t, err)
+			assert.Contains(t, out, "error in commit "+sha+": "+problem+"\n")
+			assert.Equal(t, repository.FsckErrorObject, code)
+			assert.NoError(t, r.FS.Remove(looseObjectPath(r, sha)))
+		}
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		r := newTestRepository(t)
+		blob := writeBlob(t, r, "content\n")
+		sha := writeRawObject(t, r, "tree", rawTreeEntry(objects.ModeFile, "b", blob)+rawTreeEntry(objects.ModeFile, "a", blob)+rawTreeEntry("0100644", "c", blob))
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Contains(t, out, "warning in tree "+sha+": zeroPaddedFilemode: contains zero-padded file modes\n"+
+			"error in tree "+sha+": treeNotSorted: not properly sorted\n")
+		assert.Contains(t, out, "dangling tree "+sha+"\n")
+		assert.NotContains(t, out, "dangling blob")
+		assert.Equal(t, repository.FsckErrorObject, code)
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		r, base, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		tag := writeRawObject(t, r, "tag", "object "+base+"\ntype blob\ntag v1\ntagger A <a@x> 1 +0000\n\nm\n")
+		writeRef(t, r, "refs/tags/v1", tag)
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Equal(t, "error: object "+base+" is a commit, not a blob\n", out)
+		assert.Equal(t, repository.FsckErrorObject, code)
+	})
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/store"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// defaultPruneExpire is how old an unreachable object has to be for gc to
+// prune it, unless gc.pruneExpire says otherwise.
+const defaultPruneExpire = "2.weeks.ago"
+
+type Gc struct {
+	// Prune is how old the unreachable loose objects have to be to be
+	// removed, such as "2.weeks.ago", "now" or "never"; gc.pruneExpire
+	// when empty.
+	Prune string
+}
+
+// Gc cleans up the object database: the loose objects that are also
+// packed are removed, as are the loose objects no ref, reflog entry or
+// index entry reaches and older than the prune expiry. The objects an
+// object kept for being recent refers to are kept too. The temporary files
+// of interrupted object writes older than the expiry are removed as well.
+//
+// Only the objects of the repository itself are removed: the ones borrowed
+// from alternates are never touched, but they count when looking for the
+// reachable objects, so that the objects a borrowed one refers to are
+// kept.
+//
+// Returns:
+//   - An error if the expiry is malformed, if a reachable object is
+//     missing or corrupt, or if an object can not be removed.
+func (r *Repository) Gc(opts *Gc) error {
+	expiry := opts.Prune
+	if expiry == "" {
+		expiry = r.Config.Get("gc", "pruneexpire")
+	}
+	if expiry == "" {
+		expiry = defaultPruneExpire
+	}
+	cutoff, err := parseExpiry(expiry, time.Now())
+	if err != nil {
+		return err
+	}
+
+	dir := r.path("objects")
+	loose := store.NewLooseStore(r.FS, dir, r.ObjectFormat())
+	packed := store.NewPackStore(r.FS, filepath.Join(dir, "pack"), r.ObjectFormat())
+	f := &fsck{r: r, opts: &Fsck{}, objects: map[string]*fsckObject{}}
+	if err := f.scanObjects(); err != nil {
+		return err
+	}
+	if err := f.checkRefs(); err != nil {
+		return err
+	}
+	if err := f.checkIndex(); err != nil {
+		return err
+	}
+	reachable := f.reachable()
+	if f.code != 0 {
+		return fmt.Errorf("the object database has problems, run fsck; nothing was pruned:\n%s", strings.TrimSuffix(f.out.String(), "\n"))
+	}
+
+	prunable := map[string]bool{}
+	f.roots = nil
+	err = loose.Iterate(func(id string) error {
+		info, err := r.FS.Stat(loose.Path(id))
+		if err != nil {
+			return err
+		}
+		o, ok := f.objects[id]
+		recent := ok && !info.ModTime().Before(cutoff)
+		if recent {
+			f.roots = append(f.roots, fsckLink{format: o.format, sha: id})
+		}
+		prunable[id] = !recent || packed.Has(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The objects recent ones refer to are kept whether or not they are
+	// all there.
+	for id := range f.reachable() {
+		reachable[id] = true
+	}
+
+	for id, ok := range prunable {
+		if !ok || reachable[id] && !packed.Has(id) {
+			continue
+		}
+		if err := r.FS.Remove(loose.Path(id)); err != nil {
+			return err
+		}
+	}
+	if err := r.removeStaleTempFiles(dir, cutoff); err != nil {
+		return err
+	}
+	return r.removeEmptyObjectDirs(dir)
+}
+
+// removeStaleTempFiles removes the temporary files interrupted object
+// writes left in dir, when they are older than cutoff and so no longer
+// being written.
+func (r *Repository) removeStaleTempFiles(dir string, cutoff time.Time) error {
+	entries, err := afero.ReadDir(r.FS, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "tmp_") || !e.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := r.FS.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEmptyObjectDirs removes the directories of the loose objects of
+// dir left empty.
+func (r *Repository) removeEmptyObjectDirs(dir string) error {
+	entries, err := afero.ReadDir(r.FS, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || len(e.Name()) != 2 {
+			continue
+		}
+		files, err := afero.ReadDir(r.FS, filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			if err := r.FS.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneUnits are the units of a relative expiry, in seconds.
+var pruneUnits = map[string]int64{
+	"second": 1,
+	"minute": 60,
+	"hour":   60 * 60,
+	"day":    24 * 60 * 60,
+	"week":   7 * 24 * 60 * 60,
+	"month":  30 * 24 * 60 * 60,
+	"year":   365 * 24 * 60 * 60,
+}
+
+// parseExpiry parses an expiry: "now" and "all" expire everything,
+// "never" nothing, and "<n>.<unit>.ago" everything older than n units
+// before now. A date in git's internal format is also accepted.
+//
+// Returns:
+//   - The time before which things expire.
+//   - An error if the expiry is malformed.
+func parseExpiry(expiry string, now time.Time) (time.Time, error) {
+	switch expiry {
+	case "now", "all":
+		return now.Add(time.Second), nil
+	case "never", "false":
+		return time.Unix(math.MinInt32, 0), nil
+	}
+	if fields := strings.Split(expiry, "."); len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		unit, ok := pruneUnits[strings.TrimSuffix(fields[1], "s")]
+		if err == nil && ok && n >= 0 {
+			return now.Add(-time.Duration(n*unit) * time.Second), nil
+		}
+	}
+	if when, _, err := parseDate(expiry); err == nil {
+		return time.Unix(when, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("malformed expiration date '%s'", expiry)
+}
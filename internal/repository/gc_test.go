@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// ageObject makes the loose object sha of r a month old.
+func ageObject(t *testing.T, r *repository.Repository, sha string) {
+	old := time.Now().AddDate(0, -1, 0)
+	assert.NoError(t, r.FS.Chtimes(filepath.Join(r.Gitdir, "objects", sha[:2], sha[2:]), old, old))
+}
+
+func TestGc(t *testing.T) {
+	t.Run("Prune", func(t *testing.T) {
+		r, head := newCloneSource(t)
+		old := writeBlob(t, r, "old\n")
+		recent := writeBlob(t, r, "recent\n")
+		ageObject(t, r, old)
+		ageObject(t, r, head)
+
+		assert.NoError(t, r.Gc(&repository.Gc{}))
+		assert.False(t, hasLooseObject(r, old))
+		assert.True(t, hasLooseObject(r, recent))
+		assert.True(t, hasLooseObject(r, head))
+
+		assert.NoError(t, r.Gc(&repository.Gc{Prune: "never"}))
+		assert.True(t, hasLooseObject(r, recent))
+		assert.NoError(t, r.Gc(&repository.Gc{Prune: "now"}))
+		assert.False(t, hasLooseObject(r, recent))
+		assert.True(t, hasLooseObject(r, head))
+	})
+
+	t.Run("Recent", func(t *testing.T) {
+		r, head := newCloneSource(t)
+		blob := writeBlob(t, r, "kept\n")
+		tree := writeTree(t, r, objects.TreeEntry{Mode: objects.ModeFile, Name: "kept", Hash: blob})
+		ageObject(t, r, blob)
+		assert.NoError(t, r.Gc(&repository.Gc{Prune: "1.week.ago"}))
+		assert.True(t, hasLooseObject(r, tree))
+		assert.True(t, hasLooseObject(r, blob))
+		assert.True(t, hasLooseObject(r, head))
+	})
+
+	t.Run("Alternates", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		dangling := writeBlob(t, src, "dangling\n")
+		r := cloneRepository(t, src, "/dst", &repository.Clone{Shared: true})
+		writeWorktreeFile(t, r, "NEWS", "news\n")
+		commit := commitWorktree(t, r, "news", "NEWS")
+		unreachable := writeBlob(t, r, "unreachable\n")
+
+		assert.NoError(t, r.Gc(&repository.Gc{Prune: "now"}))
+		assert.True(t, hasLooseObject(r, commit))
+		assert.False(t, hasLooseObject(r, unreachable))
+		assert.True(t, hasLooseObject(src, head))
+		assert.True(t, hasLooseObject(src, dangling))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		r, head := newCloneSource(t)
+		dangling := writeBlob(t, r, "dangling\n")
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Gitdir, "objects", head[:2], head[2:])))
+		assert.ErrorContains(t, r.Gc(&repository.Gc{Prune: "now"}), "refs/heads/master: invalid sha1 pointer "+head)
+		assert.True(t, hasLooseObject(r, dangling))
+	})
+
+	t.Run("TempFiles", func(t *testing.T) {
+		r := newTestRepository(t)
+		stale := filepath.Join(r.Gitdir, "objects", "tmp_obj_stale")
+		fresh := filepath.Join(r.Gitdir, "objects", "tmp_obj_fresh")
+		assert.NoError(t, afero.WriteFile(r.FS, stale, []byte("partial"), 0444))
+		assert.NoError(t, afero.WriteFile(r.FS, fresh, []byte("partial"), 0444))
+		old := time.Now().AddDate(0, -1, 0)
+		assert.NoError(t, r.FS.Chtimes(stale, old, old))
+
+		assert.NoError(t, r.Gc(&repository.Gc{}))
+		assert.False(t, filesystem.Exists(r.FS, stale))
+		assert.True(t, filesystem.Exists(r.FS, fresh))
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		r := newTestRepository(t)
+		assert.EqualError(t, r.Gc(&repository.Gc{Prune: "soon"}), "malformed expiration date 'soon'")
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"), "[gc]\n\tpruneExpire = 3.days.ago\n")
+		assert.NoError(t, r.Gc(&repository.Gc{}))
+	})
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/filesystem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	hooksDir = "hooks"
+	// rebaseRewrittenFile lists the commits a rebase rewrote, as the
+	// "<old> <new>" lines post-rewrite reads.
+	rebaseRewrittenFile = "rewritten-list"
+)
+
+type Hook struct {
+	Name string
+	Args []string
+	// Stdin is written to the standard input of the hook.
+	Stdin string
+}
+
+// HookError reports a hook that exited with a non-zero status.
+type HookError struct {
+	Name string
+	Code int
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook '%s' exited with status %d", e.Name, e.Code)
+}
+
+// HooksDir returns the directory the hooks are looked up in: core.hooksPath,
+// relative to the directory hooks run in, or the hooks directory of the
+// repository.
+//
+// Returns:
+//   - The absolute path of the directory.
+//   - An error if core.hooksPath can not be expanded.
+func (r *Repository) HooksDir() (string, error) {
+	dir, err := r.Config.GetPath("core", "hookspath")
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return r.path(hooksDir), nil
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(r.hookCwd(), dir)
+	}
+	return dir, nil
+}
+
+// hookCwd returns the directory hooks run in: the top of the worktree, or
+// the repository directory when it is bare.
+func (r *Repository) hookCwd() string {
+	if r.IsBare() {
+		return r.Gitdir
+	}
+	return r.Worktree
+}
+
+// findHook returns the path of the hook name, empty when it is missing or
+// not executable. A hook that is not executable is ignored with a hint,
+// unless advice.ignoredHook is false.
+//
+// Returns:
+//   - The path of the hook.
+//   - The hint about an ignored hook.
+//   - An error if the hooks directory is not known.
+func (r *Repository) findHook(name string) (string, string, error) {
+	dir, err := r.HooksDir()
+	if err != nil {
+		return "", "", err
+	}
+	path := filepath.Join(dir, name)
+	info, err := r.FS.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", "", nil
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		if advise, err := r.Config.GetBool("advice", "ignoredhook", true); err == nil && !advise {
+			return "", "", nil
+		}
+		return "", fmt.Sprintf("hint: The '%s' hook was ignored because it's not set as executable.\n"+
+			"hint: You can disable this warning with `ggit config advice.ignoredHook false`.\n", name), nil
+	}
+	return path, "", nil
+}
+
+// RunHook runs the hook opts.Name with its arguments and standard input,
+// from the top of the worktree, or the repository directory when it is
+// bare. GGIT_DIR and GGIT_WORK_TREE tell the ggit commands the hook runs
+// which repository it belongs to. A hook of a filesystem other than the
+// operating system's is run from a temporary copy.
+//
+// Returns:
+//   - The combined output of the hook.
+//   - Whether the hook exists and ran.
+//   - A *HookError if the hook exits with a non-zero status, or another
+//     error if it can not be run.
+func (r *Repository) RunHook(opts *Hook) (string, bool, error) {
+	path, hint, err := r.findHook(opts.Name)
+	if err != nil || path == "" {
+		return hint, false, err
+	}
+	cmd := exec.Command(path, opts.Args...)
+	if _, native := r.FS.Fs.(*afero.OsFs); native {
+		cmd.Dir = r.hookCwd()
+	} else {
+		data, err := filesystem.ReadFileData(r.FS, path)
+		if err != nil {
+			return "", false, err
+		}
+		dir, err := os.MkdirTemp("", "ggit-hook-")
+		if err != nil {
+			return "", false, err
+		}
+		defer os.RemoveAll(dir)
+		cmd.Path = filepath.Join(dir, opts.Name)
+		if err := os.WriteFile(cmd.Path, []byte(data), 0o755); err != nil {
+			return "", false, err
+		}
+	}
+	cmd.Env = append(os.Environ(), "GGIT_DIR="+r.Gitdir)
+	if !r.IsBare() {
+		cmd.Env = append(cmd.Env, "GGIT_WORK_TREE="+r.Worktree)
+	}
+	cmd.Stdin = strings.NewReader(opts.Stdin)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return string(out), true, &HookError{Name: opts.Name, Code: exit.ExitCode()}
+	}
+	return string(out), err == nil, err
+}
+
+// runHook runs the hook name with args, if it exists, and writes its
+// output to b.
+//
+// Returns:
+//   - A *HookError if the hook fails.
+func (r *Repository) runHook(b *strings.Builder, name string, args ...string) error {
+	out, _, err := r.RunHook(&Hook{Name: name, Args: args})
+	b.WriteString(out)
+	return err
+}
+
+// runPostHook runs the hook name like runHook, for hooks run once a
+// command is done, whose exit status does not matter.
+func (r *Repository) runPostHook(b *strings.Builder, name string, args ...string) error {
+	var failed *HookError
+	if err := r.runHook(b, name, args...); err != nil && !errors.As(err, &failed) {
+		return err
+	}
+	return nil
+}
+
+// commitMessageHooks passes the message of a commit about to be made
+// through the prepare-commit-msg hook, with the kind of message source,
+// then through the commit-msg hook unless verify is off. Both hooks get the
+// message in COMMIT_EDITMSG and may change it.
+//
+// Returns:
+//   - The message, cleaned up if a hook ran.
+//   - An error if a hook fails or leaves the message empty.
+func (r *Repository) commitMessageHooks(b *strings.Builder, message string, source string, verify bool) (string, error) {
+	names := []string{"prepare-commit-msg"}
+	if verify {
+		names = append(names, "commit-msg")
+	}
+	ran := false
+	for _, name := range names {
+		path, hint, err := r.findHook(name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(hint)
+		if path == "" {
+			continue
+		}
+		if !ran {
+			if err := r.ReplaceTextFile(message, commitEditMsgFile); err != nil {
+				return "", err
+			}
+			ran = true
+		}
+		args := []string{commitEditMsgFile}
+		if name == "prepare-commit-msg" {
+			args = append(args, source)
+		}
+		err = r.withNativeFile(commitEditMsgFile, func(path string) error {
+			if _, native := r.FS.Fs.(*afero.OsFs); !native || r.IsBare() {
+				args[0] = path
+			} else if rel, err := filepath.Rel(r.Worktree, path); err == nil {
+				args[0] = filepath.ToSlash(rel)
+			}
+			return r.runHook(b, name, args...)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if !ran {
+		return message, nil
+	}
+	edited, err := r.readFile(commitEditMsgFile)
+	if err != nil {
+		return "", err
+	}
+	if edited = CleanupMessage(edited); edited == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	return edited, nil
+}
+
+// withNativeFile calls fn with a path of the operating system to the file
+// name of the repository directory, for other programs to read and write
+// it. Files of a filesystem other than the operating system's are handed
+// over through a temporary copy, copied back once fn returns.
+func (r *Repository) withNativeFile(name string, fn func(path string) error) error {
+	path := r.path(name)
+	if _, native := r.FS.Fs.(*afero.OsFs); native {
+		return fn(path)
+	}
+	data, err := filesystem.ReadFileData(r.FS, path)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "ggit-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path = filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		return err
+	}
+	fnErr := fn(path)
+	copied, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := r.ReplaceTextFile(string(copied), name); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// recordRewritten notes in the rewritten list of a rebase that the commit
+// old was rewritten as next. The commits noted as rewritten as amended,
+// which next replaces, are noted as rewritten as next instead.
+func (r *Repository) recordRewritten(old string, amended string, next string) error {
+	name := rebaseFile(rebaseRewrittenFile)
+	data := ""
+	if r.hasFile(name) {
+		var err error
+		if data, err = r.readFile(name); err != nil {
+			return err
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if data == "" {
+		lines = nil
+	}
+	listed := false
+	for i, line := range lines {
+		from, to, _ := strings.Cut(line, " ")
+		if amended != "" && to == amended {
+			lines[i] = from + " " + next
+		}
+		listed = listed || from == old
+	}
+	if !listed && old != "" {
+		lines = append(lines, old+" "+next)
+	}
+	return r.ReplaceTextFile(strings.Join(lines, "\n")+"\n", rebaseMergeDir, rebaseRewrittenFile)
+}
@@ -0,0 +1,157 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeHook(t *testing.T, r *repository.Repository, name string, script string) {
+	path := filepath.Join(r.Gitdir, "hooks", name)
+	assert.NoError(t, afero.WriteFile(r.FS, path, []byte("#!/bin/sh\n"+script), 0o755))
+}
+
+func TestRunHook(t *testing.T) {
+	t.Run("Missing", func(t *testing.T) {
+		r := newTestRepository(t)
+		out, ran, err := r.RunHook(&repository.Hook{Name: "pre-commit"})
+		assert.NoError(t, err)
+		assert.False(t, ran)
+		assert.Equal(t, "", out)
+	})
+
+	t.Run("ArgsAndStdin", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeHook(t, r, "post-rewrite", "echo \"$1\"\ncat\necho \"$GGIT_DIR\"\n")
+		out, ran, err := r.RunHook(&repository.Hook{Name: "post-rewrite", Args: []string{"rebase"}, Stdin: "a b\n"})
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, "rebase\na b\n"+r.Gitdir+"\n", out)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeHook(t, r, "pre-commit", "echo refused\nexit 3\n")
+		out, ran, err := r.RunHook(&repository.Hook{Name: "pre-commit"})
+		assert.True(t, ran)
+		assert.Equal(t, "refused\n", out)
+		assert.Equal(t, &repository.HookError{Name: "pre-commit", Code: 3}, err)
+	})
+
+	t.Run("NotExecutable", func(t *testing.T) {
+		r := newTestRepository(t)
+		path := filepath.Join(r.Gitdir, "hooks", "pre-commit")
+		assert.NoError(t, afero.WriteFile(r.FS, path, []byte("#!/bin/sh\nexit 1\n"), 0o644))
+		out, ran, err := r.RunHook(&repository.Hook{Name: "pre-commit"})
+		assert.NoError(t, err)
+		assert.False(t, ran)
+		assert.Contains(t, out, "hint: The 'pre-commit' hook was ignored because it's not set as executable.\n")
+
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"), "[advice]\n\tignoredHook = false\n")
+		out, _, err = r.RunHook(&repository.Hook{Name: "pre-commit"})
+		assert.NoError(t, err)
+		assert.Equal(t, "", out)
+	})
+
+	t.Run("HooksPath", func(t *testing.T) {
+		r := newTestRepository(t)
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"), "[core]\n\thooksPath = githooks\n")
+		dir, err := r.HooksDir()
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(r.Worktree, "githooks"), dir)
+
+		writeHook(t, r, "pre-commit", "echo ignored\n")
+		assert.NoError(t, afero.WriteFile(r.FS, filepath.Join(dir, "pre-commit"), []byte("#!/bin/sh\necho shared\n"), 0o755))
+		out, ran, err := r.RunHook(&repository.Hook{Name: "pre-commit"})
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, "shared\n", out)
+	})
+}
+
+func TestMergeHooks(t *testing.T) {
+	t.Run("PreMergeCommit", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		writeHook(t, r, "pre-merge-commit", "echo no merges\nexit 1\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, "no merges\nNot committing merge; use 'ggit merge --continue' to complete the merge.\n")
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, "M\n2\n3\n4\n5\n6\nT\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "Merge branch 'topic'\n", readGitFile(t, r, "MERGE_MSG"))
+
+		writeHook(t, r, "pre-commit", "exit 1\n")
+		out, clean, err = r.Merge(&repository.Merge{Continue: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+
+		_, clean, err = r.Merge(&repository.Merge{Continue: true, NoVerify: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD^1"))
+	})
+
+	t.Run("NoVerify", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		writeHook(t, r, "pre-merge-commit", "exit 1\n")
+		writeHook(t, r, "commit-msg", "exit 1\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, NoVerify: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD^1"))
+	})
+
+	t.Run("CommitMessage", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		writeHook(t, r, "prepare-commit-msg", "echo \"source: $2\" >> \"$1\"\n")
+		writeHook(t, r, "commit-msg", "echo \"# dropped\" >> \"$1\"\necho \"Signed-off-by: C O Mitter\" >> \"$1\"\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Merge branch 'topic'\nsource: merge\nSigned-off-by: C O Mitter", mustReadCommit(t, r, "HEAD").KVLM.Message)
+	})
+
+	t.Run("PostMerge", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\n2\nT\n4\n5\n6\n7\n")
+		writeHook(t, r, "post-merge", "echo \"post-merge $1\"\nexit 1\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, Squash: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, "post-merge 1\n")
+	})
+}
+
+func TestRebaseHooks(t *testing.T) {
+	t.Run("PreRebase", func(t *testing.T) {
+		r, master, _, second := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		writeHook(t, r, "pre-rebase", "echo \"$1 $2\"\nexit 1\n")
+		_, _, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.EqualError(t, err, "master topic\nThe pre-rebase hook refused to rebase.")
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, second, mustResolve(t, r, "topic"))
+		assertNoRebase(t, r)
+
+		_, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", NoVerify: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+	})
+
+	t.Run("PostRewrite", func(t *testing.T) {
+		r, master, topic, second := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		writeHook(t, r, "post-checkout", "echo \"checkout $3\"\n")
+		writeHook(t, r, "post-commit", "echo committed\n")
+		writeHook(t, r, "post-rewrite", "echo \"rewrite $1\"\ncat\n")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "checkout 1\ncommitted\ncommitted\n"+
+			"rewrite rebase\n"+topic+" "+mustResolve(t, r, "topic~1")+"\n"+second+" "+mustResolve(t, r, "topic")+"\n"+
+			"Successfully rebased and updated refs/heads/topic.\n", out)
+		assert.Equal(t, master, mustResolve(t, r, "topic~2"))
+	})
+}
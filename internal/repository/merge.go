@@ -0,0 +1,1264 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/filesystem"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Files recording the state of a merge that stopped before committing.
+const (
+	mergeHeadFile = "MERGE_HEAD"
+	mergeMsgFile  = "MERGE_MSG"
+	mergeModeFile = "MERGE_MODE"
+	squashMsgFile = "SQUASH_MSG"
+	origHeadFile  = "ORIG_HEAD"
+)
+
+const (
+	conflictMarkerSize = 7
+	abbrevLength       = 7
+)
+
+type Merge struct {
+	Commits         []string
+	Strategy        string
+	StrategyOptions []string
+	NoFF            bool
+	// AllowUnrelated merges commits without a common ancestor.
+	AllowUnrelated bool
+	Squash         bool
+	Abort          bool
+	Continue       bool
+	ConflictStyle  string
+	// NoVerify skips the pre-merge-commit and commit-msg hooks.
+	NoVerify bool
+	// Message replaces the default message of the merge commit.
+	Message string
+}
+
+// treeMerge is a three-way merge of trees, path by path. The labels name
+// the sides in conflict markers and messages.
+type treeMerge struct {
+	r      *Repository
+	ours   string
+	base   string
+	theirs string
+	style  string
+	// virtual merges combine merge bases into a virtual one: conflicts are
+	// only recorded in the content of the merged files.
+	virtual    bool
+	markerSize int
+	// Strategy options, see setOptions.
+	favor             string
+	ignoreSpaceChange bool
+	renormalize       bool
+	subtree           bool
+	subtreePrefix     string
+
+	files     map[string]diff.File
+	stages    []index.Entry
+	conflicts []string
+	notes     []mergeNote
+	// failed is set when the strategy gave up, leaving nothing to write.
+	failed bool
+}
+
+// Kinds of the notes of a tree merge, as git's merge-tree names them.
+const (
+	noteAutoMerging   = "Auto-merging"
+	noteContents      = "CONFLICT (contents)"
+	noteBinary        = "CONFLICT (binary)"
+	noteFileDirectory = "CONFLICT (file/directory)"
+	noteDistinctModes = "CONFLICT (distinct modes)"
+	noteModifyDelete  = "CONFLICT (modify/delete)"
+	noteRenameDelete  = "CONFLICT (rename/delete)"
+	noteRenameRename  = "CONFLICT (rename/rename)"
+	noteSubmodule     = "CONFLICT (submodule)"
+)
+
+// mergeNote is a message of a merge about some paths.
+type mergeNote struct {
+	paths   []string
+	kind    string
+	message string
+}
+
+// note records a message about the paths of a tree merge. Virtual merges
+// keep quiet.
+func (m *treeMerge) note(kind string, message string, paths ...string) {
+	if !m.virtual {
+		m.notes = append(m.notes, mergeNote{paths: paths, kind: kind, message: message})
+	}
+}
+
+func (r *Repository) newTreeMerge(ours string, theirs string, style string) *treeMerge {
+	return &treeMerge{r: r, ours: ours, theirs: theirs, style: style, markerSize: conflictMarkerSize}
+}
+
+// merge merges the trees ours and theirs, using base as their common
+// ancestor.
+//
+// Returns:
+//   - An error if a tree or a blob can not be read or a merged blob can
+//     not be written.
+func (m *treeMerge) merge(base string, ours string, theirs string) error {
+	b, err := m.r.treeFiles(base)
+	if err != nil {
+		return err
+	}
+	o, err := m.r.treeFiles(ours)
+	if err != nil {
+		return err
+	}
+	t, err := m.r.treeFiles(theirs)
+	if err != nil {
+		return err
+	}
+	m.files = map[string]diff.File{}
+	notes := len(m.notes)
+	merged, err := m.mergeRenames(base, ours, theirs, b, o, t)
+	if err != nil {
+		return err
+	}
+	for _, p := range sortedPaths(b, o, t) {
+		if merged[p] {
+			continue
+		}
+		if err := m.mergePath(p, b[p], o[p], t[p]); err != nil {
+			return err
+		}
+	}
+	m.resolveDirectoryConflicts(o)
+	slices.Sort(m.conflicts)
+	// Like git, the messages come sorted by the path they are about.
+	slices.SortStableFunc(m.notes[notes:], func(a, b mergeNote) int {
+		return strings.Compare(a.paths[0], b.paths[0])
+	})
+	return nil
+}
+
+// renames returns the files renamed from the tree base to the tree side,
+// as their new paths by their base paths.
+func (m *treeMerge) renames(base string, side string) (map[string]string, error) {
+	changes, err := diff.TreeDiff(m.r, base, side, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	if err != nil {
+		return nil, err
+	}
+	renames := map[string]string{}
+	for _, c := range changes {
+		if c.Status == diff.Renamed {
+			renames[c.From.Path] = c.To.Path
+		}
+	}
+	return renames, nil
+}
+
+// mergeRenames detects the files renamed on each side and moves their base
+// and other side versions to the new path, where they merge like any other
+// file. A file renamed on one side and deleted on the other, or renamed to
+// different paths on each side, is a conflict merged here. Renames to a
+// path the other side has a file at are left alone.
+//
+// Returns:
+//   - The paths merged here.
+//   - An error if a tree or a blob can not be read or a merged blob can
+//     not be written.
+func (m *treeMerge) mergeRenames(base string, ours string, theirs string, b map[string]diff.File, o map[string]diff.File, t map[string]diff.File) (map[string]bool, error) {
+	oursRenames, err := m.renames(base, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsRenames, err := m.renames(base, theirs)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]bool{}
+	for _, old := range slices.Sorted(maps.Keys(oursRenames)) {
+		next := oursRenames[old]
+		other, renamed := theirsRenames[old]
+		switch {
+		case renamed && other == next:
+			delete(theirsRenames, old)
+			b[next] = b[old]
+			delete(b, old)
+		case renamed:
+			delete(theirsRenames, old)
+			if o[other].Exists() || t[next].Exists() {
+				continue
+			}
+			if err := m.renameRename(old, next, other, b[old], o[next], t[other]); err != nil {
+				return nil, err
+			}
+			merged[old], merged[next], merged[other] = true, true, true
+		case t[next].Exists():
+		case t[old].Exists():
+			b[next], t[next] = b[old], t[old]
+			delete(b, old)
+			delete(t, old)
+		default:
+			m.renameDelete(old, next, b[old], o[next], diff.File{})
+			merged[next] = true
+		}
+	}
+	for _, old := range slices.Sorted(maps.Keys(theirsRenames)) {
+		next := theirsRenames[old]
+		switch {
+		case o[next].Exists():
+		case o[old].Exists():
+			b[next], o[next] = b[old], o[old]
+			delete(b, old)
+			delete(o, old)
+		default:
+			m.renameDelete(old, next, b[old], diff.File{}, t[next])
+			merged[next] = true
+		}
+	}
+	return merged, nil
+}
+
+// renameDelete records the conflict of the file old renamed to next on the
+// side it exists on, ours or theirs, and deleted on the other.
+func (m *treeMerge) renameDelete(old string, next string, base diff.File, ours diff.File, theirs diff.File) {
+	renamed, renamedIn, deletedIn := ours, m.ours, m.theirs
+	if !ours.Exists() {
+		renamed, renamedIn, deletedIn = theirs, m.theirs, m.ours
+	}
+	m.conflict(next, m.fallback(base, renamed), base, ours, theirs)
+	m.note(noteRenameDelete, fmt.Sprintf("CONFLICT (rename/delete): %s renamed to %s in %s, but deleted in %s.",
+		old, next, renamedIn, deletedIn), next, old)
+	if !sameFile(base, renamed) {
+		m.note(noteModifyDelete, modifyDeleteMessage(next, deletedIn, renamedIn), next)
+	}
+}
+
+// renameRename records the conflict of the file old renamed to ours on our
+// side and to theirs on theirs. The merged file is left under both paths.
+func (m *treeMerge) renameRename(old string, oursPath string, theirsPath string, base diff.File, ours diff.File, theirs diff.File) error {
+	merged := diff.File{Mode: ours.Mode, Hash: ours.Hash}
+	if ours.Mode != theirs.Mode && base.Mode == ours.Mode {
+		merged.Mode = theirs.Mode
+	}
+	switch ours.Hash {
+	case theirs.Hash:
+	case base.Hash:
+		merged.Hash = theirs.Hash
+	default:
+		if base.Hash == theirs.Hash {
+			break
+		}
+		// The conflict markers stand apart from those of the contents.
+		hash, _, err := m.mergeContent(old, base, ours, theirs, m.markerSize+1)
+		if err != nil {
+			return err
+		}
+		m.note(noteAutoMerging, fmt.Sprintf("Auto-merging %s", old), old)
+		merged.Hash = hash
+	}
+	m.conflict(old, diff.File{}, base, diff.File{}, diff.File{})
+	m.conflict(oursPath, merged, diff.File{}, merged, diff.File{})
+	m.conflict(theirsPath, merged, diff.File{}, diff.File{}, merged)
+	m.note(noteRenameRename, fmt.Sprintf("CONFLICT (rename/rename): %s renamed to %s in %s and to %s in %s.",
+		old, oursPath, m.ours, theirsPath, m.theirs), old, oursPath, theirsPath)
+	return nil
+}
+
+func sameFile(a diff.File, b diff.File) bool {
+	return a.Mode == b.Mode && a.Hash == b.Hash
+}
+
+// fileKind tells regular files, symbolic links and submodules apart.
+func fileKind(mode string) string {
+	switch mode {
+	case objects.ModeSymlink, objects.ModeGitlink:
+		return mode
+	}
+	return objects.ModeFile
+}
+
+func (m *treeMerge) take(p string, f diff.File) {
+	if f.Exists() {
+		f.Path = p
+		m.files[p] = f
+	}
+}
+
+// conflict records a conflicted path: the file left in the merged tree and
+// the versions of each side as unmerged index entries.
+func (m *treeMerge) conflict(p string, merged diff.File, base diff.File, ours diff.File, theirs diff.File) {
+	m.take(p, merged)
+	if m.virtual {
+		return
+	}
+	for stage, f := range map[int]diff.File{index.StageBase: base, index.StageOurs: ours, index.StageTheirs: theirs} {
+		if f.Exists() {
+			m.stages = append(m.stages, index.Entry{Mode: f.Mode, Hash: f.Hash, Path: p, Stage: stage})
+		}
+	}
+	m.conflicts = append(m.conflicts, p)
+}
+
+func (m *treeMerge) mergePath(p string, base diff.File, ours diff.File, theirs diff.File) error {
+	switch {
+	case sameFile(ours, theirs), sameFile(base, theirs):
+		m.take(p, ours)
+	case sameFile(base, ours):
+		m.take(p, theirs)
+	case !ours.Exists() || !theirs.Exists():
+		return m.modifyDelete(p, base, ours, theirs)
+	case fileKind(ours.Mode) != fileKind(theirs.Mode):
+		m.conflict(p, m.fallback(base, ours), base, ours, theirs)
+		m.note(noteDistinctModes, fmt.Sprintf("CONFLICT (distinct types): %s had different types on each side", p), p)
+	case fileKind(ours.Mode) == objects.ModeGitlink:
+		m.conflict(p, m.fallback(base, ours), base, ours, theirs)
+		m.note(noteSubmodule, fmt.Sprintf("CONFLICT (submodule): Merge conflict in %s", p), p)
+	case fileKind(ours.Mode) == objects.ModeSymlink:
+		m.conflict(p, m.fallback(base, ours), base, ours, theirs)
+		m.note(noteContents, fmt.Sprintf("CONFLICT (content): Merge conflict in %s", p), p)
+	default:
+		return m.mergeFile(p, base, ours, theirs)
+	}
+	return nil
+}
+
+// fallback returns the version kept for a conflict that can not be merged:
+// ours, or the base version in virtual merges.
+func (m *treeMerge) fallback(base diff.File, ours diff.File) diff.File {
+	if m.virtual && base.Exists() {
+		return base
+	}
+	return ours
+}
+
+func (m *treeMerge) modifyDelete(p string, base diff.File, ours diff.File, theirs diff.File) error {
+	modified, deletedIn, modifiedIn := theirs, m.ours, m.theirs
+	if !theirs.Exists() {
+		modified, deletedIn, modifiedIn = ours, m.theirs, m.ours
+	}
+	if m.renormalize && modified.Mode == base.Mode {
+		unchanged, err := m.sameNormalized(base, modified)
+		if err != nil || unchanged {
+			return err
+		}
+	}
+	if m.virtual {
+		modified = base
+	}
+	m.conflict(p, modified, base, ours, theirs)
+	m.note(noteModifyDelete, modifyDeleteMessage(p, deletedIn, modifiedIn), p)
+	return nil
+}
+
+func modifyDeleteMessage(p string, deletedIn string, modifiedIn string) string {
+	return fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+		p, deletedIn, modifiedIn, modifiedIn, p)
+}
+
+// normalizeLineEndings turns the CRLF line endings of text into LF, as
+// checking it in with core.autocrlf would.
+func normalizeLineEndings(data string) string {
+	if diff.IsBinary(data) {
+		return data
+	}
+	return strings.ReplaceAll(data, "\r\n", "\n")
+}
+
+// sameNormalized reports whether two blobs only differ in their line
+// endings.
+func (m *treeMerge) sameNormalized(a diff.File, b diff.File) (bool, error) {
+	da, err := m.r.readBlob(a.Hash)
+	if err != nil {
+		return false, err
+	}
+	db, err := m.r.readBlob(b.Hash)
+	if err != nil {
+		return false, err
+	}
+	return normalizeLineEndings(da) == normalizeLineEndings(db), nil
+}
+
+// report returns the messages of the merge, one per line.
+func (m *treeMerge) report() string {
+	var b strings.Builder
+	for _, n := range m.notes {
+		b.WriteString(n.message + "\n")
+	}
+	return b.String()
+}
+
+// mergeFile merges the modes and the contents of two versions of a regular
+// file.
+func (m *treeMerge) mergeFile(p string, base diff.File, ours diff.File, theirs diff.File) error {
+	merged := diff.File{Path: p, Mode: ours.Mode, Hash: ours.Hash}
+	clean := true
+	if ours.Mode != theirs.Mode {
+		switch base.Mode {
+		case ours.Mode:
+			merged.Mode = theirs.Mode
+		case theirs.Mode:
+		default:
+			clean = false
+		}
+	}
+
+	switch ours.Hash {
+	case theirs.Hash:
+	case base.Hash:
+		merged.Hash = theirs.Hash
+	default:
+		if base.Hash == theirs.Hash {
+			break
+		}
+		hash, ok, err := m.mergeContent(p, base, ours, theirs, m.markerSize)
+		if err != nil {
+			return err
+		}
+		m.note(noteAutoMerging, fmt.Sprintf("Auto-merging %s", p), p)
+		merged.Hash = hash
+		clean = clean && ok
+	}
+
+	if clean {
+		m.take(p, merged)
+		return nil
+	}
+	m.conflict(p, merged, base, ours, theirs)
+	if base.Exists() {
+		m.note(noteContents, fmt.Sprintf("CONFLICT (content): Merge conflict in %s", p), p)
+	} else {
+		m.note(noteContents, fmt.Sprintf("CONFLICT (add/add): Merge conflict in %s", p), p)
+	}
+	return nil
+}
+
+// mergeContent merges the contents of three versions of a file, with
+// conflict markers of markerSize characters. The labels of the markers
+// name the paths too when a rename left the versions under different
+// ones. Binary files can not be merged: ours, or the base in virtual
+// merges, is kept.
+//
+// Returns:
+//   - The ID of the merged blob, with conflict markers if it has conflicts.
+//   - Whether the merge is free of conflicts.
+//   - An error if a blob can not be read or written.
+func (m *treeMerge) mergeContent(p string, base diff.File, ours diff.File, theirs diff.File, markerSize int) (string, bool, error) {
+	contents := make([]string, 3)
+	for i, f := range []diff.File{base, ours, theirs} {
+		if !f.Exists() {
+			continue
+		}
+		data, err := m.r.readBlob(f.Hash)
+		if err != nil {
+			return "", false, err
+		}
+		contents[i] = data
+	}
+	if diff.IsBinary(contents[0]) || diff.IsBinary(contents[1]) || diff.IsBinary(contents[2]) {
+		switch {
+		case m.favor == diff.FavorOurs:
+			return ours.Hash, true, nil
+		case m.favor == diff.FavorTheirs:
+			return theirs.Hash, true, nil
+		}
+		m.note(noteBinary, fmt.Sprintf("warning: Cannot merge binary files: %s (%s vs. %s)", p, m.ours, m.theirs), p)
+		return m.fallback(base, ours).Hash, false, nil
+	}
+	if m.renormalize {
+		for i := range contents {
+			contents[i] = normalizeLineEndings(contents[i])
+		}
+	}
+	opts := diff.MergeOptions{
+		Style:             m.style,
+		Ours:              m.ours,
+		Base:              m.base,
+		Theirs:            m.theirs,
+		MarkerSize:        markerSize,
+		IgnoreSpaceChange: m.ignoreSpaceChange,
+	}
+	if base.Exists() && base.Path != ours.Path || ours.Path != theirs.Path {
+		opts.Ours += ":" + ours.Path
+		opts.Base += ":" + base.Path
+		opts.Theirs += ":" + theirs.Path
+	}
+	if !m.virtual {
+		opts.Favor = m.favor
+	}
+	merged, conflicts := diff.Merge3(contents[0], contents[1], contents[2], opts)
+	hash, err := m.r.WriteObject(objects.NewBlob(merged))
+	return hash, conflicts == 0, err
+}
+
+// resolveDirectoryConflicts moves the files that are in the way of a
+// directory of the other side next to it, under <path>~<side>. The
+// unmerged entries and the modify/delete conflict of a file deleted on the
+// side of the directory move along with it.
+func (m *treeMerge) resolveDirectoryConflicts(ours map[string]diff.File) {
+	for _, p := range sortedPaths(m.files) {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			f, ok := m.files[dir]
+			if !ok {
+				continue
+			}
+			side, other, stage := m.theirs, m.ours, index.StageTheirs
+			if sameFile(ours[dir], f) {
+				side, other, stage = m.ours, m.theirs, index.StageOurs
+			}
+			moved := dir + "~" + strings.ReplaceAll(side, "/", "_")
+			delete(m.files, dir)
+			m.take(moved, f)
+
+			staged := false
+			for i, e := range m.stages {
+				if e.Path == dir {
+					m.stages[i].Path, staged = moved, true
+				}
+			}
+			if !staged && !m.virtual {
+				m.stages = append(m.stages, index.Entry{Mode: f.Mode, Hash: f.Hash, Path: moved, Stage: stage})
+			}
+			m.conflicts = slices.DeleteFunc(m.conflicts, func(c string) bool { return c == dir })
+			if !m.virtual {
+				m.conflicts = append(m.conflicts, moved)
+			}
+
+			modifyDelete := false
+			m.notes = slices.DeleteFunc(m.notes, func(n mergeNote) bool {
+				if !slices.Contains(n.paths, dir) || n.kind == noteAutoMerging {
+					return false
+				}
+				modifyDelete = modifyDelete || n.kind == noteModifyDelete
+				return true
+			})
+			m.note(noteFileDirectory, fmt.Sprintf("CONFLICT (file/directory): directory in the way of %s from %s; moving it to %s instead.",
+				dir, side, moved), moved, dir)
+			if modifyDelete {
+				m.note(noteModifyDelete, modifyDeleteMessage(moved, other, side), moved)
+			}
+		}
+	}
+}
+
+// readBlob reads the content of a blob.
+func (r *Repository) readBlob(sha string) (string, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return "", err
+	}
+	blob, ok := obj.(*objects.Blob)
+	if !ok {
+		return "", fmt.Errorf("object %s is a %s, not a blob", sha, obj.Format())
+	}
+	return blob.ReadData(), nil
+}
+
+// mergeCommits merges the trees of the commits ours and theirs. When they
+// have several merge bases, the bases are merged into a virtual one first,
+// recursively.
+func (r *Repository) mergeCommits(m *treeMerge, ours string, theirs string) error {
+	bases, err := r.MergeBases(ours, theirs)
+	if err != nil {
+		return err
+	}
+	oursTree, err := r.peelTree(ours)
+	if err != nil {
+		return err
+	}
+	return r.mergeOnBases(m, bases, oursTree, theirs)
+}
+
+// mergeOnBases merges the tree ours and the tree of the commit theirs from
+// their merge bases. A subtree merge first lines the trees of the bases and
+// of theirs up with ours.
+func (r *Repository) mergeOnBases(m *treeMerge, bases []string, ours string, theirs string) error {
+	slices.Reverse(bases)
+	base, err := r.virtualBase(bases, m.style, 1)
+	if err != nil {
+		return err
+	}
+	switch len(bases) {
+	case 0:
+		m.base = "empty tree"
+	case 1:
+		m.base = shortID(bases[0])
+	default:
+		m.base = "merged common ancestors"
+	}
+	theirsTree, err := r.peelTree(theirs)
+	if err != nil {
+		return err
+	}
+	if m.subtree {
+		if base, err = r.shiftTree(ours, base, m.subtreePrefix); err != nil {
+			return err
+		}
+		if theirsTree, err = r.shiftTree(ours, theirsTree, m.subtreePrefix); err != nil {
+			return err
+		}
+	}
+	return m.merge(base, ours, theirsTree)
+}
+
+// virtualBase merges merge bases, oldest first, into the tree of a virtual
+// merge base. depth counts the nested virtual merges, whose conflict
+// markers grow longer to stay apart from those of the outer merges.
+//
+// Returns:
+//   - The ID of the tree of the virtual merge base.
+//   - An error if a commit can not be read or a tree can not be written.
+func (r *Repository) virtualBase(bases []string, style string, depth int) (string, error) {
+	if len(bases) == 0 {
+		return r.ObjectFormat().EmptyTree, nil
+	}
+	tree, err := r.peelTree(bases[0])
+	if err != nil {
+		return "", err
+	}
+	for i, next := range bases[1:] {
+		inner, err := r.MergeBases(next, bases[:i+1]...)
+		if err != nil {
+			return "", err
+		}
+		slices.Reverse(inner)
+		innerTree, err := r.virtualBase(inner, style, depth+1)
+		if err != nil {
+			return "", err
+		}
+		nextTree, err := r.peelTree(next)
+		if err != nil {
+			return "", err
+		}
+		m := r.newTreeMerge("Temporary merge branch 1", "Temporary merge branch 2", style)
+		m.base = "merged common ancestors"
+		m.virtual = true
+		m.markerSize = conflictMarkerSize + 2*depth
+		if err := m.merge(innerTree, tree, nextTree); err != nil {
+			return "", err
+		}
+		if tree, err = r.writeFiles(m.files); err != nil {
+			return "", err
+		}
+	}
+	return tree, nil
+}
+
+func shortID(sha string) string {
+	return sha[:min(len(sha), abbrevLength)]
+}
+
+// conflictStyle returns the conflict style of a merge: the requested one or
+// the merge.conflictStyle setting.
+func (r *Repository) conflictStyle(requested string) (string, error) {
+	style := requested
+	if style == "" {
+		style = r.Config.Get("merge", "conflictstyle")
+	}
+	switch style {
+	case "":
+		return diff.ConflictStyleMerge, nil
+	case diff.ConflictStyleMerge, diff.ConflictStyleDiff3, diff.ConflictStyleZealousDiff3:
+		return style, nil
+	}
+	return "", fmt.Errorf("unknown conflict style '%s'", style)
+}
+
+func (r *Repository) hasFile(name string) bool {
+	return filesystem.IsFile(r.FS, r.path(name))
+}
+
+func (r *Repository) readFile(name string) (string, error) {
+	return filesystem.ReadFileData(r.FS, r.path(name))
+}
+
+func (r *Repository) removeFiles(names ...string) error {
+	for _, name := range names {
+		if r.hasFile(name) {
+			if err := r.FS.Remove(r.path(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// headCommit returns the commit HEAD points to, or an empty string on an
+// unborn branch.
+func (r *Repository) headCommit() (string, error) {
+	sha, err := r.ResolveRef(headFile)
+	if errors.Is(err, ErrorRefNotFound) {
+		return "", nil
+	}
+	return sha, err
+}
+
+// headTree returns the tree of the HEAD commit, or the empty tree on an
+// unborn branch.
+func (r *Repository) headTree(head string) (string, error) {
+	if head == "" {
+		return r.ObjectFormat().EmptyTree, nil
+	}
+	return r.peelTree(head)
+}
+
+// branchName returns the short name of the current branch, or an empty
+// string when HEAD is detached.
+func (r *Repository) branchName() string {
+	target, err := r.SymbolicRef(headFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(target, "refs/heads/")
+}
+
+// Merge joins the history of one or more commits into the current branch.
+// The branch is fast-forwarded when it is an ancestor of the only commit to
+// merge; otherwise the merge strategy combines the trees and, unless there
+// are conflicts or the merge is squashed, a merge commit is created. A
+// conflicted merge leaves the conflicts in the worktree and the index and
+// is finished with Continue or undone with Abort.
+//
+// Returns:
+//   - The report of the merge.
+//   - Whether the merge completed without conflicts.
+//   - An error if the merge can not start, e.g. because of local changes,
+//     or the strategy fails.
+func (r *Repository) Merge(opts *Merge) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	switch {
+	case opts.Abort:
+		return r.mergeAbort()
+	case opts.Continue:
+		return r.mergeContinue(opts.NoVerify)
+	case opts.Squash && opts.NoFF:
+		return "", false, fmt.Errorf("You cannot combine --squash with --no-ff.")
+	case r.hasFile(mergeHeadFile):
+		return "", false, fmt.Errorf("You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.")
+	}
+	strategy, err := mergeStrategy(opts)
+	if err != nil {
+		return "", false, err
+	}
+	style, err := r.conflictStyle(opts.ConflictStyle)
+	if err != nil {
+		return "", false, err
+	}
+	m := r.newTreeMerge("HEAD", "", style)
+	if err := m.setOptions(opts.StrategyOptions); err != nil {
+		return "", false, err
+	}
+
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return "", false, fmt.Errorf("Merging is not possible because you have unmerged files.")
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	names := map[string]string{}
+	heads := []string{}
+	for _, commit := range opts.Commits {
+		sha, err := r.ResolveCommit(commit)
+		if err != nil {
+			return "", false, err
+		}
+		if _, ok := names[sha]; !ok {
+			names[sha] = commit
+			heads = append(heads, sha)
+		}
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return "", false, err
+	}
+	headFiles, err := r.treeFiles(headTree)
+	if err != nil {
+		return "", false, err
+	}
+	if changed := indexChanges(idx, headFiles); len(changed) > 0 {
+		return "", false, fmt.Errorf("Your local changes to the following files would be overwritten by merge:\n\t%s\nPlease commit your changes or stash them before you merge.\nAborting",
+			strings.Join(changed, "\n\t"))
+	}
+
+	if head == "" {
+		if len(heads) > 1 {
+			return "", false, fmt.Errorf("Can merge only exactly one commit into empty head")
+		}
+		return r.fastForward(opts, idx, head, heads[0], headFiles)
+	}
+	remotes, subsumed, err := r.reduceParents(head, heads)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case len(remotes) == 0:
+		return "Already up to date.\n", true, nil
+	case len(remotes) == 1 && subsumed && !opts.NoFF:
+		return r.fastForward(opts, idx, head, remotes[0], headFiles)
+	}
+	if len(remotes) == 1 && !opts.AllowUnrelated {
+		bases, err := r.MergeBases(head, remotes[0])
+		if err != nil {
+			return "", false, err
+		}
+		if len(bases) == 0 {
+			return "", false, fmt.Errorf("refusing to merge unrelated histories")
+		}
+	}
+	if err := r.runStrategy(m, strategy, head, headTree, remotes, names); err != nil {
+		return "", false, err
+	}
+	if m.failed {
+		return m.report(), false, nil
+	}
+	parents := remotes
+	if !subsumed || opts.NoFF {
+		parents = append([]string{head}, remotes...)
+	}
+	return r.concludeMerge(opts, m, strategy, idx, head, headTree, headFiles, parents, remotes, names)
+}
+
+func (r *Repository) fastForward(opts *Merge, idx *index.Index, head string, theirs string, headFiles map[string]diff.File) (string, bool, error) {
+	tree, err := r.peelTree(theirs)
+	if err != nil {
+		return "", false, err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.checkout(headFiles, files, false, "merge"); err != nil {
+		return "", false, err
+	}
+	if err := r.WriteIndex(r.buildIndex(files, nil, idx)); err != nil {
+		return "", false, err
+	}
+
+	var b strings.Builder
+	if head != "" {
+		fmt.Fprintf(&b, "Updating %s..%s\n", shortID(head), shortID(theirs))
+	}
+	b.WriteString("Fast-forward\n")
+	if head != "" {
+		if err := r.ReplaceTextFile(head+"\n", origHeadFile); err != nil {
+			return "", false, err
+		}
+	}
+	if opts.Squash {
+		if err := r.writeSquashMessage(head, []string{theirs}); err != nil {
+			return "", false, err
+		}
+		b.WriteString("Squash commit -- not updating HEAD\n")
+	} else {
+		if err := r.UpdateHead(theirs, fmt.Sprintf("merge %s: Fast-forward", strings.Join(opts.Commits, " "))); err != nil {
+			return "", false, err
+		}
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return "", false, err
+	}
+	stat, err := r.diffStat(headTree, tree)
+	if err != nil {
+		return "", false, err
+	}
+	b.WriteString(stat)
+	if err := r.runPostHook(&b, "post-merge", squashFlag(opts.Squash)); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// concludeMerge writes the result of a merge strategy to the worktree and
+// the index, then commits it or, for conflicts and squashed merges, records
+// what the commit will be made of.
+func (r *Repository) concludeMerge(opts *Merge, m *treeMerge, strategy string, idx *index.Index, head string, headTree string,
+	headFiles map[string]diff.File, parents []string, remotes []string, names map[string]string) (string, bool, error) {
+	if err := r.checkout(headFiles, m.files, false, "merge"); err != nil {
+		return "", false, err
+	}
+	if err := r.WriteIndex(r.buildIndex(m.files, m.stages, idx)); err != nil {
+		return "", false, err
+	}
+
+	var b strings.Builder
+	b.WriteString(m.report())
+	remoteNames := make([]string, len(remotes))
+	for i, sha := range remotes {
+		remoteNames[i] = names[sha]
+	}
+	message := r.mergeMessage(remoteNames)
+	if opts.Message != "" {
+		message = strings.TrimSuffix(opts.Message, "\n") + "\n"
+	}
+	if err := r.ReplaceTextFile(head+"\n", origHeadFile); err != nil {
+		return "", false, err
+	}
+	if opts.Squash {
+		if err := r.writeSquashMessage(head, remotes); err != nil {
+			return "", false, err
+		}
+	}
+
+	if len(m.conflicts) > 0 {
+		if opts.Squash {
+			b.WriteString("Squash commit -- not updating HEAD\n")
+		} else if err := r.writeMergeState(remotes, message, m.conflicts, opts.NoFF); err != nil {
+			return "", false, err
+		}
+		b.WriteString("Automatic merge failed; fix conflicts and then commit the result.\n")
+		return b.String(), false, nil
+	}
+	if opts.Squash {
+		b.WriteString("Automatic merge went well; stopped before committing as requested\nSquash commit -- not updating HEAD\n")
+		if err := r.runPostHook(&b, "post-merge", squashFlag(true)); err != nil {
+			return "", false, err
+		}
+		return b.String(), true, nil
+	}
+
+	tree, err := r.writeFiles(m.files)
+	if err != nil {
+		return "", false, err
+	}
+	message, err = r.mergeCommitHooks(&b, message, opts.NoVerify)
+	if err != nil {
+		if stateErr := r.writeMergeState(remotes, message, nil, opts.NoFF); stateErr != nil {
+			return "", false, stateErr
+		}
+		var failed *HookError
+		if !errors.As(err, &failed) {
+			return "", false, err
+		}
+		b.WriteString("Not committing merge; use 'ggit merge --continue' to complete the merge.\n")
+		return b.String(), false, nil
+	}
+	commit, err := r.CommitTree(tree, parents, message)
+	if err != nil {
+		return "", false, err
+	}
+	made := fmt.Sprintf("Merge made by the '%s' strategy.", strategy)
+	if err := r.UpdateHead(commit, fmt.Sprintf("merge %s: %s", strings.Join(opts.Commits, " "), made)); err != nil {
+		return "", false, err
+	}
+	stat, err := r.diffStat(headTree, tree)
+	if err != nil {
+		return "", false, err
+	}
+	fmt.Fprintf(&b, "%s\n%s", made, stat)
+	if err := r.runPostHook(&b, "post-merge", squashFlag(false)); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// mergeCommitHooks runs the hooks of a merge commit about to be made: the
+// pre-merge-commit and commit-msg hooks, unless noVerify is set, and the
+// prepare-commit-msg hook.
+//
+// Returns:
+//   - The message the hooks left, the original one if they failed.
+//   - An error if a hook fails or leaves the message empty.
+func (r *Repository) mergeCommitHooks(b *strings.Builder, message string, noVerify bool) (string, error) {
+	if !noVerify {
+		if err := r.runHook(b, "pre-merge-commit"); err != nil {
+			return message, err
+		}
+	}
+	edited, err := r.commitMessageHooks(b, message, "merge", !noVerify)
+	if err != nil {
+		return message, err
+	}
+	return edited, nil
+}
+
+// squashFlag is the argument of the post-merge hook: whether the merge was
+// squashed.
+func squashFlag(squash bool) string {
+	if squash {
+		return "1"
+	}
+	return "0"
+}
+
+// mergeMessage returns the default message of a merge commit, e.g.
+// "Merge branches 'a' and 'b' into next". The merged names are grouped by
+// kind; the destination is left out for the master and main branches.
+func (r *Repository) mergeMessage(names []string) string {
+	kinds := [][2]string{
+		{"branch", "branches"},
+		{"remote-tracking branch", "remote-tracking branches"},
+		{"tag", "tags"},
+		{"commit", "commits"},
+	}
+	groups := make([][]string, len(kinds))
+	for _, name := range names {
+		kind := 3
+		if full, _, err := r.DwimRef(name); err == nil {
+			switch {
+			case strings.HasPrefix(full, "refs/heads/"):
+				kind, name = 0, strings.TrimPrefix(full, "refs/heads/")
+			case strings.HasPrefix(full, "refs/remotes/"):
+				kind, name = 1, strings.TrimPrefix(full, "refs/remotes/")
+			case strings.HasPrefix(full, "refs/tags/"):
+				kind, name = 2, strings.TrimPrefix(full, "refs/tags/")
+			}
+		}
+		groups[kind] = append(groups[kind], "'"+name+"'")
+	}
+
+	parts := []string{}
+	for i, group := range groups {
+		switch len(group) {
+		case 0:
+		case 1:
+			parts = append(parts, kinds[i][0]+" "+group[0])
+		default:
+			last := len(group) - 1
+			parts = append(parts, kinds[i][1]+" "+strings.Join(group[:last], ", ")+" and "+group[last])
+		}
+	}
+	return "Merge " + strings.Join(parts, ", ") + r.mergeDestination() + "\n"
+}
+
+// mergeDestination returns how merge messages name the current branch,
+// e.g. " into next", empty for the master and main branches.
+func (r *Repository) mergeDestination() string {
+	if branch := r.branchName(); branch != "" && branch != "master" && branch != "main" {
+		return " into " + branch
+	}
+	return ""
+}
+
+// writeMergeState records a merge stopped by conflicts, for Continue and
+// Abort.
+func (r *Repository) writeMergeState(remotes []string, message string, conflicts []string, noFF bool) error {
+	if err := r.ReplaceTextFile(strings.Join(remotes, "\n")+"\n", mergeHeadFile); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(message)
+	if len(conflicts) > 0 {
+		b.WriteString("\n# Conflicts:\n")
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "#\t%s\n", c)
+	}
+	if err := r.ReplaceTextFile(b.String(), mergeMsgFile); err != nil {
+		return err
+	}
+	mode := ""
+	if noFF {
+		mode = "no-ff"
+	}
+	return r.ReplaceTextFile(mode, mergeModeFile)
+}
+
+// writeSquashMessage prepares the message of the commit squashing the
+// commits merged from remotes, listing them like git log does.
+func (r *Repository) writeSquashMessage(head string, remotes []string) error {
+	exclude := []string{}
+	if head != "" {
+		exclude = append(exclude, head)
+	}
+	commits, err := r.RevList(remotes, exclude)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("Squashed commit of the following:\n")
+	for _, sha := range commits {
+		commit, err := r.readCommit(sha)
+		if err != nil {
+			return err
+		}
+		author, err := objects.ParseIdent(commit.KVLM.Author)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\ncommit %s\nAuthor: %s <%s>\nDate:   %s\n\n", sha, author.Name, author.Email, formatDate(author))
+		for _, line := range strings.Split(commit.KVLM.Message, "\n") {
+			b.WriteString(strings.TrimRight("    "+line, " ") + "\n")
+		}
+	}
+	return r.ReplaceTextFile(b.String(), squashMsgFile)
+}
+
+// formatDate formats the date of an identity in its own time zone, like
+// git's default date format.
+func formatDate(i objects.Ident) string {
+	return identTime(i).Format("Mon Jan 2 15:04:05 2006 -0700")
+}
+
+// identTime returns the date of an identity in its own time zone.
+func identTime(i objects.Ident) time.Time {
+	offset := 0
+	if _, err := fmt.Sscanf(i.Zone[1:], "%04d", &offset); err == nil {
+		offset = (offset/100*60 + offset%100) * 60
+		if i.Zone[0] == '-' {
+			offset = -offset
+		}
+	}
+	return time.Unix(i.When, 0).In(time.FixedZone(i.Zone, offset))
+}
+
+// diffStat renders the diffstat and the summary of the changes between two
+// trees, as shown after a merge.
+func (r *Repository) diffStat(from string, to string) (string, error) {
+	changes, err := diff.TreeDiff(r, from, to, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	if err != nil {
+		return "", err
+	}
+	stats, err := diff.Stats(r, changes)
+	if err != nil {
+		return "", err
+	}
+	return diff.FormatStat(stats, diff.StatOptions{}) + diff.FormatSummary(changes), nil
+}
+
+// mergeAbort undoes a merge stopped by conflicts: the paths it changed are
+// restored from HEAD in the index and the worktree.
+func (r *Repository) mergeAbort() (string, bool, error) {
+	if !r.hasFile(mergeHeadFile) {
+		return "", false, fmt.Errorf("There is no merge to abort (MERGE_HEAD missing).")
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	tree, err := r.headTree(head)
+	if err != nil {
+		return "", false, err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return "", false, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.resetPaths(idx, files); err != nil {
+		return "", false, err
+	}
+	return "", true, r.removeFiles(mergeHeadFile, mergeMsgFile, mergeModeFile)
+}
+
+// resetPaths restores the paths whose index entries differ from files, or
+// are unmerged, in the index and the worktree, discarding their changes.
+func (r *Repository) resetPaths(idx *index.Index, files map[string]diff.File) error {
+	return r.restorePaths(idx, files, append(indexChanges(idx, files), idx.Conflicts()...))
+}
+
+// restorePaths restores paths in the worktree to their version in files,
+// removing the ones files does not have, and writes files as the index.
+func (r *Repository) restorePaths(idx *index.Index, files map[string]diff.File, paths []string) error {
+	old, next := map[string]diff.File{}, map[string]diff.File{}
+	for _, p := range paths {
+		current, err := r.worktreeFile(p, files[p])
+		if err != nil {
+			return err
+		}
+		if current.Exists() {
+			old[p] = current
+		}
+		if f, ok := files[p]; ok {
+			next[p] = f
+		}
+	}
+	if err := r.checkout(old, next, true, "reset"); err != nil {
+		return err
+	}
+	return r.WriteIndex(r.buildIndex(files, nil, idx))
+}
+
+// mergeContinue concludes a merge whose conflicts were resolved by
+// committing the index with the prepared merge message. The hooks of a
+// commit run as for ggit commit: pre-commit and commit-msg, unless
+// noVerify is set, prepare-commit-msg and post-commit.
+func (r *Repository) mergeContinue(noVerify bool) (string, bool, error) {
+	if !r.hasFile(mergeHeadFile) {
+		return "", false, fmt.Errorf("There is no merge in progress (MERGE_HEAD missing).")
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return "", false, fmt.Errorf("Committing is not possible because you have unmerged files.")
+	}
+	tree, err := r.WriteTree(idx)
+	if err != nil {
+		return "", false, err
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	data, err := r.readFile(mergeHeadFile)
+	if err != nil {
+		return "", false, err
+	}
+	parents := append([]string{head}, strings.Fields(data)...)
+	message := ""
+	if r.hasFile(mergeMsgFile) {
+		if message, err = r.readFile(mergeMsgFile); err != nil {
+			return "", false, err
+		}
+	}
+	var b strings.Builder
+	if !noVerify {
+		if err := r.runHook(&b, "pre-commit"); err != nil {
+			return hookFailure(&b, err)
+		}
+	}
+	if message, err = r.commitMessageHooks(&b, message, "merge", !noVerify); err != nil {
+		return hookFailure(&b, err)
+	}
+	message = CleanupMessage(message)
+	if message == "" {
+		return "", false, fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	commit, err := r.CommitTree(tree, parents, message)
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.UpdateHead(commit, "commit (merge): "+subject(message)); err != nil {
+		return "", false, err
+	}
+	if err := r.removeFiles(mergeHeadFile, mergeMsgFile, mergeModeFile); err != nil {
+		return "", false, err
+	}
+	branch := r.branchName()
+	if branch == "" {
+		branch = "detached HEAD"
+	}
+	fmt.Fprintf(&b, "[%s %s] %s\n", branch, shortID(commit), subject(message))
+	if err := r.runPostHook(&b, "post-commit"); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// hookFailure reports a command stopped by a failing hook with the output
+// of the hooks, as an unclean result, and other errors as they are.
+func hookFailure(b *strings.Builder, err error) (string, bool, error) {
+	var failed *HookError
+	if errors.As(err, &failed) {
+		return b.String(), false, nil
+	}
+	return "", false, err
+}
@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"container/heap"
+	"ggit/internal/objects"
+)
+
+// Flags painted on commits while looking for merge bases or listing
+// revisions.
+const (
+	parent1 = 1 << iota
+	parent2
+	stale
+	result
+	uninteresting
+	seen
+)
+
+// walkCommit is a commit of the graph walked by commitWalk.
+type walkCommit struct {
+	sha     string
+	parents []string
+	date    int64
+	flags   int
+}
+
+// commitWalk reads commits lazily and keeps the flags painted on them.
+type commitWalk struct {
+	r       *Repository
+	commits map[string]*walkCommit
+}
+
+func (r *Repository) newCommitWalk() *commitWalk {
+	return &commitWalk{r: r, commits: map[string]*walkCommit{}}
+}
+
+func (w *commitWalk) get(sha string) (*walkCommit, error) {
+	if c, ok := w.commits[sha]; ok {
+		return c, nil
+	}
+	commit, err := w.r.readCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	c := &walkCommit{sha: sha, parents: commit.KVLM.Parents}
+	if committer, err := objects.ParseIdent(commit.KVLM.Comitter); err == nil {
+		c.date = committer.When
+	}
+	w.commits[sha] = c
+	return c, nil
+}
+
+func (w *commitWalk) clear() {
+	for _, c := range w.commits {
+		c.flags = 0
+	}
+}
+
+// commitQueue is a priority queue returning the most recent commit first
+// and commits of the same date in the order they were added.
+type commitQueue struct {
+	items []*walkCommit
+	order []int
+	next  int
+}
+
+func (q *commitQueue) Len() int { return len(q.items) }
+func (q *commitQueue) Less(i, j int) bool {
+	if q.items[i].date != q.items[j].date {
+		return q.items[i].date > q.items[j].date
+	}
+	return q.order[i] < q.order[j]
+}
+func (q *commitQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.order[i], q.order[j] = q.order[j], q.order[i]
+}
+func (q *commitQueue) Push(x any) {
+	q.items = append(q.items, x.(*walkCommit))
+	q.order = append(q.order, q.next)
+	q.next++
+}
+func (q *commitQueue) Pop() any {
+	n := len(q.items) - 1
+	item := q.items[n]
+	q.items, q.order = q.items[:n], q.order[:n]
+	return item
+}
+
+func (q *commitQueue) hasNonStale() bool {
+	for _, c := range q.items {
+		if c.flags&stale == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// insertByDate inserts c into a list sorted by decreasing date, after the
+// commits of the same date.
+func insertByDate(list []*walkCommit, c *walkCommit) []*walkCommit {
+	i := 0
+	for i < len(list) && list[i].date >= c.date {
+		i++
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = c
+	return list
+}
+
+// paint walks down from one and twos, marking the commits reachable from
+// one with parent1 and those reachable from any of twos with parent2. The
+// commits reachable from both sides that are not ancestors of another such
+// commit are the merge base candidates.
+func (w *commitWalk) paint(one *walkCommit, twos []*walkCommit) ([]*walkCommit, error) {
+	one.flags |= parent1
+	if len(twos) == 0 {
+		return []*walkCommit{one}, nil
+	}
+	q := &commitQueue{}
+	heap.Push(q, one)
+	for _, two := range twos {
+		two.flags |= parent2
+		heap.Push(q, two)
+	}
+
+	found := []*walkCommit{}
+	for q.hasNonStale() {
+		c := heap.Pop(q).(*walkCommit)
+		flags := c.flags & (parent1 | parent2 | stale)
+		if flags == parent1|parent2 {
+			if c.flags&result == 0 {
+				c.flags |= result
+				found = insertByDate(found, c)
+			}
+			// The parents of a merge base can not be merge bases.
+			flags |= stale
+		}
+		for _, sha := range c.parents {
+			p, err := w.get(sha)
+			if err != nil {
+				return nil, err
+			}
+			if p.flags&flags == flags {
+				continue
+			}
+			p.flags |= flags
+			heap.Push(q, p)
+		}
+	}
+	return found, nil
+}
+
+// mergeBases computes the merge bases of one and the others: the best
+// common ancestors of one and a hypothetical merge of all the others.
+func (w *commitWalk) mergeBases(one *walkCommit, twos []*walkCommit) ([]*walkCommit, error) {
+	for _, two := range twos {
+		if one == two {
+			return []*walkCommit{one}, nil
+		}
+	}
+	painted, err := w.paint(one, twos)
+	if err != nil {
+		return nil, err
+	}
+	bases := []*walkCommit{}
+	for _, c := range painted {
+		if c.flags&stale == 0 {
+			bases = insertByDate(bases, c)
+		}
+	}
+	w.clear()
+	if len(bases) <= 1 {
+		return bases, nil
+	}
+
+	bases, err = w.removeRedundant(bases)
+	if err != nil {
+		return nil, err
+	}
+	sorted := []*walkCommit{}
+	for _, c := range bases {
+		sorted = insertByDate(sorted, c)
+	}
+	return sorted, nil
+}
+
+// removeRedundant drops the candidates that are ancestors of another
+// candidate. Criss-cross merges leave several candidates, some of which
+// can be reached from each other.
+func (w *commitWalk) removeRedundant(candidates []*walkCommit) ([]*walkCommit, error) {
+	redundant := make([]bool, len(candidates))
+	for i, c := range candidates {
+		if redundant[i] {
+			continue
+		}
+		others := []*walkCommit{}
+		indexes := []int{}
+		for j, o := range candidates {
+			if i != j && !redundant[j] {
+				others = append(others, o)
+				indexes = append(indexes, j)
+			}
+		}
+		if _, err := w.paint(c, others); err != nil {
+			return nil, err
+		}
+		if c.flags&parent2 != 0 {
+			redundant[i] = true
+		}
+		for k, o := range others {
+			if o.flags&parent1 != 0 {
+				redundant[indexes[k]] = true
+			}
+		}
+		w.clear()
+	}
+
+	kept := []*walkCommit{}
+	for i, c := range candidates {
+		if !redundant[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+// MergeBases finds the best common ancestors of the commit one and a
+// hypothetical merge of the other commits. Criss-cross histories can have
+// several merge bases, none of them an ancestor of another.
+//
+// Returns:
+//   - The IDs of the merge bases, the most recent first; none if the
+//     commits share no history.
+//   - An error if a commit can not be read.
+func (r *Repository) MergeBases(one string, others ...string) ([]string, error) {
+	w := r.newCommitWalk()
+	c, err := w.get(one)
+	if err != nil {
+		return nil, err
+	}
+	twos := []*walkCommit{}
+	for _, sha := range others {
+		two, err := w.get(sha)
+		if err != nil {
+			return nil, err
+		}
+		twos = append(twos, two)
+	}
+	bases, err := w.mergeBases(c, twos)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(bases))
+	for _, b := range bases {
+		result = append(result, b.sha)
+	}
+	return result, nil
+}
+
+// IsAncestor reports whether the commit ancestor can be reached from the
+// commit descendant. A commit is its own ancestor.
+func (r *Repository) IsAncestor(ancestor string, descendant string) (bool, error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+	w := r.newCommitWalk()
+	a, err := w.get(ancestor)
+	if err != nil {
+		return false, err
+	}
+	d, err := w.get(descendant)
+	if err != nil {
+		return false, err
+	}
+	if _, err := w.paint(a, []*walkCommit{d}); err != nil {
+		return false, err
+	}
+	return a.flags&parent2 != 0, nil
+}
+
+// ForkPoint finds the point at which commit forked from the history of
+// ref, taking every commit ref pointed to according to its reflog into
+// account. This finds the fork point even when ref was rewound or rebased
+// after commit was branched off it.
+//
+// Returns:
+//   - The ID of the fork point, or an empty string if there is none.
+//   - An error if ref does not exist or a commit can not be read.
+func (r *Repository) ForkPoint(ref string, commit string) (string, error) {
+	name, sha, err := r.DwimRef(ref)
+	if err != nil {
+		return "", err
+	}
+	entries, err := r.Reflog(name)
+	if err != nil {
+		return "", err
+	}
+
+	w := r.newCommitWalk()
+	seen := map[string]bool{}
+	candidates := []*walkCommit{}
+	add := func(sha string) {
+		if seen[sha] || sha == r.ObjectFormat().NullID() {
+			return
+		}
+		seen[sha] = true
+		// Reflog entries may name commits that were pruned since.
+		if c, err := w.get(sha); err == nil {
+			candidates = append(candidates, c)
+		}
+	}
+	for i, e := range entries {
+		if i == 0 {
+			add(e.Old)
+		}
+		add(e.New)
+	}
+	if len(candidates) == 0 {
+		add(sha)
+	}
+
+	c, err := w.get(commit)
+	if err != nil {
+		return "", err
+	}
+	bases, err := w.mergeBases(c, candidates)
+	if err != nil {
+		return "", err
+	}
+	if len(bases) != 1 || !seen[bases[0].sha] {
+		return "", nil
+	}
+	return bases[0].sha, nil
+}
+
+// RevList lists the commits reachable from include but not from exclude,
+// like git rev-list <include>... ^<exclude>...
+//
+// Returns:
+//   - The IDs of the commits, the most recent first.
+//   - An error if a commit can not be read.
+func (r *Repository) RevList(include []string, exclude []string) ([]string, error) {
+	w := r.newCommitWalk()
+	pending := append([]string{}, exclude...)
+	for len(pending) > 0 {
+		c, err := w.get(pending[len(pending)-1])
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[:len(pending)-1]
+		if c.flags&uninteresting == 0 {
+			c.flags |= uninteresting
+			pending = append(pending, c.parents...)
+		}
+	}
+
+	q := &commitQueue{}
+	push := func(sha string) error {
+		c, err := w.get(sha)
+		if err != nil {
+			return err
+		}
+		if c.flags&(uninteresting|seen) == 0 {
+			c.flags |= seen
+			heap.Push(q, c)
+		}
+		return nil
+	}
+	for _, sha := range include {
+		if err := push(sha); err != nil {
+			return nil, err
+		}
+	}
+	commits := []string{}
+	for q.Len() > 0 {
+		c := heap.Pop(q).(*walkCommit)
+		commits = append(commits, c.sha)
+		for _, p := range c.parents {
+			if err := push(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return commits, nil
+}
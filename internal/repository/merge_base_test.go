@@ -0,0 +1,144 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeBases(t *testing.T) {
+	r := newTestRepository(t)
+
+	// Criss-cross history: b and d are both merged into each other.
+	//
+	//	a - b - c - e
+	//	  \   X
+	//	    d - f - g
+	a := writeCommit(t, r, 1000)
+	b := writeCommit(t, r, 1001, a)
+	d := writeCommit(t, r, 1002, a)
+	c := writeCommit(t, r, 1003, b, d)
+	e := writeCommit(t, r, 1004, c)
+	f := writeCommit(t, r, 1005, d, b)
+	g := writeCommit(t, r, 1006, f)
+	unrelated := writeCommit(t, r, 1007)
+
+	t.Run("Linear", func(t *testing.T) {
+		bases, err := r.MergeBases(e, b)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{b}, bases)
+
+		bases, err = r.MergeBases(e, e)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{e}, bases)
+	})
+
+	t.Run("CrissCross", func(t *testing.T) {
+		bases, err := r.MergeBases(e, g)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{d, b}, bases)
+
+		bases, err = r.MergeBases(g, e)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{d, b}, bases)
+	})
+
+	t.Run("Many", func(t *testing.T) {
+		// The merge base of e and a merge of b and f.
+		bases, err := r.MergeBases(e, b, f)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{d, b}, bases)
+	})
+
+	t.Run("Unrelated", func(t *testing.T) {
+		bases, err := r.MergeBases(e, unrelated)
+		assert.NoError(t, err)
+		assert.Empty(t, bases)
+	})
+
+	t.Run("IsAncestor", func(t *testing.T) {
+		for _, test := range []struct {
+			ancestor   string
+			descendant string
+			expected   bool
+		}{
+			{a, g, true},
+			{b, g, true},
+			{g, g, true},
+			{e, g, false},
+			{g, a, false},
+			{unrelated, e, false},
+		} {
+			ok, err := r.IsAncestor(test.ancestor, test.descendant)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, ok)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := r.MergeBases(e, "0123456789012345678901234567890123456789")
+		assert.Error(t, err)
+	})
+}
+
+func TestForkPoint(t *testing.T) {
+	r := newTestRepository(t)
+
+	// The upstream branch pointed to u2 when topic was branched off it and
+	// was rewound to base and rebuilt with u3 since.
+	base := writeCommit(t, r, 1000)
+	u1 := writeCommit(t, r, 1001, base)
+	u2 := writeCommit(t, r, 1002, u1)
+	topic := writeCommit(t, r, 1003, u2)
+	u3 := writeCommit(t, r, 1004, base)
+
+	writeRef(t, r, "refs/heads/up", u3)
+	writeRef(t, r, "refs/heads/topic", topic)
+
+	point, err := r.ForkPoint("up", topic)
+	assert.NoError(t, err)
+	assert.Empty(t, point, "without a reflog only the current tip is known")
+
+	point, err = r.ForkPoint("up", u3)
+	assert.NoError(t, err)
+	assert.Equal(t, u3, point)
+
+	log := "0000000000000000000000000000000000000000 " + base + " A U Thor <author@example.com> 1000 +0000\tbranch: Created\n" +
+		base + " " + u1 + " A U Thor <author@example.com> 1001 +0000\tcommit: u1\n" +
+		u1 + " " + u2 + " A U Thor <author@example.com> 1002 +0000\tcommit: u2\n" +
+		u2 + " " + base + " A U Thor <author@example.com> 1003 +0000\treset: moving to base\n" +
+		base + " " + u3 + " A U Thor <author@example.com> 1004 +0000\tcommit: u3\n"
+	assert.NoError(t, r.WriteTextToFile(log, "logs", "refs", "heads", "up"))
+
+	point, err = r.ForkPoint("up", topic)
+	assert.NoError(t, err)
+	assert.Equal(t, u2, point)
+
+	point, err = r.ForkPoint("topic", u3)
+	assert.NoError(t, err)
+	assert.Empty(t, point)
+
+	_, err = r.ForkPoint("missing", topic)
+	assert.Error(t, err)
+}
+
+func TestRevList(t *testing.T) {
+	r := newTestRepository(t)
+	a := writeCommit(t, r, 1000)
+	b := writeCommit(t, r, 1001, a)
+	c := writeCommit(t, r, 1002, a)
+	d := writeCommit(t, r, 1003, b, c)
+	e := writeCommit(t, r, 1004, d)
+
+	commits, err := r.RevList([]string{e}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{e, d, c, b, a}, commits)
+
+	commits, err = r.RevList([]string{e}, []string{b})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{e, d, c}, commits)
+
+	commits, err = r.RevList([]string{b, c}, []string{d})
+	assert.NoError(t, err)
+	assert.Empty(t, commits)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"slices"
+	"strings"
+)
+
+// Merge strategies.
+const (
+	StrategyRecursive = "recursive"
+	StrategyOurs      = "ours"
+	StrategyOctopus   = "octopus"
+	StrategySubtree   = "subtree"
+)
+
+func MergeStrategies() []string {
+	return []string{StrategyOctopus, StrategyOurs, StrategyRecursive, StrategySubtree}
+}
+
+// mergeStrategy returns the strategy of a merge: the requested one, or
+// octopus for several commits and recursive for one.
+func mergeStrategy(opts *Merge) (string, error) {
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = StrategyRecursive
+		if len(opts.Commits) > 1 {
+			strategy = StrategyOctopus
+		}
+	}
+	if !slices.Contains(MergeStrategies(), strategy) {
+		return "", fmt.Errorf("Could not find merge strategy '%s'.\nAvailable strategies are: %s.", strategy, strings.Join(MergeStrategies(), " "))
+	}
+	return strategy, nil
+}
+
+// setOptions applies the -X options of the recursive strategy:
+//   - ours and theirs resolve conflicting hunks in favor of one side.
+//   - ignore-space-change treats lines differing only in the amount of
+//     whitespace as equal.
+//   - renormalize compares the files with normalized line endings.
+//   - subtree[=<prefix>] lines the merged trees up with ours, as the subtree
+//     strategy does.
+func (m *treeMerge) setOptions(options []string) error {
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		switch name {
+		case diff.FavorOurs, diff.FavorTheirs:
+			m.favor = name
+		case "ignore-space-change":
+			m.ignoreSpaceChange = true
+		case "renormalize":
+			m.renormalize = true
+		case "no-renormalize":
+			m.renormalize = false
+		case "subtree":
+			m.subtree, m.subtreePrefix = true, value
+		default:
+			return fmt.Errorf("Unknown option for merge-recursive: -X%s", option)
+		}
+	}
+	return nil
+}
+
+// reduceParents removes the commits that are ancestors of others from the
+// head and the commits to merge, keeping their order.
+//
+// Returns:
+//   - The commits to merge that are left.
+//   - Whether the head is an ancestor of one of them.
+//   - An error if a commit can not be read.
+func (r *Repository) reduceParents(head string, heads []string) ([]string, bool, error) {
+	candidates := append([]string{head}, heads...)
+	reduced := []string{}
+	for i, c := range candidates {
+		redundant := false
+		for j, other := range candidates {
+			if c == other {
+				if j < i {
+					redundant = true
+					break
+				}
+				continue
+			}
+			ok, err := r.IsAncestor(c, other)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			reduced = append(reduced, c)
+		}
+	}
+	if reduced[0] == head {
+		return reduced[1:], false, nil
+	}
+	return reduced, true, nil
+}
+
+// runStrategy merges the remotes into the head with a strategy, leaving
+// the result in m.
+func (r *Repository) runStrategy(m *treeMerge, strategy string, head string, headTree string, remotes []string, names map[string]string) error {
+	switch strategy {
+	case StrategyOurs:
+		files, err := r.treeFiles(headTree)
+		m.files = files
+		return err
+	case StrategyOctopus:
+		return r.octopusMerge(m, head, headTree, remotes, names)
+	}
+	if len(remotes) > 1 {
+		return fmt.Errorf("Merge with strategy %s failed: it can not merge more than one commit.", strategy)
+	}
+	if strategy == StrategySubtree {
+		m.subtree = true
+	}
+	m.theirs = names[remotes[0]]
+	return r.mergeCommits(m, head, remotes[0])
+}
+
+// octopusMerge merges the remotes one after the other, fast-forwarding
+// while the result is an ancestor of the next one. Only the last merge may
+// leave conflicts: the octopus fails when an earlier one does.
+func (r *Repository) octopusMerge(m *treeMerge, head string, headTree string, remotes []string, names map[string]string) error {
+	if len(remotes) < 2 {
+		return fmt.Errorf("Merge with strategy octopus failed.")
+	}
+	merged, tree := []string{head}, headTree
+	nonFF := false
+	for _, remote := range remotes {
+		name := names[remote]
+		if len(m.conflicts) > 0 {
+			m.note("", "Automated merge did not work.\nShould not be doing an octopus.\nMerge with strategy octopus failed.")
+			m.failed = true
+			return nil
+		}
+		bases, err := r.MergeBases(remote, merged...)
+		if err != nil {
+			return err
+		}
+		if len(bases) == 1 && bases[0] == remote {
+			m.note("", "Already up to date with "+name)
+			continue
+		}
+		if !nonFF && len(merged) == 1 && len(bases) == 1 && bases[0] == merged[0] {
+			m.note("", "Fast-forwarding to: "+name)
+			merged = []string{remote}
+			if tree, err = r.peelTree(remote); err != nil {
+				return err
+			}
+			continue
+		}
+
+		nonFF = true
+		m.note("", "Trying simple merge with "+name)
+		simple := len(m.notes)
+		m.theirs = name
+		if err := r.mergeOnBases(m, bases, tree, remote); err != nil {
+			return err
+		}
+		if len(m.notes) > simple {
+			m.notes = slices.Insert(m.notes, simple, mergeNote{message: "Simple merge did not work, trying automatic merge."})
+		}
+		merged = append(merged, remote)
+		if len(m.conflicts) == 0 {
+			if tree, err = r.writeFiles(m.files); err != nil {
+				return err
+			}
+		}
+	}
+	if len(m.conflicts) > 0 {
+		return nil
+	}
+	files, err := r.treeFiles(tree)
+	m.files = files
+	return err
+}
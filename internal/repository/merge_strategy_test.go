@@ -0,0 +1,107 @@
+package repository_test
+
+import (
+	"ggit/internal/diff"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeStrategies(t *testing.T) {
+	t.Run("Ours", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, Strategy: repository.StrategyOurs})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Merge made by the 'ours' strategy.\n", out)
+
+		tree, err := r.ResolveRevision("HEAD^{tree}")
+		assert.NoError(t, err)
+		masterTree, err := r.ResolveRevision(master + "^{tree}")
+		assert.NoError(t, err)
+		assert.Equal(t, masterTree, tree)
+		second, err := r.ResolveCommit("HEAD^2")
+		assert.NoError(t, err)
+		topic, err := r.ResolveCommit("topic")
+		assert.NoError(t, err)
+		assert.Equal(t, topic, second)
+	})
+
+	t.Run("Octopus", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		other := commitChange(t, r, master+"~1", "o", "other\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/other", other, "", "branch: Created"))
+
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic", "other"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Trying simple merge with topic\nSimple merge did not work, trying automatic merge.\nAuto-merging f\n"+
+			"Trying simple merge with other\nMerge made by the 'octopus' strategy.\n"+
+			" f | 2 +-\n o | 1 +\n t | 1 +\n 3 files changed, 3 insertions(+), 1 deletion(-)\n"+
+			" create mode 100644 o\n create mode 100644 t\n", out)
+		assert.Equal(t, "M\n2\n3\n4\n5\n6\nT\n", readWorktreeFile(t, r, "f"))
+
+		obj, err := r.ReadObject(mustResolve(t, r, "HEAD"))
+		assert.NoError(t, err)
+		commit := obj.(*objects.Commit)
+		assert.Equal(t, []string{master, topic, other}, commit.KVLM.Parents)
+		assert.Equal(t, "Merge branches 'topic' and 'other'", commit.KVLM.Message)
+	})
+
+	t.Run("OctopusFailed", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		other := commitChange(t, r, master+"~1", "o", "other\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/other", other, "", "branch: Created"))
+
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic", "other"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, "Should not be doing an octopus.\nMerge with strategy octopus failed.\n")
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, "1\n2\nM\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Favor", func(t *testing.T) {
+		for favor, expected := range map[string]string{
+			diff.FavorOurs:   "1\n2\nM\n4\n5\n6\nT\n",
+			diff.FavorTheirs: "1\n2\nT\n4\n5\n6\nT\n",
+		} {
+			r, _, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\nT\n")
+			out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, StrategyOptions: []string{favor}})
+			assert.NoError(t, err, favor)
+			assert.True(t, clean, favor)
+			assert.Contains(t, out, "Merge made by the 'recursive' strategy.\n", favor)
+			assert.Equal(t, expected, readWorktreeFile(t, r, "f"), favor)
+		}
+	})
+
+	t.Run("Renormalize", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\r\n2\r\n3\r\n4\r\n5\r\n6\r\n7\r\n", "1\n2\n3\n4\n5\n6\nT\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		_, _, err = r.Merge(&repository.Merge{Abort: true})
+		assert.NoError(t, err)
+
+		_, clean, err = r.Merge(&repository.Merge{Commits: []string{"topic"}, StrategyOptions: []string{"renormalize"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nT\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		_, _, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, Strategy: "resolve"})
+		assert.EqualError(t, err, "Could not find merge strategy 'resolve'.\nAvailable strategies are: octopus ours recursive subtree.")
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{"topic"}, StrategyOptions: []string{"patience"}})
+		assert.EqualError(t, err, "Unknown option for merge-recursive: -Xpatience")
+	})
+}
+
+func mustResolve(t *testing.T, r *repository.Repository, rev string) string {
+	sha, err := r.ResolveCommit(rev)
+	assert.NoError(t, err)
+	return sha
+}
@@ -0,0 +1,252 @@
+package repository_test
+
+import (
+	"ggit/internal/diff"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMergeRepository returns a repository whose master branch and topic
+// branch both changed file f since their merge base.
+//
+//	base - master
+//	     \ topic
+func newMergeRepository(t *testing.T, master string, topic string) (*repository.Repository, string, string) {
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_AUTHOR_DATE", "1000 +0000")
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	t.Setenv("GGIT_COMMITTER_DATE", "2000 +0000")
+	r := newTestRepository(t)
+
+	writeWorktreeFile(t, r, "f", "1\n2\n3\n4\n5\n6\n7\n")
+	writeWorktreeFile(t, r, "g", "kept\n")
+	base := commitWorktree(t, r, "base", "f", "g")
+
+	writeWorktreeFile(t, r, "f", topic)
+	writeWorktreeFile(t, r, "t", "topic only\n")
+	topicCommit := commitWorktree(t, r, "topic", "f", "t")
+	assert.NoError(t, r.UpdateRef("refs/heads/topic", topicCommit, "", "branch: Created"))
+
+	// Go back to base on master, without a checkout command.
+	assert.NoError(t, r.UpdateRef("refs/heads/master", base, topicCommit, "reset: moving to base"))
+	assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "t")))
+	writeWorktreeFile(t, r, "f", "1\n2\n3\n4\n5\n6\n7\n")
+	assert.NoError(t, r.Add([]string{"f", "t"}))
+	if master == "" {
+		return r, base, topicCommit
+	}
+	writeWorktreeFile(t, r, "f", master)
+	return r, commitWorktree(t, r, "master", "f"), topicCommit
+}
+
+func readIndexStages(t *testing.T, r *repository.Repository, p string) []int {
+	idx, err := r.ReadIndex()
+	assert.NoError(t, err)
+	stages := []int{}
+	for _, e := range idx.Stages(p) {
+		stages = append(stages, e.Stage)
+	}
+	return stages
+}
+
+func TestMerge(t *testing.T) {
+	t.Run("FastForward", func(t *testing.T) {
+		r, base, topic := newMergeRepository(t, "", "1\n2\nT\n4\n5\n6\n7\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Updating "+base[:7]+".."+topic[:7]+"\nFast-forward\n"+
+			" f | 2 +-\n t | 1 +\n 2 files changed, 2 insertions(+), 1 deletion(-)\n create mode 100644 t\n", out)
+
+		head, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, topic, head)
+		assert.Equal(t, "topic only\n", readWorktreeFile(t, r, "t"))
+		entries, err := r.Reflog("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Equal(t, "merge topic: Fast-forward", entries[len(entries)-1].Message)
+
+		out, clean, err = r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Already up to date.\n", out)
+	})
+
+	t.Run("Clean", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Auto-merging f\nMerge made by the 'recursive' strategy.\n"+
+			" f | 2 +-\n t | 1 +\n 2 files changed, 2 insertions(+), 1 deletion(-)\n create mode 100644 t\n", out)
+		assert.Equal(t, "M\n2\n3\n4\n5\n6\nT\n", readWorktreeFile(t, r, "f"))
+
+		head, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		obj, err := r.ReadObject(head)
+		assert.NoError(t, err)
+		commit := obj.(*objects.Commit)
+		assert.Equal(t, []string{master, topic}, commit.KVLM.Parents)
+		assert.Equal(t, "Merge branch 'topic'", commit.KVLM.Message)
+	})
+
+	t.Run("NoFF", func(t *testing.T) {
+		r, base, topic := newMergeRepository(t, "", "1\n2\nT\n4\n5\n6\n7\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, NoFF: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		commit, err := r.ResolveCommit("HEAD")
+		assert.NoError(t, err)
+		parents, err := r.ResolveCommit("HEAD^2")
+		assert.NoError(t, err)
+		assert.Equal(t, topic, parents)
+		assert.NotEqual(t, topic, commit)
+		first, err := r.ResolveCommit("HEAD^1")
+		assert.NoError(t, err)
+		assert.Equal(t, base, first)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, ConflictStyle: diff.ConflictStyleDiff3})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "Auto-merging f\nCONFLICT (content): Merge conflict in f\n"+
+			"Automatic merge failed; fix conflicts and then commit the result.\n", out)
+		assert.Equal(t, "1\n2\n<<<<<<< HEAD\nM\n||||||| "+mergeBaseLabel(t, r, master, topic)+"\n3\n=======\nT\n>>>>>>> topic\n4\n5\n6\n7\n",
+			readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{index.StageBase, index.StageOurs, index.StageTheirs}, readIndexStages(t, r, "f"))
+		assert.Equal(t, []int{index.StageMerged}, readIndexStages(t, r, "t"))
+
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.EqualError(t, err, "You have not concluded your merge (MERGE_HEAD exists).\nPlease, commit your changes before you merge.")
+		_, _, err = r.Merge(&repository.Merge{Continue: true})
+		assert.EqualError(t, err, "Committing is not possible because you have unmerged files.")
+
+		writeWorktreeFile(t, r, "f", "resolved\n")
+		assert.NoError(t, r.Add([]string{"f"}))
+		out, clean, err = r.Merge(&repository.Merge{Continue: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		head, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "[master "+head[:7]+"] Merge branch 'topic'\n", out)
+		obj, err := r.ReadObject(head)
+		assert.NoError(t, err)
+		commit := obj.(*objects.Commit)
+		assert.Equal(t, []string{master, topic}, commit.KVLM.Parents)
+		assert.Equal(t, "Merge branch 'topic'", commit.KVLM.Message)
+
+		_, _, err = r.Merge(&repository.Merge{Continue: true})
+		assert.EqualError(t, err, "There is no merge in progress (MERGE_HEAD missing).")
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		writeWorktreeFile(t, r, "g", "local change\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+
+		_, _, err = r.Merge(&repository.Merge{Abort: true})
+		assert.NoError(t, err)
+		head, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, master, head)
+		assert.Equal(t, "1\n2\nM\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "local change\n", readWorktreeFile(t, r, "g"), "untouched local changes are kept")
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, "t"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		assert.Equal(t, []int{index.StageMerged}, readIndexStages(t, r, "f"))
+
+		_, _, err = r.Merge(&repository.Merge{Abort: true})
+		assert.EqualError(t, err, "There is no merge to abort (MERGE_HEAD missing).")
+	})
+
+	t.Run("Squash", func(t *testing.T) {
+		r, master, topic := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}, Squash: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Auto-merging f\nAutomatic merge went well; stopped before committing as requested\n"+
+			"Squash commit -- not updating HEAD\n", out)
+		head, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, master, head)
+
+		message, err := afero.ReadFile(r.FS, filepath.Join(r.Gitdir, "SQUASH_MSG"))
+		assert.NoError(t, err)
+		assert.Equal(t, "Squashed commit of the following:\n\ncommit "+topic+"\n"+
+			"Author: A U Thor <author@example.com>\nDate:   Thu Jan 1 00:16:40 1970 +0000\n\n    topic\n", string(message))
+
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{"topic"}, Squash: true, NoFF: true})
+		assert.EqualError(t, err, "You cannot combine --squash with --no-ff.")
+	})
+
+	t.Run("LocalChanges", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "M\n2\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\n6\nT\n")
+		writeWorktreeFile(t, r, "f", "dirty\n")
+		_, _, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.EqualError(t, err, "Your local changes to the following files would be overwritten by merge:\n\tf\n"+
+			"Please commit your changes or stash them before you merge.\nAborting")
+
+		assert.NoError(t, r.Add([]string{"f"}))
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.ErrorContains(t, err, "Your local changes to the following files would be overwritten by merge")
+
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{"topic"}, ConflictStyle: "fancy"})
+		assert.EqualError(t, err, "unknown conflict style 'fancy'")
+	})
+
+	t.Run("ModifyDelete", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "g")))
+		commitWorktree(t, r, "remove g", "g")
+		assert.NoError(t, r.UpdateRef("refs/heads/other", commitChange(t, r, "topic", "g", "changed\n"), "", "branch: Created"))
+
+		out, clean, err := r.Merge(&repository.Merge{Commits: []string{"other"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, "CONFLICT (modify/delete): g deleted in HEAD and modified in other.  Version other of g left in tree.\n")
+		assert.Equal(t, "changed\n", readWorktreeFile(t, r, "g"))
+		assert.Equal(t, []int{index.StageBase, index.StageTheirs}, readIndexStages(t, r, "g"))
+	})
+}
+
+// mergeBaseLabel returns the label of the merge base of two commits in
+// conflict markers.
+func mergeBaseLabel(t *testing.T, r *repository.Repository, a string, b string) string {
+	bases, err := r.MergeBases(a, b)
+	assert.NoError(t, err)
+	return bases[0][:7]
+}
+
+// commitChange commits on top of the commit rev a version of its tree
+// where the file p has the given content.
+func commitChange(t *testing.T, r *repository.Repository, rev string, p string, data string) string {
+	parent, err := r.ResolveCommit(rev)
+	assert.NoError(t, err)
+	tree, err := r.ResolveRevision(rev + "^{tree}")
+	assert.NoError(t, err)
+	obj, err := r.ReadObject(tree)
+	assert.NoError(t, err)
+	entries := []objects.TreeEntry{}
+	for _, e := range obj.(*objects.Tree).Entries {
+		if e.Name != p {
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, objects.TreeEntry{Mode: objects.ModeFile, Name: p, Hash: writeBlob(t, r, data)})
+	sha, err := r.CommitTree(writeTree(t, r, entries...), []string{parent}, "change "+p)
+	assert.NoError(t, err)
+	return sha
+}
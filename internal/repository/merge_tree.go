@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"ggit/internal/index"
+	"slices"
+	"strings"
+)
+
+type MergeTree struct {
+	Branch1    string
+	Branch2    string
+	NameOnly   bool
+	Messages   bool
+	NoMessages bool
+	// NullTerminated separates the output with NUL characters, listing the
+	// paths of each message, as -z does.
+	NullTerminated bool
+	AllowUnrelated bool
+}
+
+// MergeTree merges two commits in the object database only, leaving the
+// index, the worktree and the refs alone. The merged tree is written with
+// the conflicted files holding conflict markers.
+//
+// Returns:
+//   - The ID of the merged tree, then the conflicted files as
+//     "<mode> <object> <stage>\t<path>" lines, or only their paths with
+//     NameOnly, then an empty line and the messages of the merge. The
+//     messages are shown when there are conflicts, or as told by Messages
+//     and NoMessages.
+//   - Whether the merge is clean.
+//   - An error if a commit can not be resolved or the histories are
+//     unrelated.
+func (r *Repository) MergeTree(opts *MergeTree) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	ours, err := r.ResolveCommit(opts.Branch1)
+	if err != nil {
+		return "", false, err
+	}
+	theirs, err := r.ResolveCommit(opts.Branch2)
+	if err != nil {
+		return "", false, err
+	}
+	if !opts.AllowUnrelated {
+		bases, err := r.MergeBases(ours, theirs)
+		if err != nil {
+			return "", false, err
+		}
+		if len(bases) == 0 {
+			return "", false, fmt.Errorf("refusing to merge unrelated histories")
+		}
+	}
+	style, err := r.conflictStyle("")
+	if err != nil {
+		return "", false, err
+	}
+	m := r.newTreeMerge(opts.Branch1, opts.Branch2, style)
+	if err := r.mergeCommits(m, ours, theirs); err != nil {
+		return "", false, err
+	}
+	tree, err := r.writeFiles(m.files)
+	if err != nil {
+		return "", false, err
+	}
+
+	end := "\n"
+	if opts.NullTerminated {
+		end = "\x00"
+	}
+	clean := len(m.conflicts) == 0
+	var b strings.Builder
+	b.WriteString(tree + end)
+	if opts.NameOnly {
+		for _, p := range m.conflicts {
+			b.WriteString(p + end)
+		}
+	} else {
+		stages := slices.Clone(m.stages)
+		slices.SortStableFunc(stages, func(a, b index.Entry) int {
+			return cmp.Or(strings.Compare(a.Path, b.Path), a.Stage-b.Stage)
+		})
+		for _, e := range stages {
+			fmt.Fprintf(&b, "%s %s %d\t%s%s", e.Mode, e.Hash, e.Stage, e.Path, end)
+		}
+	}
+	if opts.Messages || (!clean && !opts.NoMessages) {
+		b.WriteString(end)
+		for _, n := range m.notes {
+			if !opts.NullTerminated {
+				b.WriteString(n.message + "\n")
+				continue
+			}
+			fmt.Fprintf(&b, "%d\x00", len(n.paths))
+			for _, p := range n.paths {
+				b.WriteString(p + "\x00")
+			}
+			b.WriteString(n.kind + "\x00" + n.message + "\n\x00")
+		}
+	}
+	return b.String(), clean, nil
+}
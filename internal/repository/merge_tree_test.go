@@ -0,0 +1,209 @@
+package repository_test
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seq returns the lines of the numbers from first to last, like seq(1).
+func seq(first int, last int) string {
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+// commitFiles commits a tree of the files, by their names, on top of the
+// parents.
+func commitFiles(t *testing.T, r *repository.Repository, files map[string]string, parents ...string) string {
+	entries := []objects.TreeEntry{}
+	for name, data := range files {
+		entries = append(entries, objects.TreeEntry{Mode: objects.ModeFile, Name: name, Hash: writeBlob(t, r, data)})
+	}
+	sha, err := r.CommitTree(writeTree(t, r, entries...), parents, "files")
+	assert.NoError(t, err)
+	return sha
+}
+
+func TestMergeTree(t *testing.T) {
+	t.Run("Conflict", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\n2\nM\n4\n5\n6\n7\n", "1\n2\nT\n4\n5\n6\n7\n")
+		before, err := r.ReadIndex()
+		assert.NoError(t, err)
+
+		out, clean, err := r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: "topic"})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		lines := strings.Split(out, "\n")
+		tree := lines[0]
+		assert.Len(t, lines, 8)
+		for i, stage := range []int{1, 2, 3} {
+			assert.Regexp(t, fmt.Sprintf("^100644 [0-9a-f]{40} %d\tf$", stage), lines[i+1])
+		}
+		assert.Equal(t, []string{"", "Auto-merging f", "CONFLICT (content): Merge conflict in f", ""}, lines[4:])
+
+		obj, err := r.ReadObject(tree)
+		assert.NoError(t, err)
+		entry, ok := obj.(*objects.Tree).Entry("f")
+		assert.True(t, ok)
+		blob, err := r.ReadObject(entry.Hash)
+		assert.NoError(t, err)
+		assert.Equal(t, "1\n2\n<<<<<<< master\nM\n=======\nT\n>>>>>>> topic\n4\n5\n6\n7\n", string(blob.Serialize()))
+
+		after, err := r.ReadIndex()
+		assert.NoError(t, err)
+		assert.Equal(t, before, after, "the index is left alone")
+		assert.Equal(t, "1\n2\nM\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+
+		out, _, err = r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: "topic", NameOnly: true, NoMessages: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tree+"\nf\n", out)
+
+		out, _, err = r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: "topic", NameOnly: true, NullTerminated: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tree+"\x00f\x00\x00"+
+			"1\x00f\x00Auto-merging\x00Auto-merging f\n\x00"+
+			"1\x00f\x00CONFLICT (contents)\x00CONFLICT (content): Merge conflict in f\n\x00", out)
+	})
+
+	t.Run("Clean", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\n2\n3\n4\n5\nT\n7\n")
+		out, clean, err := r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: "topic"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		tree := strings.TrimSuffix(out, "\n")
+		files, err := r.DiffTree(&repository.DiffTree{From: "master", To: tree, Formats: []string{repository.DiffFormatNameStatus}})
+		assert.NoError(t, err)
+		assert.Equal(t, "M\tf\nA\tt\n", files)
+
+		out, _, err = r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: "topic", Messages: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tree+"\n\nAuto-merging f\n", out)
+	})
+
+	t.Run("FileDirectory", func(t *testing.T) {
+		r, base, _ := newMergeRepository(t, "", "T\n")
+		master := commitChange(t, r, base, "g", "changed\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", master, base, "commit: change g"))
+		dir := writeTree(t, r, objects.TreeEntry{Mode: objects.ModeFile, Name: "x", Hash: writeBlob(t, r, "x\n")})
+		tree := writeTree(t, r,
+			objects.TreeEntry{Mode: objects.ModeFile, Name: "f", Hash: writeBlob(t, r, "1\n2\n3\n4\n5\n6\n7\n")},
+			objects.TreeEntry{Mode: objects.ModeTree, Name: "g", Hash: dir},
+		)
+		topic, err := r.CommitTree(tree, []string{base}, "directory g")
+		assert.NoError(t, err)
+
+		notes := "CONFLICT (file/directory): directory in the way of g from master; moving it to g~master instead.\n" +
+			"CONFLICT (modify/delete): g~master deleted in " + topic + " and modified in master.  Version master of g~master left in tree.\n"
+		out, clean, err := r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: topic})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		lines := strings.SplitN(out, "\n", 2)
+		assert.Equal(t, "100644 "+writeBlob(t, r, "kept\n")+" 1\tg~master\n"+
+			"100644 "+writeBlob(t, r, "changed\n")+" 2\tg~master\n\n"+notes, lines[1])
+
+		obj, err := r.ReadObject(lines[0])
+		assert.NoError(t, err)
+		entry, ok := obj.(*objects.Tree).Entry("g~master")
+		assert.True(t, ok)
+		assert.Equal(t, writeBlob(t, r, "changed\n"), entry.Hash)
+	})
+
+	// The trees and messages are git merge-tree's for the same files.
+	t.Run("Renames", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "T\n")
+		base := commitFiles(t, r, map[string]string{"f": seq(1, 20), "g": seq(101, 120), "h": seq(201, 220), "k": seq(301, 320)})
+		ours := commitFiles(t, r, map[string]string{
+			"f2": seq(1, 20),
+			"g2": seq(101, 120),
+			"h2": seq(201, 220),
+			"k2": strings.Replace(seq(301, 320), "305\n", "305o\n", 1),
+		}, base)
+		theirs := commitFiles(t, r, map[string]string{
+			"f":  strings.Replace(seq(1, 20), "\n2\n", "\n2t\n", 1),
+			"h3": seq(201, 220),
+			"k":  strings.Replace(seq(301, 320), "318\n", "318t\n", 1),
+		}, base)
+		assert.NoError(t, r.UpdateRef("refs/heads/ours", ours, "", "branch: Created"))
+		assert.NoError(t, r.UpdateRef("refs/heads/theirs", theirs, "", "branch: Created"))
+		g, h := writeBlob(t, r, seq(101, 120)), writeBlob(t, r, seq(201, 220))
+
+		out, clean, err := r.MergeTree(&repository.MergeTree{Branch1: "ours", Branch2: "theirs"})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "4388ebfb460781595a1a807fa6e0cc197261d7be\n"+
+			"100644 "+g+" 1\tg2\n"+
+			"100644 "+g+" 2\tg2\n"+
+			"100644 "+h+" 1\th\n"+
+			"100644 "+h+" 2\th2\n"+
+			"100644 "+h+" 3\th3\n"+
+			"\n"+
+			"CONFLICT (rename/delete): g renamed to g2 in ours, but deleted in theirs.\n"+
+			"CONFLICT (rename/rename): h renamed to h2 in ours and to h3 in theirs.\n"+
+			"Auto-merging k2\n", out)
+
+		out, _, err = r.MergeTree(&repository.MergeTree{Branch1: "theirs", Branch2: "ours", NameOnly: true, NullTerminated: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "4388ebfb460781595a1a807fa6e0cc197261d7be\x00g2\x00h\x00h2\x00h3\x00\x00"+
+			"2\x00g2\x00g\x00CONFLICT (rename/delete)\x00CONFLICT (rename/delete): g renamed to g2 in ours, but deleted in theirs.\n\x00"+
+			"3\x00h\x00h3\x00h2\x00CONFLICT (rename/rename)\x00CONFLICT (rename/rename): h renamed to h3 in theirs and to h2 in ours.\n\x00"+
+			"1\x00k2\x00Auto-merging\x00Auto-merging k2\n\x00", out)
+	})
+
+	t.Run("RenameConflicts", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "T\n")
+		base := commitFiles(t, r, map[string]string{"g": seq(101, 120), "h": seq(201, 220), "k": seq(301, 320)})
+		ours := commitFiles(t, r, map[string]string{
+			"gx": strings.Replace(seq(101, 120), "110\n", "110o\n", 1),
+			"hx": strings.Replace(seq(201, 220), "210\n", "210o\n", 1),
+			"k2": strings.Replace(seq(301, 320), "310\n", "310o\n", 1),
+		}, base)
+		theirs := commitFiles(t, r, map[string]string{
+			"hq": strings.Replace(seq(201, 220), "210\n", "210t\n", 1),
+			"k":  strings.Replace(seq(301, 320), "310\n", "310t\n", 1),
+		}, base)
+		assert.NoError(t, r.UpdateRef("refs/heads/ours", ours, "", "branch: Created"))
+		assert.NoError(t, r.UpdateRef("refs/heads/theirs", theirs, "", "branch: Created"))
+
+		out, clean, err := r.MergeTree(&repository.MergeTree{Branch1: "ours", Branch2: "theirs"})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		lines := strings.Split(out, "\n")
+		assert.Equal(t, []string{
+			"CONFLICT (rename/delete): g renamed to gx in ours, but deleted in theirs.",
+			"CONFLICT (modify/delete): gx deleted in theirs and modified in ours.  Version ours of gx left in tree.",
+			"Auto-merging h",
+			"CONFLICT (rename/rename): h renamed to hx in ours and to hq in theirs.",
+			"Auto-merging k2",
+			"CONFLICT (content): Merge conflict in k2",
+			"",
+		}, lines[10:])
+
+		obj, err := r.ReadObject(lines[0])
+		assert.NoError(t, err)
+		tree := obj.(*objects.Tree)
+		hx, _ := tree.Entry("hx")
+		hq, _ := tree.Entry("hq")
+		assert.Equal(t, hx.Hash, hq.Hash)
+		blob, err := r.ReadObject(hx.Hash)
+		assert.NoError(t, err)
+		assert.Contains(t, string(blob.Serialize()), "209\n<<<<<<<< ours:hx\n210o\n========\n210t\n>>>>>>>> theirs:hq\n211\n")
+		k2, _ := tree.Entry("k2")
+		blob, err = r.ReadObject(k2.Hash)
+		assert.NoError(t, err)
+		assert.Contains(t, string(blob.Serialize()), "309\n<<<<<<< ours:k2\n310o\n=======\n310t\n>>>>>>> theirs:k\n311\n")
+	})
+
+	t.Run("Unrelated", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "T\n")
+		orphan := writeCommit(t, r, 3000)
+		_, _, err := r.MergeTree(&repository.MergeTree{Branch1: "master", Branch2: orphan})
+		assert.EqualError(t, err, "refusing to merge unrelated histories")
+	})
+}
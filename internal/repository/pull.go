@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Pull struct {
+	// Remote is the name of a remote, or the path or file:// URL of a
+	// repository. The remote of the current branch, or origin, when empty.
+	Remote string
+	// Refspecs name the refs to merge instead of the upstream branch of the
+	// current branch.
+	Refspecs []string
+	NoFF     bool
+}
+
+// Pull fetches from another repository, like Fetch, then merges the
+// fetched refs marked for merging into the current branch: the upstream
+// branch of the current branch, branch.<name>.merge, or the refs the
+// refspecs name.
+//
+// Returns:
+//   - The reports of the fetch and of the merge.
+//   - Whether the fetch and the merge completed cleanly.
+//   - An error if the fetch fails, there is nothing to merge or the merge
+//     can not start.
+func (r *Repository) Pull(opts *Pull) (string, bool, error) {
+	out, clean, fetched, err := r.fetch(&Fetch{Remote: opts.Remote, Refspecs: opts.Refspecs})
+	if err != nil || !clean {
+		return out, clean, err
+	}
+	name := opts.Remote
+	if name == "" {
+		name = r.defaultRemoteName()
+	}
+	url, _ := r.remoteURL(name)
+
+	commits, names := []string{}, []string{}
+	for _, f := range fetched {
+		if f.merge {
+			commits = append(commits, f.sha)
+			if d := f.describe(); d != "" {
+				names = append(names, d)
+			}
+		}
+	}
+	if len(commits) == 0 {
+		return "", false, fmt.Errorf("There is no tracking information for the current branch.\n" +
+			"Please specify which branch you want to merge with.")
+	}
+	message := "Merge " + url
+	if len(names) > 0 {
+		message = "Merge " + strings.Join(names, ", ") + " of " + url
+	}
+	merged, clean, err := r.Merge(&Merge{Commits: commits, NoFF: opts.NoFF, Message: message + r.mergeDestination()})
+	if err != nil {
+		return "", false, err
+	}
+	return out + merged, clean, nil
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPull(t *testing.T) {
+	t.Run("FastForward", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, src, "master", "NEWS", "news\n")
+		assert.NoError(t, src.UpdateRef("refs/heads/master", next, head, "commit: news"))
+
+		out, clean, err := r.Pull(&repository.Pull{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, "Fast-forward\n")
+		assert.Equal(t, next, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, "news\n", readWorktreeFile(t, r, "NEWS"))
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, src, "master", "NEWS", "news\n")
+		assert.NoError(t, src.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		writeWorktreeFile(t, r, "local", "local\n")
+		local := commitWorktree(t, r, "local", "local")
+
+		_, clean, err := r.Pull(&repository.Pull{Remote: "origin", Refspecs: []string{"master"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		commit := mustReadCommit(t, r, "HEAD")
+		assert.Equal(t, []string{local, next}, commit.KVLM.Parents)
+		assert.Equal(t, "Merge branch 'master' of /src", commit.KVLM.Message)
+		assert.Equal(t, next, mustResolve(t, r, "refs/remotes/origin/master"))
+	})
+
+	t.Run("NoUpstream", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		writeConfigFile(t, r, "/dst/.ggit/config", "[remote \"origin\"]\n\turl = /src\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n")
+		_, _, err := r.Pull(&repository.Pull{})
+		assert.EqualError(t, err, "There is no tracking information for the current branch.\nPlease specify which branch you want to merge with.")
+	})
+}
@@ -0,0 +1,635 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Push struct {
+	// Remote is the name of a remote, or the path or file:// URL of a
+	// repository. The push remote of the current branch, remote.pushDefault,
+	// or the remote of the current branch when empty.
+	Remote string
+	// Refspecs map local refs or revisions to the refs of the remote. The
+	// current branch is pushed when empty.
+	Refspecs []string
+	// Force allows every update that is no fast-forward, like a refspec
+	// starting with "+".
+	Force bool
+	// ForceWithLease allows the update of a ref that is no fast-forward as
+	// long as the ref of the remote is at the expected value: "<ref>:<expect>",
+	// an empty expect requiring the ref not to exist, or "<ref>", expecting
+	// the value of its remote-tracking branch.
+	ForceWithLease []string
+	// Delete deletes the refs the refspecs name from the remote.
+	Delete bool
+	// Tags pushes all the tags, in addition to the refspecs.
+	Tags bool
+	// Atomic updates either all the refs of the remote or none.
+	Atomic   bool
+	NoVerify bool
+}
+
+// pushedRef is an update of a ref of a remote a push asks for.
+type pushedRef struct {
+	// local is the ref or the revision pushed, empty for a deletion.
+	local string
+	// sha is the object pushed, empty for a deletion.
+	sha string
+	// remote is the full name of the ref of the remote.
+	remote string
+	// old is the object the ref of the remote is at, empty when it does
+	// not exist.
+	old   string
+	force bool
+	// lease marks the updates allowed as long as the ref of the remote is
+	// at expect.
+	lease  bool
+	expect string
+	// forced marks the updates allowed that are no fast-forward.
+	forced bool
+	// rejected is why the update is rejected, as the report words it.
+	rejected string
+	// remoteRejected marks the updates the remote, rather than the push,
+	// rejects.
+	remoteRejected bool
+}
+
+// pushRemoteName returns the remote the current branch is pushed to:
+// branch.<name>.pushRemote, remote.pushDefault, or the remote it is
+// fetched from.
+func (r *Repository) pushRemoteName() string {
+	if branch := r.branchName(); branch != "" {
+		if name := r.Config.Get("branch."+branch, "pushremote"); name != "" {
+			return name
+		}
+	}
+	if name := r.Config.Get("remote", "pushdefault"); name != "" {
+		return name
+	}
+	return r.defaultRemoteName()
+}
+
+// pushURL returns the URL the remote name is pushed to, or name itself
+// when no remote of that name is configured, rewritten by
+// url.<base>.pushInsteadOf or url.<base>.insteadOf.
+//
+// Returns:
+//   - The URL.
+//   - Whether name is a configured remote.
+func (r *Repository) pushURL(name string) (string, bool) {
+	if remote := r.Remote(name); remote != nil && len(remote.PushURLs) > 0 {
+		return remote.PushURLs[0], true
+	}
+	return r.rewriteURL(name, true), false
+}
+
+// Push sends the objects the refs pushed need that another repository does
+// not have, then updates its refs. The refspecs map local refs, or any
+// revision, to the refs of the remote; a refspec without a destination
+// pushes a ref to the ref of the same name, and an empty source deletes
+// the destination. Without refspecs, remote.<name>.push or the current
+// branch, to its upstream branch, are pushed.
+//
+// A ref is only updated if that is a fast-forward, unless the refspec
+// starts with "+" or opts.Force is set, or the lease of the ref holds. Tags
+// are never updated, and the branch checked out in the remote is left
+// alone. Each ref is only updated if it is still at the value it was
+// checked at; the refs that can not be updated are reported as rejected.
+// With opts.Atomic, no ref is updated if one of them is rejected.
+// The pre-push hook gets the remote and its URL as arguments, and the
+// updates on its standard input; it can refuse the push. The
+// remote-tracking branches of the refs updated are updated too.
+//
+// Returns:
+//   - The report of the updated refs.
+//   - Whether all the refs could be updated.
+//   - An error if the remote can not be read or the objects not sent, or
+//     a refspec does not match.
+func (r *Repository) Push(opts *Push) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	if opts.Delete && opts.Tags {
+		return "", false, fmt.Errorf("--delete is incompatible with --tags")
+	}
+	if opts.Delete && len(opts.Refspecs) == 0 {
+		return "", false, fmt.Errorf("--delete doesn't make sense without any refs")
+	}
+	name := opts.Remote
+	if name == "" {
+		name = r.pushRemoteName()
+	}
+	url, configured := r.pushURL(name)
+	remote, err := r.openRemote(url)
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.checkObjectFormat(remote); err != nil {
+		return "", false, err
+	}
+	refs, err := remote.remoteRefs()
+	if err != nil {
+		return "", false, err
+	}
+	pushed, err := r.pushedRefs(name, configured, refs, opts)
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.applyLeases(name, pushed, opts.ForceWithLease); err != nil {
+		return "", false, err
+	}
+	for i := range pushed {
+		if err := r.checkPushedRef(remote, &pushed[i]); err != nil {
+			return "", false, err
+		}
+	}
+
+	var b strings.Builder
+	rejected := slices.ContainsFunc(pushed, func(p pushedRef) bool { return p.rejected != "" })
+	if rejected && opts.Atomic {
+		for i := range pushed {
+			if pushed[i].rejected == "" && pushed[i].sha != pushed[i].old {
+				pushed[i].rejected = "atomic push failed"
+			}
+		}
+	}
+	sent := []*pushedRef{}
+	for i, p := range pushed {
+		if p.rejected == "" && p.sha != p.old {
+			sent = append(sent, &pushed[i])
+		}
+	}
+	if len(sent) > 0 && !opts.NoVerify {
+		if err := r.prePushHook(&b, name, url, sent); err != nil {
+			var failed *HookError
+			if !errors.As(err, &failed) {
+				return "", false, err
+			}
+			b.WriteString("error: failed to push some refs to '" + url + "'\n")
+			return b.String(), false, nil
+		}
+	}
+
+	tips := []string{}
+	for _, p := range sent {
+		if p.sha != "" {
+			tips = append(tips, p.sha)
+		}
+	}
+	if err := remote.fetchObjects(r, tips); err != nil {
+		return "", false, err
+	}
+	rollback := remote.storePushedRefs(sent, opts.Atomic)
+	if configured {
+		for _, p := range sent {
+			if p.rejected != "" {
+				continue
+			}
+			if err := r.storePushTrackingRef(name, p); err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	rejected = slices.ContainsFunc(pushed, func(p pushedRef) bool { return p.rejected != "" })
+	var report strings.Builder
+	for _, p := range pushed {
+		if line := p.describe(); strings.HasPrefix(line, "error: ") {
+			b.WriteString(line)
+		} else {
+			report.WriteString(line)
+		}
+	}
+	switch {
+	case report.Len() > 0:
+		b.WriteString("To " + url + "\n" + report.String())
+	case !rejected:
+		b.WriteString("Everything up-to-date\n")
+	}
+	b.WriteString(rollback)
+	if rejected {
+		b.WriteString("error: failed to push some refs to '" + url + "'\n")
+		b.WriteString(pushHints(pushed))
+	}
+	return b.String(), !rejected, nil
+}
+
+// pushedRefs lists the updates the refspecs ask for, the tags with
+// opts.Tags, or the default ones. Negative refspecs leave refs out of the
+// ones globs match.
+func (r *Repository) pushedRefs(name string, configured bool, refs map[string]string, opts *Push) ([]pushedRef, error) {
+	specs := slices.Clone(opts.Refspecs)
+	if opts.Delete {
+		for i, spec := range specs {
+			if strings.ContainsAny(spec, ":^+*") {
+				return nil, fmt.Errorf("--delete only accepts plain target ref names")
+			}
+			specs[i] = ":" + spec
+		}
+	}
+	if opts.Tags {
+		specs = append(specs, "refs/tags/*:refs/tags/*")
+	} else if len(specs) == 0 {
+		defaults, err := r.defaultPushRefspecs(name, configured)
+		if err != nil {
+			return nil, err
+		}
+		specs = defaults
+	}
+	parsed, err := parseRefspecs(specs, false)
+	if err != nil {
+		return nil, err
+	}
+	locals, err := r.listRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	pushed := []pushedRef{}
+	seen := map[string]bool{}
+	add := func(p pushedRef) {
+		if !seen[p.remote] {
+			seen[p.remote] = true
+			p.old = refs[p.remote]
+			pushed = append(pushed, p)
+		}
+	}
+	for _, s := range parsed {
+		if s.Negative {
+			continue
+		}
+		force := s.Force || opts.Force
+		if s.IsGlob() {
+			for _, ref := range locals {
+				dst, ok := s.Match(ref)
+				if !ok || excludedRef(parsed, ref) {
+					continue
+				}
+				sha, err := r.ResolveRef(ref)
+				if err != nil {
+					return nil, err
+				}
+				add(pushedRef{local: ref, sha: sha, remote: dst, force: force})
+			}
+			continue
+		}
+		p, err := r.pushedRef(s, refs)
+		if err != nil {
+			return nil, err
+		}
+		p.force = force
+		add(p)
+	}
+	return pushed, nil
+}
+
+// defaultPushRefspecs returns the refspecs pushed when none are given:
+// remote.<name>.push, or the current branch, to its upstream branch when
+// it is fetched from the same remote.
+func (r *Repository) defaultPushRefspecs(name string, configured bool) ([]string, error) {
+	if configured {
+		if specs := r.Config.GetAll("remote."+name, "push"); len(specs) > 0 {
+			return specs, nil
+		}
+	}
+	branch := r.branchName()
+	if branch == "" {
+		return nil, fmt.Errorf("You are not currently on a branch.")
+	}
+	spec := "refs/heads/" + branch
+	if merge := r.Config.Get("branch."+branch, "merge"); merge != "" && r.Config.Get("branch."+branch, "remote") == name {
+		spec += ":" + merge
+	}
+	return []string{spec}, nil
+}
+
+// pushedRef resolves a refspec without a glob into the update it asks for.
+// The source is a local ref, HEAD standing for the current branch, or a
+// revision; a destination that is no full ref name is looked up among the
+// refs of the remote, or taken to be a branch or a tag like the source.
+func (r *Repository) pushedRef(s *Refspec, refs map[string]string) (pushedRef, error) {
+	p := pushedRef{}
+	if s.Src != "" {
+		src := s.Src
+		if src == headFile || src == "@" {
+			if branch, err := r.SymbolicRef(headFile); err == nil {
+				src = branch
+			}
+		}
+		if full, sha, err := r.DwimRef(src); err == nil {
+			p.local, p.sha = full, sha
+		} else if sha, err := r.ResolveRevision(src); err == nil {
+			p.local, p.sha = s.Src, sha
+		} else {
+			return p, fmt.Errorf("src refspec %s does not match any", s.Src)
+		}
+	}
+
+	p.remote = s.Dst
+	switch {
+	case p.remote == "" && strings.HasPrefix(p.local, "refs/"):
+		p.remote = p.local
+	case p.remote == "":
+		return p, fmt.Errorf("The destination you provided is not a full refname (i.e., starting with \"refs/\") in '%s'", s)
+	case strings.HasPrefix(p.remote, "refs/"):
+	default:
+		if full, ok := dwimRemoteRef(p.remote, refs); ok && full != headFile {
+			p.remote = full
+		} else if p.sha == "" {
+			// The report tells about deleting a ref that does not exist.
+		} else if strings.HasPrefix(p.local, "refs/heads/") || strings.HasPrefix(p.local, "refs/tags/") {
+			p.remote = p.local[:strings.Index(p.local[5:], "/")+6] + p.remote
+		} else {
+			return p, fmt.Errorf("The destination you provided is not a full refname (i.e., starting with \"refs/\") in '%s'", s)
+		}
+	}
+	return p, nil
+}
+
+// applyLeases marks the updates of the refs the leases name, "<ref>" or
+// "<ref>:<expect>", as allowed when the ref of the remote is at the value
+// expected: the revision expect, no ref when it is empty, or the
+// remote-tracking branch of the ref.
+//
+// Returns:
+//   - An error if a lease is malformed or expects an unknown revision.
+func (r *Repository) applyLeases(name string, pushed []pushedRef, leases []string) error {
+	for _, lease := range leases {
+		ref, expect, explicit := strings.Cut(lease, ":")
+		if ref == "" {
+			return fmt.Errorf("cannot parse lease '%s'", lease)
+		}
+		sha := ""
+		if len(expect) == r.ObjectFormat().HexSize() && isHex(expect) {
+			// The value expected does not have to be known locally.
+			sha = strings.ToLower(expect)
+		} else if explicit && expect != "" {
+			var err error
+			if sha, err = r.ResolveRevision(expect); err != nil {
+				return fmt.Errorf("cannot parse expected object name '%s'", expect)
+			}
+		}
+		for i := range pushed {
+			p := &pushed[i]
+			if !slices.ContainsFunc(refRules(), func(rule string) bool { return fmt.Sprintf(rule, ref) == p.remote }) {
+				continue
+			}
+			p.lease, p.expect = true, sha
+			if !explicit {
+				p.expect = ""
+				if tracking := r.pushTrackingRef(name, p.remote); tracking != "" {
+					p.expect, _ = r.ResolveRef(tracking)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkPushedRef notes why an update is rejected, if it is: a lease that
+// does not hold, a tag that already exists, an update that is no
+// fast-forward, or the branch checked out in the remote.
+func (r *Repository) checkPushedRef(remote *Repository, p *pushedRef) error {
+	if p.sha == p.old {
+		if p.sha == "" {
+			p.rejected = "remote ref does not exist"
+		}
+		return nil
+	}
+	if p.lease {
+		if p.old != p.expect {
+			p.rejected = "stale info"
+			return nil
+		}
+		p.force = true
+	}
+	if p.old != "" && p.sha != "" {
+		ff := false
+		if r.Objects.Has(p.old) {
+			var err error
+			if ff, err = r.IsAncestor(p.old, p.sha); err != nil {
+				ff = false
+			}
+		}
+		switch {
+		case p.force:
+			p.forced = !ff
+		case strings.HasPrefix(p.remote, "refs/tags/"):
+			p.rejected = "already exists"
+		case !r.Objects.Has(p.old):
+			p.rejected = "fetch first"
+		case !ff:
+			p.rejected = "non-fast-forward"
+		}
+		if p.rejected != "" {
+			return nil
+		}
+	}
+	if head, err := remote.SymbolicRef(headFile); err == nil && head == p.remote && !remote.IsBare() {
+		switch strings.ToLower(remote.Config.Get("receive", "denycurrentbranch")) {
+		case "ignore", "warn", "false":
+		default:
+			p.remoteRejected = true
+			p.rejected = "branch is currently checked out"
+			if p.sha == "" {
+				p.rejected = "deletion of the current branch prohibited"
+			}
+		}
+	}
+	return nil
+}
+
+// prePushHook runs the pre-push hook with the remote and its URL, and the
+// "<local ref> <local sha> <remote ref> <remote sha>" lines of the updates
+// on its standard input.
+//
+// Returns:
+//   - A *HookError if the hook refuses the push.
+func (r *Repository) prePushHook(b *strings.Builder, name string, url string, sent []*pushedRef) error {
+	var stdin strings.Builder
+	null := r.ObjectFormat().NullID()
+	for _, p := range sent {
+		local, sha, old := p.local, p.sha, p.old
+		if sha == "" {
+			local, sha = "(delete)", null
+		}
+		if old == "" {
+			old = null
+		}
+		fmt.Fprintf(&stdin, "%s %s %s %s\n", local, sha, p.remote, old)
+	}
+	out, _, err := r.RunHook(&Hook{Name: "pre-push", Args: []string{name, url}, Stdin: stdin.String()})
+	b.WriteString(out)
+	return err
+}
+
+// storePushedRefs updates the refs of the repository a push sent, each
+// only if it is still at the value the push was checked against, and
+// notes why the updates that fail are rejected. With atomic, all the refs
+// are checked before any is written, and the refs already updated are put
+// back when one can not be.
+//
+// Returns:
+//   - The errors about the refs that could not be put back.
+func (r *Repository) storePushedRefs(sent []*pushedRef, atomic bool) string {
+	for _, p := range sent {
+		if current, err := r.ResolveRef(p.remote); current != p.old || (err != nil && !errors.Is(err, ErrorRefNotFound)) {
+			p.remoteRejected, p.rejected = true, "failed to update ref"
+		}
+	}
+	if atomic && slices.ContainsFunc(sent, func(p *pushedRef) bool { return p.rejected != "" }) {
+		failTransaction(sent)
+		return ""
+	}
+	var b strings.Builder
+	done := []*pushedRef{}
+	for _, p := range sent {
+		if p.rejected != "" {
+			continue
+		}
+		if err := r.movePushedRef(p.remote, p.old, p.sha, "push"); err != nil {
+			p.remoteRejected, p.rejected = true, "failed to update ref"
+			if !atomic {
+				continue
+			}
+			for _, d := range slices.Backward(done) {
+				if err := r.movePushedRef(d.remote, d.sha, d.old, "push: rolled back"); err != nil {
+					fmt.Fprintf(&b, "error: failed to roll back '%s': %s\n", d.remote, err)
+				}
+			}
+			failTransaction(sent)
+			break
+		}
+		done = append(done, p)
+	}
+	return b.String()
+}
+
+// failTransaction rejects the updates of an atomic push that did not fail
+// themselves once one of them did.
+func failTransaction(sent []*pushedRef) {
+	for _, p := range sent {
+		if p.rejected == "" {
+			p.remoteRejected, p.rejected = true, "atomic transaction failed"
+		}
+	}
+}
+
+// movePushedRef moves the ref name from old to sha, creating it when old
+// is empty and deleting it when sha is.
+//
+// Returns:
+//   - An error if the ref is not at old or can not be written.
+func (r *Repository) movePushedRef(name string, old string, sha string, message string) error {
+	if sha == "" {
+		current, err := r.ResolveRef(name)
+		if err != nil {
+			return err
+		}
+		if current != old {
+			return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", name, current, old)
+		}
+		return r.DeleteRef(name)
+	}
+	if old == "" {
+		old = r.ObjectFormat().NullID()
+	}
+	return r.UpdateRef(name, sha, old, message)
+}
+
+// pushTrackingRef returns the remote-tracking branch the fetch refspecs of
+// the remote name map its ref to, empty when there is none.
+func (r *Repository) pushTrackingRef(name string, ref string) string {
+	specs, err := parseRefspecs(r.Config.GetAll("remote."+name, "fetch"), true)
+	if err != nil || excludedRef(specs, ref) {
+		return ""
+	}
+	for _, s := range specs {
+		if local, ok := s.Match(ref); ok && !s.Negative && local != "" {
+			return local
+		}
+	}
+	return ""
+}
+
+// storePushTrackingRef updates the remote-tracking branch of a ref a push
+// updated, if it has one.
+func (r *Repository) storePushTrackingRef(name string, p *pushedRef) error {
+	tracking := r.pushTrackingRef(name, p.remote)
+	if tracking == "" {
+		return nil
+	}
+	if p.sha == "" {
+		if err := r.DeleteRef(tracking); err != nil && !errors.Is(err, ErrorRefNotFound) {
+			return err
+		}
+		return nil
+	}
+	return r.UpdateRef(tracking, p.sha, "", "update by push")
+}
+
+// describe returns the line of the report about an update, empty when the
+// ref was up to date.
+func (p pushedRef) describe() string {
+	refs := shortRefName(p.remote)
+	if p.local != "" {
+		refs = shortRefName(p.local) + " -> " + refs
+	}
+	line := func(flag byte, summary string, reason string) string {
+		if reason != "" {
+			reason = " (" + reason + ")"
+		}
+		return fmt.Sprintf(" %c %-17s %s%s\n", flag, summary, refs, reason)
+	}
+	switch {
+	case p.sha == "" && p.old == "":
+		return "error: unable to delete '" + p.remote + "': remote ref does not exist\n"
+	case p.remoteRejected:
+		return line('!', "[remote rejected]", p.rejected)
+	case p.rejected != "":
+		return line('!', "[rejected]", p.rejected)
+	case p.sha == p.old:
+		return ""
+	case p.sha == "":
+		return line('-', "[deleted]", "")
+	case p.old == "":
+		summary := "[new reference]"
+		switch {
+		case strings.HasPrefix(p.remote, "refs/heads/"):
+			summary = "[new branch]"
+		case strings.HasPrefix(p.remote, "refs/tags/"):
+			summary = "[new tag]"
+		}
+		return line('*', summary, "")
+	case p.forced:
+		return line('+', shortID(p.old)+"..."+shortID(p.sha), "forced update")
+	}
+	return line(' ', shortID(p.old)+".."+shortID(p.sha), "")
+}
+
+// pushHints returns the hints about the updates rejected because they are
+// no fast-forward or the tag exists, as git gives them.
+func pushHints(pushed []pushedRef) string {
+	reasons := map[string]bool{}
+	for _, p := range pushed {
+		reasons[p.rejected] = true
+	}
+	var b strings.Builder
+	if reasons["non-fast-forward"] {
+		b.WriteString("hint: Updates were rejected because a pushed branch tip is behind its remote\n" +
+			"hint: counterpart. If you want to integrate the remote changes, use 'ggit pull'\n" +
+			"hint: before pushing again.\n")
+	}
+	if reasons["fetch first"] {
+		b.WriteString("hint: Updates were rejected because the remote contains work that you do not\n" +
+			"hint: have locally. If you want to integrate the remote changes, use\n" +
+			"hint: 'ggit pull' before pushing again.\n")
+	}
+	if reasons["already exists"] {
+		b.WriteString("hint: Updates were rejected because the tag already exists in the remote.\n")
+	}
+	return b.String()
+}
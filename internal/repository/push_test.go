@@ -0,0 +1,226 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingFs fails the writes of the file write and the removal of the
+// file remove.
+type failingFs struct {
+	afero.Fs
+	write  string
+	remove string
+}
+
+func (f failingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if name == f.write && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, os.ErrPermission
+	}
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+func (f failingFs) Remove(name string) error {
+	if name == f.remove {
+		return os.ErrPermission
+	}
+	return f.Fs.Remove(name)
+}
+
+// newPushRepository clones /src into the bare /srv and into /dst, whose
+// origin is /srv.
+func newPushRepository(t *testing.T) (*repository.Repository, *repository.Repository, string) {
+	src, head := newCloneSource(t)
+	srv := cloneRepository(t, src, "/srv", &repository.Clone{Bare: true})
+	r := cloneRepository(t, src, "/dst", &repository.Clone{})
+	assert.NoError(t, r.SetRemoteURL("origin", "/srv", false))
+	return r, srv, head
+}
+
+func TestPush(t *testing.T) {
+	t.Run("FastForward", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		next := commitChange(t, r, "master", "NEWS", "news\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", next, head, "commit: news"))
+
+		out, clean, err := r.Push(&repository.Push{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "To /srv\n   "+head[:7]+".."+next[:7]+"  master -> master\n", out)
+		assert.Equal(t, next, mustResolve(t, srv, "refs/heads/master"))
+		assert.Equal(t, next, mustResolve(t, r, "refs/remotes/origin/master"))
+		assert.True(t, hasLooseObject(srv, next))
+
+		out, clean, err = r.Push(&repository.Push{})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Everything up-to-date\n", out)
+	})
+
+	t.Run("NonFastForward", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		theirs := commitChange(t, srv, "master", "NEWS", "theirs\n")
+		assert.NoError(t, srv.UpdateRef("refs/heads/master", theirs, head, "push"))
+		ours := commitChange(t, r, "master", "NEWS", "ours\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", ours, head, "commit: news"))
+
+		out, clean, err := r.Push(&repository.Push{Remote: "origin", Refspecs: []string{"master"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        master -> master (fetch first)\nerror: failed to push some refs to '/srv'\n")
+		assert.Equal(t, theirs, mustResolve(t, srv, "refs/heads/master"))
+
+		_, _, err = r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		out, clean, err = r.Push(&repository.Push{Remote: "origin", Refspecs: []string{"master"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        master -> master (non-fast-forward)\n")
+
+		out, clean, err = r.Push(&repository.Push{Remote: "origin", Refspecs: []string{"+master"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "To /srv\n + "+theirs[:7]+"..."+ours[:7]+" master -> master (forced update)\n", out)
+		assert.Equal(t, ours, mustResolve(t, srv, "refs/heads/master"))
+	})
+
+	t.Run("ForceWithLease", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		theirs := commitChange(t, srv, "master", "NEWS", "theirs\n")
+		assert.NoError(t, srv.UpdateRef("refs/heads/master", theirs, head, "push"))
+		ours := commitChange(t, r, "master", "NEWS", "ours\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", ours, head, "commit: news"))
+
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"master"}, ForceWithLease: []string{"master"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        master -> master (stale info)\n")
+		assert.Equal(t, theirs, mustResolve(t, srv, "refs/heads/master"))
+
+		_, clean, err = r.Push(&repository.Push{Refspecs: []string{"master"}, ForceWithLease: []string{"refs/heads/master:" + theirs}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, ours, mustResolve(t, srv, "refs/heads/master"))
+
+		_, _, err = r.Push(&repository.Push{Refspecs: []string{"master"}, ForceWithLease: []string{"master:nope"}})
+		assert.EqualError(t, err, "cannot parse expected object name 'nope'")
+	})
+
+	t.Run("DeleteAndTags", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		writeRef(t, r, "refs/tags/v2", head)
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"HEAD:refs/heads/topic"}, Tags: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "To /srv\n * [new branch]      master -> topic\n * [new tag]         v2 -> v2\n", out)
+		assert.Equal(t, head, mustResolve(t, srv, "refs/heads/topic"))
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/origin/topic"))
+
+		assert.NoError(t, r.UpdateRef("refs/tags/v1", commitChange(t, r, "master", "NEWS", "news\n"), head, "retag"))
+		out, clean, err = r.Push(&repository.Push{Tags: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        v1 -> v1 (already exists)\n")
+
+		out, clean, err = r.Push(&repository.Push{Refspecs: []string{"topic", "gone"}, Delete: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "error: unable to delete 'gone': remote ref does not exist\n"+
+			"To /srv\n - [deleted]         topic\n"+
+			"error: failed to push some refs to '/srv'\n", out)
+		_, err = srv.ResolveRef("refs/heads/topic")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		_, err = r.ResolveRef("refs/remotes/origin/topic")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("Atomic", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		theirs := commitChange(t, srv, "master", "NEWS", "theirs\n")
+		assert.NoError(t, srv.UpdateRef("refs/heads/master", theirs, head, "push"))
+		ours := commitChange(t, r, "master", "NEWS", "ours\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", ours, head, "commit: news"))
+
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"master", "master:topic"}, Atomic: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [rejected]        master -> master (fetch first)\n"+
+			" ! [rejected]        master -> topic (atomic push failed)\n")
+		_, err = srv.ResolveRef("refs/heads/topic")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		assert.False(t, srv.Objects.Has(ours))
+	})
+
+	t.Run("FailedUpdate", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		r.FS.Fs = failingFs{Fs: r.FS.Fs, write: "/srv/refs/heads/blocked"}
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"master:refs/heads/blocked", "master:refs/heads/topic"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "To /srv\n"+
+			" ! [remote rejected] master -> blocked (failed to update ref)\n"+
+			" * [new branch]      master -> topic\n"+
+			"error: failed to push some refs to '/srv'\n", out)
+		assert.Equal(t, head, mustResolve(t, srv, "refs/heads/topic"))
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/origin/topic"))
+		_, err = r.ResolveRef("refs/remotes/origin/blocked")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("AtomicRollback", func(t *testing.T) {
+		r, srv, _ := newPushRepository(t)
+		r.FS.Fs = failingFs{Fs: r.FS.Fs, write: "/srv/refs/heads/blocked"}
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"master:refs/heads/topic", "master:refs/heads/blocked"}, Atomic: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [remote rejected] master -> topic (atomic transaction failed)\n"+
+			" ! [remote rejected] master -> blocked (failed to update ref)\n")
+		_, err = srv.ResolveRef("refs/heads/topic")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		_, err = r.ResolveRef("refs/remotes/origin/topic")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+
+		r.FS.Fs = failingFs{Fs: r.FS.Fs, write: "/srv/refs/heads/blocked", remove: "/srv/refs/heads/topic"}
+		out, clean, err = r.Push(&repository.Push{Refspecs: []string{"master:refs/heads/topic", "master:refs/heads/blocked"}, Atomic: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, "error: failed to roll back 'refs/heads/topic': permission denied\n")
+	})
+
+	t.Run("CheckedOut", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		next := commitChange(t, r, "master", "NEWS", "news\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		out, clean, err := r.Push(&repository.Push{})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Contains(t, out, " ! [remote rejected] master -> master (branch is currently checked out)\n")
+		assert.Equal(t, head, mustResolve(t, src, "master"))
+	})
+
+	t.Run("PrePush", func(t *testing.T) {
+		r, srv, head := newPushRepository(t)
+		next := commitChange(t, r, "master", "NEWS", "news\n")
+		assert.NoError(t, r.UpdateRef("refs/heads/master", next, head, "commit: news"))
+		writeHook(t, r, "pre-push", "echo \"$1 $2\"\ncat\nexit 1\n")
+
+		out, clean, err := r.Push(&repository.Push{Refspecs: []string{"master", ":refs/tags/v1"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "origin /srv\n"+
+			"refs/heads/master "+next+" refs/heads/master "+head+"\n"+
+			"(delete) "+r.ObjectFormat().NullID()+" refs/tags/v1 "+head+"\n"+
+			"error: failed to push some refs to '/srv'\n", out)
+		assert.Equal(t, head, mustResolve(t, srv, "master"))
+
+		_, clean, err = r.Push(&repository.Push{Refspecs: []string{"master"}, NoVerify: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, next, mustResolve(t, srv, "master"))
+	})
+}
@@ -0,0 +1,952 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/objects"
+	"slices"
+	"strings"
+)
+
+// Files of the rebase state, in the rebase-merge directory: the branch
+// being rebased, the commit it is rebased onto and the one it pointed to,
+// the steps left and done, and the state of a stopped step.
+const (
+	rebaseMergeDir        = "rebase-merge"
+	rebaseHeadNameFile    = "head-name"
+	rebaseOntoFile        = "onto"
+	rebaseOrigHeadFile    = "orig-head"
+	rebaseTodoFile        = "git-rebase-todo"
+	rebaseDoneFile        = "done"
+	rebaseInteractiveFile = "interactive"
+	rebaseStoppedSHAFile  = "stopped-sha"
+	rebaseMessageFile     = "message"
+	rebaseAmendFile       = "amend"
+	rebaseFixupsFile      = "current-fixups"
+	rebaseSquashMsgFile   = "message-squash"
+	commitEditMsgFile     = "COMMIT_EDITMSG"
+)
+
+// detachedHead is the head name of a rebase of a detached HEAD.
+const detachedHead = "detached HEAD"
+
+type Rebase struct {
+	Upstream string
+	// Branch is checked out before rebasing it, when set.
+	Branch      string
+	Onto        string
+	Interactive bool
+	Autosquash  bool
+	Exec        []string
+	Continue    bool
+	Skip        bool
+	Abort       bool
+	// NoVerify skips the pre-rebase hook.
+	NoVerify bool
+}
+
+func rebaseFile(name string) string {
+	return rebaseMergeDir + "/" + name
+}
+
+func (r *Repository) readRebaseFile(name string) (string, error) {
+	data, err := r.readFile(rebaseFile(name))
+	return strings.TrimSpace(data), err
+}
+
+// Rebase replays the commits of the current branch that are not in
+// upstream on top of onto, upstream by default, then moves the branch to
+// the last replayed commit. Merge commits are left out. HEAD is detached
+// while the commits are replayed.
+//
+// The steps are kept in a todo list, which Interactive hands to the
+// sequence editor to reorder, drop, reword, edit or squash commits.
+// Autosquash moves the "fixup! " and "squash! " commits after the commit
+// they name and Exec runs shell commands after each commit. A conflict, a
+// failed command or an edit stops the rebase: it resumes with Continue,
+// goes on without the stopped commit with Skip and is undone with Abort.
+//
+// Returns:
+//   - The messages of the merges and the report of the rebase.
+//   - Whether the rebase went on without conflicts or failed commands.
+//   - An error if the rebase can not start, e.g. because of local changes,
+//     another rebase is in progress or the todo list is invalid.
+func (r *Repository) Rebase(opts *Rebase) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	inProgress := r.hasFile(rebaseFile(rebaseHeadNameFile))
+	switch {
+	case (opts.Continue || opts.Skip || opts.Abort) && !inProgress:
+		return "", false, fmt.Errorf("No rebase in progress?")
+	case opts.Continue:
+		return r.rebaseContinue()
+	case opts.Skip:
+		return r.rebaseSkip()
+	case opts.Abort:
+		err := r.rebaseAbort()
+		return "", err == nil, err
+	case inProgress:
+		return "", false, fmt.Errorf("It seems that there is already a %s directory, and\n"+
+			"I wonder if you are in the middle of another rebase.  If that is the\ncase, please try\n"+
+			"\tggit rebase (--continue | --abort | --skip)\nIf that is not the case, please\n"+
+			"\trm -fr \"%s\"\nand run me again.  I am stopping in case you still have something\nvaluable there.",
+			rebaseMergeDir, r.path(rebaseMergeDir))
+	}
+	return r.startRebase(opts)
+}
+
+// startRebase checks the worktree is clean, lists the commits to replay,
+// detaches HEAD at onto and runs the todo list.
+func (r *Repository) startRebase(opts *Rebase) (string, bool, error) {
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return "", false, err
+	}
+	headFiles, err := r.treeFiles(headTree)
+	if err != nil {
+		return "", false, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if len(indexChanges(idx, headFiles)) > 0 || len(idx.Conflicts()) > 0 {
+		return "", false, fmt.Errorf("cannot rebase: Your index contains uncommitted changes.\nPlease commit or stash them.")
+	}
+	unstaged, err := r.worktreeChanges(idx)
+	if err != nil {
+		return "", false, err
+	}
+	if len(unstaged) > 0 {
+		return "", false, fmt.Errorf("cannot rebase: You have unstaged changes.\nPlease commit or stash them.")
+	}
+
+	if opts.Upstream == "" {
+		return "", false, fmt.Errorf("There is no tracking information for the current branch.\nPlease specify which branch you want to rebase against.")
+	}
+	upstream, err := r.ResolveCommit(opts.Upstream)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid upstream '%s'", opts.Upstream)
+	}
+	ontoName := opts.Upstream
+	if opts.Onto != "" {
+		ontoName = opts.Onto
+	}
+	onto, err := r.ResolveCommit(ontoName)
+	if err != nil {
+		return "", false, fmt.Errorf("Does not point to a valid commit '%s'", ontoName)
+	}
+	headName, origHead := detachedHead, head
+	if opts.Branch != "" {
+		if origHead, err = r.ResolveCommit(opts.Branch); err != nil {
+			return "", false, fmt.Errorf("no such branch/commit '%s'", opts.Branch)
+		}
+		if _, _, err := r.readRef("refs/heads/" + opts.Branch); err == nil {
+			headName = "refs/heads/" + opts.Branch
+		}
+	} else if ref, err := r.SymbolicRef(headFile); err == nil {
+		headName = ref
+	}
+	if origHead == "" {
+		return "", false, fmt.Errorf("cannot rebase an unborn branch")
+	}
+	b := &strings.Builder{}
+	if !opts.NoVerify {
+		args := []string{opts.Upstream}
+		if opts.Branch != "" {
+			args = append(args, opts.Branch)
+		}
+		if err := r.runHook(b, "pre-rebase", args...); err != nil {
+			var failed *HookError
+			if errors.As(err, &failed) {
+				return "", false, fmt.Errorf("%sThe pre-rebase hook refused to rebase.", b.String())
+			}
+			return "", false, err
+		}
+	}
+
+	commits, err := r.RevList([]string{origHead}, []string{upstream})
+	if err != nil {
+		return "", false, err
+	}
+	slices.Reverse(commits)
+	steps := []rebaseStep{}
+	linear := true
+	for _, sha := range commits {
+		commit, err := r.readCommit(sha)
+		if err != nil {
+			return "", false, err
+		}
+		if len(commit.KVLM.Parents) > 1 {
+			linear = false
+			continue
+		}
+		steps = append(steps, rebaseStep{command: rebasePick, commit: sha, arg: subject(commit.KVLM.Message)})
+	}
+
+	if !opts.Interactive && !opts.Autosquash && len(opts.Exec) == 0 && linear {
+		upToDate, err := r.isRebased(upstream, onto, origHead)
+		if err != nil {
+			return "", false, err
+		}
+		if upToDate {
+			return r.rebaseUpToDate(opts, headName, head, origHead)
+		}
+	}
+
+	if opts.Autosquash {
+		steps = autosquash(steps)
+	}
+	steps = insertExec(steps, opts.Exec)
+	for name, data := range map[string]string{
+		rebaseHeadNameFile: headName,
+		rebaseOntoFile:     onto,
+		rebaseOrigHeadFile: origHead,
+	} {
+		if err := r.ReplaceTextFile(data+"\n", rebaseMergeDir, name); err != nil {
+			return "", false, err
+		}
+	}
+	if opts.Interactive {
+		if err := r.ReplaceTextFile("", rebaseMergeDir, rebaseInteractiveFile); err != nil {
+			return "", false, err
+		}
+		todo := formatRebaseTodo(steps, true) + rebaseTodoHelp(upstream, origHead, onto, len(steps))
+		edited, err := r.editRebaseTodo(todo)
+		if err != nil {
+			return "", false, r.abandonRebase(err)
+		}
+		if len(edited) == 0 && len(steps) > 0 {
+			return "", false, r.abandonRebase(fmt.Errorf("nothing to do"))
+		}
+		steps = edited
+	}
+	if first := slices.IndexFunc(steps, rebaseStep.takesCommit); first >= 0 &&
+		(steps[first].command == rebaseSquash || steps[first].command == rebaseFixup) {
+		return "", false, r.abandonRebase(fmt.Errorf("cannot '%s' without a previous commit", steps[first].command))
+	}
+
+	// Commits already on top of onto are kept as they are.
+	done := []rebaseStep{}
+	start := onto
+	for len(steps) > 0 && steps[0].command == rebasePick {
+		commit, err := r.readCommit(steps[0].commit)
+		if err != nil {
+			return "", false, err
+		}
+		if len(commit.KVLM.Parents) != 1 || commit.KVLM.Parents[0] != start {
+			break
+		}
+		start = steps[0].commit
+		done, steps = append(done, steps[0]), steps[1:]
+	}
+	if err := r.ReplaceTextFile(formatRebaseTodo(done, false), rebaseMergeDir, rebaseDoneFile); err != nil {
+		return "", false, err
+	}
+	if err := r.ReplaceTextFile(formatRebaseTodo(steps, false), rebaseMergeDir, rebaseTodoFile); err != nil {
+		return "", false, err
+	}
+	if err := r.ReplaceTextFile(origHead+"\n", origHeadFile); err != nil {
+		return "", false, err
+	}
+
+	startTree, err := r.headTree(start)
+	if err != nil {
+		return "", false, err
+	}
+	startFiles, err := r.treeFiles(startTree)
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.checkout(headFiles, startFiles, false, "checkout"); err != nil {
+		return "", false, r.abandonRebase(err)
+	}
+	if err := r.WriteIndex(r.buildIndex(startFiles, nil, idx)); err != nil {
+		return "", false, err
+	}
+	if err := r.DetachHead(start, "rebase (start): checkout "+ontoName); err != nil {
+		return "", false, err
+	}
+	if err := r.runPostHook(b, "post-checkout", head, start, "1"); err != nil {
+		return "", false, err
+	}
+	return r.runRebase(b)
+}
+
+// isRebased reports whether origHead already sits on top of onto, with
+// no commit of upstream missing.
+func (r *Repository) isRebased(upstream string, onto string, origHead string) (bool, error) {
+	for _, from := range []string{onto, upstream} {
+		bases, err := r.MergeBases(from, origHead)
+		if err != nil {
+			return false, err
+		}
+		if len(bases) != 1 || bases[0] != onto {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// rebaseUpToDate reports there is nothing to rebase, checking out the
+// branch to rebase when it was given.
+func (r *Repository) rebaseUpToDate(opts *Rebase, headName string, head string, origHead string) (string, bool, error) {
+	name := "HEAD"
+	if headName != detachedHead {
+		name = strings.TrimPrefix(headName, "refs/heads/")
+	}
+	if opts.Branch != "" {
+		current, _ := r.SymbolicRef(headFile)
+		if current != headName || head != origHead {
+			if err := r.switchHead(head, origHead, headName, "rebase: checkout "+opts.Branch); err != nil {
+				return "", false, err
+			}
+		}
+	}
+	return fmt.Sprintf("Current branch %s is up to date.\n", name), true, nil
+}
+
+// switchHead checks out the commit sha over the commit head, then points
+// HEAD at the branch headName, or at sha when it is detached.
+func (r *Repository) switchHead(head string, sha string, headName string, message string) error {
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return err
+	}
+	headFiles, err := r.treeFiles(headTree)
+	if err != nil {
+		return err
+	}
+	tree, err := r.headTree(sha)
+	if err != nil {
+		return err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if err := r.checkout(headFiles, files, false, "checkout"); err != nil {
+		return err
+	}
+	if err := r.WriteIndex(r.buildIndex(files, nil, idx)); err != nil {
+		return err
+	}
+	if headName == detachedHead {
+		return r.DetachHead(sha, message)
+	}
+	if err := r.SetSymbolicRef(headFile, headName); err != nil {
+		return err
+	}
+	return r.appendReflog(headFile, head, sha, message)
+}
+
+// editRebaseTodo hands a todo list to the sequence editor.
+//
+// Returns:
+//   - The steps of the edited list.
+//   - An error if the editor fails or the list is invalid.
+func (r *Repository) editRebaseTodo(todo string) ([]rebaseStep, error) {
+	if err := r.ReplaceTextFile(todo, rebaseMergeDir, rebaseTodoFile); err != nil {
+		return nil, err
+	}
+	if err := r.runEditor(r.sequenceEditor(), rebaseFile(rebaseTodoFile)); err != nil {
+		return nil, err
+	}
+	edited, err := r.readFile(rebaseFile(rebaseTodoFile))
+	if err != nil {
+		return nil, err
+	}
+	return r.parseRebaseTodo(edited)
+}
+
+// abandonRebase removes the state of a rebase that could not start and
+// returns err.
+func (r *Repository) abandonRebase(err error) error {
+	if rmErr := r.FS.RemoveAll(r.path(rebaseMergeDir)); rmErr != nil {
+		return rmErr
+	}
+	return err
+}
+
+func (r *Repository) readRebaseTodo() ([]rebaseStep, error) {
+	todo, err := r.readFile(rebaseFile(rebaseTodoFile))
+	if err != nil {
+		return nil, err
+	}
+	return r.parseRebaseTodo(todo)
+}
+
+// lastRebaseStep returns the step done last.
+func (r *Repository) lastRebaseStep() (rebaseStep, error) {
+	done, err := r.readFile(rebaseFile(rebaseDoneFile))
+	if err != nil {
+		return rebaseStep{}, err
+	}
+	steps, err := r.parseRebaseTodo(done)
+	if err != nil || len(steps) == 0 {
+		return rebaseStep{}, fmt.Errorf("could not read the last rebase step: %v", err)
+	}
+	return steps[len(steps)-1], nil
+}
+
+// runRebase runs the todo list step by step, until a step stops or the
+// list is done, in which case the rebase is finished.
+func (r *Repository) runRebase(b *strings.Builder) (string, bool, error) {
+	for {
+		steps, err := r.readRebaseTodo()
+		if err != nil {
+			return "", false, err
+		}
+		if len(steps) == 0 {
+			return r.finishRebase(b)
+		}
+		step := steps[0]
+		if err := r.WriteTextToFile(step.format(false)+"\n", rebaseMergeDir, rebaseDoneFile); err != nil {
+			return "", false, err
+		}
+		if err := r.ReplaceTextFile(formatRebaseTodo(steps[1:], false), rebaseMergeDir, rebaseTodoFile); err != nil {
+			return "", false, err
+		}
+
+		switch step.command {
+		case rebaseDrop:
+			continue
+		case rebaseBreak:
+			return b.String(), true, nil
+		case rebaseExec:
+			fmt.Fprintf(b, "Executing: %s\n", step.arg)
+			out, err := r.runShell(step.arg)
+			b.WriteString(out)
+			if err != nil {
+				fmt.Fprintf(b, "warning: execution failed: %s\nYou can fix the problem, and then run\n\n  ggit rebase --continue\n\n\n", step.arg)
+				return b.String(), false, nil
+			}
+			continue
+		}
+		stopped, clean, err := r.rebasePick(b, step, steps[1:])
+		if err != nil {
+			return "", false, err
+		}
+		if stopped {
+			return b.String(), clean, nil
+		}
+	}
+}
+
+// rebasePick applies the commit of a step to HEAD. A commit whose parent
+// is HEAD is fast-forwarded to instead of being replayed.
+//
+// Returns:
+//   - Whether the rebase stops, on a conflict or an edit step.
+//   - Whether the step went without conflicts.
+//   - An error if the commit can not be applied.
+func (r *Repository) rebasePick(b *strings.Builder, step rebaseStep, next []rebaseStep) (bool, bool, error) {
+	commit, err := r.readCommit(step.commit)
+	if err != nil {
+		return false, false, err
+	}
+	if len(commit.KVLM.Parents) > 1 {
+		return false, false, fmt.Errorf("commit %s is a merge, which rebase can not replay", step.commit)
+	}
+	parent := ""
+	if len(commit.KVLM.Parents) == 1 {
+		parent = commit.KVLM.Parents[0]
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return false, false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return false, false, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return false, false, err
+	}
+
+	if parent == head && step.command != rebaseSquash && step.command != rebaseFixup {
+		if err := r.switchHead(head, step.commit, detachedHead, "rebase: fast-forward"); err != nil {
+			return false, false, err
+		}
+		return r.concludeRebasePick(b, step, commit, step.commit, headTree, false)
+	}
+
+	m, err := r.applyCommit(ActionPick, step.commit, subject(commit.KVLM.Message), parent, idx, headTree)
+	if err != nil {
+		return false, false, err
+	}
+	// The messages of clean merges are left out.
+	if len(m.conflicts) > 0 {
+		b.WriteString(m.report())
+		message := commit.KVLM.Message + "\n"
+		if err := r.ReplaceTextFile(message, rebaseMergeDir, rebaseMessageFile); err != nil {
+			return false, false, err
+		}
+		if err := r.ReplaceTextFile(step.commit+"\n", rebaseMergeDir, rebaseStoppedSHAFile); err != nil {
+			return false, false, err
+		}
+		if err := r.writeSequencerMessage(message, m.conflicts); err != nil {
+			return false, false, err
+		}
+		fmt.Fprintf(b, "error: could not apply %s... %s\n", shortID(step.commit), step.arg)
+		b.WriteString("hint: Resolve all conflicts manually, mark them as resolved with\n" +
+			"hint: \"ggit add/rm <conflicted_files>\", then run \"ggit rebase --continue\".\n" +
+			"hint: You can instead skip this commit: run \"ggit rebase --skip\".\n" +
+			"hint: To abort and get back to the state before \"ggit rebase\", run \"ggit rebase --abort\".\n")
+		fmt.Fprintf(b, "Could not apply %s... %s\n", shortID(step.commit), step.arg)
+		return true, false, nil
+	}
+	tree, err := r.writeFiles(m.files)
+	if err != nil {
+		return false, false, err
+	}
+	return r.commitRebasePick(b, step, commit, tree, next, step.command)
+}
+
+// commitRebasePick commits the tree resulting from applying the commit
+// of a step on HEAD, recording action in the reflog. Squash and fixup
+// steps amend HEAD instead. Commits that become empty are dropped, unless
+// they were empty to begin with.
+//
+// Returns:
+//   - Whether the rebase stops, at an edit step.
+//   - Whether the step went without conflicts.
+//   - An error if the commit can not be written.
+func (r *Repository) commitRebasePick(b *strings.Builder, step rebaseStep, commit *objects.Commit, tree string, next []rebaseStep, action string) (bool, bool, error) {
+	if step.command == rebaseSquash || step.command == rebaseFixup {
+		return false, true, r.squashRebasePick(b, step, commit, tree, next)
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return false, false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return false, false, err
+	}
+	parentTree := r.ObjectFormat().EmptyTree
+	if len(commit.KVLM.Parents) > 0 {
+		if parentTree, err = r.peelTree(commit.KVLM.Parents[0]); err != nil {
+			return false, false, err
+		}
+	}
+	if tree == headTree && commit.KVLM.Tree != parentTree {
+		return false, true, nil
+	}
+	message := commit.KVLM.Message + "\n"
+	sha, err := r.commitTreeKeepingAuthor(tree, headParents(head), message, commit)
+	if err != nil {
+		return false, false, err
+	}
+	if err := r.UpdateHead(sha, fmt.Sprintf("rebase (%s): %s", action, subject(message))); err != nil {
+		return false, false, err
+	}
+	if err := r.rebaseCommitted(b, step.commit, "", sha); err != nil {
+		return false, false, err
+	}
+	if action == rebaseContinue {
+		summary, err := r.commitSummary(sha, headTree, false)
+		if err != nil {
+			return false, false, err
+		}
+		b.WriteString(summary)
+	}
+	return r.concludeRebasePick(b, step, commit, sha, headTree, action == rebaseContinue)
+}
+
+// rebaseCommitted notes that a step rewrote the commit old as next, which
+// replaces the commit amended when set, and runs the post-commit hook.
+func (r *Repository) rebaseCommitted(b *strings.Builder, old string, amended string, next string) error {
+	if err := r.recordRewritten(old, amended, next); err != nil {
+		return err
+	}
+	return r.runPostHook(b, "post-commit")
+}
+
+// rebaseContinue is the reflog action of the commits of resolved steps.
+const rebaseContinue = "continue"
+
+// concludeRebasePick rewords the commit sha of a reword step, or stops at
+// it for an edit step unless it was resolved after stopping already.
+func (r *Repository) concludeRebasePick(b *strings.Builder, step rebaseStep, commit *objects.Commit, sha string, parentTree string, resolved bool) (bool, bool, error) {
+	switch {
+	case step.command == rebaseReword:
+		message, err := r.editCommitMessage(commit.KVLM.Message + "\n")
+		if err != nil {
+			return false, false, err
+		}
+		picked, err := r.readCommit(sha)
+		if err != nil {
+			return false, false, err
+		}
+		reworded, err := r.commitTreeKeepingAuthor(picked.KVLM.Tree, picked.KVLM.Parents, message, commit)
+		if err != nil {
+			return false, false, err
+		}
+		if err := r.UpdateHead(reworded, "rebase (reword): "+subject(message)); err != nil {
+			return false, false, err
+		}
+		if err := r.rebaseCommitted(b, step.commit, sha, reworded); err != nil {
+			return false, false, err
+		}
+		summary, err := r.commitSummary(reworded, parentTree, true)
+		if err != nil {
+			return false, false, err
+		}
+		b.WriteString(summary)
+	case step.command == rebaseEdit && !resolved:
+		if err := r.ReplaceTextFile(sha+"\n", rebaseMergeDir, rebaseAmendFile); err != nil {
+			return false, false, err
+		}
+		if err := r.ReplaceTextFile(step.commit+"\n", rebaseMergeDir, rebaseStoppedSHAFile); err != nil {
+			return false, false, err
+		}
+		fmt.Fprintf(b, "Stopped at %s...  %s\nYou can amend the commit now, with\n\n  ggit commit --amend \n\n"+
+			"Once you are satisfied with your changes, run\n\n  ggit rebase --continue\n", shortID(step.commit), step.arg)
+		return true, true, nil
+	}
+	return false, true, nil
+}
+
+// squashRebasePick melds the tree of a squash or fixup step into HEAD,
+// combining the messages: squashed messages are kept and the messages of
+// fixups are commented out. The combined message goes through the editor
+// at the end of a chain holding a squash.
+func (r *Repository) squashRebasePick(b *strings.Builder, step rebaseStep, commit *objects.Commit, tree string, next []rebaseStep) error {
+	head, err := r.headCommit()
+	if err != nil {
+		return err
+	}
+	amended, err := r.readCommit(head)
+	if err != nil {
+		return err
+	}
+	fixups := ""
+	if r.hasFile(rebaseFile(rebaseFixupsFile)) {
+		if fixups, err = r.readFile(rebaseFile(rebaseFixupsFile)); err != nil {
+			return err
+		}
+	}
+	count := strings.Count(fixups, "\n") + 1
+	var message string
+	if fixups == "" {
+		message = fmt.Sprintf("# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n%s\n", amended.KVLM.Message)
+	} else {
+		squashed, err := r.readFile(rebaseFile(rebaseSquashMsgFile))
+		if err != nil {
+			return err
+		}
+		_, rest, _ := strings.Cut(squashed, "\n")
+		message = fmt.Sprintf("# This is a combination of %d commits.\n%s", count+1, rest)
+	}
+	if step.command == rebaseSquash {
+		// The subject of "squash! " and "fixup! " commits only names their
+		// target.
+		body := commit.KVLM.Message
+		if strings.HasPrefix(body, rebaseSquash+"!") || strings.HasPrefix(body, rebaseFixup+"!") {
+			line, rest, _ := strings.Cut(body, "\n")
+			body = commentLines(line) + "\n" + rest
+		}
+		message += fmt.Sprintf("\n# This is the commit message #%d:\n\n%s\n", count+1, body)
+	} else {
+		message += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n%s\n", count+1, commentLines(commit.KVLM.Message))
+	}
+	fixups += fmt.Sprintf("%s %s\n", step.command, step.commit)
+
+	final := len(next) == 0 || (next[0].command != rebaseSquash && next[0].command != rebaseFixup)
+	if final {
+		if err := r.removeFiles(rebaseFile(rebaseFixupsFile), rebaseFile(rebaseSquashMsgFile)); err != nil {
+			return err
+		}
+	} else {
+		if err := r.ReplaceTextFile(fixups, rebaseMergeDir, rebaseFixupsFile); err != nil {
+			return err
+		}
+		if err := r.ReplaceTextFile(message, rebaseMergeDir, rebaseSquashMsgFile); err != nil {
+			return err
+		}
+	}
+	squashing := strings.Contains(fixups, rebaseSquash+" ")
+	if final && squashing {
+		if message, err = r.editCommitMessage(message); err != nil {
+			return err
+		}
+	} else if message = CleanupMessage(message); message == "" {
+		return fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+
+	author, err := objects.ParseIdent(amended.KVLM.Author)
+	if err != nil {
+		return err
+	}
+	sha, err := r.commitTreeAs(tree, amended.KVLM.Parents, message, author)
+	if err != nil {
+		return err
+	}
+	if err := r.UpdateHead(sha, fmt.Sprintf("rebase (%s): %s", step.command, subject(message))); err != nil {
+		return err
+	}
+	if err := r.rebaseCommitted(b, step.commit, head, sha); err != nil {
+		return err
+	}
+	if !final || !squashing {
+		return nil
+	}
+	parentTree := r.ObjectFormat().EmptyTree
+	if len(amended.KVLM.Parents) > 0 {
+		if parentTree, err = r.peelTree(amended.KVLM.Parents[0]); err != nil {
+			return err
+		}
+	}
+	summary, err := r.commitSummary(sha, parentTree, true)
+	if err != nil {
+		return err
+	}
+	b.WriteString(summary)
+	return nil
+}
+
+// commentLines comments out the lines of a message.
+func commentLines(message string) string {
+	lines := strings.Split(message, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "#"
+		} else {
+			lines[i] = "# " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// editCommitMessage hands a commit message to the editor, with
+// instructions, and cleans up the result.
+//
+// Returns:
+//   - The edited message.
+//   - An error if the editor fails or the message is left empty.
+func (r *Repository) editCommitMessage(message string) (string, error) {
+	message += "\n# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n"
+	if err := r.ReplaceTextFile(message, commitEditMsgFile); err != nil {
+		return "", err
+	}
+	if err := r.runEditor(r.editor(), commitEditMsgFile); err != nil {
+		return "", err
+	}
+	edited, err := r.readFile(commitEditMsgFile)
+	if err != nil {
+		return "", err
+	}
+	if edited = CleanupMessage(edited); edited == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	return edited, nil
+}
+
+// finishRebase moves the rebased branch to HEAD, checks it out again and
+// removes the rebase state.
+func (r *Repository) finishRebase(b *strings.Builder) (string, bool, error) {
+	headName, err := r.readRebaseFile(rebaseHeadNameFile)
+	if err != nil {
+		return "", false, err
+	}
+	onto, err := r.readRebaseFile(rebaseOntoFile)
+	if err != nil {
+		return "", false, err
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	if headName != detachedHead {
+		if err := r.UpdateRef(headName, head, "", fmt.Sprintf("rebase (finish): %s onto %s", headName, onto)); err != nil {
+			return "", false, err
+		}
+		if err := r.SetSymbolicRef(headFile, headName); err != nil {
+			return "", false, err
+		}
+		if err := r.appendReflog(headFile, head, head, "rebase (finish): returning to "+headName); err != nil {
+			return "", false, err
+		}
+	}
+	if r.hasFile(rebaseFile(rebaseRewrittenFile)) {
+		rewritten, err := r.readFile(rebaseFile(rebaseRewrittenFile))
+		if err != nil {
+			return "", false, err
+		}
+		out, _, err := r.RunHook(&Hook{Name: "post-rewrite", Args: []string{"rebase"}, Stdin: rewritten})
+		b.WriteString(out)
+		var failed *HookError
+		if err != nil && !errors.As(err, &failed) {
+			return "", false, err
+		}
+	}
+	if err := r.removeRebaseState(); err != nil {
+		return "", false, err
+	}
+	fmt.Fprintf(b, "Successfully rebased and updated %s.\n", headName)
+	return b.String(), true, nil
+}
+
+func (r *Repository) removeRebaseState() error {
+	if err := r.FS.RemoveAll(r.path(rebaseMergeDir)); err != nil {
+		return err
+	}
+	return r.removeFiles(mergeMsgFile)
+}
+
+// rebaseContinue commits the changes staged for the stopped step: the
+// resolution of a conflicted commit, or changes amending the commit of an
+// edit step. Then the todo list goes on.
+func (r *Repository) rebaseContinue() (string, bool, error) {
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if conflicts := idx.Conflicts(); len(conflicts) > 0 {
+		return "", false, fmt.Errorf("%s: needs merge\nYou must edit all merge conflicts and then\nmark them as resolved using ggit add",
+			strings.Join(conflicts, ": needs merge\n"))
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", false, err
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return "", false, err
+	}
+	tree, err := r.WriteTree(idx)
+	if err != nil {
+		return "", false, err
+	}
+
+	b := &strings.Builder{}
+	switch {
+	case r.hasFile(rebaseFile(rebaseAmendFile)):
+		if tree != headTree {
+			if err := r.amendRebaseHead(b, head, tree); err != nil {
+				return "", false, err
+			}
+		}
+	case r.hasFile(rebaseFile(rebaseStoppedSHAFile)):
+		step, err := r.lastRebaseStep()
+		if err != nil {
+			return "", false, err
+		}
+		commit, err := r.readCommit(step.commit)
+		if err != nil {
+			return "", false, err
+		}
+		next, err := r.readRebaseTodo()
+		if err != nil {
+			return "", false, err
+		}
+		if _, _, err := r.commitRebasePick(b, step, commit, tree, next, rebaseContinue); err != nil {
+			return "", false, err
+		}
+	}
+	if err := r.removeStoppedRebaseStep(); err != nil {
+		return "", false, err
+	}
+	return r.runRebase(b)
+}
+
+// amendRebaseHead replaces HEAD with a commit of tree, keeping its
+// author. Its message goes through the editor.
+func (r *Repository) amendRebaseHead(b *strings.Builder, head string, tree string) error {
+	commit, err := r.readCommit(head)
+	if err != nil {
+		return err
+	}
+	message, err := r.editCommitMessage(commit.KVLM.Message + "\n")
+	if err != nil {
+		return err
+	}
+	sha, err := r.commitTreeKeepingAuthor(tree, commit.KVLM.Parents, message, commit)
+	if err != nil {
+		return err
+	}
+	if err := r.UpdateHead(sha, fmt.Sprintf("rebase (%s): %s", rebaseContinue, subject(message))); err != nil {
+		return err
+	}
+	stopped, err := r.readRebaseFile(rebaseStoppedSHAFile)
+	if err != nil {
+		return err
+	}
+	if err := r.rebaseCommitted(b, stopped, head, sha); err != nil {
+		return err
+	}
+	parentTree := r.ObjectFormat().EmptyTree
+	if len(commit.KVLM.Parents) > 0 {
+		if parentTree, err = r.peelTree(commit.KVLM.Parents[0]); err != nil {
+			return err
+		}
+	}
+	summary, err := r.commitSummary(sha, parentTree, true)
+	if err != nil {
+		return err
+	}
+	b.WriteString(summary)
+	return nil
+}
+
+func (r *Repository) removeStoppedRebaseStep() error {
+	return r.removeFiles(rebaseFile(rebaseAmendFile), rebaseFile(rebaseStoppedSHAFile), rebaseFile(rebaseMessageFile), mergeMsgFile)
+}
+
+// rebaseSkip drops the changes of the stopped step and goes on with the
+// todo list.
+func (r *Repository) rebaseSkip() (string, bool, error) {
+	if err := r.resetToCommit(""); err != nil {
+		return "", false, err
+	}
+	if err := r.removeStoppedRebaseStep(); err != nil {
+		return "", false, err
+	}
+	return r.runRebase(&strings.Builder{})
+}
+
+// rebaseAbort goes back to the branch and the commit the rebase started
+// from.
+func (r *Repository) rebaseAbort() error {
+	headName, err := r.readRebaseFile(rebaseHeadNameFile)
+	if err != nil {
+		return err
+	}
+	origHead, err := r.readRebaseFile(rebaseOrigHeadFile)
+	if err != nil {
+		return err
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return err
+	}
+	if err := r.resetToCommit(origHead); err != nil {
+		return err
+	}
+	message := "rebase (abort): returning to "
+	if headName == detachedHead {
+		if err := r.DetachHead(origHead, message+origHead); err != nil {
+			return err
+		}
+	} else {
+		if err := r.SetSymbolicRef(headFile, headName); err != nil {
+			return err
+		}
+		if err := r.appendReflog(headFile, head, origHead, message+headName); err != nil {
+			return err
+		}
+	}
+	return r.removeRebaseState()
+}
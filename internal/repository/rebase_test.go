@@ -0,0 +1,246 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRebaseRepository returns a repository whose topic branch holds two
+// commits to rebase onto master: one changing f, then one adding h. HEAD
+// is on master.
+func newRebaseRepository(t *testing.T, master string) (*repository.Repository, string, string, string) {
+	r, masterCommit, topic := newMergeRepository(t, master, "1\nT\n3\n4\n5\n6\n7\n")
+	second := commitChange(t, r, "topic", "h", "second\n")
+	assert.NoError(t, r.UpdateRef("refs/heads/topic", second, topic, "commit: second"))
+	return r, masterCommit, topic, second
+}
+
+// commitWithMessage commits the tree of rev on top of parent with the
+// given message.
+func commitWithMessage(t *testing.T, r *repository.Repository, rev string, parent string, message string) string {
+	commit := mustReadCommit(t, r, rev)
+	sha, err := r.CommitTree(commit.KVLM.Tree, []string{parent}, message)
+	assert.NoError(t, err)
+	return sha
+}
+
+func assertNoRebase(t *testing.T, r *repository.Repository) {
+	exists, err := afero.Exists(r.FS, filepath.Join(r.Gitdir, "rebase-merge"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRebase(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) {
+		r, master, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", out)
+		assert.Equal(t, "ref: refs/heads/topic\n", readGitFile(t, r, "HEAD"))
+		assert.Equal(t, master, mustResolve(t, r, "topic~2"))
+		head, commit := readHeadCommit(t, r)
+		assert.Equal(t, mustResolve(t, r, "topic"), head)
+		assert.Equal(t, "change h", commit.KVLM.Message)
+		assert.Equal(t, "1\nT\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "second\n", readWorktreeFile(t, r, "h"))
+		assertNoRebase(t, r)
+
+		reflog, err := r.Reflog("HEAD")
+		assert.NoError(t, err)
+		messages := []string{}
+		for _, e := range reflog[len(reflog)-4:] {
+			messages = append(messages, e.Message)
+		}
+		assert.Equal(t, []string{"rebase (start): checkout master", "rebase (pick): topic", "rebase (pick): change h",
+			"rebase (finish): returning to refs/heads/topic"}, messages)
+
+		out, clean, err = r.Rebase(&repository.Rebase{Upstream: "master"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Current branch topic is up to date.\n", out)
+	})
+
+	t.Run("Onto", func(t *testing.T) {
+		r, master, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		_, clean, err := r.Rebase(&repository.Rebase{Upstream: "topic~1", Branch: "topic", Onto: "master"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Continue", func(t *testing.T) {
+		r, master, topic, _ := newRebaseRepository(t, "1\nM\n3\n4\n5\n6\n7\n")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "Auto-merging f\nCONFLICT (content): Merge conflict in f\nerror: could not apply "+topic[:7]+"... topic\n"+
+			"hint: Resolve all conflicts manually, mark them as resolved with\n"+
+			"hint: \"ggit add/rm <conflicted_files>\", then run \"ggit rebase --continue\".\n"+
+			"hint: You can instead skip this commit: run \"ggit rebase --skip\".\n"+
+			"hint: To abort and get back to the state before \"ggit rebase\", run \"ggit rebase --abort\".\n"+
+			"Could not apply "+topic[:7]+"... topic\n", out)
+		assert.Equal(t, master+"\n", readGitFile(t, r, "HEAD"))
+		assert.Equal(t, topic+"\n", readGitFile(t, r, "rebase-merge/stopped-sha"))
+
+		_, _, err = r.Rebase(&repository.Rebase{Upstream: "master"})
+		assert.ErrorContains(t, err, "It seems that there is already a rebase-merge directory")
+		_, _, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.EqualError(t, err, "f: needs merge\nYou must edit all merge conflicts and then\nmark them as resolved using ggit add")
+
+		writeWorktreeFile(t, r, "f", "1\nR\n3\n4\n5\n6\n7\n")
+		assert.NoError(t, r.Add([]string{"f"}))
+		out, clean, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, "[detached HEAD ")
+		assert.Contains(t, out, "] topic\n")
+		assert.Contains(t, out, "Successfully rebased and updated refs/heads/topic.\n")
+		resolved := mustReadCommit(t, r, "topic~1")
+		assert.Equal(t, []string{master}, resolved.KVLM.Parents)
+		assert.Equal(t, "1\nR\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assertNoRebase(t, r)
+
+		_, _, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.EqualError(t, err, "No rebase in progress?")
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		r, master, _, _ := newRebaseRepository(t, "1\nM\n3\n4\n5\n6\n7\n")
+		_, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		out, clean, err := r.Rebase(&repository.Rebase{Skip: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", out)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "1\nM\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		r, _, _, second := newRebaseRepository(t, "1\nM\n3\n4\n5\n6\n7\n")
+		_, _, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.NoError(t, err)
+		_, clean, err := r.Rebase(&repository.Rebase{Abort: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "ref: refs/heads/topic\n", readGitFile(t, r, "HEAD"))
+		assert.Equal(t, second, mustResolve(t, r, "topic"))
+		assert.Equal(t, "1\nT\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{0}, readIndexStages(t, r, "f"))
+		assertNoRebase(t, r)
+	})
+
+	t.Run("RewordSquash", func(t *testing.T) {
+		r, master, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		t.Setenv("GGIT_SEQUENCE_EDITOR", "sed -i -e '1s/^pick/reword/' -e '2s/^pick/squash/'")
+		t.Setenv("GGIT_EDITOR", "sed -i '1s/$/ edited/'")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Interactive: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, "] topic edited\n")
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, "topic edited\n\nchange h", commit.KVLM.Message)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "A U Thor <author@example.com> 1000 +0000", commit.KVLM.Author)
+		assert.Equal(t, "second\n", readWorktreeFile(t, r, "h"))
+	})
+
+	t.Run("EditDrop", func(t *testing.T) {
+		r, master, _, second := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		t.Setenv("GGIT_SEQUENCE_EDITOR", "sed -i -e '1s/^pick/drop/' -e '2s/^pick/edit/'")
+		t.Setenv("GGIT_EDITOR", ":")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Interactive: true, Branch: "topic"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Stopped at "+second[:7]+"...  change h\nYou can amend the commit now, with\n\n  ggit commit --amend \n\n"+
+			"Once you are satisfied with your changes, run\n\n  ggit rebase --continue\n", out)
+
+		writeWorktreeFile(t, r, "h", "amended\n")
+		assert.NoError(t, r.Add([]string{"h"}))
+		out, clean, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Contains(t, out, "] change h\n")
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "amended\n", readWorktreeFile(t, r, "h"))
+	})
+
+	t.Run("InvalidTodo", func(t *testing.T) {
+		r, master, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		t.Setenv("GGIT_SEQUENCE_EDITOR", "sed -i '1s/^pick/bogus/'")
+		_, _, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Interactive: true})
+		assert.ErrorContains(t, err, "invalid command 'bogus' in line 1")
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assertNoRebase(t, r)
+
+		t.Setenv("GGIT_SEQUENCE_EDITOR", "sed -i '/^pick/d'")
+		_, _, err = r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Interactive: true})
+		assert.EqualError(t, err, "nothing to do")
+		assertNoRebase(t, r)
+	})
+
+	t.Run("Autosquash", func(t *testing.T) {
+		r, master, topic, second := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		fixup := commitChange(t, r, "topic", "z", "fixed\n")
+		fixup = commitWithMessage(t, r, fixup, second, "fixup! topic")
+		assert.NoError(t, r.UpdateRef("refs/heads/topic", fixup, second, "commit: fixup"))
+		t.Setenv("GGIT_SEQUENCE_EDITOR", ":")
+		_, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Interactive: true, Autosquash: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, "change h", commit.KVLM.Message)
+		fixed := mustReadCommit(t, r, "topic~1")
+		assert.Equal(t, "topic", fixed.KVLM.Message)
+		assert.Equal(t, []string{master}, fixed.KVLM.Parents)
+		assert.NotEqual(t, topic, mustResolve(t, r, "topic~1"))
+		assert.Equal(t, "fixed\n", readWorktreeFile(t, r, "z"))
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		r, _, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Exec: []string{"echo ran"}})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Executing: echo ran\nran\nExecuting: echo ran\nran\nSuccessfully rebased and updated refs/heads/topic.\n", out)
+	})
+
+	t.Run("ExecFailure", func(t *testing.T) {
+		r, _, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		out, clean, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic", Exec: []string{"false"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "Executing: false\nwarning: execution failed: false\nYou can fix the problem, and then run\n\n  ggit rebase --continue\n\n\n", out)
+		assert.Equal(t, "1\nT\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+
+		_, clean, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		out, clean, err = r.Rebase(&repository.Rebase{Continue: true})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", out)
+	})
+
+	t.Run("LocalChanges", func(t *testing.T) {
+		r, _, _, _ := newRebaseRepository(t, "1\n2\n3\n4\n5\n6\nM\n")
+		writeWorktreeFile(t, r, "g", "changed\n")
+		_, _, err := r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.EqualError(t, err, "cannot rebase: You have unstaged changes.\nPlease commit or stash them.")
+		assert.NoError(t, r.Add([]string{"g"}))
+		_, _, err = r.Rebase(&repository.Rebase{Upstream: "master", Branch: "topic"})
+		assert.EqualError(t, err, "cannot rebase: Your index contains uncommitted changes.\nPlease commit or stash them.")
+		assertNoRebase(t, r)
+	})
+}
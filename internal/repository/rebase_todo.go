@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Commands of rebase todo lists.
+const (
+	rebasePick   = "pick"
+	rebaseReword = "reword"
+	rebaseEdit   = "edit"
+	rebaseSquash = "squash"
+	rebaseFixup  = "fixup"
+	rebaseExec   = "exec"
+	rebaseBreak  = "break"
+	rebaseDrop   = "drop"
+)
+
+var rebaseAbbreviations = map[string]string{
+	"p": rebasePick,
+	"r": rebaseReword,
+	"e": rebaseEdit,
+	"s": rebaseSquash,
+	"f": rebaseFixup,
+	"x": rebaseExec,
+	"b": rebaseBreak,
+	"d": rebaseDrop,
+}
+
+// rebaseStep is a line of a rebase todo list: a command on a commit
+// followed by its subject, or an exec command followed by the shell
+// command to run.
+type rebaseStep struct {
+	command string
+	commit  string
+	arg     string
+}
+
+// takesCommit reports whether the step applies a commit.
+func (s rebaseStep) takesCommit() bool {
+	return s.command != rebaseExec && s.command != rebaseBreak
+}
+
+// format returns the todo line of the step, with the abbreviated ID of
+// its commit when short is set.
+func (s rebaseStep) format(short bool) string {
+	if !s.takesCommit() {
+		return strings.TrimSpace(s.command + " " + s.arg)
+	}
+	sha := s.commit
+	if short {
+		sha = shortID(sha)
+	}
+	return fmt.Sprintf("%s %s %s", s.command, sha, s.arg)
+}
+
+func formatRebaseTodo(steps []rebaseStep, short bool) string {
+	var b strings.Builder
+	for _, s := range steps {
+		b.WriteString(s.format(short) + "\n")
+	}
+	return b.String()
+}
+
+// parseRebaseTodo parses a todo list, skipping empty and comment lines.
+// Commands may be abbreviated to their first letter.
+//
+// Returns:
+//   - The steps of the list.
+//   - An error naming the first invalid line.
+func (r *Repository) parseRebaseTodo(todo string) ([]rebaseStep, error) {
+	steps := []rebaseStep{}
+	for n, line := range strings.Split(todo, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		command, rest, _ := strings.Cut(line, " ")
+		if full, ok := rebaseAbbreviations[command]; ok {
+			command = full
+		}
+		step := rebaseStep{command: command}
+		switch command {
+		case rebaseExec:
+			if step.arg = strings.TrimSpace(rest); step.arg == "" {
+				return nil, fmt.Errorf("missing command in line %d: '%s'", n+1, line)
+			}
+		case rebaseBreak:
+		case rebasePick, rebaseReword, rebaseEdit, rebaseSquash, rebaseFixup, rebaseDrop:
+			rev, arg, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			sha, err := r.ResolveCommit(rev)
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %d: %s", n+1, line)
+			}
+			step.commit, step.arg = sha, arg
+		default:
+			return nil, fmt.Errorf("invalid command '%s' in line %d: %s", command, n+1, line)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// rebaseTodoHelp returns the comment appended to todo lists given to the
+// sequence editor.
+func rebaseTodoHelp(from string, to string, onto string, count int) string {
+	commands := "command"
+	if count != 1 {
+		commands = "commands"
+	}
+	return fmt.Sprintf(`
+# Rebase %s..%s onto %s (%d %s)
+#
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'ggit rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`, shortID(from), shortID(to), shortID(onto), count, commands)
+}
+
+// autosquash moves the commits whose subject starts with "fixup! " or
+// "squash! " right after the commit they name, turning them into fixup
+// and squash steps. The named commit is the first earlier one with that
+// subject, with that abbreviated ID, or else whose subject starts with it.
+// Several fixups of a commit keep their order.
+func autosquash(steps []rebaseStep) []rebaseStep {
+	subjects := map[string]int{}
+	fixups := make([][]int, len(steps))
+	moved := make([]bool, len(steps))
+	for i, s := range steps {
+		if s.command != rebasePick {
+			continue
+		}
+		command, name := "", ""
+		for _, prefix := range []string{rebaseFixup, rebaseSquash} {
+			if rest, ok := strings.CutPrefix(s.arg, prefix+"! "); ok {
+				command, name = prefix, strings.TrimSpace(rest)
+				break
+			}
+		}
+		if command != "" {
+			target, found := subjects[name]
+			for j := 0; !found && j < i; j++ {
+				if steps[j].command == rebasePick && !strings.Contains(name, " ") && name != "" && strings.HasPrefix(steps[j].commit, name) {
+					target, found = j, true
+				}
+			}
+			for j := 0; !found && j < i; j++ {
+				if steps[j].command == rebasePick && strings.HasPrefix(steps[j].arg, name) {
+					target, found = j, true
+				}
+			}
+			if found {
+				steps[i].command = command
+				fixups[target] = append(fixups[target], i)
+				moved[i] = true
+			}
+		}
+		if _, ok := subjects[s.arg]; !ok {
+			subjects[s.arg] = i
+		}
+	}
+
+	sorted := make([]rebaseStep, 0, len(steps))
+	var add func(i int)
+	add = func(i int) {
+		sorted = append(sorted, steps[i])
+		for _, f := range fixups[i] {
+			add(f)
+		}
+	}
+	for i := range steps {
+		if !moved[i] {
+			add(i)
+		}
+	}
+	return sorted
+}
+
+// insertExec adds exec steps running the commands after each commit of a
+// todo list, once its fixups and squashes are applied.
+func insertExec(steps []rebaseStep, commands []string) []rebaseStep {
+	if len(commands) == 0 {
+		return steps
+	}
+	execs := make([]rebaseStep, len(commands))
+	for i, c := range commands {
+		execs[i] = rebaseStep{command: rebaseExec, arg: c}
+	}
+	result := []rebaseStep{}
+	for i, s := range steps {
+		result = append(result, s)
+		if !s.takesCommit() || s.command == rebaseDrop {
+			continue
+		}
+		if i+1 < len(steps) && (steps[i+1].command == rebaseSquash || steps[i+1].command == rebaseFixup) {
+			continue
+		}
+		result = append(result, execs...)
+	}
+	return result
+}
@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	symrefPrefix   = "ref: "
+	packedRefsFile = "packed-refs"
+	logsDir        = "logs"
+	// maxSymrefDepth limits how many symbolic refs are followed.
+	maxSymrefDepth = 5
+)
+
+// refRules are the places a short ref name is looked up, in order.
+func refRules() []string {
+	return []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"}
+}
+
+// readRef reads a single loose or packed ref without following it.
+//
+// Returns:
+//   - The object ID the ref points to, or the name of the ref a symbolic
+//     ref points to.
+//   - Whether the ref is symbolic.
+//   - ErrorRefNotFound if the ref does not exist, or an error if it can
+//     not be read or is malformed.
+func (r *Repository) readRef(name string) (string, bool, error) {
+	path := r.path(name)
+	if filesystem.IsFile(r.FS, path) {
+		data, err := filesystem.ReadFileData(r.FS, path)
+		if err != nil {
+			return "", false, err
+		}
+		data = strings.TrimSpace(data)
+		if target, ok := strings.CutPrefix(data, symrefPrefix); ok {
+			return strings.TrimSpace(target), true, nil
+		}
+		if !r.ObjectFormat().IsID(data) {
+			return "", false, fmt.Errorf("%w: %s is not a valid ref", ErrorRefNotFound, name)
+		}
+		return data, false, nil
+	}
+
+	packed, err := r.packedRefs()
+	if err != nil {
+		return "", false, err
+	}
+	if sha, ok := packed[name]; ok {
+		return sha, false, nil
+	}
+	return "", false, fmt.Errorf("%w: %s", ErrorRefNotFound, name)
+}
+
+// packedRefs reads the refs stored in the packed-refs file.
+func (r *Repository) packedRefs() (map[string]string, error) {
+	refs := map[string]string{}
+	path := r.path(packedRefsFile)
+	if !filesystem.IsFile(r.FS, path) {
+		return refs, nil
+	}
+	data, err := filesystem.ReadFileData(r.FS, path)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		sha, name, ok := strings.Cut(line, " ")
+		if !ok || len(sha) != r.ObjectFormat().HexSize() {
+			return nil, fmt.Errorf("malformed packed-refs line %q", line)
+		}
+		refs[name] = sha
+	}
+	return refs, nil
+}
+
+// listRefs lists the loose and packed refs below refs/.
+//
+// Returns:
+//   - The names of the refs, sorted.
+//   - An error if the refs can not be read.
+func (r *Repository) listRefs() ([]string, error) {
+	names, err := r.listFiles("refs")
+	if err != nil {
+		return nil, err
+	}
+	for i := range names {
+		names[i] = "refs/" + names[i]
+	}
+	packed, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name := range packed {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// listFiles lists the files below a directory of the repository, by their
+// slash separated path relative to it.
+func (r *Repository) listFiles(dir string) ([]string, error) {
+	root := r.path(dir)
+	files := []string{}
+	if !filesystem.IsDir(r.FS, root) {
+		return files, nil
+	}
+	err := afero.Walk(r.FS, root, func(full string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, full)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// ResolveRef follows a ref, and the symbolic refs it points to, down to an
+// object ID.
+//
+// Returns:
+//   - The object ID the ref points to.
+//   - ErrorRefNotFound if the ref, or a ref it points to, does not exist.
+func (r *Repository) ResolveRef(name string) (string, error) {
+	for i := 0; i < maxSymrefDepth; i++ {
+		target, symbolic, err := r.readRef(name)
+		if err != nil {
+			return "", err
+		}
+		if !symbolic {
+			return target, nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("symbolic ref %s nested too deeply", name)
+}
+
+// SymbolicRef returns the name of the ref a symbolic ref such as HEAD
+// points to. The target does not have to exist yet.
+func (r *Repository) SymbolicRef(name string) (string, error) {
+	target, symbolic, err := r.readRef(name)
+	if err != nil {
+		return "", err
+	}
+	if !symbolic {
+		return "", fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+	return target, nil
+}
+
+// DwimRef expands a short ref name such as "master" or "origin/main" using
+// git's lookup rules.
+//
+// Returns:
+//   - The full name of the first matching ref, e.g. "refs/heads/master".
+//   - The object ID it points to.
+//   - ErrorRefNotFound if no ref matches.
+func (r *Repository) DwimRef(name string) (string, string, error) {
+	if name == "" || strings.Contains(name, "..") {
+		return "", "", fmt.Errorf("%w: %s", ErrorRefNotFound, name)
+	}
+	if name == "@" {
+		name = headFile
+	}
+	for _, rule := range refRules() {
+		full := fmt.Sprintf(rule, name)
+		sha, err := r.ResolveRef(full)
+		if err == nil {
+			return full, sha, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %s", ErrorRefNotFound, name)
+}
+
+// ReflogEntry is a single update of a ref as recorded in its reflog.
+type ReflogEntry struct {
+	Old     string
+	New     string
+	Who     objects.Ident
+	Message string
+}
+
+// Reflog reads the reflog of a ref, oldest entry first. A ref without a
+// reflog has no entries.
+//
+// Returns:
+//   - The entries of the reflog.
+//   - An error if the reflog can not be read or is malformed.
+func (r *Repository) Reflog(name string) ([]ReflogEntry, error) {
+	path := r.path(logsDir, name)
+	if !filesystem.IsFile(r.FS, path) {
+		return nil, nil
+	}
+	data, err := filesystem.ReadFileData(r.FS, path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []ReflogEntry{}
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields, message, _ := strings.Cut(line, "\t")
+		old, rest, _ := strings.Cut(fields, " ")
+		sha, who, _ := strings.Cut(rest, " ")
+		ident, err := objects.ParseIdent(who)
+		if err != nil || len(old) != r.ObjectFormat().HexSize() || len(sha) != r.ObjectFormat().HexSize() {
+			return nil, fmt.Errorf("malformed reflog entry %q of %s", line, name)
+		}
+		entries = append(entries, ReflogEntry{Old: old, New: sha, Who: ident, Message: message})
+	}
+	return entries, nil
+}
+
+// deleteReflogEntry removes the n-th newest entry, from zero, of the
+// reflog of the ref name.
+//
+// Returns:
+//   - An error if the reflog has no such entry or can not be rewritten.
+func (r *Repository) deleteReflogEntry(name string, n int) error {
+	data, err := filesystem.ReadFileData(r.FS, r.path(logsDir, name))
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(data, "\n"), "\n")
+	if n < 0 || n >= len(lines) {
+		return fmt.Errorf("log for '%s' only has %d entries", name, len(lines))
+	}
+	lines = slices.Delete(lines, len(lines)-1-n, len(lines)-n)
+	data = strings.Join(lines, "")
+	if data != "" && !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	return r.ReplaceTextFile(data, logsDir, name)
+}
+
+// logsUpdates reports whether updates of the ref name are recorded in a
+// reflog: HEAD, branches, remote-tracking branches and notes always are,
+// other refs only when they already have a reflog.
+func (r *Repository) logsUpdates(name string) bool {
+	if name == headFile || filesystem.IsFile(r.FS, r.path(logsDir, name)) {
+		return true
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendReflog records an update of the ref name in its reflog.
+func (r *Repository) appendReflog(name string, old string, sha string, message string) error {
+	if old == "" {
+		old = r.ObjectFormat().NullID()
+	}
+	who := r.reflogIdent()
+	line := fmt.Sprintf("%s %s %s\t%s\n", old, sha, who, strings.ReplaceAll(message, "\n", " "))
+	path := r.path(logsDir, name)
+	if err := r.FS.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return filesystem.WriteStringToFile(r.FS, line, path)
+}
+
+// UpdateRef points the ref name at sha and records the update in the
+// reflogs of the ref and, when HEAD points to the ref, of HEAD. When old is
+// not empty the ref must currently point to old; the null object ID
+// requires the ref not to exist yet.
+//
+// Returns:
+//   - An error if the ref does not point to old or can not be written.
+func (r *Repository) UpdateRef(name string, sha string, old string, message string) error {
+	current, err := r.ResolveRef(name)
+	if err != nil && !errors.Is(err, ErrorRefNotFound) {
+		return err
+	}
+	if old == r.ObjectFormat().NullID() {
+		old = ""
+		if current != "" {
+			return fmt.Errorf("cannot lock ref '%s': reference already exists", name)
+		}
+	}
+	if old != "" && old != current {
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", name, current, old)
+	}
+	target := name
+	if head, err := r.SymbolicRef(name); err == nil {
+		target = head
+	}
+	if err := r.ReplaceTextFile(sha+"\n", strings.Split(target, "/")...); err != nil {
+		return err
+	}
+	if r.logsUpdates(target) {
+		if err := r.appendReflog(target, current, sha, message); err != nil {
+			return err
+		}
+	}
+	if head, err := r.SymbolicRef(headFile); target != headFile && err == nil && head == target {
+		return r.appendReflog(headFile, current, sha, message)
+	}
+	return nil
+}
+
+// DeleteRef removes the loose and packed versions of the ref name and its
+// reflog.
+//
+// Returns:
+//   - ErrorRefNotFound if the ref does not exist, or an error if it can not
+//     be removed.
+func (r *Repository) DeleteRef(name string) error {
+	if _, _, err := r.readRef(name); err != nil {
+		return err
+	}
+	if filesystem.IsFile(r.FS, r.path(name)) {
+		if err := r.FS.Remove(r.path(name)); err != nil {
+			return err
+		}
+		if err := r.removeEmptyRefDirs(name); err != nil {
+			return err
+		}
+	}
+	packed, err := r.packedRefs()
+	if err != nil {
+		return err
+	}
+	if _, ok := packed[name]; ok {
+		if err := r.rewritePackedRefs(name); err != nil {
+			return err
+		}
+	}
+	if filesystem.IsFile(r.FS, r.path(logsDir, name)) {
+		return r.FS.Remove(r.path(logsDir, name))
+	}
+	return nil
+}
+
+// removeEmptyRefDirs removes the directories of the ref name left empty
+// once it is removed, up to refs/ and its direct subdirectories.
+func (r *Repository) removeEmptyRefDirs(name string) error {
+	for dir := path.Dir(name); strings.Count(dir, "/") > 1; dir = path.Dir(dir) {
+		entries, err := afero.ReadDir(r.FS, r.path(dir))
+		if err != nil || len(entries) > 0 {
+			return nil
+		}
+		if err := r.FS.Remove(r.path(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewritePackedRefs rewrites the packed-refs file without the ref name and
+// the peeled line following it.
+func (r *Repository) rewritePackedRefs(name string) error {
+	data, err := filesystem.ReadFileData(r.FS, r.path(packedRefsFile))
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	skipping := false
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if line == "" || (skipping && line[0] == '^') {
+			continue
+		}
+		_, ref, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		skipping = line[0] != '#' && line[0] != '^' && ref == name
+		if !skipping {
+			b.WriteString(line)
+		}
+	}
+	return r.ReplaceTextFile(b.String(), packedRefsFile)
+}
+
+// SetSymbolicRef points the symbolic ref name, usually HEAD, at the ref
+// target.
+func (r *Repository) SetSymbolicRef(name string, target string) error {
+	return r.ReplaceTextFile(symrefPrefix+target+"\n", strings.Split(name, "/")...)
+}
+
+// DetachHead points HEAD directly at sha, off the branch it was on, and
+// records the move in its reflog.
+func (r *Repository) DetachHead(sha string, message string) error {
+	current, err := r.headCommit()
+	if err != nil {
+		return err
+	}
+	if err := r.ReplaceTextFile(sha+"\n", headFile); err != nil {
+		return err
+	}
+	return r.appendReflog(headFile, current, sha, message)
+}
+
+// UpdateHead moves the current branch, or HEAD itself when it is detached,
+// to sha.
+func (r *Repository) UpdateHead(sha string, message string) error {
+	return r.UpdateRef(headFile, sha, "", message)
+}
@@ -0,0 +1,198 @@
+package repository_test
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCommit writes a commit of the empty tree made at the given time.
+func writeCommit(t *testing.T, r *repository.Repository, when int64, parents ...string) string {
+	commit := objects.NewCommit()
+	commit.KVLM.Tree = objects.EmptyTreeHash
+	commit.KVLM.Parents = parents
+	commit.KVLM.Author = fmt.Sprintf("A U Thor <author@example.com> %d +0000", when)
+	commit.KVLM.Comitter = commit.KVLM.Author
+	commit.KVLM.Message = fmt.Sprintf("commit %d", when)
+	sha, err := r.WriteObject(commit)
+	assert.NoError(t, err)
+	return sha
+}
+
+func writeRef(t *testing.T, r *repository.Repository, name string, target string) {
+	assert.NoError(t, r.WriteTextToFile(target+"\n", name))
+}
+
+func TestRefs(t *testing.T) {
+	r := newTestRepository(t)
+	root := writeCommit(t, r, 1000)
+	child := writeCommit(t, r, 1001, root)
+	tagged := writeCommit(t, r, 1002, child)
+
+	writeRef(t, r, "refs/heads/master", child)
+	writeRef(t, r, "refs/remotes/origin/HEAD", "ref: refs/remotes/origin/main")
+	writeRef(t, r, "refs/remotes/origin/main", root)
+	assert.NoError(t, r.WriteTextToFile("# pack-refs with: peeled\n"+tagged+" refs/tags/v1.0\n", "packed-refs"))
+
+	t.Run("ResolveRef", func(t *testing.T) {
+		sha, err := r.ResolveRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, child, sha)
+
+		sha, err = r.ResolveRef("refs/tags/v1.0")
+		assert.NoError(t, err)
+		assert.Equal(t, tagged, sha)
+
+		_, err = r.ResolveRef("refs/heads/missing")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("SymbolicRef", func(t *testing.T) {
+		target, err := r.SymbolicRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "refs/heads/master", target)
+
+		_, err = r.SymbolicRef("refs/heads/master")
+		assert.Error(t, err)
+	})
+
+	t.Run("DwimRef", func(t *testing.T) {
+		for short, full := range map[string]string{
+			"master": "refs/heads/master",
+			"v1.0":   "refs/tags/v1.0",
+			"origin": "refs/remotes/origin/HEAD",
+			"@":      "HEAD",
+		} {
+			name, _, err := r.DwimRef(short)
+			assert.NoError(t, err)
+			assert.Equal(t, full, name)
+		}
+		_, _, err := r.DwimRef("config")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("ResolveRevision", func(t *testing.T) {
+		for rev, expected := range map[string]string{
+			"HEAD":              child,
+			"master~1":          root,
+			"v1.0~2":            root,
+			"v1.0^^":            root,
+			"HEAD^0":            child,
+			"origin/main":       root,
+			child[:8] + "^1":    root,
+			"HEAD^{tree}":       objects.EmptyTreeHash,
+			"v1.0^{commit}~1":   child,
+			"refs/heads/master": child,
+		} {
+			sha, err := r.ResolveRevision(rev)
+			assert.NoError(t, err, rev)
+			assert.Equal(t, expected, sha, rev)
+		}
+		for _, invalid := range []string{"HEAD~3", "HEAD^2", "missing", "HEAD^{blob}", "HEAD^{"} {
+			_, err := r.ResolveRevision(invalid)
+			assert.Error(t, err, invalid)
+		}
+		_, err := r.ResolveCommit("HEAD^{tree}")
+		assert.Error(t, err)
+	})
+
+	t.Run("Reflog", func(t *testing.T) {
+		entries, err := r.Reflog("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		log := "0000000000000000000000000000000000000000 " + root + " A U Thor <author@example.com> 1000 +0000\tcommit (initial): root\n" +
+			root + " " + child + " A U Thor <author@example.com> 1001 +0000\tcommit: child\n"
+		assert.NoError(t, r.WriteTextToFile(log, "logs", "refs", "heads", "master"))
+		entries, err = r.Reflog("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, child, entries[1].New)
+		assert.Equal(t, "commit: child", entries[1].Message)
+		assert.Equal(t, int64(1001), entries[1].Who.When)
+
+		assert.NoError(t, r.WriteTextToFile("garbage\n", "logs", "refs", "heads", "broken"))
+		_, err = r.Reflog("refs/heads/broken")
+		assert.Error(t, err)
+	})
+}
+
+func TestUpdateRef(t *testing.T) {
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	t.Setenv("GGIT_COMMITTER_DATE", "1500 +0000")
+	r := newTestRepository(t)
+	root := writeCommit(t, r, 1000)
+	child := writeCommit(t, r, 1001, root)
+	null := "0000000000000000000000000000000000000000"
+
+	t.Run("UpdateHead", func(t *testing.T) {
+		assert.NoError(t, r.UpdateHead(root, "commit (initial): root"))
+		assert.NoError(t, r.UpdateHead(child, "commit: child"))
+
+		sha, err := r.ResolveRef("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Equal(t, child, sha)
+		for _, name := range []string{"HEAD", "refs/heads/master"} {
+			entries, err := r.Reflog(name)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 2, name)
+			assert.Equal(t, null, entries[0].Old)
+			assert.Equal(t, root, entries[1].Old)
+			assert.Equal(t, "commit: child", entries[1].Message)
+			assert.Equal(t, "C O Mitter", entries[1].Who.Name)
+		}
+	})
+
+	t.Run("Old", func(t *testing.T) {
+		assert.Error(t, r.UpdateRef("refs/heads/master", root, root, "reset"))
+		assert.Error(t, r.UpdateRef("refs/heads/master", root, null, "branch: Created"))
+		assert.NoError(t, r.UpdateRef("refs/heads/topic", root, null, "branch: Created"))
+		assert.NoError(t, r.UpdateRef("refs/heads/topic", child, root, "merge"))
+
+		entries, err := r.Reflog("HEAD")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2, "topic is not the current branch")
+	})
+
+	t.Run("Detached", func(t *testing.T) {
+		assert.NoError(t, r.WriteTextToFile(root+"\n", "refs", "tags", "v1"))
+		assert.NoError(t, r.UpdateRef("refs/tags/v1", child, "", "tag"))
+		entries, err := r.Reflog("refs/tags/v1")
+		assert.NoError(t, err)
+		assert.Empty(t, entries, "tags have no reflog")
+
+		assert.NoError(t, r.ReplaceTextFile(child+"\n", "HEAD"))
+		assert.NoError(t, r.UpdateHead(root, "checkout: moving to root"))
+		sha, err := r.ResolveRef("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Equal(t, child, sha)
+		entries, err = r.Reflog("HEAD")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 3)
+
+		assert.NoError(t, r.SetSymbolicRef("HEAD", "refs/heads/topic"))
+		target, err := r.SymbolicRef("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "refs/heads/topic", target)
+	})
+
+	t.Run("DeleteRef", func(t *testing.T) {
+		assert.NoError(t, r.WriteTextToFile(root+" refs/heads/packed\n", "packed-refs"))
+		assert.NoError(t, r.DeleteRef("refs/heads/packed"))
+		_, err := r.ResolveRef("refs/heads/packed")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+
+		assert.NoError(t, r.DeleteRef("refs/heads/master"))
+		_, err = r.ResolveRef("refs/heads/master")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		entries, err := r.Reflog("refs/heads/master")
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		assert.ErrorIs(t, r.DeleteRef("refs/heads/master"), repository.ErrorRefNotFound)
+	})
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refspec maps the refs of a source repository, Src, to the refs of a
+// destination one, Dst: the remote refs to local refs for fetch, the
+// other way around for push. A "*" of Src matches any part of a ref name,
+// which replaces the "*" of Dst.
+type Refspec struct {
+	// Force allows updates that are no fast-forward, from a "+" prefix.
+	Force bool
+	// Negative refspecs, with a "^" prefix, exclude the refs Src matches
+	// from the ones the other refspecs map.
+	Negative bool
+	Src      string
+	Dst      string
+}
+
+// ParseRefspec parses a refspec such as "+refs/heads/*:refs/remotes/origin/*"
+// or "^refs/heads/wip/*". The source of a fetch refspec is a ref name or a
+// glob; the source of a push refspec may be any revision, and is empty to
+// delete the destination.
+//
+// Returns:
+//   - The refspec.
+//   - An error if the refspec is malformed.
+func ParseRefspec(spec string, fetch bool) (*Refspec, error) {
+	s := &Refspec{}
+	rest := spec
+	if after, ok := strings.CutPrefix(rest, "^"); ok {
+		s.Negative, rest = true, after
+	} else if after, ok := strings.CutPrefix(rest, "+"); ok {
+		s.Force, rest = true, after
+	}
+	colon := strings.LastIndex(rest, ":")
+	s.Src, s.Dst = rest, ""
+	if colon >= 0 {
+		s.Src, s.Dst = rest[:colon], rest[colon+1:]
+	}
+
+	invalid := fmt.Errorf("invalid refspec '%s'", spec)
+	globs := strings.Count(s.Src, "*")
+	switch {
+	case s.Negative && (colon >= 0 || s.Src == ""):
+		return nil, invalid
+	case globs > 1 || strings.Count(s.Dst, "*") > 1:
+		return nil, invalid
+	case s.Dst != "" && strings.Count(s.Dst, "*") != globs:
+		return nil, invalid
+	case s.Src == "" && (fetch || colon < 0):
+		return nil, invalid
+	case s.Dst != "" && !validRefName(s.Dst):
+		return nil, invalid
+	case (fetch || globs > 0 || s.Negative) && s.Src != "" && !validRefName(s.Src):
+		return nil, invalid
+	}
+	return s, nil
+}
+
+// validRefName checks a ref name, or a short one, the way git does, a
+// single "*" being allowed for globs.
+func validRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?[\\\x7f") {
+		return false
+	}
+	for _, c := range name {
+		if c < ' ' {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// IsGlob reports whether the refspec maps refs by a "*" pattern.
+func (s *Refspec) IsGlob() bool {
+	return strings.Contains(s.Src, "*")
+}
+
+// String formats the refspec the way it is parsed.
+func (s *Refspec) String() string {
+	if s.Negative {
+		return "^" + s.Src
+	}
+	prefix := ""
+	if s.Force {
+		prefix = "+"
+	}
+	if s.Dst == "" && s.Src != "" {
+		return prefix + s.Src
+	}
+	return prefix + s.Src + ":" + s.Dst
+}
+
+// Match returns the ref the source ref name maps to.
+//
+// Returns:
+//   - The destination ref, empty when the refspec has none.
+//   - Whether the source of the refspec matches name.
+func (s *Refspec) Match(name string) (string, bool) {
+	prefix, suffix, glob := strings.Cut(s.Src, "*")
+	if !glob {
+		return s.Dst, name == s.Src
+	}
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return strings.Replace(s.Dst, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
+
+// parseRefspecs parses a list of refspecs.
+//
+// Returns:
+//   - The refspecs.
+//   - An error if one of them is malformed.
+func parseRefspecs(specs []string, fetch bool) ([]*Refspec, error) {
+	parsed := make([]*Refspec, 0, len(specs))
+	for _, spec := range specs {
+		s, err := ParseRefspec(spec, fetch)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, s)
+	}
+	return parsed, nil
+}
+
+// excludedRef reports whether a negative refspec of specs matches the ref
+// name.
+func excludedRef(specs []*Refspec, name string) bool {
+	for _, s := range specs {
+		if _, ok := s.Match(name); ok && s.Negative {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteURL rewrites a URL by url.<base>.insteadOf: the URL starting with
+// the longest of these prefixes has it replaced by its base. For push,
+// url.<base>.pushInsteadOf is tried first.
+func (r *Repository) rewriteURL(url string, push bool) string {
+	keys := []string{"insteadof"}
+	if push {
+		keys = []string{"pushinsteadof", "insteadof"}
+	}
+	for _, key := range keys {
+		base, longest := "", -1
+		for _, e := range r.Config.List("") {
+			rest, ok := strings.CutPrefix(e.Name, "url.")
+			if !ok || !strings.HasSuffix(rest, "."+key) {
+				continue
+			}
+			if strings.HasPrefix(url, e.Value) && len(e.Value) > longest {
+				base, longest = strings.TrimSuffix(rest, "."+key), len(e.Value)
+			}
+		}
+		if longest >= 0 {
+			return base + url[longest:]
+		}
+	}
+	return url
+}
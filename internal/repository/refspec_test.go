@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRefspec(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		for spec, want := range map[string]repository.Refspec{
+			"+refs/heads/*:refs/remotes/origin/*": {Force: true, Src: "refs/heads/*", Dst: "refs/remotes/origin/*"},
+			"master":                              {Src: "master"},
+			"refs/heads/a:refs/heads/b":           {Src: "refs/heads/a", Dst: "refs/heads/b"},
+			"^refs/heads/wip/*":                   {Negative: true, Src: "refs/heads/wip/*"},
+			"refs/heads/*-fix:refs/fixes/*":       {Src: "refs/heads/*-fix", Dst: "refs/fixes/*"},
+		} {
+			s, err := repository.ParseRefspec(spec, true)
+			assert.NoError(t, err, spec)
+			assert.Equal(t, want, *s, spec)
+			assert.Equal(t, spec, s.String())
+		}
+	})
+
+	t.Run("Push", func(t *testing.T) {
+		s, err := repository.ParseRefspec(":refs/heads/gone", false)
+		assert.NoError(t, err)
+		assert.Equal(t, repository.Refspec{Dst: "refs/heads/gone"}, *s)
+		s, err = repository.ParseRefspec("HEAD~1:refs/heads/back", false)
+		assert.NoError(t, err)
+		assert.Equal(t, "HEAD~1", s.Src)
+		_, err = repository.ParseRefspec(":refs/heads/gone", true)
+		assert.EqualError(t, err, "invalid refspec ':refs/heads/gone'")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, spec := range []string{
+			"refs/heads/*:refs/remotes/origin/master",
+			"refs/heads/master:refs/remotes/*",
+			"refs/*/*:refs/x/*/*",
+			"^refs/heads/a:refs/heads/b",
+			"^",
+			"refs/heads/a..b",
+			"refs/heads/a b",
+			"refs/heads/x.lock",
+			"refs/heads/.hidden",
+			"refs/heads/",
+			"",
+		} {
+			_, err := repository.ParseRefspec(spec, true)
+			assert.EqualError(t, err, "invalid refspec '"+spec+"'")
+		}
+	})
+}
+
+func TestRefspecMatch(t *testing.T) {
+	s, err := repository.ParseRefspec("+refs/heads/*:refs/remotes/origin/*", true)
+	assert.NoError(t, err)
+	assert.True(t, s.IsGlob())
+	dst, ok := s.Match("refs/heads/feature/x")
+	assert.True(t, ok)
+	assert.Equal(t, "refs/remotes/origin/feature/x", dst)
+	_, ok = s.Match("refs/tags/v1")
+	assert.False(t, ok)
+
+	s, err = repository.ParseRefspec("refs/heads/*-fix:refs/fixes/*", true)
+	assert.NoError(t, err)
+	dst, ok = s.Match("refs/heads/bug-fix")
+	assert.True(t, ok)
+	assert.Equal(t, "refs/fixes/bug", dst)
+	_, ok = s.Match("refs/heads/-fi")
+	assert.False(t, ok)
+
+	s, err = repository.ParseRefspec("refs/heads/master", true)
+	assert.NoError(t, err)
+	dst, ok = s.Match("refs/heads/master")
+	assert.True(t, ok)
+	assert.Equal(t, "", dst)
+}
+
+func TestFetchRefspecs(t *testing.T) {
+	t.Run("Negative", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		writeRef(t, src, "refs/heads/wip/a", head)
+		writeRef(t, src, "refs/heads/done", head)
+		assert.NoError(t, r.Config.Add(repository.ConfigLocal, "remote.origin", "fetch", "^refs/heads/wip/*"))
+
+		out, _, err := r.Fetch(&repository.Fetch{})
+		assert.NoError(t, err)
+		assert.Equal(t, "From /src\n * [new branch]      done       -> origin/done\n", out)
+	})
+
+	t.Run("InsteadOf", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"),
+			"[remote \"mirror\"]\n\turl = mirror:src\n\tfetch = +refs/heads/*:refs/remotes/mirror/*\n"+
+				"[url \"/\"]\n\tinsteadOf = mirror:\n[url \"/nowhere/\"]\n\tinsteadOf = mir\n")
+		out, clean, err := r.Fetch(&repository.Fetch{Remote: "mirror"})
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "From /src\n * [new branch]      master     -> mirror/master\n", out)
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/mirror/master"))
+	})
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Remote is a repository configured by a remote.<name> section.
+type Remote struct {
+	Name string
+	// URLs are where fetches go, rewritten by url.<base>.insteadOf.
+	URLs []string
+	// PushURLs are where pushes go: remote.<name>.pushurl, or the URLs
+	// rewritten by url.<base>.pushInsteadOf first.
+	PushURLs []string
+	Fetch    []string
+}
+
+// defaultFetchRefspec returns the refspec a new remote fetches its
+// branches with, as its remote-tracking branches.
+func defaultFetchRefspec(name string) string {
+	return "+refs/heads/*:refs/remotes/" + name + "/*"
+}
+
+// Remotes lists the configured remotes, in the order the configuration
+// files first mention them.
+func (r *Repository) Remotes() []*Remote {
+	names := []string{}
+	for _, e := range r.Config.List("") {
+		rest, ok := strings.CutPrefix(e.Name, "remote.")
+		if dot := strings.LastIndex(rest, "."); ok && dot > 0 && !slices.Contains(names, rest[:dot]) {
+			names = append(names, rest[:dot])
+		}
+	}
+	remotes := []*Remote{}
+	for _, name := range names {
+		remotes = append(remotes, r.Remote(name))
+	}
+	return remotes
+}
+
+// Remote returns the remote name, nil when it is not configured.
+func (r *Repository) Remote(name string) *Remote {
+	section := "remote." + name
+	urls, fetch := r.Config.GetAll(section, "url"), r.Config.GetAll(section, "fetch")
+	pushURLs := r.Config.GetAll(section, "pushurl")
+	if len(urls) == 0 && len(fetch) == 0 && len(pushURLs) == 0 {
+		return nil
+	}
+	remote := &Remote{Name: name, Fetch: fetch}
+	for _, url := range urls {
+		remote.URLs = append(remote.URLs, r.rewriteURL(url, false))
+	}
+	for _, url := range pushURLs {
+		remote.PushURLs = append(remote.PushURLs, r.rewriteURL(url, false))
+	}
+	if len(pushURLs) == 0 {
+		for _, url := range urls {
+			remote.PushURLs = append(remote.PushURLs, r.rewriteURL(url, true))
+		}
+	}
+	return remote
+}
+
+// checkRemoteName checks name can name a remote, whose remote-tracking
+// branches are below refs/remotes/<name>/.
+func checkRemoteName(name string) error {
+	if !validRefName("refs/remotes/"+name+"/test") || strings.Contains(name, "*") {
+		return fmt.Errorf("'%s' is not a valid remote name", name)
+	}
+	return nil
+}
+
+// AddRemote configures the remote name at url, fetching its branches as
+// the remote-tracking branches refs/remotes/<name>/*.
+//
+// Returns:
+//   - An error if the name is invalid or taken, or the configuration can
+//     not be written.
+func (r *Repository) AddRemote(name string, url string) error {
+	if err := checkRemoteName(name); err != nil {
+		return err
+	}
+	if r.Remote(name) != nil {
+		return fmt.Errorf("remote %s already exists.", name)
+	}
+	if err := r.Config.Set(ConfigLocal, "remote."+name, "url", url); err != nil {
+		return err
+	}
+	return r.Config.Add(ConfigLocal, "remote."+name, "fetch", defaultFetchRefspec(name))
+}
+
+// SetRemoteURL changes the URL of the remote name, or its push URL with
+// push.
+//
+// Returns:
+//   - An error if there is no such remote or the configuration can not be
+//     written.
+func (r *Repository) SetRemoteURL(name string, url string, push bool) error {
+	if r.Remote(name) == nil {
+		return fmt.Errorf("No such remote '%s'", name)
+	}
+	key := "url"
+	if push {
+		key = "pushurl"
+	}
+	return r.Config.Set(ConfigLocal, "remote."+name, key, url)
+}
+
+// RemoveRemote removes the remote name: its section, its remote-tracking
+// branches and the upstream configuration of the branches tracking it.
+//
+// Returns:
+//   - An error if there is no such remote, or the configuration or the
+//     refs can not be written.
+func (r *Repository) RemoveRemote(name string) error {
+	remote := r.Remote(name)
+	if remote == nil {
+		return fmt.Errorf("No such remote: '%s'", name)
+	}
+	refs, err := r.trackingRefs(remote)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := r.DeleteRef(ref); err != nil && !errors.Is(err, ErrorRefNotFound) {
+			return err
+		}
+	}
+	for _, branch := range r.trackingBranches(name) {
+		for _, key := range []string{"remote", "merge"} {
+			if err := r.Config.Unset(ConfigLocal, "branch."+branch, key, true); err != nil && !errors.Is(err, ErrorConfigNotFound) {
+				return err
+			}
+		}
+	}
+	return r.Config.RemoveSection(ConfigLocal, "remote."+name)
+}
+
+// RenameRemote renames the remote name to next: its section, its
+// remote-tracking branches and the default refspec it fetches them with,
+// and the upstream configuration of the branches tracking it.
+//
+// Returns:
+//   - An error if there is no such remote, next is invalid or taken, or
+//     the configuration or the refs can not be written.
+func (r *Repository) RenameRemote(name string, next string) error {
+	remote := r.Remote(name)
+	if remote == nil {
+		return fmt.Errorf("No such remote: '%s'", name)
+	}
+	if err := checkRemoteName(next); err != nil {
+		return err
+	}
+	if r.Remote(next) != nil {
+		return fmt.Errorf("remote %s already exists.", next)
+	}
+	refs, err := r.trackingRefs(remote)
+	if err != nil {
+		return err
+	}
+	if err := r.Config.RenameSection(ConfigLocal, "remote."+name, "remote."+next); err != nil {
+		return err
+	}
+
+	oldPrefix, newPrefix := "refs/remotes/"+name+"/", "refs/remotes/"+next+"/"
+	if len(remote.Fetch) > 0 {
+		if err := r.Config.Unset(ConfigLocal, "remote."+next, "fetch", true); err != nil && !errors.Is(err, ErrorConfigNotFound) {
+			return err
+		}
+		for _, spec := range remote.Fetch {
+			if src, dst, ok := strings.Cut(spec, ":"); ok && strings.HasPrefix(dst, oldPrefix) {
+				spec = src + ":" + newPrefix + strings.TrimPrefix(dst, oldPrefix)
+			}
+			if err := r.Config.Add(ConfigLocal, "remote."+next, "fetch", spec); err != nil {
+				return err
+			}
+		}
+	}
+	for _, branch := range r.trackingBranches(name) {
+		if err := r.Config.Set(ConfigLocal, "branch."+branch, "remote", next); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		renamed, ok := strings.CutPrefix(ref, oldPrefix)
+		if !ok {
+			continue
+		}
+		target, symbolic, err := r.readRef(ref)
+		if err != nil {
+			return err
+		}
+		if symbolic {
+			err = r.SetSymbolicRef(newPrefix+renamed, strings.Replace(target, oldPrefix, newPrefix, 1))
+		} else {
+			err = r.UpdateRef(newPrefix+renamed, target, "", fmt.Sprintf("remote: renamed %s to %s", ref, newPrefix+renamed))
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.DeleteRef(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackingRefs lists the local refs the fetch refspecs of a remote map
+// its refs to.
+func (r *Repository) trackingRefs(remote *Remote) ([]string, error) {
+	specs, err := parseRefspecs(remote.Fetch, true)
+	if err != nil {
+		return nil, err
+	}
+	names, err := r.listRefs()
+	if err != nil {
+		return nil, err
+	}
+	refs := []string{}
+	for _, name := range names {
+		for _, s := range specs {
+			if s.Negative || s.Dst == "" {
+				continue
+			}
+			if _, ok := (&Refspec{Src: s.Dst}).Match(name); ok {
+				refs = append(refs, name)
+				break
+			}
+		}
+	}
+	return refs, nil
+}
+
+// trackingBranches lists the branches whose upstream branch is on the
+// remote name.
+func (r *Repository) trackingBranches(name string) []string {
+	branches := []string{}
+	for _, e := range r.Config.List(ConfigLocal) {
+		rest, ok := strings.CutPrefix(e.Name, "branch.")
+		if branch, isRemote := strings.CutSuffix(rest, ".remote"); ok && isRemote && e.Value == name && !slices.Contains(branches, branch) {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
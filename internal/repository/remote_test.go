@@ -0,0 +1,72 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemote(t *testing.T) {
+	t.Run("Add", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		assert.NoError(t, r.AddRemote("upstream", "/src"))
+		assert.Equal(t, "+refs/heads/*:refs/remotes/upstream/*", r.Config.Get("remote.upstream", "fetch"))
+		assert.Equal(t, []*repository.Remote{
+			{Name: "origin", URLs: []string{"/src"}, PushURLs: []string{"/src"}, Fetch: []string{"+refs/heads/*:refs/remotes/origin/*"}},
+			{Name: "upstream", URLs: []string{"/src"}, PushURLs: []string{"/src"}, Fetch: []string{"+refs/heads/*:refs/remotes/upstream/*"}},
+		}, r.Remotes())
+
+		assert.EqualError(t, r.AddRemote("upstream", "/elsewhere"), "remote upstream already exists.")
+		assert.EqualError(t, r.AddRemote("bad name", "/src"), "'bad name' is not a valid remote name")
+	})
+
+	t.Run("SetURL", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"),
+			"[remote \"origin\"]\n\turl = /src\n[url \"ssh://example.com/\"]\n\tpushInsteadOf = /\n")
+		assert.Equal(t, []string{"ssh://example.com/src"}, r.Remote("origin").PushURLs)
+
+		assert.NoError(t, r.SetRemoteURL("origin", "/moved", false))
+		assert.NoError(t, r.SetRemoteURL("origin", "/push", true))
+		remote := r.Remote("origin")
+		assert.Equal(t, []string{"/moved"}, remote.URLs)
+		assert.Equal(t, []string{"/push"}, remote.PushURLs)
+		assert.EqualError(t, r.SetRemoteURL("nope", "/x", false), "No such remote 'nope'")
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		src, head := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		assert.NoError(t, r.RenameRemote("origin", "upstream"))
+		assert.Nil(t, r.Remote("origin"))
+		assert.Equal(t, []string{"+refs/heads/*:refs/remotes/upstream/*"}, r.Remote("upstream").Fetch)
+		assert.Equal(t, "upstream", r.Config.Get("branch.master", "remote"))
+		assert.Equal(t, head, mustResolve(t, r, "refs/remotes/upstream/master"))
+		target, err := r.SymbolicRef("refs/remotes/upstream/HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "refs/remotes/upstream/master", target)
+		_, err = r.ResolveRef("refs/remotes/origin/master")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		assert.NoDirExists(t, filepath.Join(r.Gitdir, "refs", "remotes", "origin"))
+
+		assert.EqualError(t, r.RenameRemote("origin", "x"), "No such remote: 'origin'")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		src, _ := newCloneSource(t)
+		r := cloneRepository(t, src, "/dst", &repository.Clone{})
+		assert.NoError(t, r.RemoveRemote("origin"))
+		assert.Empty(t, r.Remotes())
+		assert.Empty(t, r.Config.Get("branch.master", "remote"))
+		assert.Empty(t, r.Config.Get("branch.master", "merge"))
+		_, err := r.ResolveRef("refs/remotes/origin/master")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+		assert.Equal(t, mustResolve(t, r, "refs/tags/v1"), mustResolve(t, r, "HEAD"))
+
+		assert.EqualError(t, r.RemoveRemote("origin"), "No such remote: 'origin'")
+	})
+}
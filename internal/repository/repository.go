@@ -1,32 +1,49 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
+	"ggit/internal/cache"
 	"ggit/internal/factory"
 	"ggit/internal/filesystem"
 	"ggit/internal/objects"
-	"ggit/internal/util"
+	"ggit/internal/store"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/spf13/afero"
 )
 
 const (
 	gitdir          = ".ggit"
 	descriptionFile = "description"
 	headFile        = "HEAD"
+	// defaultObjectCacheLimit is the total size of the parsed objects kept
+	// in memory unless core.objectCacheLimit says otherwise.
+	defaultObjectCacheLimit = 32 << 20
 )
 
 type Repository struct {
 	Worktree string
 	Gitdir   string
-	Config   config
-	FS       factory.FS
+	// Prefix is the slash separated path of the current directory relative
+	// to the worktree, empty at its top.
+	Prefix string
+	Config config
+	FS     factory.FS
+	// Objects is where the objects are read from and written to, the
+	// loose and packed objects of the repository directory by default.
+	Objects store.ObjectStore
+	// parsed keeps the objects read recently, by ID.
+	parsed *cache.LRU[string, objects.GitObject]
 }
 
 func GitObjects() []string {
-	return []string{"blob"}
+	return []string{"blob", "commit", "tree"}
 }
 
 // NewRepository creates and initializes a new repository instance.
@@ -48,9 +65,180 @@ func NewRepository(fs factory.FS, cwd string) (*Repository, error) {
 	r.FS = fs
 	r.Config = *NewConfig(r.Gitdir, r.FS)
 	r.Config.Load()
+	r.Objects = r.openObjects()
+	return r, nil
+}
+
+// FindRepository finds the repository the directory cwd belongs to: the
+// first of cwd and its parents holding a .ggit directory. The search does
+// not cross into another filesystem. GGIT_DIR names the repository
+// directory instead, with cwd as its worktree, and GGIT_WORK_TREE names
+// the worktree.
+//
+// Returns:
+//   - The repository, with cwd as its worktree when none was found so that
+//     it can be created there.
+//   - An error if the paths can not be made absolute.
+func FindRepository(fs factory.FS, cwd string) (*Repository, error) {
+	cwd, err := filepath.Abs(cwd)
+	if err != nil {
+		return nil, err
+	}
+	worktree := os.Getenv("GGIT_WORK_TREE")
+	if worktree != "" {
+		if worktree, err = filepath.Abs(worktree); err != nil {
+			return nil, err
+		}
+	}
+	r := &Repository{FS: fs}
+	if dir := os.Getenv("GGIT_DIR"); dir != "" {
+		if r.Gitdir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		r.Worktree = cwd
+	} else if top, dir, ok, err := discover(fs, cwd); err != nil {
+		return nil, err
+	} else if ok {
+		r.Worktree, r.Gitdir = top, dir
+	} else {
+		r.Gitdir = filepath.Join(cwd, gitdir)
+		r.Worktree = cwd
+	}
+	if worktree != "" {
+		r.Worktree = worktree
+	}
+	if r.Worktree != "" {
+		if rel, err := filepath.Rel(r.Worktree, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			r.Prefix = filepath.ToSlash(rel)
+		}
+	}
+	r.Config = *NewConfig(r.Gitdir, r.FS)
+	r.Config.Load()
+	if _, err := objects.LookupHashAlgorithm(r.Config.Get("extensions", "objectformat")); err != nil {
+		return nil, err
+	}
+	r.Objects = r.openObjects()
 	return r, nil
 }
 
+// openObjects returns the store of the objects of the repository
+// directory: the loose objects, which new objects are written to, then the
+// packed ones, then the loose and packed objects of each alternate.
+//
+// It also sets up the cache of the parsed objects, sized by
+// core.objectCacheLimit, and the delta base caches of the packs are sized
+// by core.deltaBaseCacheLimit. An invalid limit leaves the default one.
+func (r *Repository) openObjects() store.ObjectStore {
+	limit, err := r.Config.GetInt("core", "objectcachelimit", defaultObjectCacheLimit)
+	if err != nil {
+		limit = defaultObjectCacheLimit
+	}
+	r.parsed = cache.New[string, objects.GitObject](limit)
+	baseLimit, err := r.Config.GetInt("core", "deltabasecachelimit", store.DefaultDeltaBaseCacheLimit)
+	if err != nil {
+		baseLimit = store.DefaultDeltaBaseCacheLimit
+	}
+
+	stores := []store.ObjectStore{}
+	for _, dir := range append([]string{r.path("objects")}, r.Alternates()...) {
+		packs := store.NewPackStore(r.FS, filepath.Join(dir, "pack"), r.ObjectFormat())
+		packs.SetDeltaBaseCacheLimit(baseLimit)
+		stores = append(stores, store.NewLooseStore(r.FS, dir, r.ObjectFormat()), packs)
+	}
+	return store.NewCompositeStore(stores...)
+}
+
+// discover walks up from dir to the first directory holding a .ggit
+// directory or a .ggit file pointing to one, or being a bare repository
+// itself, stopping at filesystem boundaries.
+//
+// Returns:
+//   - The worktree, empty for a bare repository.
+//   - The repository directory.
+//   - False if there is none.
+//   - An error if a .ggit file can not be read.
+func discover(fs factory.FS, dir string) (string, string, bool, error) {
+	for {
+		dotgit := filepath.Join(dir, gitdir)
+		switch {
+		case filesystem.IsDir(fs, dotgit):
+			return dir, dotgit, true, nil
+		case filesystem.IsFile(fs, dotgit):
+			target, err := readGitfile(fs, dotgit)
+			return dir, target, err == nil, err
+		case isGitdir(fs, dir):
+			return "", dir, true, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false, nil
+		}
+		device, ok := filesystem.Device(fs, dir)
+		if other, known := filesystem.Device(fs, parent); ok && known && device != other {
+			return "", "", false, nil
+		}
+		dir = parent
+	}
+}
+
+// readGitfile reads a .ggit file, which holds "gitdir: <path>" to point
+// to a repository directory kept outside of the worktree.
+//
+// Returns:
+//   - The absolute path of the repository directory, a relative one being
+//     relative to the directory of the file.
+//   - An error if the file is not in this format or does not point to a
+//     repository.
+func readGitfile(fs factory.FS, file string) (string, error) {
+	data, err := filesystem.ReadFileData(fs, file)
+	if err != nil {
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimRight(data, "\r\n"), "gitdir: ")
+	if !ok || target == "" {
+		return "", fmt.Errorf("invalid gitfile format: %s", file)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(file), target)
+	}
+	if !isGitdir(fs, target) {
+		return "", fmt.Errorf("not a ggit repository: %s", target)
+	}
+	return target, nil
+}
+
+// isGitdir reports whether dir is laid out as a repository directory.
+func isGitdir(fs factory.FS, dir string) bool {
+	return filesystem.IsFile(fs, filepath.Join(dir, headFile)) &&
+		filesystem.IsDir(fs, filepath.Join(dir, "objects")) &&
+		filesystem.IsDir(fs, filepath.Join(dir, "refs"))
+}
+
+// PrefixPaths turns paths given relative to the current directory into
+// paths relative to the top of the worktree.
+//
+// Returns:
+//   - The slash separated paths, "." for the top of the worktree.
+//   - An error if a path is outside of the worktree.
+func (r *Repository) PrefixPaths(paths []string) ([]string, error) {
+	prefixed := make([]string, 0, len(paths))
+	for _, p := range paths {
+		full := path.Join(r.Prefix, filepath.ToSlash(p))
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(r.Worktree, p)
+			if err != nil {
+				return nil, err
+			}
+			full = path.Clean(filepath.ToSlash(rel))
+		}
+		if full == ".." || strings.HasPrefix(full, "../") {
+			return nil, fmt.Errorf("%s: '%s' is outside repository at '%s'", p, p, r.Worktree)
+		}
+		prefixed = append(prefixed, full)
+	}
+	return prefixed, nil
+}
+
 // path constructs and returns a file path relative to the repository's Git directory.
 // It takes a variadic number of string arguments (path) that represent additional path components
 // to be appended to the Git directory (r.Gitdir).
@@ -109,19 +297,15 @@ func (r *Repository) WriteTextToFile(data string, path ...string) error {
 	return filesystem.WriteStringToFile(r.FS, data, r.path(path...))
 }
 
-// WriteCompressedToFile compresses the data and writes the specified data
-// to a file at the given path, which is relative to the repository's Git directory.
-// The method ensures that the necessary directory structure exists.
+// ReplaceTextFile replaces the content of the file at the given path,
+// which is relative to the repository's Git directory, with data. The
+// method ensures that the necessary directory structure exists.
 //
 // Returns:
 //   - An error if writing to the file fails.
-func (r *Repository) WriteCompressedToFile(data string, path ...string) error {
-	r.MakeDir(path...)
-	compressed, err := util.Compress(data)
-	if err != nil {
-		return err
-	}
-	return filesystem.WriteStringToFile(r.FS, compressed, r.path(path...))
+func (r *Repository) ReplaceTextFile(data string, path ...string) error {
+	r.MakeDir(path[0 : len(path)-1]...)
+	return filesystem.ReplaceFileData(r.FS, data, r.path(path...))
 }
 
 // defaultFile checks if a file exists at the specified path in the repository.
@@ -211,60 +395,218 @@ func (r *Repository) Create(saveConfig bool) (string, error) {
 	return msg, err
 }
 
-func (r *Repository) ObjectPath(sha string) []string {
-	return []string{"objects", sha[0:2], sha[2:]}
+type Init struct {
+	// Bare lays the repository directory out in the worktree path itself,
+	// leaving the repository without a worktree.
+	Bare bool
+	// Template is a directory whose files, such as hooks and info files,
+	// are copied into the repository directory.
+	Template string
+	// SeparateGitDir is where the repository directory is created, the
+	// worktree getting a .ggit file pointing to it.
+	SeparateGitDir string
+	// ObjectFormat is the name of the hash algorithm of the object IDs,
+	// sha1 or sha256.
+	ObjectFormat string
 }
 
-func (r *Repository) WriteObject(o objects.GitObject) (string, error) {
-	data := o.Serialize()
-	hash, err := o.Hash()
-	if err != nil {
-		return "", nil
+// Init creates a repository in the worktree path the way Create does,
+// bare or with its repository directory elsewhere. An existing repository
+// directory is moved to the separate one.
+//
+// Returns:
+//   - The message telling where the repository was initialized, after a
+//     warning about a missing template directory.
+//   - An error if the options conflict or the repository can not be
+//     written.
+func (r *Repository) Init(opts *Init) (string, error) {
+	if opts.Bare && opts.SeparateGitDir != "" {
+		return "", fmt.Errorf("options '--separate-git-dir' and '--bare' cannot be used together")
+	}
+	format := r.ObjectFormat()
+	if opts.ObjectFormat != "" {
+		var err error
+		if format, err = objects.LookupHashAlgorithm(opts.ObjectFormat); err != nil {
+			return "", err
+		}
+	}
+	// The repository directory, and the one it is found in when it
+	// exists, are checked before anything is written.
+	dir, existing, gitfile := r.Gitdir, r.Gitdir, ""
+	switch {
+	case opts.Bare:
+		dir, existing = r.Worktree, r.Worktree
+	case opts.SeparateGitDir != "":
+		separate, err := filepath.Abs(opts.SeparateGitDir)
+		if err != nil {
+			return "", err
+		}
+		gitfile = filepath.Join(r.Worktree, gitdir)
+		dir, existing = separate, separate
+		if filesystem.IsDir(r.FS, gitfile) {
+			existing = gitfile
+		}
 	}
-	path := r.ObjectPath(hash)
-	err = r.WriteCompressedToFile(data, path...)
+	if opts.ObjectFormat != "" && isGitdir(r.FS, existing) {
+		current := NewConfig(existing, r.FS)
+		current.Load()
+		if objectFormat(current) != format {
+			return "", fmt.Errorf("attempt to reinitialize repository with different hash")
+		}
+	}
+	if existing != dir {
+		if err := r.FS.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+			return "", err
+		}
+		if err := r.FS.Rename(existing, dir); err != nil {
+			return "", err
+		}
+	}
+	r.Gitdir = dir
+	if opts.Bare {
+		r.Worktree = ""
+	}
+
+	reinit := r.IsInitiated()
+	msg, err := r.Create(true)
 	if err != nil {
-		return "", nil
+		return "", err
+	}
+	if opts.Template != "" {
+		warning, err := r.copyTemplate(opts.Template)
+		if err != nil {
+			return "", err
+		}
+		msg = warning + msg
+	}
+	if gitfile != "" {
+		if err := filesystem.ReplaceFileData(r.FS, "gitdir: "+r.Gitdir+"\n", gitfile); err != nil {
+			return "", err
+		}
+	}
+	r.Config = *NewConfig(r.Gitdir, r.FS)
+	r.Config.Load()
+	if err := r.Config.Set(ConfigLocal, "core", "bare", strconv.FormatBool(opts.Bare)); err != nil {
+		return "", err
 	}
-	return o.Hash()
-}
 
-func (r *Repository) ReadObject(sha string) (objects.GitObject, error) {
-	path := r.ObjectPath(sha)
-	repoPath := r.path(path...)
-	if !filesystem.Exists(r.FS, repoPath) {
-		return nil, fmt.Errorf("object not found")
+	// Repository extensions are only honored from format version 1.
+	if !reinit && format != objects.SHA1 {
+		if err := r.Config.Set(ConfigLocal, "core", "repositoryformatversion", "1"); err != nil {
+			return "", err
+		}
+		if err := r.Config.Set(ConfigLocal, "extensions", "objectformat", format.Name); err != nil {
+			return "", err
+		}
 	}
+	r.Objects = r.openObjects()
+	return msg, nil
+}
 
-	data, err := filesystem.ReadFileData(r.FS, repoPath)
-	if err != nil {
-		return nil, err
+// copyTemplate copies the files of the template directory into the
+// repository directory, keeping the ones it already has.
+//
+// Returns:
+//   - A warning when the template directory does not exist.
+//   - An error if a file can not be copied.
+func (r *Repository) copyTemplate(template string) (string, error) {
+	if !filesystem.IsDir(r.FS, template) {
+		return fmt.Sprintf("warning: templates not found in %s\n", template), nil
 	}
+	return "", afero.Walk(r.FS, template, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(template, p)
+		if err != nil {
+			return err
+		}
+		dest := r.path(rel)
+		if info.IsDir() {
+			return r.FS.MkdirAll(dest, os.ModePerm)
+		}
+		if filesystem.Exists(r.FS, dest) || rel == ConfigName {
+			return nil
+		}
+		data, err := afero.ReadFile(r.FS, p)
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(r.FS, dest, data, info.Mode().Perm())
+	})
+}
 
-	decompressedData, err := util.Decompress(data)
+// ObjectFormat returns the hash algorithm the object IDs of the repository
+// are computed with, set by extensions.objectFormat and SHA-1 by default.
+func (r *Repository) ObjectFormat() *objects.HashAlgorithm {
+	return objectFormat(&r.Config)
+}
+
+// objectFormat returns the hash algorithm extensions.objectFormat of c
+// sets, SHA-1 by default.
+func objectFormat(c *config) *objects.HashAlgorithm {
+	h, err := objects.LookupHashAlgorithm(c.Get("extensions", "objectformat"))
 	if err != nil {
-		return nil, err
+		return objects.SHA1
 	}
+	return h
+}
 
-	x := strings.Index(decompressedData, " ")
-	format := decompressedData[0:x]
+// IsBare reports whether the repository has no worktree.
+func (r *Repository) IsBare() bool {
+	return r.Worktree == ""
+}
 
-	y := strings.Index(decompressedData, "\x00")
-	size, err := strconv.Atoi(decompressedData[x+1 : y])
-	if err != nil {
-		return nil, fmt.Errorf("unable to read object size")
+// WriteObject stores an object unless the repository already has it,
+// packed or borrowed from an alternate.
+//
+// Returns:
+//   - The ID of the object.
+//   - An error if the object can not be stored.
+func (r *Repository) WriteObject(o objects.GitObject) (string, error) {
+	data := o.Serialize()
+	if id := r.ObjectFormat().HashObject(o.Format(), data); r.Objects.Has(id) {
+		return id, nil
 	}
+	return r.Objects.Write(store.Object{Format: o.Format(), Data: data})
+}
 
-	if size != len(decompressedData)-y-1 {
-		return nil, fmt.Errorf("malformed object %s: bad length", sha)
+// ReadObject reads and parses the object sha. The empty tree is found even
+// if the repository does not store it. Objects read recently are returned
+// from a cache, so the object is shared and must not be modified.
+//
+// Returns:
+//   - The object.
+//   - An error if the object is missing, corrupt or of an unknown type.
+func (r *Repository) ReadObject(sha string) (objects.GitObject, error) {
+	if obj, ok := r.parsed.Get(sha); ok {
+		return obj, nil
+	}
+	raw, err := r.Objects.Read(sha)
+	if errors.Is(err, store.ErrNotFound) && sha == r.ObjectFormat().EmptyTree {
+		raw, err = store.Object{Format: "tree"}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	switch format {
+	var obj objects.GitObject
+	switch raw.Format {
 	case "blob":
-		return objects.NewBlob(decompressedData[y+1:]), nil
+		obj = objects.NewBlob("")
+	case "tree":
+		obj = objects.NewTree()
+	case "commit":
+		obj = objects.NewCommit()
 	default:
-		return nil, fmt.Errorf("unknown type %s for object %s", format, sha)
+		return nil, fmt.Errorf("unknown type %s for object %s", raw.Format, sha)
+	}
+	obj.SetHashAlgorithm(r.ObjectFormat())
+	if err := obj.Deserialize(raw.Data); err != nil {
+		return nil, fmt.Errorf("malformed object %s: %w", sha, err)
 	}
+	r.parsed.Add(sha, obj, int64(len(raw.Data)))
+	return obj, nil
 }
 
 func (r *Repository) IsInitiated() bool {
@@ -6,8 +6,10 @@ import (
 	"ggit/internal/filesystem"
 	"ggit/internal/objects"
 	"ggit/internal/repository"
+	"ggit/internal/store"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -27,6 +29,254 @@ func TestNewRepository(t *testing.T) {
 	})
 }
 
+func TestFindRepository(t *testing.T) {
+	fs := factory.NewTestFactory()
+	top := "/test/path"
+	r, err := repository.NewRepository(fs, top)
+	assert.NoError(t, err)
+	_, err = r.Create(false)
+	assert.NoError(t, err)
+	assert.NoError(t, fs.MkdirAll(filepath.Join(top, "a", "b"), os.ModePerm))
+
+	t.Run("Subdirectory", func(t *testing.T) {
+		found, err := repository.FindRepository(fs, filepath.Join(top, "a", "b"))
+		assert.NoError(t, err)
+		assert.Equal(t, top, found.Worktree)
+		assert.Equal(t, filepath.Join(top, ".ggit"), found.Gitdir)
+		assert.Equal(t, "a/b", found.Prefix)
+
+		paths, err := found.PrefixPaths([]string{"f", "../g", ".", "../../h"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a/b/f", "a/g", "a/b", "h"}, paths)
+		_, err = found.PrefixPaths([]string{"../../../x"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Top", func(t *testing.T) {
+		found, err := repository.FindRepository(fs, top)
+		assert.NoError(t, err)
+		assert.Equal(t, top, found.Worktree)
+		assert.Empty(t, found.Prefix)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		assert.NoError(t, fs.MkdirAll("/other", os.ModePerm))
+		found, err := repository.FindRepository(fs, "/other")
+		assert.NoError(t, err)
+		assert.Equal(t, "/other", found.Worktree)
+		assert.False(t, found.IsInitiated())
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		t.Setenv("GGIT_DIR", filepath.Join(top, ".ggit"))
+		t.Setenv("GGIT_WORK_TREE", top)
+		found, err := repository.FindRepository(fs, "/other")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(top, ".ggit"), found.Gitdir)
+		assert.Equal(t, top, found.Worktree)
+		assert.Empty(t, found.Prefix)
+		assert.True(t, found.IsInitiated())
+	})
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Bare", func(t *testing.T) {
+		fs := factory.NewTestFactory()
+		r, err := repository.NewRepository(fs, "/srv/repo.git")
+		assert.NoError(t, err)
+		msg, err := r.Init(&repository.Init{Bare: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "Initialized empty GGit repository in /srv/repo.git", msg)
+		assert.True(t, r.IsBare())
+		assert.True(t, filesystem.IsFile(fs, "/srv/repo.git/HEAD"))
+		assert.False(t, filesystem.Exists(fs, "/srv/repo.git/.ggit"))
+		assert.Equal(t, "true", r.Config.Get("core", "bare"))
+		assert.ErrorIs(t, r.Add([]string{"."}), repository.ErrorBare)
+
+		found, err := repository.FindRepository(fs, "/srv/repo.git/refs")
+		assert.NoError(t, err)
+		assert.Equal(t, "/srv/repo.git", found.Gitdir)
+		assert.True(t, found.IsBare())
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		fs := factory.NewTestFactory()
+		assert.NoError(t, afero.WriteFile(fs, "/tpl/hooks/pre-commit", []byte("#!/bin/sh\n"), 0o755))
+		assert.NoError(t, afero.WriteFile(fs, "/tpl/info/exclude", []byte("*.o\n"), 0o644))
+		assert.NoError(t, afero.WriteFile(fs, "/tpl/description", []byte("template\n"), 0o644))
+		r, err := repository.NewRepository(fs, "/work")
+		assert.NoError(t, err)
+		_, err = r.Init(&repository.Init{Template: "/tpl"})
+		assert.NoError(t, err)
+
+		info, err := fs.Stat("/work/.ggit/hooks/pre-commit")
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+		data, _ := filesystem.ReadFileData(fs, "/work/.ggit/info/exclude")
+		assert.Equal(t, "*.o\n", data)
+		data, _ = filesystem.ReadFileData(fs, "/work/.ggit/description")
+		assert.NotEqual(t, "template\n", data)
+
+		out, err := r.Init(&repository.Init{Template: "/missing"})
+		assert.NoError(t, err)
+		assert.Equal(t, "warning: templates not found in /missing\nReinitialized existing GGit repository in /work/.ggit", out)
+	})
+
+	t.Run("SeparateGitDir", func(t *testing.T) {
+		fs := factory.NewTestFactory()
+		r, err := repository.NewRepository(fs, "/work")
+		assert.NoError(t, err)
+		_, err = r.Create(true)
+		assert.NoError(t, err)
+		_, err = r.Init(&repository.Init{SeparateGitDir: "/store/work.git"})
+		assert.NoError(t, err)
+		data, _ := filesystem.ReadFileData(fs, "/work/.ggit")
+		assert.Equal(t, "gitdir: /store/work.git\n", data)
+		assert.True(t, filesystem.IsFile(fs, "/store/work.git/HEAD"))
+		assert.Equal(t, "false", r.Config.Get("core", "bare"))
+
+		assert.NoError(t, fs.MkdirAll("/work/sub", os.ModePerm))
+		found, err := repository.FindRepository(fs, "/work/sub")
+		assert.NoError(t, err)
+		assert.Equal(t, "/work", found.Worktree)
+		assert.Equal(t, "/store/work.git", found.Gitdir)
+		assert.Equal(t, "sub", found.Prefix)
+
+		_, err = r.Init(&repository.Init{Bare: true, SeparateGitDir: "/other"})
+		assert.Error(t, err)
+	})
+}
+
+func TestObjectFormat(t *testing.T) {
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	fs := factory.NewTestFactory()
+	r, err := repository.NewRepository(fs, "/work")
+	assert.NoError(t, err)
+	_, err = r.Init(&repository.Init{ObjectFormat: "sha256"})
+	assert.NoError(t, err)
+	assert.Equal(t, objects.SHA256, r.ObjectFormat())
+	assert.Equal(t, "1", r.Config.Get("core", "repositoryformatversion"))
+
+	writeWorktreeFile(t, r, "a.txt", "hello\n")
+	writeWorktreeFile(t, r, "dir/b.txt", "world\n")
+	first := commitWorktree(t, r, "first", ".")
+	assert.Len(t, first, 64)
+	writeWorktreeFile(t, r, "a.txt", "hello again\n")
+	second := commitWorktree(t, r, "second", ".")
+
+	idx, err := r.ReadIndex()
+	assert.NoError(t, err)
+	entry, _ := idx.Entry("a.txt", 0)
+	assert.Equal(t, objects.SHA256.HashObject("blob", "hello again\n"), entry.Hash)
+
+	head, err := r.ResolveRef("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, second, head)
+	assert.Equal(t, first, mustResolve(t, r, "HEAD~1"))
+	reflog, err := r.Reflog("HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, objects.SHA256.NullID(), reflog[0].Old)
+
+	out, code, err := r.Fsck(&repository.Fsck{})
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+	assert.Equal(t, 0, code)
+
+	_, err = r.Init(&repository.Init{ObjectFormat: "sha1"})
+	assert.ErrorContains(t, err, "different hash")
+	// A rejected reinitialization leaves the repository alone.
+	assert.NoError(t, afero.WriteFile(fs, "/tpl/info/exclude", []byte("*.o\n"), 0o644))
+	_, err = r.Init(&repository.Init{ObjectFormat: "sha1", Template: "/tpl", SeparateGitDir: "/elsewhere"})
+	assert.ErrorContains(t, err, "different hash")
+	assert.True(t, filesystem.IsDir(fs, "/work/.ggit"))
+	assert.False(t, filesystem.Exists(fs, "/elsewhere"))
+	assert.False(t, filesystem.Exists(fs, "/work/.ggit/info/exclude"))
+	_, err = r.Init(&repository.Init{ObjectFormat: "md5"})
+	assert.Error(t, err)
+}
+
+func TestObjectStore(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		r := newTestRepository(t)
+		r.Objects = store.NewMemoryStore(r.ObjectFormat())
+		sha, err := r.WriteObject(objects.NewBlob("in memory\n"))
+		assert.NoError(t, err)
+		assert.False(t, filesystem.Exists(r.FS, looseObjectPath(r, sha)))
+
+		obj, err := r.ReadObject(sha)
+		assert.NoError(t, err)
+		assert.Equal(t, "in memory\n", obj.(*objects.Blob).ReadData())
+		resolved, err := r.ResolveObject(sha[:7])
+		assert.NoError(t, err)
+		assert.Equal(t, sha, resolved)
+	})
+
+	t.Run("Packed", func(t *testing.T) {
+		r := newTestRepository(t)
+		for _, ext := range []string{"idx", "pack"} {
+			name := "pack-429109ac7ee96e32d82fe89c723943fed7c77611." + ext
+			data, err := os.ReadFile(filepath.Join("..", "store", "testdata", "sha1", "sha1-"+name))
+			assert.NoError(t, err)
+			assert.NoError(t, afero.WriteFile(r.FS, filepath.Join(r.Gitdir, "objects", "pack", name), data, 0o444))
+		}
+		commit := "1364b0085da7c564f85c311c2b1c99e6e373ebd7"
+		writeRef(t, r, "refs/heads/master", commit)
+		assert.Equal(t, "74cd0661936fbd1349be6d4a089de95491dea825", mustResolve(t, r, "master~1"))
+		obj, err := r.ReadObject("e49cf7e083bd244a81c31bcd2ac7faa4f332156a")
+		assert.NoError(t, err)
+		assert.Contains(t, obj.(*objects.Blob).ReadData(), "line 100 x")
+
+		out, code, err := r.Fsck(&repository.Fsck{})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		r := newTestRepository(t)
+		sha := writeBlob(t, r, "cached\n")
+		obj, err := r.ReadObject(sha)
+		assert.NoError(t, err)
+		r.Objects = store.NewMemoryStore(r.ObjectFormat())
+		cached, err := r.ReadObject(sha)
+		assert.NoError(t, err)
+		assert.Same(t, obj, cached)
+
+		writeConfigFile(t, r, filepath.Join(r.Gitdir, "config"), "[core]\n\tobjectCacheLimit = 0\n")
+		r, err = repository.NewRepository(r.FS, r.Worktree)
+		assert.NoError(t, err)
+		first, err := r.ReadObject(sha)
+		assert.NoError(t, err)
+		second, err := r.ReadObject(sha)
+		assert.NoError(t, err)
+		assert.NotSame(t, first, second)
+	})
+
+	t.Run("ConcurrentReads", func(t *testing.T) {
+		r := newTestRepository(t)
+		shas := []string{}
+		for i := 0; i < 20; i++ {
+			shas = append(shas, writeBlob(t, r, fmt.Sprintf("blob %d\n", i)))
+		}
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i, sha := range shas {
+					obj, err := r.ReadObject(sha)
+					assert.NoError(t, err)
+					assert.Equal(t, fmt.Sprintf("blob %d\n", i), obj.(*objects.Blob).ReadData())
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
 func TestMakeDir(t *testing.T) {
 	cwd := "./test/path"
 
@@ -113,8 +363,7 @@ func TestWriteObject(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, sha)
 
-		objectPath := r.ObjectPath(sha)
-		path := filepath.Join(append([]string{r.Gitdir}, objectPath...)...)
+		path := looseObjectPath(r, sha)
 
 		assert.True(t, filesystem.Exists(r.FS, path))
 
@@ -122,6 +371,19 @@ func TestWriteObject(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEqual(t, stats.Size(), 0)
 	})
+
+	t.Run("WriteTwice", func(t *testing.T) {
+		obj := objects.NewBlob("writtenTwice")
+		first, err := r.WriteObject(obj)
+		assert.NoError(t, err)
+		second, err := r.WriteObject(obj)
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		read, err := r.ReadObject(second)
+		assert.NoError(t, err)
+		assert.Equal(t, "writtenTwice", read.(*objects.Blob).ReadData())
+	})
 }
 
 func TestReadObject(t *testing.T) {
@@ -148,8 +410,7 @@ func TestReadObject(t *testing.T) {
 		blob := obj.(*objects.Blob)
 		assert.Equal(t, blob.ReadData(), data)
 
-		objectPath := r.ObjectPath(sha)
-		path := filepath.Join(append([]string{r.Gitdir}, objectPath...)...)
+		path := looseObjectPath(r, sha)
 
 		assert.True(t, filesystem.Exists(r.FS, path))
 	})
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/index"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Modes of a reset, from the one touching the least to the one touching
+// the most.
+const (
+	ResetSoft  = "soft"
+	ResetMixed = "mixed"
+	ResetHard  = "hard"
+)
+
+type Reset struct {
+	Mode string
+	// Commit is the revision to reset to, HEAD when empty.
+	Commit string
+	// Paths limits a mixed reset to the index entries of these paths,
+	// leaving HEAD alone.
+	Paths []string
+}
+
+type Restore struct {
+	// Source is the tree-ish to restore from: the index when empty and only
+	// the worktree is restored, HEAD otherwise.
+	Source   string
+	Staged   bool
+	Worktree bool
+	Paths    []string
+}
+
+// Reset moves the current branch, or HEAD when it is detached, to a
+// commit. The mode chooses what follows it: nothing with ResetSoft, the
+// index with ResetMixed, the index and the worktree with ResetHard, which
+// discards every local change to the tracked files. The state of a stopped
+// merge, cherry-pick or revert is dropped, and ORIG_HEAD records where
+// HEAD was.
+//
+// With Paths, only the index entries of the paths are reset to their
+// version in the commit, which unstages their changes.
+//
+// Returns:
+//   - The worktree changes left unstaged by a mixed reset, or the new HEAD
+//     commit after a hard one.
+//   - An error if the commit can not be resolved, or if the mode is soft
+//     in the middle of a merge or not mixed with paths.
+func (r *Repository) Reset(opts *Reset) (string, error) {
+	if opts.Mode == "" {
+		opts.Mode = ResetMixed
+	}
+	if opts.Mode != ResetMixed && len(opts.Paths) > 0 {
+		return "", fmt.Errorf("Cannot do %s reset with paths.", opts.Mode)
+	}
+	rev := opts.Commit
+	if rev == "" {
+		rev = headFile
+	}
+	sha, err := r.ResolveCommit(rev)
+	if err != nil {
+		return "", err
+	}
+	tree, err := r.headTree(sha)
+	if err != nil {
+		return "", err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return "", err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", err
+	}
+	if len(opts.Paths) > 0 {
+		return r.resetIndexPaths(idx, files, opts.Paths)
+	}
+	if opts.Mode == ResetSoft && r.hasFile(mergeHeadFile) {
+		return "", fmt.Errorf("Cannot do a soft reset in the middle of a merge.")
+	}
+
+	head, err := r.headCommit()
+	if err != nil {
+		return "", err
+	}
+	out := ""
+	switch opts.Mode {
+	case ResetMixed:
+		idx = r.buildIndex(files, nil, idx)
+		if err := r.WriteIndex(idx); err != nil {
+			return "", err
+		}
+		if out, err = r.unstagedChanges(idx); err != nil {
+			return "", err
+		}
+	case ResetHard:
+		paths := append(sortedPaths(indexFiles(idx), files), idx.Conflicts()...)
+		if err := r.restorePaths(idx, files, paths); err != nil {
+			return "", err
+		}
+		commit, err := r.readCommit(sha)
+		if err != nil {
+			return "", err
+		}
+		out = fmt.Sprintf("HEAD is now at %s %s\n", shortID(sha), subject(commit.KVLM.Message))
+	case ResetSoft:
+	default:
+		return "", fmt.Errorf("unknown reset mode %s", opts.Mode)
+	}
+
+	if err := r.ReplaceTextFile(head+"\n", origHeadFile); err != nil {
+		return "", err
+	}
+	if err := r.UpdateHead(sha, "reset: moving to "+rev); err != nil {
+		return "", err
+	}
+	return out, r.removeFiles(mergeHeadFile, mergeMsgFile, mergeModeFile, squashMsgFile, cherryPickHeadFile, revertHeadFile)
+}
+
+// resetIndexPaths resets the index entries of the paths matching specs to
+// their version in files, removing the ones files does not have.
+func (r *Repository) resetIndexPaths(idx *index.Index, files map[string]diff.File, specs []string) (string, error) {
+	for _, p := range matchPathspecs(specs, indexPaths(idx), files) {
+		if f, ok := files[p]; ok {
+			idx.Add(index.Entry{Mode: f.Mode, Hash: f.Hash, Path: p})
+		} else {
+			idx.Remove(p)
+		}
+	}
+	if err := r.WriteIndex(idx); err != nil {
+		return "", err
+	}
+	return r.unstagedChanges(idx)
+}
+
+// unstagedChanges lists the worktree changes to the files of the index, as
+// reported after a reset.
+func (r *Repository) unstagedChanges(idx *index.Index) (string, error) {
+	changed, err := r.worktreeChanges(idx)
+	if err != nil || len(changed) == 0 {
+		return "", err
+	}
+	staged := indexFiles(idx)
+	var b strings.Builder
+	b.WriteString("Unstaged changes after reset:\n")
+	for _, p := range changed {
+		status := "M"
+		if f, _ := r.worktreeFile(p, staged[p]); !f.Exists() {
+			status = "D"
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", status, p)
+	}
+	return b.String(), nil
+}
+
+// indexPaths returns the paths of the index, merged or not.
+func indexPaths(idx *index.Index) map[string]diff.File {
+	paths := map[string]diff.File{}
+	for _, e := range idx.Entries {
+		paths[e.Path] = diff.File{Path: e.Path, Mode: e.Mode, Hash: e.Hash}
+	}
+	return paths
+}
+
+// matchPathspecs returns the paths of files matching specs, sorted. A spec
+// matches the path it names and the paths below it, "." matches them all.
+func matchPathspecs(specs []string, files ...map[string]diff.File) []string {
+	matched := []string{}
+	for _, p := range sortedPaths(files...) {
+		for _, spec := range specs {
+			spec = path.Clean(filepath.ToSlash(spec))
+			if spec == "." || p == spec || strings.HasPrefix(p, spec+"/") {
+				matched = append(matched, p)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// Restore restores the content of paths in the index with Staged, and in
+// the worktree with Worktree, the default, from Source. Paths the source
+// does not have are removed.
+//
+// Returns:
+//   - An error if a path matches no file of the source or the index, if a
+//     path to restore from the index is unmerged, or if the source can not
+//     be resolved.
+func (r *Repository) Restore(opts *Restore) error {
+	if r.IsBare() {
+		return ErrorBare
+	}
+	if !opts.Staged && !opts.Worktree {
+		opts.Worktree = true
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	var files map[string]diff.File
+	if opts.Source == "" && !opts.Staged {
+		files = indexFiles(idx)
+	} else {
+		source := opts.Source
+		if source == "" {
+			source = headFile
+		}
+		tree, err := r.ResolveTree(source)
+		if err != nil {
+			return err
+		}
+		if files, err = r.treeFiles(tree); err != nil {
+			return err
+		}
+	}
+
+	tracked := indexPaths(idx)
+	for _, spec := range opts.Paths {
+		if len(matchPathspecs([]string{spec}, files, tracked)) == 0 {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to git", spec)
+		}
+	}
+	paths := matchPathspecs(opts.Paths, files, tracked)
+	if opts.Source == "" && !opts.Staged {
+		for _, p := range paths {
+			if _, ok := files[p]; !ok {
+				return fmt.Errorf("path '%s' is unmerged", p)
+			}
+		}
+	}
+
+	for _, p := range paths {
+		f, ok := files[p]
+		if opts.Worktree {
+			if !ok {
+				if err := r.removeWorktreeFile(p); err != nil {
+					return err
+				}
+			} else if err := r.writeWorktreeFile(f); err != nil {
+				return err
+			}
+		}
+		if !opts.Staged {
+			continue
+		}
+		if !ok {
+			idx.Remove(p)
+		} else if opts.Worktree {
+			idx.Add(r.indexEntry(f, index.StageMerged))
+		} else {
+			idx.Add(index.Entry{Mode: f.Mode, Hash: f.Hash, Path: p})
+		}
+	}
+	if !opts.Staged {
+		return nil
+	}
+	return r.WriteIndex(idx)
+}
@@ -0,0 +1,185 @@
+package repository_test
+
+import (
+	"ggit/internal/index"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// readIndexHash returns the hash of the merged index entry of p, empty
+// when it has none.
+func readIndexHash(t *testing.T, r *repository.Repository, p string) string {
+	idx, err := r.ReadIndex()
+	assert.NoError(t, err)
+	for _, e := range idx.Entries {
+		if e.Path == p && e.Stage == 0 {
+			return e.Hash
+		}
+	}
+	return ""
+}
+
+func assertNoWorktreeFile(t *testing.T, r *repository.Repository, p string) {
+	exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, p))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestReset(t *testing.T) {
+	t.Run("Soft", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\n3\n4\n5\n6\nM\n", "1\nT\n3\n4\n5\n6\n7\n")
+		base := mustResolve(t, r, "master~1")
+		staged := readIndexHash(t, r, "f")
+		out, err := r.Reset(&repository.Reset{Mode: repository.ResetSoft, Commit: "master~1"})
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Equal(t, base, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, master+"\n", readGitFile(t, r, "ORIG_HEAD"))
+		assert.Equal(t, staged, readIndexHash(t, r, "f"))
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+
+		reflog, err := r.Reflog("HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, "reset: moving to master~1", reflog[len(reflog)-1].Message)
+	})
+
+	t.Run("Mixed", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\n2\n3\n4\n5\n6\nM\n", "1\nT\n3\n4\n5\n6\n7\n")
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "g")))
+		out, err := r.Reset(&repository.Reset{Commit: "HEAD~1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "Unstaged changes after reset:\nM\tf\nD\tg\n", out)
+		assert.Equal(t, "base", mustReadCommit(t, r, "HEAD").KVLM.Message)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nM\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Hard", func(t *testing.T) {
+		r, base, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		writeWorktreeFile(t, r, "f", "changed\n")
+		writeWorktreeFile(t, r, "n", "new\n")
+		assert.NoError(t, r.Add([]string{"n"}))
+		writeWorktreeFile(t, r, "u", "untracked\n")
+
+		out, err := r.Reset(&repository.Reset{Mode: repository.ResetHard, Commit: "topic"})
+		assert.NoError(t, err)
+		assert.Equal(t, "HEAD is now at "+mustResolve(t, r, "topic")[:7]+" topic\n", out)
+		assert.Equal(t, "1\nT\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "topic only\n", readWorktreeFile(t, r, "t"))
+		assert.Equal(t, "untracked\n", readWorktreeFile(t, r, "u"))
+		assertNoWorktreeFile(t, r, "n")
+		assert.Empty(t, readIndexHash(t, r, "n"))
+
+		_, err = r.Reset(&repository.Reset{Mode: repository.ResetHard, Commit: base})
+		assert.NoError(t, err)
+		assertNoWorktreeFile(t, r, "t")
+	})
+
+	t.Run("StatInformation", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "a longer master version\n", "1\nT\n3\n4\n5\n6\n7\n")
+		readIndexSize := func() uint32 {
+			idx, err := r.ReadIndex()
+			assert.NoError(t, err)
+			e, ok := idx.Entry("f", index.StageMerged)
+			assert.True(t, ok)
+			return e.Size
+		}
+		_, err := r.Reset(&repository.Reset{Mode: repository.ResetSoft, Commit: "HEAD~1"})
+		assert.NoError(t, err)
+		_, err = r.Reset(&repository.Reset{})
+		assert.NoError(t, err)
+		// The worktree version is not the staged one.
+		assert.Equal(t, uint32(0), readIndexSize())
+
+		_, err = r.Reset(&repository.Reset{Mode: repository.ResetHard})
+		assert.NoError(t, err)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, uint32(len("1\n2\n3\n4\n5\n6\n7\n")), readIndexSize())
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\nT\n3\n4\n5\n6\n7\n")
+		_, clean, err := r.Merge(&repository.Merge{Commits: []string{"topic"}})
+		assert.NoError(t, err)
+		assert.False(t, clean)
+
+		_, err = r.Reset(&repository.Reset{Mode: repository.ResetSoft})
+		assert.EqualError(t, err, "Cannot do a soft reset in the middle of a merge.")
+
+		_, err = r.Reset(&repository.Reset{Mode: repository.ResetHard})
+		assert.NoError(t, err)
+		assert.Equal(t, "1\nM\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{0}, readIndexStages(t, r, "f"))
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Gitdir, "MERGE_HEAD"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Paths", func(t *testing.T) {
+		r, master, _ := newMergeRepository(t, "1\n2\n3\n4\n5\n6\nM\n", "1\nT\n3\n4\n5\n6\n7\n")
+		writeWorktreeFile(t, r, "f", "changed\n")
+		writeWorktreeFile(t, r, "n", "new\n")
+		assert.NoError(t, r.Add([]string{"f", "n"}))
+
+		out, err := r.Reset(&repository.Reset{Paths: []string{"f", "n"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "Unstaged changes after reset:\nM\tf\n", out)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Empty(t, readIndexHash(t, r, "n"))
+		assert.Equal(t, "new\n", readWorktreeFile(t, r, "n"))
+
+		_, err = r.Reset(&repository.Reset{Commit: "topic", Paths: []string{"."}})
+		assert.NoError(t, err)
+		assert.Equal(t, "master", mustReadCommit(t, r, "HEAD").KVLM.Message)
+		assert.NotEmpty(t, readIndexHash(t, r, "t"))
+
+		_, err = r.Reset(&repository.Reset{Mode: repository.ResetHard, Paths: []string{"f"}})
+		assert.EqualError(t, err, "Cannot do hard reset with paths.")
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("Worktree", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		writeWorktreeFile(t, r, "f", "staged\n")
+		assert.NoError(t, r.Add([]string{"f"}))
+		writeWorktreeFile(t, r, "f", "changed\n")
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "g")))
+
+		assert.NoError(t, r.Restore(&repository.Restore{Paths: []string{"f", "g"}}))
+		assert.Equal(t, "staged\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "kept\n", readWorktreeFile(t, r, "g"))
+	})
+
+	t.Run("Staged", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		head := readIndexHash(t, r, "f")
+		writeWorktreeFile(t, r, "f", "staged\n")
+		assert.NoError(t, r.Add([]string{"f"}))
+
+		assert.NoError(t, r.Restore(&repository.Restore{Staged: true, Paths: []string{"f"}}))
+		assert.Equal(t, head, readIndexHash(t, r, "f"))
+		assert.Equal(t, "staged\n", readWorktreeFile(t, r, "f"))
+	})
+
+	t.Run("Source", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		assert.NoError(t, r.Restore(&repository.Restore{Source: "topic", Staged: true, Worktree: true, Paths: []string{"."}}))
+		assert.Equal(t, "1\nT\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "topic only\n", readWorktreeFile(t, r, "t"))
+		assert.NotEmpty(t, readIndexHash(t, r, "t"))
+
+		assert.NoError(t, r.Restore(&repository.Restore{Source: "master", Paths: []string{"t"}}))
+		assertNoWorktreeFile(t, r, "t")
+		assert.NotEmpty(t, readIndexHash(t, r, "t"))
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		err := r.Restore(&repository.Restore{Paths: []string{"nope"}})
+		assert.EqualError(t, err, "pathspec 'nope' did not match any file(s) known to git")
+	})
+}
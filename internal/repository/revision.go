@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"encoding/hex"
+	"fmt"
+	"ggit/internal/objects"
+	"strconv"
+	"strings"
+)
+
+const minPrefixLength = 4
+
+// ResolveObject expands a full or abbreviated object name into the full
+// object ID. Abbreviated names have to be at least four hex characters long
+// and must match exactly one object of the repository.
+//
+// Returns:
+//   - The full object ID.
+//   - An error if the name is not a valid hex name, if no object matches it
+//     or if the abbreviation is ambiguous.
+func (r *Repository) ResolveObject(name string) (string, error) {
+	name = strings.ToLower(name)
+	if len(name) < minPrefixLength || len(name) > r.ObjectFormat().HexSize() || !isHex(name) {
+		return "", fmt.Errorf("not a valid object name %s", name)
+	}
+	if len(name) == r.ObjectFormat().HexSize() {
+		if name == r.ObjectFormat().EmptyTree {
+			return name, nil
+		}
+		if !r.Objects.Has(name) {
+			return "", fmt.Errorf("not a valid object name %s", name)
+		}
+		return name, nil
+	}
+
+	found := ""
+	ambiguous := fmt.Errorf("short object ID %s is ambiguous", name)
+	err := r.Objects.Iterate(func(id string) error {
+		if !strings.HasPrefix(id, name) {
+			return nil
+		}
+		if found != "" && found != id {
+			return ambiguous
+		}
+		found = id
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("not a valid object name %s", name)
+	}
+	return found, nil
+}
+
+// ResolveRevision resolves a revision into an object ID. A revision starts
+// with HEAD, a ref name or an object name and may be followed by any number
+// of "~<n>", selecting the n-th first parent generation, "^<n>", selecting
+// the n-th parent, and "^{commit}", "^{tree}" or "^{}" peeling the object.
+//
+// Returns:
+//   - The object ID the revision names.
+//   - An error if the revision is malformed or names no object.
+func (r *Repository) ResolveRevision(rev string) (string, error) {
+	base, ops := rev, ""
+	if i := strings.IndexAny(rev, "~^"); i >= 0 {
+		base, ops = rev[:i], rev[i:]
+	}
+	sha, err := r.resolveName(base)
+	if err != nil {
+		return "", err
+	}
+
+	for ops != "" {
+		if peel, ok := strings.CutPrefix(ops, "^{"); ok {
+			kind, rest, found := strings.Cut(peel, "}")
+			if !found {
+				return "", fmt.Errorf("invalid revision %s", rev)
+			}
+			ops = rest
+			switch kind {
+			case "":
+			case "commit":
+				if _, err := r.readCommit(sha); err != nil {
+					return "", err
+				}
+			case "tree":
+				if sha, err = r.peelTree(sha); err != nil {
+					return "", err
+				}
+			default:
+				return "", fmt.Errorf("invalid revision %s", rev)
+			}
+			continue
+		}
+
+		op := ops[0]
+		digits := 1
+		for digits < len(ops) && ops[digits] >= '0' && ops[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 1 {
+			if n, err = strconv.Atoi(ops[1:digits]); err != nil {
+				return "", fmt.Errorf("invalid revision %s", rev)
+			}
+		}
+		ops = ops[digits:]
+
+		if op == '~' {
+			for ; n > 0; n-- {
+				if sha, err = r.parent(sha, 1); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+		if n == 0 {
+			if _, err := r.readCommit(sha); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if sha, err = r.parent(sha, n); err != nil {
+			return "", err
+		}
+	}
+	return sha, nil
+}
+
+// resolveName resolves the start of a revision. Full object IDs are taken
+// as they are, other names are looked up as refs before they are tried as
+// abbreviated object IDs.
+func (r *Repository) resolveName(name string) (string, error) {
+	if len(name) == r.ObjectFormat().HexSize() && isHex(name) {
+		return r.ResolveObject(name)
+	}
+	if _, sha, err := r.DwimRef(name); err == nil {
+		return sha, nil
+	}
+	sha, err := r.ResolveObject(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s", name)
+	}
+	return sha, nil
+}
+
+// parent returns the n-th parent of a commit, counting from one.
+func (r *Repository) parent(sha string, n int) (string, error) {
+	commit, err := r.readCommit(sha)
+	if err != nil {
+		return "", err
+	}
+	if n > len(commit.KVLM.Parents) {
+		return "", fmt.Errorf("commit %s has no parent %d", sha, n)
+	}
+	return commit.KVLM.Parents[n-1], nil
+}
+
+// readCommit reads an object that has to be a commit.
+func (r *Repository) readCommit(sha string) (*objects.Commit, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	commit, ok := obj.(*objects.Commit)
+	if !ok {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", sha, obj.Format())
+	}
+	return commit, nil
+}
+
+// ResolveCommit resolves a revision that has to name a commit.
+//
+// Returns:
+//   - The ID of the commit.
+//   - An error if the revision can not be resolved or is not a commit.
+func (r *Repository) ResolveCommit(rev string) (string, error) {
+	sha, err := r.ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.readCommit(sha); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// ResolveTree resolves a tree-ish revision into the ID of a tree object.
+// Commits are peeled to the tree they record.
+//
+// Returns:
+//   - The ID of the tree object.
+//   - An error if the name can not be resolved or does not name a tree-ish.
+func (r *Repository) ResolveTree(name string) (string, error) {
+	sha, err := r.ResolveRevision(name)
+	if err != nil {
+		return "", err
+	}
+	return r.peelTree(sha)
+}
+
+// peelTree returns the tree of a tree-ish object.
+func (r *Repository) peelTree(sha string) (string, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return "", err
+	}
+	switch o := obj.(type) {
+	case *objects.Tree:
+		return sha, nil
+	case *objects.Commit:
+		return o.KVLM.Tree, nil
+	default:
+		return "", fmt.Errorf("object %s is a %s, not a tree", sha, obj.Format())
+	}
+}
+
+func isHex(s string) bool {
+	if len(s)%2 == 1 {
+		s = s + "0"
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
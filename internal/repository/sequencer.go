@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Files of the sequencer state, in the sequencer directory: the HEAD the
+// sequence started from, the HEAD after the last step, the options and the
+// steps left, the current one first.
+const (
+	sequencerDir             = "sequencer"
+	sequencerHeadFile        = "head"
+	sequencerAbortSafetyFile = "abort-safety"
+	sequencerOptsFile        = "opts"
+	sequencerTodoFile        = "todo"
+)
+
+// sequencerStep is a line of the todo list, "<action> <commit> <subject>".
+type sequencerStep struct {
+	action  string
+	commit  string
+	subject string
+}
+
+// sequencerState holds the options of a sequence.
+type sequencerState struct {
+	head         string
+	recordOrigin bool
+	mainline     int
+	noCommit     bool
+}
+
+func (r *Repository) sequencerInProgress() bool {
+	sha, _, _ := r.stoppedPick()
+	return sha != "" || r.hasFile(sequencerDir+"/"+sequencerTodoFile)
+}
+
+// writeSequencerState records a new sequence.
+func (r *Repository) writeSequencerState(state *sequencerState, steps []sequencerStep) error {
+	if err := r.ReplaceTextFile(state.head+"\n", sequencerDir, sequencerHeadFile); err != nil {
+		return err
+	}
+	if err := r.ReplaceTextFile(state.head+"\n", sequencerDir, sequencerAbortSafetyFile); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if state.recordOrigin {
+		b.WriteString("\trecord-origin = true\n")
+	}
+	if state.mainline > 0 {
+		fmt.Fprintf(&b, "\tmainline = %d\n", state.mainline)
+	}
+	if state.noCommit {
+		b.WriteString("\tno-commit = true\n")
+	}
+	if b.Len() > 0 {
+		if err := r.ReplaceTextFile("[options]\n"+b.String(), sequencerDir, sequencerOptsFile); err != nil {
+			return err
+		}
+	}
+	return r.writeSequencerTodo(steps)
+}
+
+func (r *Repository) writeSequencerTodo(steps []sequencerStep) error {
+	var b strings.Builder
+	for _, s := range steps {
+		fmt.Fprintf(&b, "%s %s %s\n", s.action, shortID(s.commit), s.subject)
+	}
+	return r.ReplaceTextFile(b.String(), sequencerDir, sequencerTodoFile)
+}
+
+// readSequencerState reads the state of the sequence in progress.
+//
+// Returns:
+//   - The options of the sequence.
+//   - The steps left, the current one first.
+//   - An error if no sequence is in progress or its state is corrupt.
+func (r *Repository) readSequencerState() (*sequencerState, []sequencerStep, error) {
+	if !r.hasFile(sequencerDir + "/" + sequencerTodoFile) {
+		return nil, nil, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	head, err := r.readFile(sequencerDir + "/" + sequencerHeadFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := &sequencerState{head: strings.TrimSpace(head)}
+	if r.hasFile(sequencerDir + "/" + sequencerOptsFile) {
+		data, err := r.readFile(sequencerDir + "/" + sequencerOptsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts, err := ini.Load([]byte(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed options sheet: %w", err)
+		}
+		section := opts.Section("options")
+		state.recordOrigin = section.Key("record-origin").MustBool(false)
+		state.mainline = section.Key("mainline").MustInt(0)
+		state.noCommit = section.Key("no-commit").MustBool(false)
+	}
+
+	todo, err := r.readFile(sequencerDir + "/" + sequencerTodoFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	steps := []sequencerStep{}
+	for _, line := range strings.Split(todo, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 || (fields[0] != ActionPick && fields[0] != ActionRevert) {
+			return nil, nil, fmt.Errorf("invalid line in the todo list: %s", line)
+		}
+		sha, err := r.ResolveObject(fields[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		step := sequencerStep{action: fields[0], commit: sha}
+		if len(fields) == 3 {
+			step.subject = fields[2]
+		}
+		steps = append(steps, step)
+	}
+	return state, steps, nil
+}
+
+func (r *Repository) removeSequencerState() error {
+	if err := r.FS.RemoveAll(r.path(sequencerDir)); err != nil {
+		return err
+	}
+	return r.removeFiles(cherryPickHeadFile, revertHeadFile, mergeMsgFile)
+}
+
+// runSequencer applies the steps left one by one, until a step stops or
+// the sequence is complete, in which case its state is removed.
+func (r *Repository) runSequencer(b *strings.Builder) (string, bool, error) {
+	state, steps, err := r.readSequencerState()
+	if err != nil {
+		return "", false, err
+	}
+	for len(steps) > 0 {
+		done, err := r.pickCommit(b, steps[0], state)
+		if err != nil {
+			return "", false, err
+		}
+		if !done {
+			return b.String(), false, nil
+		}
+		if err := r.completeStep(steps); err != nil {
+			return "", false, err
+		}
+		steps = steps[1:]
+	}
+	if err := r.FS.RemoveAll(r.path(sequencerDir)); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// completeStep removes the current step from the todo list, recording the
+// HEAD it left.
+func (r *Repository) completeStep(steps []sequencerStep) error {
+	head, err := r.headCommit()
+	if err != nil {
+		return err
+	}
+	if err := r.ReplaceTextFile(head+"\n", sequencerDir, sequencerAbortSafetyFile); err != nil {
+		return err
+	}
+	return r.writeSequencerTodo(steps[1:])
+}
+
+// sequencerContinue commits the resolved stopped step, then goes on with
+// the sequence.
+func (r *Repository) sequencerContinue() (string, bool, error) {
+	if !r.sequencerInProgress() {
+		return "", false, fmt.Errorf("no cherry-pick or revert in progress")
+	}
+	b := &strings.Builder{}
+	sha, action, err := r.stoppedPick()
+	if err != nil {
+		return "", false, err
+	}
+	if sha != "" {
+		idx, err := r.ReadIndex()
+		if err != nil {
+			return "", false, err
+		}
+		done, err := r.commitStoppedPick(b, idx, sha, action)
+		if err != nil || !done {
+			return b.String(), false, err
+		}
+	}
+	if !r.hasFile(sequencerDir + "/" + sequencerTodoFile) {
+		return b.String(), true, nil
+	}
+	_, steps, err := r.readSequencerState()
+	if err != nil {
+		return "", false, err
+	}
+	if len(steps) > 0 {
+		if err := r.completeStep(steps); err != nil {
+			return "", false, err
+		}
+	}
+	return r.runSequencer(b)
+}
+
+// sequencerSkip drops the changes of the stopped step, then goes on with
+// the sequence.
+func (r *Repository) sequencerSkip() (string, bool, error) {
+	_, steps, err := r.readSequencerState()
+	if err != nil {
+		return "", false, err
+	}
+	if err := r.resetToCommit(""); err != nil {
+		return "", false, err
+	}
+	if err := r.removeFiles(cherryPickHeadFile, revertHeadFile, mergeMsgFile); err != nil {
+		return "", false, err
+	}
+	if len(steps) > 0 {
+		if err := r.completeStep(steps); err != nil {
+			return "", false, err
+		}
+	}
+	return r.runSequencer(&strings.Builder{})
+}
+
+// sequencerAbort goes back to the HEAD the sequence started from. When
+// HEAD was moved since the last step, it is left alone with a warning.
+func (r *Repository) sequencerAbort() (string, error) {
+	state, _, err := r.readSequencerState()
+	if err != nil {
+		return "", err
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", err
+	}
+	safety, err := r.readFile(sequencerDir + "/" + sequencerAbortSafetyFile)
+	if err != nil {
+		return "", err
+	}
+	if head != strings.TrimSpace(safety) {
+		return "warning: You seem to have moved HEAD. Not rewinding, check your HEAD!\n", r.removeSequencerState()
+	}
+	if err := r.resetToCommit(state.head); err != nil {
+		return "", err
+	}
+	if head != state.head && state.head != "" {
+		if err := r.UpdateHead(state.head, "reset: moving to "+state.head); err != nil {
+			return "", err
+		}
+	}
+	return "", r.removeSequencerState()
+}
+
+// resetToCommit restores the index and the worktree to the tree of a
+// commit, or of HEAD when sha is empty, discarding the changes of the
+// stopped step.
+func (r *Repository) resetToCommit(sha string) error {
+	var err error
+	if sha == "" {
+		if sha, err = r.headCommit(); err != nil {
+			return err
+		}
+	}
+	tree, err := r.headTree(sha)
+	if err != nil {
+		return err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	return r.resetPaths(idx, files)
+}
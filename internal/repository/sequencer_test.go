@@ -0,0 +1,134 @@
+package repository_test
+
+import (
+	"ggit/internal/index"
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSequenceRepository returns a repository whose topic branch holds two
+// commits to pick onto master: one conflicting on f, then one adding h.
+func newSequenceRepository(t *testing.T) (*repository.Repository, string, string, string) {
+	r, master, topic := newMergeRepository(t, "1\nM\n3\n4\n5\n6\n7\n", "1\nT\n3\n4\n5\n6\n7\n")
+	second := commitChange(t, r, "topic", "h", "second\n")
+	assert.NoError(t, r.UpdateRef("refs/heads/topic", second, topic, "commit: second"))
+	return r, master, topic, second
+}
+
+func readGitFile(t *testing.T, r *repository.Repository, name string) string {
+	data, err := afero.ReadFile(r.FS, filepath.Join(r.Gitdir, name))
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestSequencer(t *testing.T) {
+	pick := func(r *repository.Repository, opts repository.CherryPick) (string, bool, error) {
+		opts.Action = repository.ActionPick
+		return r.CherryPick(&opts)
+	}
+
+	t.Run("Continue", func(t *testing.T) {
+		r, master, topic, second := newSequenceRepository(t)
+		out, done, err := pick(r, repository.CherryPick{Commits: []string{"topic~1", "topic"}, RecordOrigin: true})
+		assert.NoError(t, err)
+		assert.False(t, done)
+		assert.Equal(t, "Auto-merging f\nCONFLICT (content): Merge conflict in f\nerror: could not apply "+topic[:7]+"... topic\n"+
+			"hint: After resolving the conflicts, mark them with\nhint: \"ggit add/rm <pathspec>\", then run\nhint: \"ggit cherry-pick --continue\".\n"+
+			"hint: You can instead skip this commit with \"ggit cherry-pick --skip\".\n"+
+			"hint: To abort and get back to the state before \"ggit cherry-pick\",\nhint: run \"ggit cherry-pick --abort\".\n", out)
+		assert.Equal(t, "1\n<<<<<<< HEAD\nM\n=======\nT\n>>>>>>> "+topic[:7]+" (topic)\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, topic+"\n", readGitFile(t, r, "CHERRY_PICK_HEAD"))
+		assert.Equal(t, "pick "+topic[:7]+" topic\npick "+second[:7]+" change h\n", readGitFile(t, r, "sequencer/todo"))
+		assert.Equal(t, "[options]\n\trecord-origin = true\n", readGitFile(t, r, "sequencer/opts"))
+		assert.Equal(t, master+"\n", readGitFile(t, r, "sequencer/head"))
+
+		_, _, err = pick(r, repository.CherryPick{Commits: []string{"topic"}})
+		assert.EqualError(t, err, "a cherry-pick or revert is already in progress\nhint: try \"ggit cherry-pick (--continue | --skip | --abort)\"")
+		_, _, err = pick(r, repository.CherryPick{Continue: true})
+		assert.EqualError(t, err, "Committing is not possible because you have unmerged files.")
+
+		writeWorktreeFile(t, r, "f", "1\nR\n3\n4\n5\n6\n7\n")
+		assert.NoError(t, r.Add([]string{"f"}))
+		out, done, err = pick(r, repository.CherryPick{Continue: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Contains(t, out, "] topic\n")
+		assert.Contains(t, out, "] change h\n")
+
+		head, commit := readHeadCommit(t, r)
+		assert.Equal(t, "change h\n\n(cherry picked from commit "+second+")", commit.KVLM.Message)
+		resolved := mustReadCommit(t, r, head+"~1")
+		assert.Equal(t, "topic\n\n(cherry picked from commit "+topic+")", resolved.KVLM.Message)
+		assert.Equal(t, []string{master}, resolved.KVLM.Parents)
+		assert.Equal(t, "1\nR\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		for _, name := range []string{"CHERRY_PICK_HEAD", "MERGE_MSG", "sequencer"} {
+			exists, err := afero.Exists(r.FS, filepath.Join(r.Gitdir, name))
+			assert.NoError(t, err)
+			assert.False(t, exists, name)
+		}
+
+		_, _, err = pick(r, repository.CherryPick{Continue: true})
+		assert.EqualError(t, err, "no cherry-pick or revert in progress")
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		r, master, _, _ := newSequenceRepository(t)
+		_, done, err := pick(r, repository.CherryPick{Commits: []string{"topic~1", "topic"}})
+		assert.NoError(t, err)
+		assert.False(t, done)
+		_, done, err = pick(r, repository.CherryPick{Skip: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		_, commit := readHeadCommit(t, r)
+		assert.Equal(t, "change h", commit.KVLM.Message)
+		assert.Equal(t, []string{master}, commit.KVLM.Parents)
+		assert.Equal(t, "1\nM\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{index.StageMerged}, readIndexStages(t, r, "f"))
+
+		_, _, err = pick(r, repository.CherryPick{Skip: true})
+		assert.EqualError(t, err, "no cherry-pick in progress")
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		r, master, _, _ := newSequenceRepository(t)
+		_, done, err := pick(r, repository.CherryPick{Commits: []string{"topic", "topic~1"}})
+		assert.NoError(t, err)
+		assert.False(t, done)
+		assert.NotEqual(t, master, mustResolve(t, r, "HEAD"), "the first commit was picked")
+
+		out, done, err := pick(r, repository.CherryPick{Abort: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Empty(t, out)
+		assert.Equal(t, master, mustResolve(t, r, "HEAD"))
+		assert.Equal(t, "1\nM\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{index.StageMerged}, readIndexStages(t, r, "f"))
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, "h"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("AbortMovedHead", func(t *testing.T) {
+		r, master, _, _ := newSequenceRepository(t)
+		_, _, err := pick(r, repository.CherryPick{Commits: []string{"topic", "topic~1"}})
+		assert.NoError(t, err)
+		assert.NoError(t, r.UpdateHead(master, "reset: moving to master"))
+		out, done, err := pick(r, repository.CherryPick{Abort: true})
+		assert.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, "warning: You seem to have moved HEAD. Not rewinding, check your HEAD!\n", out)
+	})
+
+	t.Run("RevertConflict", func(t *testing.T) {
+		r, master, _, _ := newSequenceRepository(t)
+		_, done, err := r.CherryPick(&repository.CherryPick{Action: repository.ActionRevert, Commits: []string{"topic~1"}})
+		assert.NoError(t, err)
+		assert.False(t, done)
+		assert.Equal(t, master+"\n", readGitFile(t, r, "sequencer/head"))
+		assert.Equal(t, mustResolve(t, r, "topic~1")+"\n", readGitFile(t, r, "REVERT_HEAD"))
+	})
+}
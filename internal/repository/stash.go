@@ -0,0 +1,479 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/filesystem"
+	"ggit/internal/index"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// stashRef holds the newest stash entry; its reflog is the stack of
+// entries.
+const stashRef = "refs/stash"
+
+type StashPush struct {
+	Message string
+	// IncludeUntracked also stashes, and removes, the untracked files.
+	IncludeUntracked bool
+}
+
+// StashPush records the changes of the index and the worktree as a stash
+// entry, then resets them to HEAD. The entry is a commit of the worktree
+// state whose parents are HEAD, a commit of the index and, with
+// IncludeUntracked, a commit of the untracked files.
+//
+// Returns:
+//   - The description of the saved entry, or a note that there is nothing
+//     to save.
+//   - An error if there is no commit yet, the index is unmerged or the
+//     entry can not be written.
+func (r *Repository) StashPush(opts *StashPush) (string, error) {
+	if !r.IsInitiated() {
+		return "", ErrorUninitiate
+	}
+	if r.IsBare() {
+		return "", ErrorBare
+	}
+	head, err := r.headCommit()
+	if err != nil {
+		return "", err
+	}
+	if head == "" {
+		return "", fmt.Errorf("You do not have the initial commit yet")
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return "", fmt.Errorf("could not save index tree: the index is unmerged")
+	}
+	headTree, err := r.headTree(head)
+	if err != nil {
+		return "", err
+	}
+	headFiles, err := r.treeFiles(headTree)
+	if err != nil {
+		return "", err
+	}
+	indexTree, err := r.WriteTree(idx)
+	if err != nil {
+		return "", err
+	}
+
+	staged := indexFiles(idx)
+	changed, err := r.worktreeChanges(idx)
+	if err != nil {
+		return "", err
+	}
+	worktree := map[string]diff.File{}
+	for p, f := range staged {
+		worktree[p] = f
+	}
+	for _, p := range changed {
+		f, err := r.worktreeFile(p, staged[p])
+		if err != nil {
+			return "", err
+		}
+		if !f.Exists() {
+			delete(worktree, p)
+			continue
+		}
+		if err := r.storeWorktreeFile(f); err != nil {
+			return "", err
+		}
+		worktree[p] = f
+	}
+	untracked := map[string]diff.File{}
+	if opts.IncludeUntracked {
+		if untracked, err = r.untrackedFiles(idx); err != nil {
+			return "", err
+		}
+	}
+	if indexTree == headTree && len(changed) == 0 && len(untracked) == 0 {
+		return "No local changes to save\n", nil
+	}
+
+	commit, err := r.readCommit(head)
+	if err != nil {
+		return "", err
+	}
+	branch := r.branchName()
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	on := fmt.Sprintf("%s: %s %s", branch, shortID(head), subject(commit.KVLM.Message))
+	indexCommit, err := r.CommitTree(indexTree, []string{head}, "index on "+on+"\n")
+	if err != nil {
+		return "", err
+	}
+	parents := []string{head, indexCommit}
+	if len(untracked) > 0 {
+		tree, err := r.writeFiles(untracked)
+		if err != nil {
+			return "", err
+		}
+		untrackedCommit, err := r.CommitTree(tree, nil, "untracked files on "+on+"\n")
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+	message := "WIP on " + on
+	if opts.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+	tree, err := r.writeFiles(worktree)
+	if err != nil {
+		return "", err
+	}
+	sha, err := r.CommitTree(tree, parents, message)
+	if err != nil {
+		return "", err
+	}
+	if !filesystem.IsFile(r.FS, r.path(logsDir, stashRef)) {
+		if err := r.ReplaceTextFile("", logsDir, stashRef); err != nil {
+			return "", err
+		}
+	}
+	if err := r.UpdateRef(stashRef, sha, "", message); err != nil {
+		return "", err
+	}
+
+	old := map[string]diff.File{}
+	for _, p := range append(indexChanges(idx, headFiles), changed...) {
+		f, err := r.worktreeFile(p, staged[p])
+		if err != nil {
+			return "", err
+		}
+		if f.Exists() {
+			old[p] = f
+		}
+	}
+	if err := r.checkout(old, headFiles, true, "reset"); err != nil {
+		return "", err
+	}
+	if err := r.WriteIndex(r.buildIndex(headFiles, nil, idx)); err != nil {
+		return "", err
+	}
+	for p := range untracked {
+		if err := r.removeWorktreeFile(p); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("Saved working directory and index state %s\n", message), nil
+}
+
+// untrackedFiles stores the worktree files the index does not track.
+//
+// Returns:
+//   - The untracked files by path.
+//   - An error if a file can not be read or stored.
+func (r *Repository) untrackedFiles(idx *index.Index) (map[string]diff.File, error) {
+	tracked := map[string]bool{}
+	for _, e := range idx.Entries {
+		tracked[e.Path] = true
+	}
+	paths, err := r.listWorktree("")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]diff.File{}
+	for _, p := range paths {
+		if tracked[p] {
+			continue
+		}
+		f, err := r.worktreeFile(p, diff.File{})
+		if err != nil {
+			return nil, err
+		}
+		if err := r.storeWorktreeFile(f); err != nil {
+			return nil, err
+		}
+		files[p] = f
+	}
+	return files, nil
+}
+
+var stashEntry = regexp.MustCompile(`^(?:refs/)?stash@\{(\d+)\}$`)
+
+// resolveStash resolves a stash entry given as "stash@{<n>}" or "<n>", the
+// newest one by default.
+//
+// Returns:
+//   - The commit of the entry.
+//   - Its position in the stack, from zero.
+//   - Its name, as reported.
+//   - An error if there is no such entry.
+func (r *Repository) resolveStash(name string) (string, int, string, error) {
+	n := 0
+	switch match := stashEntry.FindStringSubmatch(name); {
+	case name == "":
+		name = stashRef + "@{0}"
+	case match != nil:
+		n, _ = strconv.Atoi(match[1])
+	default:
+		var err error
+		if n, err = strconv.Atoi(name); err != nil || n < 0 {
+			return "", 0, "", fmt.Errorf("%s is not a stash reference", name)
+		}
+		name = fmt.Sprintf("%s@{%d}", stashRef, n)
+	}
+	entries, err := r.Reflog(stashRef)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if len(entries) == 0 {
+		return "", 0, "", fmt.Errorf("No stash entries found.")
+	}
+	if n >= len(entries) {
+		return "", 0, "", fmt.Errorf("log for 'stash' only has %d entries", len(entries))
+	}
+	return entries[len(entries)-1-n].New, n, name, nil
+}
+
+// StashList lists the stash entries, newest first, as
+// "stash@{<n>}: <message>" lines.
+//
+// Returns:
+//   - The list of entries.
+//   - An error if the reflog of the stash can not be read.
+func (r *Repository) StashList() (string, error) {
+	if !r.IsInitiated() {
+		return "", ErrorUninitiate
+	}
+	entries, err := r.Reflog(stashRef)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i := range entries {
+		fmt.Fprintf(&b, "stash@{%d}: %s\n", i, entries[len(entries)-1-i].Message)
+	}
+	return b.String(), nil
+}
+
+// StashShow shows the changes recorded in a stash entry against the commit
+// it was based on, as a diffstat or as a patch.
+//
+// Returns:
+//   - The diffstat or the patch.
+//   - An error if the entry does not exist.
+func (r *Repository) StashShow(name string, patch bool) (string, error) {
+	if !r.IsInitiated() {
+		return "", ErrorUninitiate
+	}
+	sha, _, _, err := r.resolveStash(name)
+	if err != nil {
+		return "", err
+	}
+	commit, err := r.readCommit(sha)
+	if err != nil {
+		return "", err
+	}
+	base, err := r.peelTree(commit.KVLM.Parents[0])
+	if err != nil {
+		return "", err
+	}
+	changes, err := diff.TreeDiff(r, base, commit.KVLM.Tree, &diff.Options{Renames: true, RenameScore: diff.DefaultRenameScore})
+	if err != nil {
+		return "", err
+	}
+	if patch {
+		return diff.FormatPatch(r, changes, diff.PatchOptions{Context: 3})
+	}
+	stats, err := diff.Stats(r, changes)
+	if err != nil {
+		return "", err
+	}
+	return diff.FormatStat(stats, diff.StatOptions{}), nil
+}
+
+// StashApply merges the changes of a stash entry into the index and the
+// worktree, from the commit the entry was based on. Once merged, only the
+// files the entry added stay staged. The untracked files of the entry are
+// restored unless they exist. With pop the entry is dropped when it applies
+// without conflicts.
+//
+// Returns:
+//   - The messages of the merge and, with pop, the dropped entry.
+//   - Whether the entry applied without conflicts.
+//   - An error if the entry does not exist or the merge would overwrite
+//     local changes.
+func (r *Repository) StashApply(name string, pop bool) (string, bool, error) {
+	if !r.IsInitiated() {
+		return "", false, ErrorUninitiate
+	}
+	sha, _, _, err := r.resolveStash(name)
+	if err != nil {
+		return "", false, err
+	}
+	commit, err := r.readCommit(sha)
+	if err != nil {
+		return "", false, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	if len(idx.Conflicts()) > 0 {
+		return "", false, fmt.Errorf("Cannot apply a stash in the middle of a merge")
+	}
+	current, err := r.WriteTree(idx)
+	if err != nil {
+		return "", false, err
+	}
+	currentFiles, err := r.treeFiles(current)
+	if err != nil {
+		return "", false, err
+	}
+	base, err := r.peelTree(commit.KVLM.Parents[0])
+	if err != nil {
+		return "", false, err
+	}
+
+	// The untracked files are checked before the merge touches the
+	// worktree, so that an entry either applies or leaves it alone.
+	b := &strings.Builder{}
+	var untracked map[string]diff.File
+	if len(commit.KVLM.Parents) > 2 {
+		var restorable bool
+		if untracked, restorable, err = r.stashedUntracked(b, commit.KVLM.Parents[2]); err != nil {
+			return "", false, err
+		}
+		if !restorable {
+			b.WriteString("error: could not restore untracked files from stash\n")
+			if pop {
+				b.WriteString("The stash entry is kept in case you need it again.\n")
+			}
+			return b.String(), false, nil
+		}
+	}
+
+	if base == commit.KVLM.Tree {
+		b.WriteString("Already up to date.\n")
+		if err := r.writeWorktreeFiles(untracked); err != nil {
+			return "", false, err
+		}
+	} else {
+		style, err := r.conflictStyle("")
+		if err != nil {
+			return "", false, err
+		}
+		m := r.newTreeMerge("Updated upstream", "Stashed changes", style)
+		m.base = "Version stash was based on"
+		if err := m.merge(base, current, commit.KVLM.Tree); err != nil {
+			return "", false, err
+		}
+		if err := r.checkout(indexFiles(idx), m.files, false, "merge"); err != nil {
+			return "", false, err
+		}
+		if err := r.writeWorktreeFiles(untracked); err != nil {
+			return "", false, err
+		}
+		b.WriteString(m.report())
+		if len(m.conflicts) > 0 {
+			if err := r.WriteIndex(r.buildIndex(m.files, m.stages, idx)); err != nil {
+				return "", false, err
+			}
+			if pop {
+				b.WriteString("The stash entry is kept in case you need it again.\n")
+			}
+			return b.String(), false, nil
+		}
+		// Keep the changes unstaged, but the new files.
+		files := currentFiles
+		for p, f := range m.files {
+			if _, ok := currentFiles[p]; !ok {
+				files[p] = f
+			}
+		}
+		if err := r.WriteIndex(r.buildIndex(files, nil, idx)); err != nil {
+			return "", false, err
+		}
+	}
+
+	if pop {
+		out, err := r.StashDrop(name)
+		if err != nil {
+			return "", false, err
+		}
+		b.WriteString(out)
+	}
+	return b.String(), true, nil
+}
+
+// stashedUntracked returns the files of the untracked files commit of a
+// stash entry, reporting the ones that exist in the worktree.
+//
+// Returns:
+//   - The files, by path.
+//   - Whether none of them exists, for them to be restored.
+//   - An error if a file can not be read.
+func (r *Repository) stashedUntracked(b *strings.Builder, sha string) (map[string]diff.File, bool, error) {
+	tree, err := r.peelTree(sha)
+	if err != nil {
+		return nil, false, err
+	}
+	files, err := r.treeFiles(tree)
+	if err != nil {
+		return nil, false, err
+	}
+	restorable := true
+	for _, p := range sortedPaths(files) {
+		current, err := r.worktreeFile(p, diff.File{})
+		if err != nil {
+			return nil, false, err
+		}
+		if current.Exists() {
+			fmt.Fprintf(b, "%s already exists, no checkout\n", p)
+			restorable = false
+		}
+	}
+	return files, restorable, nil
+}
+
+// writeWorktreeFiles writes files to the worktree.
+func (r *Repository) writeWorktreeFiles(files map[string]diff.File) error {
+	for _, p := range sortedPaths(files) {
+		if err := r.writeWorktreeFile(files[p]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StashDrop removes a stash entry from the stack, the newest one by
+// default.
+//
+// Returns:
+//   - The name and the commit of the dropped entry.
+//   - An error if the entry does not exist.
+func (r *Repository) StashDrop(name string) (string, error) {
+	if !r.IsInitiated() {
+		return "", ErrorUninitiate
+	}
+	sha, n, name, err := r.resolveStash(name)
+	if err != nil {
+		return "", err
+	}
+	if err := r.deleteReflogEntry(stashRef, n); err != nil {
+		return "", err
+	}
+	entries, err := r.Reflog(stashRef)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		err = r.DeleteRef(stashRef)
+	} else if n == 0 {
+		err = r.ReplaceTextFile(entries[len(entries)-1].New+"\n", strings.Split(stashRef, "/")...)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Dropped %s (%s)\n", name, sha), nil
+}
@@ -0,0 +1,167 @@
+package repository_test
+
+import (
+	"ggit/internal/repository"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStashRepository returns a repository on master with f changed in the
+// worktree and the new file n staged.
+func newStashRepository(t *testing.T) (*repository.Repository, string) {
+	r, base, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+	writeWorktreeFile(t, r, "f", "1\n2\n3\n4\n5\n6\nW\n")
+	writeWorktreeFile(t, r, "n", "new\n")
+	assert.NoError(t, r.Add([]string{"n"}))
+	return r, base
+}
+
+func TestStash(t *testing.T) {
+	t.Run("PushAndPop", func(t *testing.T) {
+		r, base := newStashRepository(t)
+		out, err := r.StashPush(&repository.StashPush{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Saved working directory and index state WIP on master: "+base[:7]+" base\n", out)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\n7\n", readWorktreeFile(t, r, "f"))
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, "n"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		stash := mustReadCommit(t, r, "refs/stash")
+		assert.Equal(t, "WIP on master: "+base[:7]+" base", stash.KVLM.Message)
+		assert.Len(t, stash.KVLM.Parents, 2)
+		assert.Equal(t, base, stash.KVLM.Parents[0])
+		assert.Equal(t, "index on master: "+base[:7]+" base", mustReadCommit(t, r, stash.KVLM.Parents[1]).KVLM.Message)
+
+		out, err = r.StashList()
+		assert.NoError(t, err)
+		assert.Equal(t, "stash@{0}: WIP on master: "+base[:7]+" base\n", out)
+
+		sha := mustResolve(t, r, "refs/stash")
+		out, clean, err := r.StashApply("", true)
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "Dropped refs/stash@{0} ("+sha+")\n", out)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\nW\n", readWorktreeFile(t, r, "f"))
+		assert.Equal(t, "new\n", readWorktreeFile(t, r, "n"))
+		assert.Equal(t, []int{0}, readIndexStages(t, r, "n"))
+		_, err = r.ResolveRef("refs/stash")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("NoChanges", func(t *testing.T) {
+		r, _, _ := newMergeRepository(t, "", "1\nT\n3\n4\n5\n6\n7\n")
+		out, err := r.StashPush(&repository.StashPush{})
+		assert.NoError(t, err)
+		assert.Equal(t, "No local changes to save\n", out)
+
+		_, _, err = r.StashApply("", true)
+		assert.EqualError(t, err, "No stash entries found.")
+	})
+
+	t.Run("Message", func(t *testing.T) {
+		r, _ := newStashRepository(t)
+		_, err := r.StashPush(&repository.StashPush{Message: "hello"})
+		assert.NoError(t, err)
+		out, err := r.StashList()
+		assert.NoError(t, err)
+		assert.Equal(t, "stash@{0}: On master: hello\n", out)
+	})
+
+	t.Run("Show", func(t *testing.T) {
+		r, _ := newStashRepository(t)
+		_, err := r.StashPush(&repository.StashPush{})
+		assert.NoError(t, err)
+
+		out, err := r.StashShow("", false)
+		assert.NoError(t, err)
+		assert.Equal(t, " f | 2 +-\n n | 1 +\n 2 files changed, 2 insertions(+), 1 deletion(-)\n", out)
+
+		out, err = r.StashShow("stash@{0}", true)
+		assert.NoError(t, err)
+		assert.Contains(t, out, "diff --git a/f b/f\n")
+		assert.Contains(t, out, "-7\n+W\n")
+		assert.Contains(t, out, "new file mode 100644\n")
+	})
+
+	t.Run("Stack", func(t *testing.T) {
+		r, _ := newStashRepository(t)
+		_, err := r.StashPush(&repository.StashPush{Message: "first"})
+		assert.NoError(t, err)
+		first := mustResolve(t, r, "refs/stash")
+		writeWorktreeFile(t, r, "g", "second\n")
+		_, err = r.StashPush(&repository.StashPush{Message: "second"})
+		assert.NoError(t, err)
+		second := mustResolve(t, r, "refs/stash")
+
+		out, err := r.StashList()
+		assert.NoError(t, err)
+		assert.Equal(t, "stash@{0}: On master: second\nstash@{1}: On master: first\n", out)
+
+		_, err = r.StashDrop("stash@{2}")
+		assert.EqualError(t, err, "log for 'stash' only has 2 entries")
+
+		out, err = r.StashDrop("stash@{1}")
+		assert.NoError(t, err)
+		assert.Equal(t, "Dropped stash@{1} ("+first+")\n", out)
+		assert.Equal(t, second, mustResolve(t, r, "refs/stash"))
+
+		out, err = r.StashDrop("0")
+		assert.NoError(t, err)
+		assert.Equal(t, "Dropped refs/stash@{0} ("+second+")\n", out)
+		_, err = r.StashList()
+		assert.NoError(t, err)
+		_, err = r.ResolveRef("refs/stash")
+		assert.ErrorIs(t, err, repository.ErrorRefNotFound)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		r, _ := newStashRepository(t)
+		_, err := r.StashPush(&repository.StashPush{})
+		assert.NoError(t, err)
+		writeWorktreeFile(t, r, "f", "1\n2\n3\n4\n5\n6\nC\n")
+		commitWorktree(t, r, "change", "f")
+
+		out, clean, err := r.StashApply("", true)
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "Auto-merging f\nCONFLICT (content): Merge conflict in f\n"+
+			"The stash entry is kept in case you need it again.\n", out)
+		assert.Equal(t, "1\n2\n3\n4\n5\n6\n<<<<<<< Updated upstream\nC\n=======\nW\n>>>>>>> Stashed changes\n",
+			readWorktreeFile(t, r, "f"))
+		assert.Equal(t, []int{1, 2, 3}, readIndexStages(t, r, "f"))
+		_, err = r.ResolveRef("refs/stash")
+		assert.NoError(t, err)
+	})
+
+	t.Run("IncludeUntracked", func(t *testing.T) {
+		r, _ := newStashRepository(t)
+		writeWorktreeFile(t, r, "u", "untracked\n")
+		_, err := r.StashPush(&repository.StashPush{IncludeUntracked: true})
+		assert.NoError(t, err)
+		exists, err := afero.Exists(r.FS, filepath.Join(r.Worktree, "u"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		assert.Len(t, mustReadCommit(t, r, "refs/stash").KVLM.Parents, 3)
+
+		writeWorktreeFile(t, r, "u", "in the way\n")
+		out, clean, err := r.StashApply("", false)
+		assert.NoError(t, err)
+		assert.False(t, clean)
+		assert.Equal(t, "u already exists, no checkout\nerror: could not restore untracked files from stash\n", out)
+		// The tracked changes are not applied either.
+		exists, err = afero.Exists(r.FS, filepath.Join(r.Worktree, "n"))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "u")))
+		_, clean, err = r.StashApply("", false)
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "untracked\n", readWorktreeFile(t, r, "u"))
+		assert.Equal(t, "new\n", readWorktreeFile(t, r, "n"))
+	})
+}
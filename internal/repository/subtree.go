@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/objects"
+	"strings"
+)
+
+// readTree reads a tree object.
+func (r *Repository) readTree(sha string) (*objects.Tree, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	tree, ok := obj.(*objects.Tree)
+	if !ok {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", sha, obj.Format())
+	}
+	return tree, nil
+}
+
+// Scores of a pair of tree entries, as in git's match-trees: matching
+// directories weigh most, entries missing on one side cost most.
+func scoreMissing(mode string) int {
+	switch mode {
+	case objects.ModeTree:
+		return -1000
+	case objects.ModeSymlink:
+		return -500
+	}
+	return -50
+}
+
+func scoreDiffers(a string, b string) int {
+	switch {
+	case (a == objects.ModeTree) != (b == objects.ModeTree):
+		return -100
+	case (a == objects.ModeSymlink) != (b == objects.ModeSymlink):
+		return -50
+	}
+	return -5
+}
+
+func scoreMatches(a string, b string) int {
+	switch {
+	case (a == objects.ModeTree) != (b == objects.ModeTree):
+		return -100
+	case (a == objects.ModeSymlink) != (b == objects.ModeSymlink):
+		return -50
+	case a == objects.ModeTree:
+		return 1000
+	case a == objects.ModeSymlink:
+		return 500
+	}
+	return 250
+}
+
+// scoreTrees tells how much the top levels of two trees look alike.
+func (r *Repository) scoreTrees(a string, b string) (int, error) {
+	ta, err := r.readTree(a)
+	if err != nil {
+		return 0, err
+	}
+	tb, err := r.readTree(b)
+	if err != nil {
+		return 0, err
+	}
+	score := 0
+	for _, e := range ta.Entries {
+		other, ok := tb.Entry(e.Name)
+		switch {
+		case !ok:
+			score += scoreMissing(e.Mode)
+		case other.Hash == e.Hash:
+			score += scoreMatches(e.Mode, other.Mode)
+		default:
+			score += scoreDiffers(e.Mode, other.Mode)
+		}
+	}
+	for _, e := range tb.Entries {
+		if _, ok := ta.Entry(e.Name); !ok {
+			score += scoreMissing(e.Mode)
+		}
+	}
+	return score, nil
+}
+
+// matchTrees looks for the subtree of tree that looks most like other,
+// improving on best.
+//
+// Returns:
+//   - The path of the best matching subtree, or match when none improves
+//     on best.
+//   - Its score.
+//   - An error if a tree can not be read.
+func (r *Repository) matchTrees(tree string, other string, prefix string, match string, best int) (string, int, error) {
+	t, err := r.readTree(tree)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, e := range t.Entries {
+		if !e.IsTree() {
+			continue
+		}
+		score, err := r.scoreTrees(e.Hash, other)
+		if err != nil {
+			return "", 0, err
+		}
+		if score > best {
+			match, best = prefix+e.Name, score
+		}
+		if match, best, err = r.matchTrees(e.Hash, other, prefix+e.Name+"/", match, best); err != nil {
+			return "", 0, err
+		}
+	}
+	return match, best, nil
+}
+
+// subtree returns the ID of the subtree of tree at the path p, or an empty
+// string when there is none.
+func (r *Repository) subtree(tree string, p string) (string, error) {
+	for _, name := range strings.Split(p, "/") {
+		t, err := r.readTree(tree)
+		if err != nil {
+			return "", err
+		}
+		e, ok := t.Entry(name)
+		if !ok || !e.IsTree() {
+			return "", nil
+		}
+		tree = e.Hash
+	}
+	return tree, nil
+}
+
+// spliceTree returns a copy of tree where the subtree at the path p is
+// replaced by sub.
+func (r *Repository) spliceTree(tree string, p string, sub string) (string, error) {
+	name, rest, nested := strings.Cut(p, "/")
+	t, err := r.readTree(tree)
+	if err != nil {
+		return "", err
+	}
+	e, ok := t.Entry(name)
+	if !ok || !e.IsTree() {
+		return "", fmt.Errorf("cannot splice %s: %s is not a tree", p, name)
+	}
+	if nested {
+		if sub, err = r.spliceTree(e.Hash, rest, sub); err != nil {
+			return "", err
+		}
+	}
+	spliced := objects.NewTree()
+	for _, entry := range t.Entries {
+		if entry.Name == name {
+			entry.Hash = sub
+		}
+		spliced.Entries = append(spliced.Entries, entry)
+	}
+	return r.WriteObject(spliced)
+}
+
+// shiftTree lines the tree other up with tree for a subtree merge. When a
+// subtree of tree looks like other, other is moved down into it, and when
+// a subtree of other looks like tree, that subtree is taken instead. With
+// a prefix, the subtree at the prefix is used instead of the best looking
+// one.
+//
+// Returns:
+//   - The ID of the shifted tree.
+//   - An error if a tree can not be read or written.
+func (r *Repository) shiftTree(tree string, other string, prefix string) (string, error) {
+	if prefix != "" {
+		prefix = strings.Trim(prefix, "/")
+		if sub, err := r.subtree(tree, prefix); err != nil || sub != "" {
+			if err != nil {
+				return "", err
+			}
+			return r.spliceTree(tree, prefix, other)
+		}
+		sub, err := r.subtree(other, prefix)
+		if err != nil || sub == "" {
+			return other, err
+		}
+		return sub, nil
+	}
+
+	score, err := r.scoreTrees(tree, other)
+	if err != nil {
+		return "", err
+	}
+	add, addScore, err := r.matchTrees(tree, other, "", "", score)
+	if err != nil {
+		return "", err
+	}
+	del, delScore, err := r.matchTrees(other, tree, "", "", score)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case addScore < delScore:
+		return r.subtree(other, del)
+	case add == "":
+		return other, nil
+	}
+	return r.spliceTree(tree, add, other)
+}
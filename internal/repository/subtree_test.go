@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSubtreeRepository returns a repository whose master branch holds the
+// lib project in vendor/lib, merged from the lib branch that has changed
+// since.
+func newSubtreeRepository(t *testing.T) *repository.Repository {
+	r, _, _ := newMergeRepository(t, "", "1\n2\n3\n4\n5\n6\n7\n")
+	readme := objects.TreeEntry{Mode: objects.ModeFile, Name: "README", Hash: writeBlob(t, r, "lib\n")}
+	lib1, err := r.CommitTree(writeTree(t, r, readme,
+		objects.TreeEntry{Mode: objects.ModeFile, Name: "lib.c", Hash: writeBlob(t, r, "l1\nl2\nl3\nl4\nl5\n")},
+	), nil, "lib1")
+	assert.NoError(t, err)
+	lib2, err := r.CommitTree(writeTree(t, r, readme,
+		objects.TreeEntry{Mode: objects.ModeFile, Name: "lib.c", Hash: writeBlob(t, r, "l1\nL2\nl3\nl4\nl5\n")},
+	), []string{lib1}, "lib2")
+	assert.NoError(t, err)
+	assert.NoError(t, r.UpdateRef("refs/heads/lib", lib2, "", "branch: Created"))
+
+	writeWorktreeFile(t, r, "vendor/lib/README", "lib\n")
+	writeWorktreeFile(t, r, "vendor/lib/lib.c", "l1\nl2\nl3\nl4\nl5\n")
+	assert.NoError(t, r.Add([]string{"vendor"}))
+	idx, err := r.ReadIndex()
+	assert.NoError(t, err)
+	tree, err := r.WriteTree(idx)
+	assert.NoError(t, err)
+	merged, err := r.CommitTree(tree, []string{mustResolve(t, r, "HEAD"), lib1}, "Merge lib into vendor/lib")
+	assert.NoError(t, err)
+	assert.NoError(t, r.UpdateHead(merged, "commit (merge): Merge lib into vendor/lib"))
+
+	writeWorktreeFile(t, r, "vendor/lib/lib.c", "l1\nl2\nl3\nl4\nL5\n")
+	commitWorktree(t, r, "change lib locally", "vendor/lib/lib.c")
+	return r
+}
+
+func TestSubtreeMerge(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		opts     *repository.Merge
+		strategy string
+	}{
+		{"Detected", &repository.Merge{Commits: []string{"lib"}, Strategy: repository.StrategySubtree}, repository.StrategySubtree},
+		{"Prefix", &repository.Merge{Commits: []string{"lib"}, StrategyOptions: []string{"subtree=vendor/lib"}}, repository.StrategyRecursive},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := newSubtreeRepository(t)
+			out, clean, err := r.Merge(test.opts)
+			assert.NoError(t, err)
+			assert.True(t, clean)
+			assert.Equal(t, "Auto-merging vendor/lib/lib.c\nMerge made by the '"+test.strategy+"' strategy.\n"+
+				" vendor/lib/lib.c | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n", out)
+			assert.Equal(t, "l1\nL2\nl3\nl4\nL5\n", readWorktreeFile(t, r, "vendor/lib/lib.c"))
+		})
+	}
+
+	t.Run("Unrelated", func(t *testing.T) {
+		r := newSubtreeRepository(t)
+		_, _, err := r.Merge(&repository.Merge{Commits: []string{"lib~1"}})
+		assert.NoError(t, err, "lib~1 is already merged")
+
+		other, err := r.CommitTree(objects.EmptyTreeHash, nil, "unrelated")
+		assert.NoError(t, err)
+		_, _, err = r.Merge(&repository.Merge{Commits: []string{other}})
+		assert.EqualError(t, err, "refusing to merge unrelated histories")
+	})
+}
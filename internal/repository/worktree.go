@@ -0,0 +1,561 @@
+package repository
+
+import (
+	"fmt"
+	"ggit/internal/diff"
+	"ggit/internal/filesystem"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const indexFile = "index"
+
+// ReadIndex reads the index of the repository. A repository without an
+// index file has an empty index.
+func (r *Repository) ReadIndex() (*index.Index, error) {
+	return index.Read(r.FS, r.path(indexFile), r.ObjectFormat())
+}
+
+// WriteIndex replaces the index of the repository.
+func (r *Repository) WriteIndex(idx *index.Index) error {
+	return idx.Write(r.FS, r.path(indexFile))
+}
+
+// treeFiles lists the files of a tree and its subtrees by path.
+//
+// Returns:
+//   - The files of the tree, keyed by their slash separated path.
+//   - An error if a tree can not be read.
+func (r *Repository) treeFiles(sha string) (map[string]diff.File, error) {
+	files := map[string]diff.File{}
+	var walk func(prefix string, sha string) error
+	walk = func(prefix string, sha string) error {
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return err
+		}
+		tree, ok := obj.(*objects.Tree)
+		if !ok {
+			return fmt.Errorf("object %s is a %s, not a tree", sha, obj.Format())
+		}
+		for _, e := range tree.Entries {
+			if e.IsTree() {
+				if err := walk(prefix+e.Name+"/", e.Hash); err != nil {
+					return err
+				}
+				continue
+			}
+			files[prefix+e.Name] = diff.File{Path: prefix + e.Name, Mode: e.Mode, Hash: e.Hash}
+		}
+		return nil
+	}
+	return files, walk("", sha)
+}
+
+// indexFiles lists the merged entries of an index by path.
+func indexFiles(idx *index.Index) map[string]diff.File {
+	files := map[string]diff.File{}
+	for _, e := range idx.Entries {
+		if e.Stage == index.StageMerged {
+			files[e.Path] = diff.File{Path: e.Path, Mode: e.Mode, Hash: e.Hash}
+		}
+	}
+	return files
+}
+
+// sortedPaths returns the paths of files in index order.
+func sortedPaths(files ...map[string]diff.File) []string {
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, m := range files {
+		for p := range m {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// WriteTree writes the merged entries of an index as tree objects.
+//
+// Returns:
+//   - The ID of the root tree.
+//   - An error if the index has unmerged entries or a tree can not be
+//     written.
+func (r *Repository) WriteTree(idx *index.Index) (string, error) {
+	if conflicts := idx.Conflicts(); len(conflicts) > 0 {
+		return "", fmt.Errorf("%s: unmerged entries, cannot write a tree", strings.Join(conflicts, ", "))
+	}
+	return r.writeFiles(indexFiles(idx))
+}
+
+// writeFiles writes the tree objects holding files.
+func (r *Repository) writeFiles(files map[string]diff.File) (string, error) {
+	list := make([]diff.File, 0, len(files))
+	for _, p := range sortedPaths(files) {
+		list = append(list, files[p])
+	}
+	return r.writeTreeFiles(list, "")
+}
+
+// writeTreeFiles writes the tree of the directory prefix. files are the
+// files below it, in path order.
+func (r *Repository) writeTreeFiles(files []diff.File, prefix string) (string, error) {
+	tree := objects.NewTree()
+	for i := 0; i < len(files); {
+		name := strings.TrimPrefix(files[i].Path, prefix)
+		if dir, _, ok := strings.Cut(name, "/"); ok {
+			sub := prefix + dir + "/"
+			j := i
+			for j < len(files) && strings.HasPrefix(files[j].Path, sub) {
+				j++
+			}
+			sha, err := r.writeTreeFiles(files[i:j], sub)
+			if err != nil {
+				return "", err
+			}
+			tree.Entries = append(tree.Entries, objects.TreeEntry{Mode: objects.ModeTree, Name: dir, Hash: sha})
+			i = j
+			continue
+		}
+		tree.Entries = append(tree.Entries, objects.TreeEntry{Mode: files[i].Mode, Name: name, Hash: files[i].Hash})
+		i++
+	}
+	tree.Sort()
+	return r.WriteObject(tree)
+}
+
+// worktreePath returns the location of a repository path in the worktree.
+func (r *Repository) worktreePath(p string) string {
+	return filepath.Join(r.Worktree, filepath.FromSlash(p))
+}
+
+// trustExecutableBit reports whether the executable bit of worktree files
+// is meaningful, as configured by core.fileMode.
+func (r *Repository) trustExecutableBit() bool {
+	return r.Config.Get("core", "filemode") != "false"
+}
+
+// lstat returns the information of a worktree file without following
+// symbolic links when the filesystem supports them.
+func (r *Repository) lstat(p string) (os.FileInfo, error) {
+	if l, ok := r.FS.Fs.(afero.Lstater); ok {
+		info, _, err := l.LstatIfPossible(p)
+		return info, err
+	}
+	return r.FS.Stat(p)
+}
+
+// worktreeFile hashes the worktree version of a repository path. Files the
+// worktree does not have, or has a directory in place of, are returned
+// without a mode. The mode is taken from tracked when the executable bit
+// can not be trusted.
+//
+// Returns:
+//   - The file as it would be staged.
+//   - An error if the file can not be read.
+func (r *Repository) worktreeFile(p string, tracked diff.File) (diff.File, error) {
+	full := r.worktreePath(p)
+	info, err := r.lstat(full)
+	if err != nil || info.IsDir() {
+		return diff.File{Path: p}, nil
+	}
+	var data string
+	mode := objects.ModeFile
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		reader, ok := r.FS.Fs.(afero.LinkReader)
+		if !ok {
+			return diff.File{}, fmt.Errorf("cannot read symbolic link %s", p)
+		}
+		if data, err = reader.ReadlinkIfPossible(full); err != nil {
+			return diff.File{}, err
+		}
+		mode = objects.ModeSymlink
+	default:
+		if data, err = filesystem.ReadFileData(r.FS, full); err != nil {
+			return diff.File{}, err
+		}
+		switch {
+		case !r.trustExecutableBit() && tracked.Exists() && tracked.Mode != objects.ModeSymlink:
+			mode = tracked.Mode
+		case r.trustExecutableBit() && info.Mode()&0111 != 0:
+			mode = objects.ModeExecutable
+		}
+	}
+	blob := objects.NewBlob(data)
+	blob.SetHashAlgorithm(r.ObjectFormat())
+	hash, err := blob.Hash()
+	if err != nil {
+		return diff.File{}, err
+	}
+	return diff.File{Path: p, Mode: mode, Hash: hash}, nil
+}
+
+// indexEntry returns the index entry of a file, with the stat information
+// of its worktree version when that version is the file. The stat
+// information is left zero otherwise, so that the file is hashed again
+// instead of being taken for the entry.
+func (r *Repository) indexEntry(f diff.File, stage int) index.Entry {
+	e := index.Entry{Mode: f.Mode, Hash: f.Hash, Path: f.Path, Stage: stage}
+	if stage != index.StageMerged {
+		return e
+	}
+	info, err := r.lstat(r.worktreePath(f.Path))
+	if err != nil || info.IsDir() {
+		return e
+	}
+	if current, err := r.worktreeFile(f.Path, f); err != nil || current.Hash != f.Hash || current.Mode != f.Mode {
+		return e
+	}
+	mtime := info.ModTime()
+	e.MtimeSec, e.MtimeNsec = uint32(mtime.Unix()), uint32(mtime.Nanosecond())
+	e.CtimeSec, e.CtimeNsec = e.MtimeSec, e.MtimeNsec
+	e.Size = uint32(info.Size())
+	return e
+}
+
+// statMatches reports whether the stat information of an index entry is
+// still that of its worktree file, which was not written since.
+func (r *Repository) statMatches(e index.Entry) bool {
+	info, err := r.lstat(r.worktreePath(e.Path))
+	if err != nil || info.IsDir() {
+		return false
+	}
+	mtime := info.ModTime()
+	return e.Size == uint32(info.Size()) && e.MtimeSec == uint32(mtime.Unix()) && e.MtimeNsec == uint32(mtime.Nanosecond())
+}
+
+// buildIndex returns an index of the merged files and the unmerged entries
+// of the conflicted paths. Entries of previous are kept for the files that
+// did not change, as their worktree versions may have local changes,
+// unless checkout wrote the files since; those are stat again.
+func (r *Repository) buildIndex(files map[string]diff.File, stages []index.Entry, previous *index.Index) *index.Index {
+	idx := index.New()
+	idx.Hash = r.ObjectFormat()
+	conflicted := map[string]bool{}
+	for _, e := range stages {
+		conflicted[e.Path] = true
+		idx.Entries = append(idx.Entries, e)
+	}
+	for _, p := range sortedPaths(files) {
+		if conflicted[p] {
+			continue
+		}
+		f := files[p]
+		if e, ok := previous.Entry(p, index.StageMerged); ok && e.Mode == f.Mode && e.Hash == f.Hash && r.statMatches(e) {
+			idx.Entries = append(idx.Entries, e)
+		} else {
+			idx.Entries = append(idx.Entries, r.indexEntry(f, index.StageMerged))
+		}
+	}
+	idx.Sort()
+	return idx
+}
+
+// changedPaths returns the paths whose files differ between a and b.
+func changedPaths(a map[string]diff.File, b map[string]diff.File) []string {
+	paths := []string{}
+	for _, p := range sortedPaths(a, b) {
+		if a[p] != b[p] {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// checkout updates the worktree from the files of old to those of next:
+// files only in old are removed and files that changed are written. Unless
+// force is set, nothing is touched when the worktree version of a changed
+// file differs from old, or when an untracked file is in the way; action
+// names the command in the error.
+//
+// Returns:
+//   - An error listing the files that would be overwritten, or if a file
+//     can not be written or removed.
+func (r *Repository) checkout(old map[string]diff.File, next map[string]diff.File, force bool, action string) error {
+	changed := changedPaths(old, next)
+	if !force {
+		dirty, untracked := []string{}, []string{}
+		for _, p := range changed {
+			current, err := r.worktreeFile(p, old[p])
+			if err != nil {
+				return err
+			}
+			if current.Hash == next[p].Hash && (current.Hash != "" || !r.isWorktreeDir(p)) {
+				continue
+			}
+			if o, ok := old[p]; ok {
+				if current.Hash != o.Hash {
+					dirty = append(dirty, p)
+				}
+			} else if current.Exists() {
+				untracked = append(untracked, p)
+			}
+		}
+		if len(dirty) > 0 {
+			return fmt.Errorf("Your local changes to the following files would be overwritten by %s:\n\t%s\nPlease commit your changes or stash them before you %s.\nAborting",
+				action, strings.Join(dirty, "\n\t"), action)
+		}
+		if len(untracked) > 0 {
+			return fmt.Errorf("The following untracked working tree files would be overwritten by %s:\n\t%s\nPlease move or remove them before you %s.\nAborting",
+				action, strings.Join(untracked, "\n\t"), action)
+		}
+	}
+
+	for _, p := range changed {
+		if _, ok := next[p]; !ok {
+			if err := r.removeWorktreeFile(p); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range changed {
+		if f, ok := next[p]; ok {
+			if err := r.writeWorktreeFile(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) isWorktreeDir(p string) bool {
+	return filesystem.IsDir(r.FS, r.worktreePath(p))
+}
+
+// removeWorktreeFile removes a file from the worktree along with the
+// directories it leaves empty.
+func (r *Repository) removeWorktreeFile(p string) error {
+	full := r.worktreePath(p)
+	if _, err := r.lstat(full); err != nil {
+		return nil
+	}
+	if err := r.FS.Remove(full); err != nil {
+		return err
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		empty, err := afero.IsEmpty(r.FS, r.worktreePath(dir))
+		if err != nil || !empty {
+			break
+		}
+		if err := r.FS.Remove(r.worktreePath(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWorktreeFile writes the content of a file to the worktree, replacing
+// whatever is in its place. Symbolic links are written as plain files
+// holding their target when the filesystem does not support them.
+func (r *Repository) writeWorktreeFile(f diff.File) error {
+	full := r.worktreePath(f.Path)
+	for dir := path.Dir(f.Path); dir != "."; dir = path.Dir(dir) {
+		if filesystem.IsFile(r.FS, r.worktreePath(dir)) {
+			if err := r.FS.Remove(r.worktreePath(dir)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.FS.MkdirAll(filepath.Dir(full), os.ModePerm); err != nil {
+		return err
+	}
+	if info, err := r.lstat(full); err == nil {
+		remove := r.FS.Remove
+		if info.IsDir() {
+			remove = r.FS.RemoveAll
+		}
+		if err := remove(full); err != nil {
+			return err
+		}
+	}
+
+	if f.Mode == objects.ModeGitlink {
+		return r.FS.MkdirAll(full, os.ModePerm)
+	}
+	obj, err := r.ReadObject(f.Hash)
+	if err != nil {
+		return err
+	}
+	blob, ok := obj.(*objects.Blob)
+	if !ok {
+		return fmt.Errorf("object %s is a %s, not a blob", f.Hash, obj.Format())
+	}
+	if f.Mode == objects.ModeSymlink {
+		if linker, ok := r.FS.Fs.(afero.Linker); ok {
+			return linker.SymlinkIfPossible(blob.ReadData(), full)
+		}
+	}
+	perm := os.FileMode(0644)
+	if f.Mode == objects.ModeExecutable {
+		perm = 0755
+	}
+	file, err := r.FS.OpenFile(full, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(blob.ReadData())
+	return err
+}
+
+// indexChanges returns the paths whose merged index entry differs from the
+// files of tree.
+func indexChanges(idx *index.Index, tree map[string]diff.File) []string {
+	staged := indexFiles(idx)
+	changed := []string{}
+	for _, p := range sortedPaths(staged, tree) {
+		if staged[p].Mode != tree[p].Mode || staged[p].Hash != tree[p].Hash {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+// worktreeChanges returns the paths whose worktree version differs from
+// their merged index entry.
+//
+// Returns:
+//   - The changed paths, in index order.
+//   - An error if a worktree file can not be read.
+func (r *Repository) worktreeChanges(idx *index.Index) ([]string, error) {
+	staged := indexFiles(idx)
+	changed := []string{}
+	for _, p := range sortedPaths(staged) {
+		current, err := r.worktreeFile(p, staged[p])
+		if err != nil {
+			return nil, err
+		}
+		if current.Mode != staged[p].Mode || current.Hash != staged[p].Hash {
+			changed = append(changed, p)
+		}
+	}
+	return changed, nil
+}
+
+// Add stages the worktree content of paths, relative to the worktree.
+// Directories are added recursively and files that were removed from the
+// worktree are removed from the index. Adding a conflicted path marks it
+// as resolved.
+//
+// Returns:
+//   - An error if a path matches neither a worktree file nor an index
+//     entry, or if a file can not be stored.
+func (r *Repository) Add(paths []string) error {
+	if r.IsBare() {
+		return ErrorBare
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	tracked := map[string]diff.File{}
+	for _, e := range idx.Entries {
+		tracked[e.Path] = diff.File{Path: e.Path, Mode: e.Mode, Hash: e.Hash}
+	}
+
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+		matched := false
+		for t := range tracked {
+			if p == "." || t == p || strings.HasPrefix(t, p+"/") {
+				matched = true
+				if f, _ := r.worktreeFile(t, tracked[t]); !f.Exists() {
+					idx.Remove(t)
+				}
+			}
+		}
+		files, err := r.listWorktree(p)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 && !matched {
+			return fmt.Errorf("pathspec '%s' did not match any files", p)
+		}
+		for _, f := range files {
+			file, err := r.worktreeFile(f, tracked[f])
+			if err != nil {
+				return err
+			}
+			if err := r.storeWorktreeFile(file); err != nil {
+				return err
+			}
+			idx.Add(r.indexEntry(file, index.StageMerged))
+		}
+	}
+	return r.WriteIndex(idx)
+}
+
+// listWorktree lists the worktree files at or below p, outside of
+// the repository directory, wherever it is, of the .ggit directories and
+// of the .ggit file pointing to a separate repository directory.
+func (r *Repository) listWorktree(p string) ([]string, error) {
+	root := r.worktreePath(p)
+	info, err := r.lstat(root)
+	if err != nil || r.inGitdir(root) || root == r.worktreePath(gitdir) {
+		return nil, nil
+	}
+	if !info.IsDir() {
+		return []string{p}, nil
+	}
+	files := []string{}
+	err = afero.Walk(r.FS, root, func(full string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == gitdir || r.inGitdir(full) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if r.inGitdir(full) || full == r.worktreePath(gitdir) {
+			return nil
+		}
+		rel, err := filepath.Rel(r.Worktree, full)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// inGitdir reports whether the path full is the repository directory or
+// below it, as when GGIT_DIR names a directory inside the worktree.
+func (r *Repository) inGitdir(full string) bool {
+	dir := filepath.Clean(r.Gitdir)
+	full = filepath.Clean(full)
+	return full == dir || strings.HasPrefix(full, dir+string(filepath.Separator))
+}
+
+// storeWorktreeFile writes the blob of a worktree file to the object
+// database.
+func (r *Repository) storeWorktreeFile(f diff.File) error {
+	full := r.worktreePath(f.Path)
+	var data string
+	var err error
+	if reader, ok := r.FS.Fs.(afero.LinkReader); ok && f.Mode == objects.ModeSymlink {
+		data, err = reader.ReadlinkIfPossible(full)
+	} else {
+		data, err = filesystem.ReadFileData(r.FS, full)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.WriteObject(objects.NewBlob(data))
+	return err
+}
@@ -0,0 +1,185 @@
+package repository_test
+
+import (
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/index"
+	"ggit/internal/objects"
+	"ggit/internal/repository"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeWorktreeFile(t *testing.T, r *repository.Repository, p string, data string) {
+	full := filepath.Join(r.Worktree, filepath.FromSlash(p))
+	assert.NoError(t, r.FS.MkdirAll(filepath.Dir(full), 0755))
+	assert.NoError(t, afero.WriteFile(r.FS, full, []byte(data), 0644))
+}
+
+func readWorktreeFile(t *testing.T, r *repository.Repository, p string) string {
+	data, err := afero.ReadFile(r.FS, filepath.Join(r.Worktree, filepath.FromSlash(p)))
+	assert.NoError(t, err)
+	return string(data)
+}
+
+// commitWorktree adds paths and commits the index on top of HEAD.
+func commitWorktree(t *testing.T, r *repository.Repository, message string, paths ...string) string {
+	assert.NoError(t, r.Add(paths))
+	idx, err := r.ReadIndex()
+	assert.NoError(t, err)
+	tree, err := r.WriteTree(idx)
+	assert.NoError(t, err)
+	parents := []string{}
+	if head, err := r.ResolveRef("HEAD"); err == nil {
+		parents = append(parents, head)
+	}
+	sha, err := r.CommitTree(tree, parents, message)
+	assert.NoError(t, err)
+	assert.NoError(t, r.UpdateHead(sha, "commit: "+message))
+	return sha
+}
+
+func TestAdd(t *testing.T) {
+	r := newTestRepository(t)
+	writeWorktreeFile(t, r, "README", "read me\n")
+	writeWorktreeFile(t, r, "src/main.go", "package main\n")
+	writeWorktreeFile(t, r, "src/lib/lib.go", "package lib\n")
+
+	t.Run("Directories", func(t *testing.T) {
+		assert.NoError(t, r.Add([]string{"README", "src"}))
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		paths := []string{}
+		for _, e := range idx.Entries {
+			paths = append(paths, e.Path)
+		}
+		assert.Equal(t, []string{"README", "src/lib/lib.go", "src/main.go"}, paths)
+
+		e, ok := idx.Entry("src/main.go", index.StageMerged)
+		assert.True(t, ok)
+		assert.Equal(t, writeBlob(t, r, "package main\n"), e.Hash)
+		assert.Equal(t, uint32(len("package main\n")), e.Size)
+	})
+
+	t.Run("WriteTree", func(t *testing.T) {
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		tree, err := r.WriteTree(idx)
+		assert.NoError(t, err)
+
+		lib := writeTree(t, r, objects.TreeEntry{Mode: objects.ModeFile, Name: "lib.go", Hash: writeBlob(t, r, "package lib\n")})
+		src := writeTree(t, r,
+			objects.TreeEntry{Mode: objects.ModeTree, Name: "lib", Hash: lib},
+			objects.TreeEntry{Mode: objects.ModeFile, Name: "main.go", Hash: writeBlob(t, r, "package main\n")},
+		)
+		expected := writeTree(t, r,
+			objects.TreeEntry{Mode: objects.ModeFile, Name: "README", Hash: writeBlob(t, r, "read me\n")},
+			objects.TreeEntry{Mode: objects.ModeTree, Name: "src", Hash: src},
+		)
+		assert.Equal(t, expected, tree)
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		assert.NoError(t, r.FS.Remove(filepath.Join(r.Worktree, "README")))
+		assert.NoError(t, r.Add([]string{"README"}))
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		_, ok := idx.Entry("README", index.StageMerged)
+		assert.False(t, ok)
+	})
+
+	t.Run("Resolved", func(t *testing.T) {
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		idx.Add(index.Entry{Mode: objects.ModeFile, Hash: writeBlob(t, r, "ours\n"), Path: "src/main.go", Stage: index.StageOurs})
+		assert.NoError(t, r.WriteIndex(idx))
+		_, err = r.WriteTree(idx)
+		assert.Error(t, err)
+
+		assert.NoError(t, r.Add([]string{"src/main.go"}))
+		idx, err = r.ReadIndex()
+		assert.NoError(t, err)
+		assert.Empty(t, idx.Conflicts())
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		assert.EqualError(t, r.Add([]string{"missing"}), "pathspec 'missing' did not match any files")
+	})
+}
+
+// newRepositoryDirTest returns a repository with its worktree in /work,
+// found with the environment set by setup, and a commit of the file f.
+func newRepositoryDirTest(t *testing.T, setup func(fs factory.FS)) *repository.Repository {
+	t.Setenv("GGIT_AUTHOR_NAME", "A U Thor")
+	t.Setenv("GGIT_AUTHOR_EMAIL", "author@example.com")
+	t.Setenv("GGIT_COMMITTER_NAME", "C O Mitter")
+	t.Setenv("GGIT_COMMITTER_EMAIL", "committer@example.com")
+	fs := factory.NewTestFactory()
+	assert.NoError(t, fs.MkdirAll("/work", os.ModePerm))
+	setup(fs)
+	r, err := repository.FindRepository(fs, "/work")
+	assert.NoError(t, err)
+	writeWorktreeFile(t, r, "f", "tracked\n")
+	commitWorktree(t, r, "base", ".")
+	return r
+}
+
+func TestRepositoryDirInWorktree(t *testing.T) {
+	t.Run("Environment", func(t *testing.T) {
+		r := newRepositoryDirTest(t, func(fs factory.FS) {
+			t.Setenv("GGIT_DIR", "/work/.git")
+			r, err := repository.FindRepository(fs, "/work")
+			assert.NoError(t, err)
+			_, err = r.Create(false)
+			assert.NoError(t, err)
+		})
+		assert.Equal(t, "/work/.git", r.Gitdir)
+
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		assert.Len(t, idx.Entries, 1)
+		assert.Equal(t, "f", idx.Entries[0].Path)
+
+		writeWorktreeFile(t, r, "u", "untracked\n")
+		_, err = r.StashPush(&repository.StashPush{IncludeUntracked: true})
+		assert.NoError(t, err)
+		assert.True(t, filesystem.IsFile(r.FS, "/work/.git/HEAD"))
+		assert.False(t, filesystem.IsFile(r.FS, "/work/u"))
+
+		_, clean, err := r.StashApply("", false)
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "untracked\n", readWorktreeFile(t, r, "u"))
+	})
+
+	t.Run("SeparateGitDir", func(t *testing.T) {
+		r := newRepositoryDirTest(t, func(fs factory.FS) {
+			r, err := repository.NewRepository(fs, "/work")
+			assert.NoError(t, err)
+			_, err = r.Init(&repository.Init{SeparateGitDir: "/store/work.git"})
+			assert.NoError(t, err)
+		})
+		assert.Equal(t, "/store/work.git", r.Gitdir)
+
+		assert.NoError(t, r.Add([]string{"."}))
+		idx, err := r.ReadIndex()
+		assert.NoError(t, err)
+		assert.Len(t, idx.Entries, 1)
+		assert.Equal(t, "f", idx.Entries[0].Path)
+
+		writeWorktreeFile(t, r, "u", "untracked\n")
+		_, err = r.StashPush(&repository.StashPush{IncludeUntracked: true})
+		assert.NoError(t, err)
+		assert.True(t, filesystem.IsFile(r.FS, "/work/.ggit"))
+		assert.False(t, filesystem.IsFile(r.FS, "/work/u"))
+
+		_, clean, err := r.StashApply("", false)
+		assert.NoError(t, err)
+		assert.True(t, clean)
+		assert.Equal(t, "untracked\n", readWorktreeFile(t, r, "u"))
+	})
+}
@@ -0,0 +1,74 @@
+package store
+
+import "errors"
+
+// CompositeStore layers stores: objects are looked up in each store in
+// turn and written to the first one.
+type CompositeStore struct {
+	stores []ObjectStore
+}
+
+func NewCompositeStore(stores ...ObjectStore) *CompositeStore {
+	return &CompositeStore{stores: stores}
+}
+
+// Stores returns the layered stores, in lookup order.
+func (s *CompositeStore) Stores() []ObjectStore {
+	return s.stores
+}
+
+func (s *CompositeStore) Has(id string) bool {
+	for _, store := range s.stores {
+		if store.Has(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *CompositeStore) Read(id string) (Object, error) {
+	for _, store := range s.stores {
+		o, err := store.Read(id)
+		if !errors.Is(err, ErrNotFound) {
+			return o, err
+		}
+	}
+	return Object{}, notFound(id)
+}
+
+// Write writes to the first store.
+func (s *CompositeStore) Write(o Object) (string, error) {
+	if len(s.stores) == 0 {
+		return "", ErrReadOnly
+	}
+	return s.stores[0].Write(o)
+}
+
+// Iterate calls fn once with the ID of each object, even if several stores
+// have it.
+func (s *CompositeStore) Iterate(fn func(id string) error) error {
+	seen := map[string]bool{}
+	for _, store := range s.stores {
+		err := store.Iterate(func(id string) error {
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+			return fn(id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CompositeStore) Stat(id string) (Info, error) {
+	for _, store := range s.stores {
+		info, err := store.Stat(id)
+		if !errors.Is(err, ErrNotFound) {
+			return info, err
+		}
+	}
+	return Info{}, notFound(id)
+}
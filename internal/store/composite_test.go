@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompositeStore(t *testing.T) {
+	top := store.NewMemoryStore(objects.SHA1)
+	bottom := store.NewMemoryStore(objects.SHA1)
+	shared, _ := bottom.Write(store.Object{Format: "blob", Data: "shared\n"})
+	_, _ = top.Write(store.Object{Format: "blob", Data: "shared\n"})
+	below, _ := bottom.Write(store.Object{Format: "blob", Data: "below\n"})
+	s := store.NewCompositeStore(top, bottom)
+
+	t.Run("Read", func(t *testing.T) {
+		assert.True(t, s.Has(below))
+		o, err := s.Read(below)
+		assert.NoError(t, err)
+		assert.Equal(t, "below\n", o.Data)
+		info, err := s.Stat(below)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), info.Size)
+		_, err = s.Read(objects.SHA1.NullID())
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	})
+
+	t.Run("WriteToFirst", func(t *testing.T) {
+		id, err := s.Write(store.Object{Format: "blob", Data: "new\n"})
+		assert.NoError(t, err)
+		assert.True(t, top.Has(id))
+		assert.False(t, bottom.Has(id))
+	})
+
+	t.Run("IterateOnce", func(t *testing.T) {
+		seen := map[string]int{}
+		assert.NoError(t, s.Iterate(func(id string) error {
+			seen[id]++
+			return nil
+		}))
+		assert.Len(t, seen, 3)
+		assert.Equal(t, 1, seen[shared])
+	})
+}
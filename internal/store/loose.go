@@ -0,0 +1,168 @@
+package store
+
+import (
+	"bufio"
+	"compress/zlib"
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"ggit/internal/util"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// LooseStore keeps every object compressed in its own file, named after
+// the object ID below a directory named after its first two characters.
+// Objects are written to a temporary file of the directory first and then
+// renamed, so that concurrent or interrupted writes never leave a partial
+// object behind.
+type LooseStore struct {
+	fs   factory.FS
+	dir  string
+	hash *objects.HashAlgorithm
+}
+
+func NewLooseStore(fs factory.FS, dir string, hash *objects.HashAlgorithm) *LooseStore {
+	return &LooseStore{fs: fs, dir: dir, hash: hash}
+}
+
+// Path returns the file of the object id.
+func (s *LooseStore) Path(id string) string {
+	return filepath.Join(s.dir, id[0:2], id[2:])
+}
+
+func (s *LooseStore) Has(id string) bool {
+	return len(id) > 2 && filesystem.IsFile(s.fs, s.Path(id))
+}
+
+func (s *LooseStore) Read(id string) (Object, error) {
+	if !s.Has(id) {
+		return Object{}, notFound(id)
+	}
+	path := s.Path(id)
+	raw, err := filesystem.ReadFileData(s.fs, path)
+	if err != nil {
+		return Object{}, err
+	}
+	data, err := util.Decompress(raw)
+	if err != nil {
+		return Object{}, &CorruptError{ID: id, Source: path, Reason: "bad compression"}
+	}
+
+	header, payload, ok := strings.Cut(data, "\x00")
+	if !ok {
+		return Object{}, &CorruptError{ID: id, Source: path, Reason: "bad header"}
+	}
+	format, n, reason := parseLooseHeader(header)
+	if reason != "" {
+		return Object{}, &CorruptError{ID: id, Source: path, Reason: reason}
+	}
+	if n != len(payload) {
+		return Object{}, &CorruptError{ID: id, Source: path, Reason: "bad length"}
+	}
+	return Object{Format: format, Data: payload}, nil
+}
+
+func (s *LooseStore) Write(o Object) (string, error) {
+	id := s.hash.HashObject(o.Format, o.Data)
+	// Objects are immutable: an existing object already holds the data.
+	if s.Has(id) {
+		return id, nil
+	}
+	path := s.Path(id)
+	if err := s.fs.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+	compressed, err := util.Compress(objects.EncodePayload(o.Format, o.Data))
+	if err != nil {
+		return "", err
+	}
+	return id, filesystem.WriteFileAtomic(s.fs, compressed, path, s.dir)
+}
+
+func (s *LooseStore) Iterate(fn func(id string) error) error {
+	dirs, err := afero.ReadDir(s.fs, s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := afero.ReadDir(s.fs, filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			id := dir.Name() + file.Name()
+			if file.IsDir() || !s.hash.IsID(id) {
+				continue
+			}
+			if err := fn(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stat inflates the file of the object id only up to the end of its
+// "<format> <size>" header.
+func (s *LooseStore) Stat(id string) (Info, error) {
+	if !s.Has(id) {
+		return Info{}, notFound(id)
+	}
+	path := s.Path(id)
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	corrupt := func(reason string) (Info, error) {
+		return Info{}, &CorruptError{ID: id, Source: path, Reason: reason}
+	}
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return corrupt("bad compression")
+	}
+	defer z.Close()
+	header, err := bufio.NewReader(io.LimitReader(z, maxLooseHeader)).ReadString(0)
+	if err != nil {
+		return corrupt("bad header")
+	}
+	format, n, reason := parseLooseHeader(strings.TrimSuffix(header, "\x00"))
+	if reason != "" {
+		return corrupt(reason)
+	}
+	return Info{Format: format, Size: int64(n), Source: path}, nil
+}
+
+// maxLooseHeader bounds the "<format> <size>\x00" header of a loose
+// object, far above any valid one.
+const maxLooseHeader = 64
+
+// parseLooseHeader parses the "<format> <size>" header of a loose object.
+//
+// Returns:
+//   - The format of the object.
+//   - The size of its payload.
+//   - Why the header is malformed, empty when it is not.
+func parseLooseHeader(header string) (string, int, string) {
+	format, size, found := strings.Cut(header, " ")
+	if !found {
+		return "", 0, "bad header"
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 0 {
+		return "", 0, "bad size"
+	}
+	return format, n, ""
+}
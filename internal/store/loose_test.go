@@ -0,0 +1,111 @@
+package store_test
+
+import (
+	"fmt"
+	"ggit/internal/factory"
+	"ggit/internal/filesystem"
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"ggit/internal/util"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLooseStore(t *testing.T) {
+	fs := factory.NewTestFactory()
+	s := store.NewLooseStore(fs, "/repo/objects", objects.SHA1)
+
+	t.Run("WriteAndRead", func(t *testing.T) {
+		id, err := s.Write(store.Object{Format: "blob", Data: "hello\n"})
+		assert.NoError(t, err)
+		assert.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", id)
+		assert.Equal(t, "/repo/objects/ce/013625030ba8dba906f756967f9e9ca394464a", s.Path(id))
+		assert.True(t, s.Has(id))
+
+		o, err := s.Read(id)
+		assert.NoError(t, err)
+		assert.Equal(t, store.Object{Format: "blob", Data: "hello\n"}, o)
+		info, err := s.Stat(id)
+		assert.NoError(t, err)
+		assert.Equal(t, store.Info{Format: "blob", Size: 6, Source: s.Path(id)}, info)
+
+		again, err := s.Write(store.Object{Format: "blob", Data: "hello\n"})
+		assert.NoError(t, err)
+		assert.Equal(t, id, again)
+	})
+
+	t.Run("Iterate", func(t *testing.T) {
+		assert.NoError(t, filesystem.WriteStringToFile(fs, "", "/repo/objects/info/packs"))
+		ids := []string{}
+		assert.NoError(t, s.Iterate(func(id string) error {
+			ids = append(ids, id)
+			return nil
+		}))
+		assert.Equal(t, []string{"ce013625030ba8dba906f756967f9e9ca394464a"}, ids)
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		id := "0123456789012345678901234567890123456789"
+		data, _ := util.Compress("blob 10\x00short")
+		assert.NoError(t, filesystem.WriteStringToFile(fs, data, s.Path(id)))
+		_, err := s.Read(id)
+		var corrupt *store.CorruptError
+		assert.ErrorAs(t, err, &corrupt)
+		assert.Equal(t, s.Path(id), corrupt.Source)
+		assert.EqualError(t, err, "malformed object "+id+": bad length")
+
+		// Stat only reads the header.
+		info, err := s.Stat(id)
+		assert.NoError(t, err)
+		assert.Equal(t, store.Info{Format: "blob", Size: 10, Source: s.Path(id)}, info)
+
+		badSize := "1123456789012345678901234567890123456789"
+		data, _ = util.Compress("blob ten\x00short")
+		assert.NoError(t, filesystem.WriteStringToFile(fs, data, s.Path(badSize)))
+		_, err = s.Stat(badSize)
+		assert.EqualError(t, err, "malformed object "+badSize+": bad size")
+	})
+
+	t.Run("ConcurrentWrites", func(t *testing.T) {
+		// A real filesystem, where the writers race on the renames.
+		dir := filepath.Join(t.TempDir(), "objects")
+		s := store.NewLooseStore(factory.FS{Fs: afero.NewOsFs()}, dir, objects.SHA1)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					_, err := s.Write(store.Object{Format: "blob", Data: fmt.Sprintf("blob %d\n", i)})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n := 0
+		assert.NoError(t, s.Iterate(func(id string) error {
+			n++
+			o, err := s.Read(id)
+			assert.NoError(t, err)
+			assert.Equal(t, id, objects.SHA1.HashObject(o.Format, o.Data))
+			return nil
+		}))
+		assert.Equal(t, 50, n)
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		for _, e := range entries {
+			assert.True(t, e.IsDir(), "temporary file %s left behind", e.Name())
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := s.Read("ffffffffffffffffffffffffffffffffffffffff")
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	})
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"ggit/internal/objects"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps objects in memory, for repositories that do not need
+// them to outlive the process. It is safe for concurrent use.
+type MemoryStore struct {
+	hash    *objects.HashAlgorithm
+	mu      sync.RWMutex
+	objects map[string]Object
+}
+
+func NewMemoryStore(hash *objects.HashAlgorithm) *MemoryStore {
+	return &MemoryStore{hash: hash, objects: map[string]Object{}}
+}
+
+func (s *MemoryStore) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.objects[id]
+	return ok
+}
+
+func (s *MemoryStore) Read(id string) (Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	o, ok := s.objects[id]
+	if !ok {
+		return Object{}, notFound(id)
+	}
+	return o, nil
+}
+
+func (s *MemoryStore) Write(o Object) (string, error) {
+	id := s.hash.HashObject(o.Format, o.Data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.objects[id]; !ok {
+		s.objects[id] = o
+	}
+	return id, nil
+}
+
+// Iterate calls fn with the IDs in order. Objects written by fn are not
+// iterated over.
+func (s *MemoryStore) Iterate(fn func(id string) error) error {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.objects))
+	for id := range s.objects {
+		ids = append(ids, id)
+	}
+	s.mu.RUnlock()
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Stat(id string) (Info, error) {
+	o, err := s.Read(id)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Format: o.Format, Size: int64(len(o.Data))}, nil
+}
@@ -0,0 +1,34 @@
+package store_test
+
+import (
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := store.NewMemoryStore(objects.SHA256)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := s.Write(store.Object{Format: "blob", Data: "hello\n"})
+			assert.NoError(t, err)
+			assert.Equal(t, objects.SHA256.HashObject("blob", "hello\n"), id)
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	assert.NoError(t, s.Iterate(func(id string) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 1, count)
+	_, err := s.Stat(objects.SHA256.NullID())
+	assert.ErrorIs(t, err, store.ErrNotFound)
+}
@@ -0,0 +1,468 @@
+package store
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"ggit/internal/cache"
+	"ggit/internal/factory"
+	"ggit/internal/objects"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	packSignature = "PACK"
+	idxSignature  = "\377tOc"
+	// fanoutSize is the number of entries of the fan-out table of an
+	// index, one per value of the first byte of the object IDs.
+	fanoutSize = 256
+	// largeOffset marks a 31-bit offset of a version 2 index pointing into
+	// the table of 64-bit offsets.
+	largeOffset = 0x80000000
+	// maxDeltaDepth limits how many deltas are followed to an object.
+	maxDeltaDepth = 4096
+	// DefaultDeltaBaseCacheLimit is the total size of the delta bases kept
+	// in memory, as core.deltaBaseCacheLimit does by default.
+	DefaultDeltaBaseCacheLimit = 96 << 20
+)
+
+// Types of the entries of a pack.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packFormats = map[int]string{packCommit: "commit", packTree: "tree", packBlob: "blob", packTag: "tag"}
+
+// PackStore reads the objects of the packs of a directory, each pack
+// file being described by the index file of the same name. Packs can only
+// be read: writing returns ErrReadOnly. The objects deltas are applied to
+// are kept in a cache, as many deltas share the same bases.
+type PackStore struct {
+	fs    factory.FS
+	dir   string
+	hash  *objects.HashAlgorithm
+	bases *cache.LRU[deltaBase, packEntry]
+
+	mu     sync.Mutex
+	packs  []*pack
+	loaded bool
+}
+
+// deltaBase is the position of an object deltas were applied to.
+type deltaBase struct {
+	pack   *pack
+	offset uint64
+}
+
+// packEntry is an object read from a pack, with its deltas applied.
+type packEntry struct {
+	format string
+	data   []byte
+}
+
+// pack is a pack file and its index. The pack itself is read on the first
+// access to one of its objects.
+type pack struct {
+	path string
+	// ids are the raw object IDs, sorted, and offsets their positions in
+	// the pack.
+	ids     []string
+	offsets []uint64
+
+	once sync.Once
+	data []byte
+	err  error
+}
+
+func NewPackStore(fs factory.FS, dir string, hash *objects.HashAlgorithm) *PackStore {
+	return &PackStore{fs: fs, dir: dir, hash: hash, bases: cache.New[deltaBase, packEntry](DefaultDeltaBaseCacheLimit)}
+}
+
+// SetDeltaBaseCacheLimit sets the total size of the delta bases kept in
+// memory, zero disabling the cache.
+func (s *PackStore) SetDeltaBaseCacheLimit(limit int64) {
+	s.bases.SetLimit(limit)
+}
+
+// Reload forgets the packs read so far, so that packs added since are
+// found.
+func (s *PackStore) Reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packs, s.loaded = nil, false
+}
+
+func (s *PackStore) Has(id string) bool {
+	_, _, err := s.find(id)
+	return err == nil
+}
+
+func (s *PackStore) Read(id string) (Object, error) {
+	p, offset, err := s.find(id)
+	if err != nil {
+		return Object{}, err
+	}
+	format, data, err := s.readEntry(p, offset, 0)
+	if err != nil {
+		return Object{}, &CorruptError{ID: id, Source: p.path, Reason: err.Error()}
+	}
+	return Object{Format: format, Data: string(data)}, nil
+}
+
+func (s *PackStore) Write(o Object) (string, error) {
+	return "", ErrReadOnly
+}
+
+func (s *PackStore) Iterate(fn func(id string) error) error {
+	packs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, p := range packs {
+		for _, raw := range p.ids {
+			if err := fn(hex.EncodeToString([]byte(raw))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *PackStore) Stat(id string) (Info, error) {
+	p, _, err := s.find(id)
+	if err != nil {
+		return Info{}, err
+	}
+	o, err := s.Read(id)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Format: o.Format, Size: int64(len(o.Data)), Source: p.path}, nil
+}
+
+// load reads the indexes of the packs of the directory, once.
+func (s *PackStore) load() ([]*pack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return s.packs, nil
+	}
+	files, err := afero.ReadDir(s.fs, s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	packs := []*pack{}
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".idx")
+		if !ok || f.IsDir() {
+			continue
+		}
+		p, err := s.readIndex(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		p.path = filepath.Join(s.dir, name+".pack")
+		packs = append(packs, p)
+	}
+	s.packs, s.loaded = packs, true
+	return packs, nil
+}
+
+// readIndex reads a version 1 or 2 pack index.
+//
+// Returns:
+//   - The pack, without its data.
+//   - An error if the index can not be read or is corrupt.
+func (s *PackStore) readIndex(path string) (*pack, error) {
+	data, err := afero.ReadFile(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	size := s.hash.Size
+	corrupt := fmt.Errorf("pack index %s is corrupt", path)
+	version, start := 1, 0
+	if bytes.HasPrefix(data, []byte(idxSignature)) {
+		if len(data) < 8 {
+			return nil, corrupt
+		}
+		if version = int(binary.BigEndian.Uint32(data[4:8])); version != 2 {
+			return nil, fmt.Errorf("pack index %s has unsupported version %d", path, version)
+		}
+		start = 8
+	}
+	if len(data) < start+fanoutSize*4 {
+		return nil, corrupt
+	}
+	count := int(binary.BigEndian.Uint32(data[start+(fanoutSize-1)*4:]))
+	table := start + fanoutSize*4
+	p := &pack{ids: make([]string, count), offsets: make([]uint64, count)}
+
+	if version == 1 {
+		if len(data) < table+count*(4+size) {
+			return nil, corrupt
+		}
+		for i := 0; i < count; i++ {
+			entry := data[table+i*(4+size):]
+			p.offsets[i] = uint64(binary.BigEndian.Uint32(entry))
+			p.ids[i] = string(entry[4 : 4+size])
+		}
+		return p, nil
+	}
+
+	offsets := table + count*(size+4)
+	large := offsets + count*4
+	if len(data) < large {
+		return nil, corrupt
+	}
+	for i := 0; i < count; i++ {
+		p.ids[i] = string(data[table+i*size : table+(i+1)*size])
+		offset := binary.BigEndian.Uint32(data[offsets+i*4:])
+		if offset&largeOffset == 0 {
+			p.offsets[i] = uint64(offset)
+			continue
+		}
+		at := large + int(offset&^largeOffset)*8
+		if len(data) < at+8 {
+			return nil, corrupt
+		}
+		p.offsets[i] = binary.BigEndian.Uint64(data[at:])
+	}
+	return p, nil
+}
+
+// find looks the object id up in the indexes.
+//
+// Returns:
+//   - The pack holding the object.
+//   - The offset of the object in the pack.
+//   - ErrNotFound if no pack has the object.
+func (s *PackStore) find(id string) (*pack, uint64, error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != s.hash.Size {
+		return nil, 0, notFound(id)
+	}
+	packs, err := s.load()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, p := range packs {
+		i := sort.SearchStrings(p.ids, string(raw))
+		if i < len(p.ids) && p.ids[i] == string(raw) {
+			return p, p.offsets[i], nil
+		}
+	}
+	return nil, 0, notFound(id)
+}
+
+// readEntry reads the object at offset in the pack, applying the deltas
+// it is stored as.
+//
+// Returns:
+//   - The format of the object.
+//   - The payload of the object.
+//   - An error if the pack can not be read or the entry is corrupt.
+func (s *PackStore) readEntry(p *pack, offset uint64, depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, errors.New("delta chain too deep")
+	}
+	p.once.Do(func() {
+		p.data, p.err = afero.ReadFile(s.fs, p.path)
+		if p.err == nil && (len(p.data) < 12 || string(p.data[:4]) != packSignature) {
+			p.err = errors.New("bad pack signature")
+		}
+	})
+	if p.err != nil {
+		return "", nil, p.err
+	}
+	if offset >= uint64(len(p.data)) {
+		return "", nil, errors.New("offset beyond end of pack")
+	}
+
+	data := p.data[offset:]
+	c := data[0]
+	kind := int(c>>4) & 7
+	size := uint64(c & 15)
+	pos := 1
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if pos >= len(data) {
+			return "", nil, errors.New("truncated entry header")
+		}
+		c = data[pos]
+		size |= uint64(c&0x7f) << shift
+		pos++
+	}
+
+	var base func() (string, []byte, error)
+	switch kind {
+	case packOfsDelta:
+		if pos >= len(data) {
+			return "", nil, errors.New("truncated delta offset")
+		}
+		c = data[pos]
+		pos++
+		distance := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if pos >= len(data) {
+				return "", nil, errors.New("truncated delta offset")
+			}
+			c = data[pos]
+			pos++
+			distance = (distance+1)<<7 | uint64(c&0x7f)
+		}
+		if distance == 0 || distance > offset {
+			return "", nil, errors.New("bad delta base offset")
+		}
+		base = func() (string, []byte, error) {
+			return s.readBase(p, offset-distance, depth+1)
+		}
+	case packRefDelta:
+		if pos+s.hash.Size > len(data) {
+			return "", nil, errors.New("truncated delta base")
+		}
+		id := hex.EncodeToString(data[pos : pos+s.hash.Size])
+		pos += s.hash.Size
+		base = func() (string, []byte, error) {
+			basePack, baseOffset, err := s.find(id)
+			if err != nil {
+				return "", nil, fmt.Errorf("missing delta base %s", id)
+			}
+			return s.readBase(basePack, baseOffset, depth+1)
+		}
+	default:
+		if _, ok := packFormats[kind]; !ok {
+			return "", nil, fmt.Errorf("unknown object type %d", kind)
+		}
+	}
+
+	payload, err := inflate(data[pos:], size)
+	if err != nil {
+		return "", nil, err
+	}
+	if base == nil {
+		return packFormats[kind], payload, nil
+	}
+	format, source, err := base()
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := applyDelta(source, payload)
+	return format, result, err
+}
+
+// readBase reads the object at offset in the pack for a delta to be
+// applied to it, through the delta base cache. The data returned is shared
+// and must not be modified.
+func (s *PackStore) readBase(p *pack, offset uint64, depth int) (string, []byte, error) {
+	key := deltaBase{pack: p, offset: offset}
+	if e, ok := s.bases.Get(key); ok {
+		return e.format, e.data, nil
+	}
+	format, data, err := s.readEntry(p, offset, depth)
+	if err != nil {
+		return "", nil, err
+	}
+	s.bases.Add(key, packEntry{format: format, data: data}, int64(len(data)))
+	return format, data, nil
+}
+
+// inflate decompresses the zlib stream at the start of data, which has to
+// hold size bytes.
+func inflate(data []byte, size uint64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) != size {
+		return nil, errors.New("inflated size mismatch")
+	}
+	return out, nil
+}
+
+// applyDelta rebuilds an object from its delta against source: the sizes
+// of the source and the result, then instructions copying a range of the
+// source or inserting the bytes that follow them.
+func applyDelta(source []byte, delta []byte) ([]byte, error) {
+	corrupt := errors.New("corrupt delta")
+	varint := func() (uint64, bool) {
+		var v uint64
+		for shift := 0; len(delta) > 0; shift += 7 {
+			c := delta[0]
+			delta = delta[1:]
+			v |= uint64(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return v, true
+			}
+		}
+		return 0, false
+	}
+	sourceSize, ok := varint()
+	if !ok || sourceSize != uint64(len(source)) {
+		return nil, corrupt
+	}
+	resultSize, ok := varint()
+	if !ok {
+		return nil, corrupt
+	}
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, corrupt
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(source)) {
+				return nil, corrupt
+			}
+			result = append(result, source[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, corrupt
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, corrupt
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, corrupt
+	}
+	return result, nil
+}
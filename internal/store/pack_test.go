@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"ggit/internal/factory"
+	"ggit/internal/objects"
+	"ggit/internal/store"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackStore(t *testing.T) {
+	fs := factory.FS{Fs: afero.NewReadOnlyFs(afero.NewOsFs())}
+
+	for _, test := range []struct {
+		hash  *objects.HashAlgorithm
+		delta string
+		base  string
+	}{
+		// Packed with offset deltas.
+		{objects.SHA1, "e49cf7e083bd244a81c31bcd2ac7faa4f332156a", "293b1631769aeadfec90d900612995cd3c01df6a"},
+		// Packed with --no-delta-base-offset, so with deltas naming their base.
+		{objects.SHA256, "08c035bdf1a458af6a8bee5e012ecae32304d7f639a8a7d79097bc056b3148de", "129a700c4f1765817c9fecb2f4f0c2880ed12fb1e132162255dbd16e6317ce54"},
+	} {
+		t.Run(test.hash.Name, func(t *testing.T) {
+			s := store.NewPackStore(fs, "testdata/"+test.hash.Name, test.hash)
+			ids := []string{}
+			assert.NoError(t, s.Iterate(func(id string) error {
+				ids = append(ids, id)
+				return nil
+			}))
+			assert.Len(t, ids, 6)
+
+			formats := map[string]int{}
+			for _, id := range ids {
+				assert.True(t, s.Has(id))
+				o, err := s.Read(id)
+				assert.NoError(t, err)
+				assert.Equal(t, id, test.hash.HashObject(o.Format, o.Data))
+				formats[o.Format]++
+			}
+			assert.Equal(t, map[string]int{"commit": 2, "tree": 2, "blob": 2}, formats)
+
+			delta, err := s.Read(test.delta)
+			assert.NoError(t, err)
+			base, err := s.Read(test.base)
+			assert.NoError(t, err)
+			assert.NotEqual(t, base.Data, delta.Data)
+			info, err := s.Stat(test.delta)
+			assert.NoError(t, err)
+			assert.Equal(t, "blob", info.Format)
+			assert.Equal(t, int64(len(delta.Data)), info.Size)
+			assert.Contains(t, info.Source, ".pack")
+
+			missing := test.hash.NullID()
+			assert.False(t, s.Has(missing))
+			_, err = s.Read(missing)
+			assert.ErrorIs(t, err, store.ErrNotFound)
+			_, err = s.Write(store.Object{Format: "blob", Data: "new\n"})
+			assert.ErrorIs(t, err, store.ErrReadOnly)
+		})
+	}
+
+	t.Run("DeltaBaseCache", func(t *testing.T) {
+		uncached := store.NewPackStore(fs, "testdata/sha1", objects.SHA1)
+		uncached.SetDeltaBaseCacheLimit(0)
+		want, err := uncached.Read("e49cf7e083bd244a81c31bcd2ac7faa4f332156a")
+		assert.NoError(t, err)
+
+		s := store.NewPackStore(fs, "testdata/sha1", objects.SHA1)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					o, err := s.Read("e49cf7e083bd244a81c31bcd2ac7faa4f332156a")
+					assert.NoError(t, err)
+					assert.Equal(t, want, o)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		s := store.NewPackStore(fs, "testdata/none", objects.SHA1)
+		assert.NoError(t, s.Iterate(func(id string) error { return nil }))
+		assert.False(t, s.Has("e49cf7e083bd244a81c31bcd2ac7faa4f332156a"))
+	})
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned for an object the store does not have.
+var ErrNotFound = errors.New("object not found")
+
+// ErrReadOnly is returned when writing to a store that can only be read.
+var ErrReadOnly = errors.New("object store is read-only")
+
+// Object is a stored object: its format and its payload, without the
+// header.
+type Object struct {
+	Format string
+	Data   string
+}
+
+// Info describes a stored object without reading its payload.
+type Info struct {
+	Format string
+	Size   int64
+	// Source is the file holding the object, empty for stores without
+	// files.
+	Source string
+}
+
+// ObjectStore is where a repository keeps its objects, addressed by their
+// hex encoded IDs.
+type ObjectStore interface {
+	// Has reports whether the store has the object id.
+	Has(id string) bool
+	// Read returns the object id, ErrNotFound if the store does not have
+	// it or a CorruptError if it can not be decoded.
+	Read(id string) (Object, error)
+	// Write stores an object unless the store already has it.
+	//
+	// Returns:
+	//   - The ID of the object.
+	//   - An error if the object can not be stored.
+	Write(o Object) (string, error)
+	// Iterate calls fn with the ID of every object of the store, stopping
+	// at the first error fn returns.
+	Iterate(fn func(id string) error) error
+	// Stat returns the format and size of the object id.
+	Stat(id string) (Info, error)
+}
+
+// CorruptError reports an object the store has but can not decode.
+type CorruptError struct {
+	ID     string
+	Source string
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("malformed object %s: %s", e.ID, e.Reason)
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, id)
+}